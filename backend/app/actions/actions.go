@@ -4,6 +4,7 @@ import (
 	"log/slog"
 
 	"github.com/blue-monads/potatoverse/backend/engine"
+	"github.com/blue-monads/potatoverse/backend/services/buddyhub"
 	"github.com/blue-monads/potatoverse/backend/services/datahub"
 	"github.com/blue-monads/potatoverse/backend/services/mailer"
 	"github.com/blue-monads/potatoverse/backend/services/signer"
@@ -17,6 +18,7 @@ type Option struct {
 	AppOpts  *xtypes.AppOptions
 	Engine   *engine.Engine
 	Mailer   mailer.Mailer
+	BuddyHub *buddyhub.BuddyHub
 }
 
 type Controller struct {
@@ -26,15 +28,26 @@ type Controller struct {
 	AppOpts  *xtypes.AppOptions
 	engine   *engine.Engine
 	mailer   mailer.Mailer
+	buddyhub *buddyhub.BuddyHub
+
+	twoFactorFails twoFactorFailures
+	ssoProviders   map[string]*ssoProvider
+	oidcSigningKey oidcKeyCache
+	oidcCodes      usedOIDCCodes
 }
 
 func New(opt Option) *Controller {
-	return &Controller{
+	c := &Controller{
 		database: opt.Database,
 		logger:   opt.Logger,
 		signer:   opt.Signer,
 		AppOpts:  opt.AppOpts,
 		engine:   opt.Engine,
 		mailer:   opt.Mailer,
+		buddyhub: opt.BuddyHub,
 	}
+
+	c.ssoProviders = c.buildSSOProviders()
+
+	return c
 }
@@ -8,6 +8,7 @@ import (
 	"github.com/blue-monads/potatoverse/backend/services/signer"
 	xutils "github.com/blue-monads/potatoverse/backend/utils"
 	"github.com/blue-monads/potatoverse/backend/utils/libx/easyerr"
+	"github.com/blue-monads/potatoverse/backend/utils/passhash"
 	"github.com/blue-monads/potatoverse/backend/utils/qq"
 )
 
@@ -16,6 +17,19 @@ func (c *Controller) ListUsers(offset int, limit int) ([]dbmodels.User, error) {
 }
 
 func (c *Controller) AddUser(user *dbmodels.User) (int64, error) {
+	return c.addUser(user)
+}
+
+// addUser stores the user with its password hashed
+func (c *Controller) addUser(user *dbmodels.User) (int64, error) {
+	if user.Password != "" {
+		hash, err := passhash.Hash(user.Password)
+		if err != nil {
+			return 0, err
+		}
+		user.Password = hash
+	}
+
 	return c.database.GetUserOps().AddUser(user)
 }
 
@@ -39,7 +53,7 @@ func (c *Controller) GetUser(id int64) (*dbmodels.User, error) {
 
 func (c *Controller) ResetUserPassword(id int64) (string, error) {
 
-	user, err := c.database.GetUserOps().GetUser(id)
+	_, err := c.database.GetUserOps().GetUser(id)
 	if err != nil {
 		return "", err
 	}
@@ -49,22 +63,35 @@ func (c *Controller) ResetUserPassword(id int64) (string, error) {
 		return "", err
 	}
 
-	user.Password = password
+	hash, err := passhash.Hash(password)
+	if err != nil {
+		return "", err
+	}
 
 	err = c.database.GetUserOps().UpdateUser(id, map[string]any{
-		"password": password,
+		"password": hash,
 	})
 	if err != nil {
 		return "", err
 	}
 
+	err = c.LogoutAll(id)
+	if err != nil {
+		return "", err
+	}
+
 	return password, nil
 }
 
 func (c *Controller) DeactivateUser(id int64) error {
-	return c.database.GetUserOps().UpdateUser(id, map[string]any{
+	err := c.database.GetUserOps().UpdateUser(id, map[string]any{
 		"disabled": true,
 	})
+	if err != nil {
+		return err
+	}
+
+	return c.LogoutAll(id)
 }
 
 func (c *Controller) ActivateUser(id int64) error {
@@ -266,7 +293,7 @@ func (c *Controller) AcceptUserInvite(inviteId int64, name, username, password s
 		OwnerUserId: invite.InvitedBy,
 	}
 
-	userId, err := c.database.GetUserOps().AddUser(user)
+	userId, err := c.addUser(user)
 	if err != nil {
 		return nil, err
 	}
@@ -313,7 +340,7 @@ func (c *Controller) CreateUserDirectly(name, email, username, utype, ugroup str
 		IsDeleted:   false,
 	}
 
-	id, err := c.database.GetUserOps().AddUser(user)
+	id, err := c.addUser(user)
 	if err != nil {
 		return nil, err
 	}
@@ -324,6 +351,9 @@ func (c *Controller) CreateUserDirectly(name, email, username, utype, ugroup str
 		return nil, err
 	}
 
-	// Return user with password for display (admin needs to see it)
+	// Return user with password for display (admin needs to see it),
+	// only the hash is stored
+	createdUser.Password = password
+
 	return createdUser, nil
 }
@@ -10,6 +10,7 @@ import (
 
 	"github.com/blue-monads/potatoverse/backend/services/datahub/dbmodels"
 	"github.com/blue-monads/potatoverse/backend/services/signer"
+	"github.com/blue-monads/potatoverse/backend/utils/passhash"
 )
 
 type LoginOpts struct {
@@ -22,91 +23,105 @@ type LoginOpts struct {
 
 type LoginResponse struct {
 	AccessToken    string         `json:"access_token"`
+	RefreshToken   string         `json:"refresh_token,omitempty"`
+	ExpiresIn      int64          `json:"expires_in,omitempty"` // seconds the access token is valid for
 	UserInfo       *dbmodels.User `json:"user_info"`
 	PortalPageType string         `json:"portal_page_type"`
+
+	// set instead of the tokens when a second factor is needed
+	ChallengeToken         string   `json:"challenge_token,omitempty"`
+	TwoFactorRequired      bool     `json:"two_factor_required,omitempty"`
+	TwoFactorSetupRequired bool     `json:"two_factor_setup_required,omitempty"`
+	RecoveryCodes          []string `json:"recovery_codes,omitempty"`
 }
 
 var phoneRegex = regexp.MustCompile(`^\+?[1-9]\d{1,14}$`)
 
 func (c *Controller) Login(opts *LoginOpts) (*LoginResponse, error) {
 
+	user, err := c.findLoginUser(opts.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	ok, needsRehash := passhash.Verify(user.Password, opts.Password)
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+
+	if user.Disabled || user.IsDeleted {
+		return nil, ErrUserDisabled
+	}
+
+	if needsRehash {
+		c.rehashPassword(int64(user.ID), opts.Password)
+	}
+
+	return c.finishLogin(user, opts)
+}
+
+// findLoginUser looks the user up by email, phone or username, phone
+// looking values fall back to username
+func (c *Controller) findLoginUser(login string) (*dbmodels.User, error) {
+	login = strings.TrimSpace(login)
+	if login == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	uops := c.database.GetUserOps()
+
 	var user *dbmodels.User
+	var err error
 
-	if strings.Contains(opts.Username, "@") {
-		_user, err := c.database.GetUserOps().GetUserByEmail(opts.Username)
+	switch {
+	case strings.Contains(login, "@"):
+		user, err = uops.GetUserByEmail(login)
+	case phoneRegex.MatchString(login):
+		user, err = uops.GetUserByPhone(login)
 		if err != nil {
-			return nil, err
+			user, err = uops.GetUserByUsername(login)
 		}
-		user = _user
-	} else if phoneRegex.MatchString(opts.Username) {
-		return nil, errors.New("implement login by phone")
-	} else {
-		return nil, errors.New("implement login by username")
+	default:
+		user, err = uops.GetUserByUsername(login)
 	}
 
-	// fixme => hash it
-	if user.Password != opts.Password {
-		return nil, errors.New("invalid password")
+	if err != nil || user == nil {
+		return nil, ErrInvalidCredentials
 	}
 
-	token, err := c.signer.SignAccess(&signer.AccessClaim{
-		UserId: int64(user.ID),
-	})
-	if err != nil {
-		return nil, err
-	}
+	return user, nil
+}
 
-	// Create or update device record for this session
-	tokenHash := HashToken(token)
-	now := time.Now()
-	expiresOn := now.Add(30 * 24 * time.Hour)
-	lastLogin := now.Format(time.RFC3339)
+// startSession creates (or reuses) the session device and signs its tokens
+func (c *Controller) startSession(user *dbmodels.User, deviceName, oldToken, clientIP string) (*LoginResponse, error) {
 	userOps := c.database.GetUserOps()
 
-	if opts.OldToken != "" {
-		oldHash := HashToken(opts.OldToken)
-		existing, err := userOps.GetUserDeviceByTokenHash(int64(user.ID), oldHash)
-		if err == nil && existing != nil {
-			_ = userOps.UpdateUserDevice(existing.ID, map[string]any{
-				"token_hash": tokenHash,
-				"last_ip":    opts.ClientIP,
-				"last_login": lastLogin,
-				"expires_on": expiresOn,
-				"updated_at": now,
-			})
-			user.Password = ""
-			user.ExtraMeta = ""
-			return &LoginResponse{
-				AccessToken:    token,
-				UserInfo:       user,
-				PortalPageType: "login",
-			}, nil
+	// a client logging in again with its last refresh token keeps its device
+	if oldToken != "" {
+		existing, err := userOps.GetUserDeviceByTokenHash(int64(user.ID), HashToken(oldToken))
+		if err == nil && existing != nil && existing.RevokedAt == nil {
+			return c.issueSession(user, existing.ID, clientIP)
 		}
 	}
 
-	deviceName := opts.DeviceName
 	if deviceName == "" {
 		deviceName = "Session"
 	}
-	_, _ = userOps.AddUserDevice(&dbmodels.UserDevice{
+
+	expiresOn := c.sessionExpiry(time.Now())
+	deviceId, err := userOps.AddUserDevice(&dbmodels.UserDevice{
 		Name:      deviceName,
 		Dtype:     "session",
-		TokenHash: tokenHash,
 		UserId:    int64(user.ID),
-		LastIp:    opts.ClientIP,
-		LastLogin: lastLogin,
+		LastIp:    clientIP,
 		ExtraMeta: "{}",
 		ExpiresOn: &expiresOn,
 	})
+	if err != nil {
+		return nil, err
+	}
 
-	user.Password = ""
-	user.ExtraMeta = ""
-
-	return &LoginResponse{
-		AccessToken:    token,
-		UserInfo:       user,
-		PortalPageType: "login",
-	}, nil
+	return c.issueSession(user, deviceId, clientIP)
 }
 
 func HashToken(token string) string {
@@ -186,6 +201,9 @@ func (c *Controller) LoginWithDeviceToken(deviceToken string, clientIP string) (
 	if device.UserId != claim.UserId {
 		return nil, errors.New("device not found")
 	}
+	if device.RevokedAt != nil || device.TokenHash != HashToken(deviceToken) {
+		return nil, ErrSessionRevoked
+	}
 	if device.ExpiresOn != nil && time.Now().After(*device.ExpiresOn) {
 		return nil, errors.New("device token expired")
 	}
@@ -195,7 +213,14 @@ func (c *Controller) LoginWithDeviceToken(deviceToken string, clientIP string) (
 		return nil, errors.New("user not found")
 	}
 
-	accessToken, err := c.signer.SignAccess(&signer.AccessClaim{UserId: claim.UserId})
+	if user.Disabled || user.IsDeleted {
+		return nil, ErrUserDisabled
+	}
+
+	accessToken, err := c.signer.SignAccess(&signer.AccessClaim{
+		UserId:   claim.UserId,
+		DeviceId: device.ID,
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -212,7 +237,25 @@ func (c *Controller) LoginWithDeviceToken(deviceToken string, clientIP string) (
 	user.ExtraMeta = ""
 	return &LoginResponse{
 		AccessToken:    accessToken,
+		ExpiresIn:      int64(c.signer.TTL(signer.TokenTypeAccess).Seconds()),
 		UserInfo:       user,
 		PortalPageType: "login",
 	}, nil
 }
+
+// rehashPassword upgrades a legacy plaintext or outdated hash after a
+// successful login, failing it only costs another try next login
+func (c *Controller) rehashPassword(userId int64, password string) {
+	hash, err := passhash.Hash(password)
+	if err != nil {
+		c.logger.Error("failed to hash password", "user_id", userId, "error", err)
+		return
+	}
+
+	err = c.database.GetUserOps().UpdateUser(userId, map[string]any{
+		"password": hash,
+	})
+	if err != nil {
+		c.logger.Error("failed to rehash password", "user_id", userId, "error", err)
+	}
+}
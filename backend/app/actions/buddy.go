@@ -0,0 +1,65 @@
+package actions
+
+import (
+	"errors"
+
+	"github.com/blue-monads/potatoverse/backend/services/buddyhub"
+)
+
+var (
+	ErrBuddyHubNotAvailable = errors.New("buddy hub is not available")
+)
+
+func (c *Controller) isAdmin(userId int64) error {
+	user, err := c.database.GetUserOps().GetUser(userId)
+	if err != nil {
+		return err
+	}
+
+	if user.Ugroup != "admin" {
+		return ErrUserNotAllowed
+	}
+
+	return nil
+}
+
+func (c *Controller) ListBuddyUsage(userId int64) ([]*buddyhub.BuddyUsage, error) {
+	err := c.isAdmin(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.buddyhub == nil {
+		return nil, ErrBuddyHubNotAvailable
+	}
+
+	return c.buddyhub.ListUsage(), nil
+}
+
+func (c *Controller) GetBuddyUsage(userId int64, pubkey string) (*buddyhub.BuddyUsage, error) {
+	err := c.isAdmin(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.buddyhub == nil {
+		return nil, ErrBuddyHubNotAvailable
+	}
+
+	return c.buddyhub.GetUsage(pubkey), nil
+}
+
+func (c *Controller) ResetBuddyUsage(userId int64, pubkey string) (*buddyhub.BuddyUsage, error) {
+	err := c.isAdmin(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.buddyhub == nil {
+		return nil, ErrBuddyHubNotAvailable
+	}
+
+	c.buddyhub.ResetUsage(pubkey)
+
+	return c.buddyhub.GetUsage(pubkey), nil
+}
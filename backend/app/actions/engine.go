@@ -2,6 +2,7 @@ package actions
 
 import (
 	"errors"
+	"strings"
 
 	"github.com/blue-monads/potatoverse/backend/services/datahub/dbmodels"
 	"github.com/blue-monads/potatoverse/backend/services/signer"
@@ -126,7 +127,7 @@ func (c *Controller) IsUserPackageAdmin(userId, installId int64) error {
 
 		currUser := users[0]
 
-		if currUser.Scope != "core.admin" && currUser.Scope != "*" {
+		if !hasScope(currUser.Scope, "core.admin") && !hasScope(currUser.Scope, "*") {
 			return ErrUserNotAllowed
 		}
 
@@ -201,7 +202,11 @@ func (c *Controller) GeneratePackageDevToken(userId int64, packageId int64, epth
 	}
 
 	if pkg.DevToken != "" && !epthermal {
-		return pkg.DevToken, nil
+		// stored tokens expire too, hand out a new one then
+		_, err := c.signer.ParsePackageDev(strings.TrimPrefix(pkg.DevToken, PackageDevTokenPrefix))
+		if err == nil {
+			return pkg.DevToken, nil
+		}
 	}
 
 	if pkg.InstalledBy != userId {
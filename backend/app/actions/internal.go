@@ -21,7 +21,7 @@ func (c *Controller) AddNormalUserDirect(name, password, email string) (*dbmodel
 
 func (c *Controller) AddUserDirect(name, password, email, utype string) (*dbmodels.User, error) {
 
-	uid, err := c.database.GetUserOps().AddUser(&dbmodels.User{
+	uid, err := c.addUser(&dbmodels.User{
 		ID:         0,
 		Name:       name,
 		Bio:        "This is a normal user.",
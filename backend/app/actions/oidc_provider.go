@@ -0,0 +1,907 @@
+package actions
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blue-monads/potatoverse/backend/services/datahub/dbmodels"
+	"github.com/blue-monads/potatoverse/backend/services/oidc"
+	"github.com/blue-monads/potatoverse/backend/services/signer"
+	xutils "github.com/blue-monads/potatoverse/backend/utils"
+)
+
+/*
+
+the platform as an openid connect provider (login with potatoverse). apps
+are registered per space as OIDCClients, a user can log in to them when
+they can use the space (admin, owner, SpaceUsers row or a public space).
+consent is kept per user and client in OIDCConsents, never in SpaceUsers,
+so agreeing to a public space's app does not make one a member of it.
+
+only the authorization code flow is supported, pkce is required for public
+clients. codes and access tokens are signer tokens, id tokens are RS256 jwts
+signed with a key generated on first use and kept sealed in GlobalConfig.
+
+*/
+
+const (
+	oidcClientIdPrefix     = "pvc_"
+	oidcClientSecretPrefix = "pcsec_"
+	oidcSigningKeyConfig   = "oidc_signing_key"
+	oidcConsentPage        = "/zz/pages/auth/oidc/authorize"
+	oidcIDTokenTTL         = time.Hour
+)
+
+var oidcScopes = []string{"openid", "profile", "email"}
+
+var (
+	ErrOIDCClientNotFound   = errors.New("unknown oidc client")
+	ErrOIDCRedirectMismatch = errors.New("redirect_uri is not registered for this client")
+	ErrOIDCInvalidRedirect  = errors.New("redirect uris must be https (or http on loopback) urls without a fragment")
+	ErrOIDCInvalidScope     = errors.New("unsupported oidc scope")
+)
+
+// OIDCError is an oauth error response, Code is the rfc 6749 error code
+type OIDCError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *OIDCError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+func oidcErr(code, description string) *OIDCError {
+	return &OIDCError{Code: code, Description: description}
+}
+
+// oidcKeyCache holds the signing key loaded (or generated) on first use
+type oidcKeyCache struct {
+	mu  sync.Mutex
+	key *oidc.SigningKey
+}
+
+// usedOIDCCodes remembers redeemed authorization codes until they expire, kept
+// in memory so a restart only lets codes of the last minute be replayed
+type usedOIDCCodes struct {
+	mu    sync.Mutex
+	codes map[string]time.Time
+}
+
+// use marks the code redeemed, false when it already was
+func (u *usedOIDCCodes) use(codeId string, until time.Time) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.codes == nil {
+		u.codes = make(map[string]time.Time)
+	}
+
+	now := time.Now()
+	for id, exp := range u.codes {
+		if now.After(exp) {
+			delete(u.codes, id)
+		}
+	}
+
+	if _, ok := u.codes[codeId]; ok {
+		return false
+	}
+
+	u.codes[codeId] = until
+	return true
+}
+
+func (c *Controller) OIDCProviderEnabled() bool {
+	return c.AppOpts == nil || c.AppOpts.OIDCProvider == nil || !c.AppOpts.OIDCProvider.Disabled
+}
+
+func (c *Controller) OIDCIssuer() string {
+	if c.AppOpts == nil {
+		return "/zz/oidc"
+	}
+
+	if c.AppOpts.OIDCProvider != nil && c.AppOpts.OIDCProvider.Issuer != "" {
+		return strings.TrimSuffix(c.AppOpts.OIDCProvider.Issuer, "/")
+	}
+
+	host := "localhost"
+	if len(c.AppOpts.Hosts) > 0 {
+		host = c.AppOpts.Hosts[0].Name
+	}
+
+	return xutils.GetFullUrl(host, "/zz/oidc", c.AppOpts.Port, false)
+}
+
+func (c *Controller) OIDCDiscovery() map[string]any {
+	issuer := c.OIDCIssuer()
+
+	return map[string]any{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/authorize",
+		"token_endpoint":                        issuer + "/token",
+		"userinfo_endpoint":                     issuer + "/userinfo",
+		"jwks_uri":                              issuer + "/jwks",
+		"scopes_supported":                      oidcScopes,
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"claims_supported": []string{
+			"iss", "sub", "aud", "azp", "exp", "iat", "nonce",
+			"name", "preferred_username", "email", "email_verified",
+		},
+	}
+}
+
+func (c *Controller) OIDCJWKS() (*oidc.JWKS, error) {
+	key, err := c.oidcKey()
+	if err != nil {
+		return nil, err
+	}
+	return key.JWKS(), nil
+}
+
+// client registrations
+
+type CreateOIDCClientOpts struct {
+	SpaceId      int64    `json:"space_id"`
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes"`
+	// public clients (spas, mobile apps) have no secret and must use pkce
+	Public bool `json:"public"`
+}
+
+type OIDCClientWithSecret struct {
+	*dbmodels.OIDCClient
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+func (c *Controller) ListOIDCClients(userId int64, spaceId int64) ([]dbmodels.OIDCClient, error) {
+	_, err := c.canManageSpace(userId, spaceId)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.database.GetSpaceOps().ListOIDCClients(spaceId)
+}
+
+// CreateOIDCClient registers a client, its secret is only returned here
+func (c *Controller) CreateOIDCClient(userId int64, opts *CreateOIDCClientOpts) (*OIDCClientWithSecret, error) {
+	space, err := c.canManageSpace(userId, opts.SpaceId)
+	if err != nil {
+		return nil, err
+	}
+
+	redirectURIs, err := validateRedirectURIs(opts.RedirectURIs)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := opts.Scopes
+	if len(scopes) == 0 {
+		scopes = oidcScopes
+	}
+	for _, s := range scopes {
+		if !slices.Contains(oidcScopes, s) {
+			return nil, ErrOIDCInvalidScope
+		}
+	}
+	if !slices.Contains(scopes, "openid") {
+		scopes = append([]string{"openid"}, scopes...)
+	}
+
+	rid, err := xutils.GenerateRandomString(24)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, secretHash := "", ""
+	if !opts.Public {
+		secret, secretHash, err = newOIDCClientSecret()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	name := opts.Name
+	if name == "" {
+		name = space.NamespaceKey
+	}
+
+	id, err := c.database.GetSpaceOps().AddOIDCClient(&dbmodels.OIDCClient{
+		ClientId:     oidcClientIdPrefix + rid,
+		SecretHash:   secretHash,
+		Name:         name,
+		InstallID:    space.InstalledId,
+		SpaceID:      space.ID,
+		RedirectURIs: redirectURIs,
+		Scopes:       strings.Join(scopes, " "),
+		OwnedBy:      userId,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := c.database.GetSpaceOps().GetOIDCClient(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OIDCClientWithSecret{OIDCClient: client, ClientSecret: secret}, nil
+}
+
+type UpdateOIDCClientOpts struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+}
+
+func (c *Controller) UpdateOIDCClient(userId int64, id int64, opts *UpdateOIDCClientOpts) (*dbmodels.OIDCClient, error) {
+	client, err := c.managedOIDCClient(userId, id)
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string]any{}
+	if opts.Name != "" {
+		data["name"] = opts.Name
+	}
+	if opts.RedirectURIs != nil {
+		redirectURIs, err := validateRedirectURIs(opts.RedirectURIs)
+		if err != nil {
+			return nil, err
+		}
+		data["redirect_uris"] = redirectURIs
+	}
+
+	if len(data) > 0 {
+		err = c.database.GetSpaceOps().UpdateOIDCClient(client.ID, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return c.database.GetSpaceOps().GetOIDCClient(client.ID)
+}
+
+func (c *Controller) DeleteOIDCClient(userId int64, id int64) error {
+	client, err := c.managedOIDCClient(userId, id)
+	if err != nil {
+		return err
+	}
+
+	err = c.database.GetSpaceOps().RemoveOIDCConsents(client.ClientId)
+	if err != nil {
+		return err
+	}
+
+	return c.database.GetSpaceOps().RemoveOIDCClient(client.ID)
+}
+
+// RotateOIDCClientSecret replaces the secret, the old one stops working
+// right away. public clients become confidential.
+func (c *Controller) RotateOIDCClientSecret(userId int64, id int64) (*OIDCClientWithSecret, error) {
+	client, err := c.managedOIDCClient(userId, id)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, secretHash, err := newOIDCClientSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.database.GetSpaceOps().UpdateOIDCClient(client.ID, map[string]any{
+		"secret_hash": secretHash,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &OIDCClientWithSecret{OIDCClient: client, ClientSecret: secret}, nil
+}
+
+// authorization
+
+type OIDCAuthorizeRequest struct {
+	ClientId            string `json:"client_id" form:"client_id"`
+	RedirectURI         string `json:"redirect_uri" form:"redirect_uri"`
+	ResponseType        string `json:"response_type" form:"response_type"`
+	Scope               string `json:"scope" form:"scope"`
+	State               string `json:"state" form:"state"`
+	Nonce               string `json:"nonce" form:"nonce"`
+	CodeChallenge       string `json:"code_challenge" form:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method" form:"code_challenge_method"`
+}
+
+// OIDCAuthorizeRedirect is where the authorization endpoint sends the
+// browser, the consent page or back to the client with an error. an unknown
+// client or redirect uri is returned as error, never redirected to.
+func (c *Controller) OIDCAuthorizeRedirect(req *OIDCAuthorizeRequest) (string, error) {
+	client, err := c.resolveOIDCClient(req)
+	if err != nil {
+		return "", err
+	}
+
+	_, oerr := checkOIDCAuthorizeRequest(client, req)
+	if oerr != nil {
+		return oidcErrorRedirect(req, oerr), nil
+	}
+
+	q := url.Values{}
+	q.Set("client_id", req.ClientId)
+	q.Set("redirect_uri", req.RedirectURI)
+	q.Set("response_type", req.ResponseType)
+	q.Set("scope", req.Scope)
+	setIfNotEmpty(q, "state", req.State)
+	setIfNotEmpty(q, "nonce", req.Nonce)
+	setIfNotEmpty(q, "code_challenge", req.CodeChallenge)
+	setIfNotEmpty(q, "code_challenge_method", req.CodeChallengeMethod)
+
+	return oidcConsentPage + "?" + q.Encode(), nil
+}
+
+type OIDCAuthorizeInfo struct {
+	ClientName string   `json:"client_name"`
+	SpaceId    int64    `json:"space_id"`
+	Scopes     []string `json:"scopes"`
+	// the user already agreed to every requested scope
+	Consented bool `json:"consented"`
+}
+
+// GetOIDCAuthorizeInfo is what the consent page shows
+func (c *Controller) GetOIDCAuthorizeInfo(userId int64, req *OIDCAuthorizeRequest) (*OIDCAuthorizeInfo, error) {
+	client, err := c.resolveOIDCClient(req)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes, oerr := checkOIDCAuthorizeRequest(client, req)
+	if oerr != nil {
+		return nil, oerr
+	}
+
+	_, err = c.oidcSpaceAccess(userId, client.SpaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OIDCAuthorizeInfo{
+		ClientName: client.Name,
+		SpaceId:    client.SpaceID,
+		Scopes:     scopes,
+		Consented:  hasOIDCConsent(c.oidcConsentScopes(userId, client.ClientId), scopes),
+	}, nil
+}
+
+// OIDCAuthorize records the user's consent decision and returns the client
+// redirect carrying the code or the error
+func (c *Controller) OIDCAuthorize(userId int64, req *OIDCAuthorizeRequest, approve bool) (string, error) {
+	client, err := c.resolveOIDCClient(req)
+	if err != nil {
+		return "", err
+	}
+
+	scopes, oerr := checkOIDCAuthorizeRequest(client, req)
+	if oerr != nil {
+		return oidcErrorRedirect(req, oerr), nil
+	}
+
+	if !approve {
+		return oidcErrorRedirect(req, oidcErr("access_denied", "the user denied the request")), nil
+	}
+
+	_, err = c.oidcSpaceAccess(userId, client.SpaceID)
+	if errors.Is(err, ErrUserNotAllowed) {
+		return oidcErrorRedirect(req, oidcErr("access_denied", "the user can not use this space")), nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	err = c.grantOIDCConsent(userId, client.ClientId, scopes)
+	if err != nil {
+		return "", err
+	}
+
+	codeId, err := oidc.RandomString()
+	if err != nil {
+		return "", err
+	}
+
+	code, err := c.signer.SignOIDCCode(&signer.OIDCCodeClaim{
+		CodeId:      codeId,
+		UserId:      userId,
+		ClientId:    client.ClientId,
+		RedirectURI: req.RedirectURI,
+		Scope:       strings.Join(scopes, " "),
+		Nonce:       req.Nonce,
+		Challenge:   req.CodeChallenge,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	q := url.Values{}
+	q.Set("code", code)
+	setIfNotEmpty(q, "state", req.State)
+
+	return appendQuery(req.RedirectURI, q), nil
+}
+
+// token endpoint
+
+type OIDCTokenOpts struct {
+	GrantType    string
+	Code         string
+	RedirectURI  string
+	ClientId     string
+	ClientSecret string
+	CodeVerifier string
+}
+
+type OIDCTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in,omitempty"`
+	IDToken     string `json:"id_token"`
+	Scope       string `json:"scope"`
+}
+
+// OIDCToken redeems an authorization code, errors are *OIDCError
+func (c *Controller) OIDCToken(opts *OIDCTokenOpts) (*OIDCTokenResponse, error) {
+	if opts.GrantType != "authorization_code" {
+		return nil, oidcErr("unsupported_grant_type", "")
+	}
+
+	client, err := c.database.GetSpaceOps().GetOIDCClientByClientId(opts.ClientId)
+	if err != nil {
+		return nil, oidcErr("invalid_client", "")
+	}
+
+	if client.SecretHash != "" {
+		// the stored hash is of the secret without its prefix, but the
+		// prefix is part of the secret as handed out and must be there
+		secret, ok := strings.CutPrefix(opts.ClientSecret, oidcClientSecretPrefix)
+		hash := HashToken(secret)
+		if !ok || secret == "" || subtle.ConstantTimeCompare([]byte(hash), []byte(client.SecretHash)) != 1 {
+			return nil, oidcErr("invalid_client", "")
+		}
+	}
+
+	claim, err := c.signer.ParseOIDCCode(opts.Code)
+	if err != nil || claim.ClientId != client.ClientId || claim.RedirectURI != opts.RedirectURI {
+		return nil, oidcErr("invalid_grant", "")
+	}
+
+	if claim.Challenge != "" && !oidc.VerifyPKCE(opts.CodeVerifier, claim.Challenge) {
+		return nil, oidcErr("invalid_grant", "code_verifier mismatch")
+	}
+
+	if !c.oidcCodes.use(claim.CodeId, time.Now().Add(time.Minute+c.signer.TTL(signer.TokenTypeOIDCCode))) {
+		c.logger.Warn("oidc authorization code replayed", "client_id", client.ClientId, "user_id", claim.UserId)
+		return nil, oidcErr("invalid_grant", "")
+	}
+
+	scopes := strings.Fields(claim.Scope)
+
+	user, err := c.oidcUser(client, claim.UserId, scopes)
+	if err != nil {
+		return nil, oidcErr("invalid_grant", "")
+	}
+
+	accessToken, err := c.signer.SignOIDCAccess(&signer.OIDCAccessClaim{
+		UserId:   user.ID,
+		ClientId: client.ClientId,
+		Scope:    claim.Scope,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := c.oidcKey()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	idClaims := oidcUserClaims(user, scopes)
+	idClaims["iss"] = c.OIDCIssuer()
+	idClaims["aud"] = client.ClientId
+	idClaims["azp"] = client.ClientId
+	idClaims["iat"] = now.Unix()
+	idClaims["exp"] = now.Add(oidcIDTokenTTL).Unix()
+	if claim.Nonce != "" {
+		idClaims["nonce"] = claim.Nonce
+	}
+
+	idToken, err := key.Sign(idClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OIDCTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(c.signer.TTL(signer.TokenTypeOIDCAccess).Seconds()),
+		IDToken:     idToken,
+		Scope:       claim.Scope,
+	}, nil
+}
+
+// OIDCUserInfo returns the claims the access token's scopes allow
+func (c *Controller) OIDCUserInfo(accessToken string) (map[string]any, error) {
+	claim, err := c.signer.ParseOIDCAccess(accessToken)
+	if err != nil {
+		return nil, oidcErr("invalid_token", "")
+	}
+
+	client, err := c.database.GetSpaceOps().GetOIDCClientByClientId(claim.ClientId)
+	if err != nil {
+		return nil, oidcErr("invalid_token", "")
+	}
+
+	scopes := strings.Fields(claim.Scope)
+
+	user, err := c.oidcUser(client, claim.UserId, scopes)
+	if err != nil {
+		return nil, oidcErr("invalid_token", "")
+	}
+
+	return oidcUserClaims(user, scopes), nil
+}
+
+// private
+
+func (c *Controller) canManageSpace(userId int64, spaceId int64) (*dbmodels.Space, error) {
+	space, err := c.database.GetSpaceOps().GetSpace(spaceId)
+	if err != nil {
+		return nil, err
+	}
+
+	if space.OwnerID != userId {
+		err = c.isAdmin(userId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return space, nil
+}
+
+func (c *Controller) managedOIDCClient(userId int64, id int64) (*dbmodels.OIDCClient, error) {
+	client, err := c.database.GetSpaceOps().GetOIDCClient(id)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = c.canManageSpace(userId, client.SpaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+func (c *Controller) resolveOIDCClient(req *OIDCAuthorizeRequest) (*dbmodels.OIDCClient, error) {
+	client, err := c.database.GetSpaceOps().GetOIDCClientByClientId(req.ClientId)
+	if err != nil {
+		return nil, ErrOIDCClientNotFound
+	}
+
+	// exact match only, no prefix or wildcard matching
+	// checked again for clients registered before the scheme rule
+	if !slices.Contains(oidcClientRedirectURIs(client), req.RedirectURI) || !isSafeRedirectURI(req.RedirectURI) {
+		return nil, ErrOIDCRedirectMismatch
+	}
+
+	return client, nil
+}
+
+// oidcSpaceAccess checks the user can use the space, it only reads
+// membership and never adds to it
+func (c *Controller) oidcSpaceAccess(userId int64, spaceId int64) (*dbmodels.Space, error) {
+	user, err := c.database.GetUserOps().GetUser(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Disabled || user.IsDeleted {
+		return nil, ErrUserDisabled
+	}
+
+	space, err := c.database.GetSpaceOps().GetSpace(spaceId)
+	if err != nil {
+		return nil, err
+	}
+
+	if space.IsPublic || space.OwnerID == userId || user.Ugroup == "admin" {
+		return space, nil
+	}
+
+	users, err := c.database.GetSpaceOps().QuerySpaceUsers(space.InstalledId, map[any]any{
+		"user_id": userId,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// a row of this space or an install wide one (space_id 0)
+	for _, su := range users {
+		if su.SpaceID == space.ID || su.SpaceID == 0 {
+			return space, nil
+		}
+	}
+
+	return nil, ErrUserNotAllowed
+}
+
+// oidcConsentScopes is what the user agreed to share with the client,
+// empty when they never did
+func (c *Controller) oidcConsentScopes(userId int64, clientId string) string {
+	consent, err := c.database.GetSpaceOps().GetOIDCConsent(userId, clientId)
+	if err != nil {
+		return ""
+	}
+
+	return consent.Scopes
+}
+
+func (c *Controller) grantOIDCConsent(userId int64, clientId string, scopes []string) error {
+	consented := c.oidcConsentScopes(userId, clientId)
+	if hasOIDCConsent(consented, scopes) {
+		return nil
+	}
+
+	return c.database.GetSpaceOps().SetOIDCConsent(userId, clientId, addOIDCConsent(consented, scopes))
+}
+
+// oidcUser is the user a code or access token was issued for, as long as
+// they are active and have not revoked their consent
+func (c *Controller) oidcUser(client *dbmodels.OIDCClient, userId int64, scopes []string) (*dbmodels.User, error) {
+	_, err := c.oidcSpaceAccess(userId, client.SpaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !hasOIDCConsent(c.oidcConsentScopes(userId, client.ClientId), scopes) {
+		return nil, ErrUserNotAllowed
+	}
+
+	return c.database.GetUserOps().GetUser(userId)
+}
+
+func (c *Controller) oidcKey() (*oidc.SigningKey, error) {
+	c.oidcSigningKey.mu.Lock()
+	defer c.oidcSigningKey.mu.Unlock()
+
+	if c.oidcSigningKey.key != nil {
+		return c.oidcSigningKey.key, nil
+	}
+
+	gops := c.database.GetGlobalOps()
+
+	config, err := gops.GetGlobalConfig(oidcSigningKeyConfig, "CORE")
+	exists := err == nil && config != nil
+	if exists && config.Value != "" {
+		data, err := c.signer.Open(config.Value)
+		if err == nil {
+			key, err := oidc.ParseSigningKey(data)
+			if err == nil {
+				c.oidcSigningKey.key = key
+				return key, nil
+			}
+		}
+
+		// sealed with a master secret that is no longer accepted
+		c.logger.Warn("oidc signing key unreadable, generating a new one", "error", err)
+	}
+
+	key, err := oidc.NewSigningKey()
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := c.signer.Seal(key.PEM())
+	if err != nil {
+		return nil, err
+	}
+
+	if exists {
+		err = gops.UpdateGlobalConfigByKey(oidcSigningKeyConfig, "CORE", map[string]any{"value": sealed})
+	} else {
+		_, err = gops.AddGlobalConfig(&dbmodels.GlobalConfig{
+			Key:       oidcSigningKeyConfig,
+			GroupName: "CORE",
+			Value:     sealed,
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c.logger.Info("generated oidc signing key", "kid", key.KeyId())
+	c.oidcSigningKey.key = key
+
+	return key, nil
+}
+
+func checkOIDCAuthorizeRequest(client *dbmodels.OIDCClient, req *OIDCAuthorizeRequest) ([]string, *OIDCError) {
+	if req.ResponseType != "code" {
+		return nil, oidcErr("unsupported_response_type", "only the code flow is supported")
+	}
+
+	scopes := strings.Fields(req.Scope)
+	if !slices.Contains(scopes, "openid") {
+		return nil, oidcErr("invalid_scope", "openid scope is required")
+	}
+
+	allowed := strings.Fields(client.Scopes)
+	out := make([]string, 0, len(scopes))
+	for _, s := range scopes {
+		if !slices.Contains(allowed, s) {
+			return nil, oidcErr("invalid_scope", "scope "+s+" is not allowed for this client")
+		}
+		if !slices.Contains(out, s) {
+			out = append(out, s)
+		}
+	}
+
+	switch req.CodeChallengeMethod {
+	case "S256":
+		if req.CodeChallenge == "" {
+			return nil, oidcErr("invalid_request", "code_challenge is missing")
+		}
+	case "":
+		if req.CodeChallenge != "" {
+			return nil, oidcErr("invalid_request", "only the S256 code_challenge_method is supported")
+		}
+	default:
+		return nil, oidcErr("invalid_request", "only the S256 code_challenge_method is supported")
+	}
+
+	if client.SecretHash == "" && req.CodeChallenge == "" {
+		return nil, oidcErr("invalid_request", "public clients must use pkce")
+	}
+
+	return out, nil
+}
+
+func oidcUserClaims(user *dbmodels.User, scopes []string) map[string]any {
+	claims := map[string]any{
+		"sub": strconv.FormatInt(user.ID, 10),
+	}
+
+	if slices.Contains(scopes, "profile") {
+		claims["name"] = user.Name
+		if user.Username != nil && *user.Username != "" {
+			claims["preferred_username"] = *user.Username
+		}
+	}
+
+	if slices.Contains(scopes, "email") && user.Email != "" {
+		claims["email"] = user.Email
+		claims["email_verified"] = user.IsVerified
+	}
+
+	return claims
+}
+
+func oidcClientRedirectURIs(client *dbmodels.OIDCClient) []string {
+	uris := make([]string, 0)
+	json.Unmarshal([]byte(client.RedirectURIs), &uris)
+	return uris
+}
+
+func validateRedirectURIs(uris []string) (string, error) {
+	if len(uris) == 0 {
+		return "", ErrOIDCInvalidRedirect
+	}
+
+	for _, uri := range uris {
+		if !isSafeRedirectURI(uri) {
+			return "", ErrOIDCInvalidRedirect
+		}
+	}
+
+	data, err := json.Marshal(uris)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// isSafeRedirectURI allows https and http on loopback only, the consent page
+// navigates to it so javascript:, data: and the like must never pass
+func isSafeRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || u.Host == "" || u.Fragment != "" || u.User != nil {
+		return false
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "https":
+		return true
+	case "http":
+		host := u.Hostname()
+		if host == "localhost" {
+			return true
+		}
+		ip := net.ParseIP(host)
+		return ip != nil && ip.IsLoopback()
+	default:
+		return false
+	}
+}
+
+func newOIDCClientSecret() (string, string, error) {
+	secret, err := xutils.GenerateRandomString(40)
+	if err != nil {
+		return "", "", err
+	}
+
+	return oidcClientSecretPrefix + secret, HashToken(secret), nil
+}
+
+func oidcErrorRedirect(req *OIDCAuthorizeRequest, oerr *OIDCError) string {
+	q := url.Values{}
+	q.Set("error", oerr.Code)
+	setIfNotEmpty(q, "error_description", oerr.Description)
+	setIfNotEmpty(q, "state", req.State)
+
+	return appendQuery(req.RedirectURI, q)
+}
+
+func appendQuery(target string, q url.Values) string {
+	sep := "?"
+	if strings.Contains(target, "?") {
+		sep = "&"
+	}
+	return target + sep + q.Encode()
+}
+
+func setIfNotEmpty(q url.Values, key, value string) {
+	if value != "" {
+		q.Set(key, value)
+	}
+}
+
+// hasScope checks a space separated scope list for one scope token
+func hasScope(scope string, want string) bool {
+	return slices.Contains(strings.Fields(scope), want)
+}
+
+// hasOIDCConsent checks every requested scope is among the consented ones
+func hasOIDCConsent(consented string, scopes []string) bool {
+	for _, s := range scopes {
+		if !hasScope(consented, s) {
+			return false
+		}
+	}
+	return true
+}
+
+func addOIDCConsent(consented string, scopes []string) string {
+	tokens := strings.Fields(consented)
+	for _, s := range scopes {
+		if !slices.Contains(tokens, s) {
+			tokens = append(tokens, s)
+		}
+	}
+	return strings.Join(tokens, " ")
+}
@@ -11,6 +11,7 @@ import (
 	"regexp"
 	"strings"
 
+	"github.com/blue-monads/potatoverse/backend/engine/hubs/repohub/repotypes"
 	"github.com/blue-monads/potatoverse/backend/services/datahub"
 	"github.com/blue-monads/potatoverse/backend/services/datahub/dbmodels"
 	xutils "github.com/blue-monads/potatoverse/backend/utils"
@@ -18,7 +19,7 @@ import (
 	"github.com/blue-monads/potatoverse/backend/xtypes/models"
 )
 
-func (c *Controller) InstallPackageByUrl(userId int64, url string) (*InstallPackageResult, error) {
+func (c *Controller) InstallPackageByUrl(userId int64, url string, allowUnsigned bool) (*InstallPackageResult, error) {
 
 	tmpFile, err := os.CreateTemp("", "potato-package-*.zip")
 	if err != nil {
@@ -39,24 +40,41 @@ func (c *Controller) InstallPackageByUrl(userId int64, url string) (*InstallPack
 
 	file := tmpFile.Name()
 
+	pf := &repotypes.PackageFile{Path: file}
+
+	rawSignature, err := fetchDetachedSignature(url)
+	if err != nil {
+		return nil, err
+	}
+
+	if rawSignature != nil {
+		c.fillDetachedSignature(pf, rawSignature)
+	}
+
+	err = c.verifyPackage(userId, pf, allowUnsigned)
+	if err != nil {
+		return nil, err
+	}
+
 	return c.InstallPackageByFile(userId, "", file)
 
 }
 
-func (c *Controller) InstallPackageRepo(userId int64, name string, repoSlug string) (*InstallPackageResult, error) {
-	var file string
-	var err error
-
+func (c *Controller) InstallPackageRepo(userId int64, name string, repoSlug string, allowUnsigned bool) (*InstallPackageResult, error) {
 	repoHub := c.engine.GetRepoHub()
-	file, err = repoHub.ZipPackage(repoSlug, name, "")
-
+	pf, err := repoHub.ZipPackage(repoSlug, name, "")
 	if err != nil {
 		return nil, err
 	}
 
-	defer os.Remove(file)
+	defer os.Remove(pf.Path)
+
+	err = c.verifyPackage(userId, pf, allowUnsigned)
+	if err != nil {
+		return nil, err
+	}
 
-	return c.InstallPackageByFile(userId, repoSlug, file)
+	return c.InstallPackageByFile(userId, repoSlug, pf.Path)
 }
 
 func (c *Controller) InstallPackageByFile(userId int64, repo, file string) (*InstallPackageResult, error) {
@@ -0,0 +1,409 @@
+package actions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/blue-monads/potatoverse/backend/engine/capabilities/xDatabase/xMigrator"
+	"github.com/blue-monads/potatoverse/backend/engine/hubs/caphub"
+	"github.com/blue-monads/potatoverse/backend/services/datahub/dbmodels"
+	"github.com/blue-monads/potatoverse/backend/xtypes/models"
+)
+
+const (
+	SnapshotReasonUpgrade  = "upgrade"
+	SnapshotReasonRollback = "rollback"
+
+	// snapshots kept per package, same as package versions
+	maxPackageSnapshots = 3
+)
+
+var (
+	ErrNoSnapshot          = errors.New("no data snapshot found for that version")
+	ErrRollbackDataOptions = errors.New("choose either restore_data or down_migrations")
+)
+
+type RollbackOptions struct {
+	VersionId int64 `json:"version_id"`
+	// RestoreData puts back the snapshot taken while VersionId was active
+	RestoreData bool `json:"restore_data"`
+	// DownMigrations runs xMigrator down files shipped with the current version
+	DownMigrations bool `json:"down_migrations"`
+}
+
+type RollbackResult struct {
+	PackageVersionId   int64    `json:"package_version_id"`
+	Version            string   `json:"version"`
+	RestoredSnapshotId int64    `json:"restored_snapshot_id,omitempty"`
+	BackupSnapshotId   int64    `json:"backup_snapshot_id"`
+	RevertedMigrations []string `json:"reverted_migrations,omitempty"`
+}
+
+// RollbackPackage re-activates an older kept version and rebuilds spaces and
+// capabilities from its manifest. the current data is snapshotted first and
+// put back if anything fails.
+func (c *Controller) RollbackPackage(userId int64, installedId int64, opts RollbackOptions) (*RollbackResult, error) {
+	err := c.IsUserPackageAdmin(userId, installedId)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.RestoreData && opts.DownMigrations {
+		return nil, ErrRollbackDataOptions
+	}
+
+	pops := c.database.GetPackageInstallOps()
+
+	ipkg, err := pops.GetPackage(installedId)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := pops.GetPackageVersion(opts.VersionId)
+	if err != nil {
+		return nil, err
+	}
+
+	if target.InstallId != installedId {
+		return nil, fmt.Errorf("version %d does not belong to package %d", opts.VersionId, installedId)
+	}
+
+	if target.ID == ipkg.ActiveInstallID {
+		return nil, errors.New("version is already active")
+	}
+
+	manifest, err := c.versionManifest(target.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var restore *dbmodels.PackageSnapshot
+	if opts.RestoreData {
+		restore, err = c.findVersionSnapshot(installedId, target.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	backupId, err := pops.SnapshotPackageData(installedId, ipkg.ActiveInstallID, SnapshotReasonRollback)
+	if err != nil {
+		return nil, fmt.Errorf("could not snapshot package data: %w", err)
+	}
+
+	result := &RollbackResult{
+		PackageVersionId: target.ID,
+		Version:          target.Version,
+		BackupSnapshotId: backupId,
+	}
+
+	err = c.rollbackTo(userId, installedId, ipkg.ActiveInstallID, manifest, target.ID, opts.DownMigrations, result)
+	if err != nil {
+		c.logger.Error("rollback failed, restoring", "installed_id", installedId, "error", err)
+
+		rerr := c.restoreVersion(userId, installedId, ipkg.ActiveInstallID, backupId)
+		if rerr != nil {
+			return nil, fmt.Errorf("%w (restore failed: %s)", err, rerr.Error())
+		}
+
+		return nil, err
+	}
+
+	if restore != nil {
+		err = pops.RestorePackageSnapshot(restore.ID)
+		if err != nil {
+			c.logger.Error("snapshot restore failed, restoring", "installed_id", installedId, "error", err)
+
+			rerr := c.restoreVersion(userId, installedId, ipkg.ActiveInstallID, backupId)
+			if rerr != nil {
+				return nil, fmt.Errorf("%w (restore failed: %s)", err, rerr.Error())
+			}
+
+			return nil, err
+		}
+
+		result.RestoredSnapshotId = restore.ID
+	}
+
+	// the update checker would upgrade it right back
+	if ipkg.AutoUpgrade {
+		pops.UpdatePackageData(installedId, map[string]any{"auto_upgrade": false})
+		c.logger.Info("auto upgrade turned off after rollback", "installed_id", installedId)
+	}
+
+	c.pruneSnapshots(installedId)
+
+	return result, nil
+}
+
+func (c *Controller) ListPackageSnapshots(userId int64, installedId int64) ([]dbmodels.PackageSnapshot, error) {
+	err := c.IsUserPackageAdmin(userId, installedId)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.database.GetPackageInstallOps().ListPackageSnapshots(installedId)
+}
+
+func (c *Controller) rollbackTo(userId, installedId, currentId int64, manifest *models.PotatoPackage, targetId int64, downMigrations bool, result *RollbackResult) error {
+	if downMigrations {
+		for _, folder := range c.migrationFolders(installedId) {
+			reverted, err := migrator.RollbackMigrations(c.database, installedId, currentId, targetId, folder)
+			result.RevertedMigrations = append(result.RevertedMigrations, reverted...)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return c.activateVersion(userId, installedId, manifest, targetId)
+}
+
+// activateVersion points the package at versionId and rebuilds spaces and
+// capabilities from its manifest
+func (c *Controller) activateVersion(userId, installedId int64, manifest *models.PotatoPackage, versionId int64) error {
+	_, err := c.syncPackageSpaces(userId, installedId, manifest.Spaces, true)
+	if err != nil {
+		return err
+	}
+
+	err = c.syncPackageCapabilities(installedId, manifest.Capabilities)
+	if err != nil {
+		return err
+	}
+
+	err = c.database.GetPackageInstallOps().UpdateActiveInstallId(installedId, versionId)
+	if err != nil {
+		return err
+	}
+
+	c.engine.LoadRoutingIndexForPackages(installedId)
+
+	return nil
+}
+
+// restoreVersion undoes a failed upgrade or rollback, back to versionId
+// with the data of snapshotId
+func (c *Controller) restoreVersion(userId, installedId, versionId, snapshotId int64) error {
+	manifest, err := c.versionManifest(versionId)
+	if err != nil {
+		return err
+	}
+
+	err = c.activateVersion(userId, installedId, manifest, versionId)
+	if err != nil {
+		return err
+	}
+
+	return c.database.GetPackageInstallOps().RestorePackageSnapshot(snapshotId)
+}
+
+func (c *Controller) revertUpgrade(userId, installedId, previousId, failedId, snapshotId int64) error {
+	err := c.restoreVersion(userId, installedId, previousId, snapshotId)
+	if err != nil {
+		return err
+	}
+
+	if failedId != 0 {
+		err = c.database.GetPackageInstallOps().DeletePackageVersion(failedId)
+		if err != nil {
+			c.logger.Warn("could not delete failed package version", "version_id", failedId, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// syncPackageCapabilities makes package capabilities match the manifest,
+// matched by name and space, and drops cached instances so they are rebuilt.
+// capabilities that are still there keep their options, admins may have
+// edited them, only a changed type resets them to the manifest defaults.
+func (c *Controller) syncPackageCapabilities(installedId int64, capabilities []models.PotatoCapability) error {
+	sops := c.database.GetSpaceOps()
+
+	spaces, err := sops.ListSpacesByPackageId(installedId)
+	if err != nil {
+		return err
+	}
+
+	spaceIds := make(map[string]int64)
+	for _, space := range spaces {
+		spaceIds[space.NamespaceKey] = space.ID
+	}
+
+	existing, err := sops.QuerySpaceCapabilities(installedId, map[any]any{})
+	if err != nil {
+		return err
+	}
+
+	capHub, _ := c.engine.GetCapabilityHub().(*caphub.CapabilityHub)
+	evict := func(name string, spaceId int64) {
+		if capHub != nil {
+			capHub.Evict(name, spaceId)
+		}
+	}
+
+	wanted := make(map[string]bool)
+
+	for _, capability := range capabilities {
+		targets := []int64{0}
+		if len(capability.Spaces) != 0 {
+			targets = targets[:0]
+			for _, space := range capability.Spaces {
+				spaceId, ok := spaceIds[space]
+				if !ok {
+					return errors.New("space not found")
+				}
+				targets = append(targets, spaceId)
+			}
+		}
+
+		for _, spaceId := range targets {
+			wanted[capabilityKey(capability.Name, spaceId)] = true
+
+			var current *dbmodels.SpaceCapability
+			for i := range existing {
+				if existing[i].Name == capability.Name && existing[i].SpaceID == spaceId {
+					current = &existing[i]
+					break
+				}
+			}
+
+			switch {
+			case current == nil:
+				err = installCapability(c.database, installedId, spaceId, capability)
+			case current.CapabilityType != capability.Type:
+				var options []byte
+				options, err = json.Marshal(capability.Options)
+				if err != nil {
+					return err
+				}
+
+				err = sops.UpdateSpaceCapabilityByID(installedId, current.ID, map[string]any{
+					"capability_type": capability.Type,
+					"options":         string(options),
+				})
+			}
+			if err != nil {
+				return err
+			}
+
+			evict(capability.Name, spaceId)
+		}
+	}
+
+	for _, capability := range existing {
+		if wanted[capabilityKey(capability.Name, capability.SpaceID)] {
+			continue
+		}
+
+		err = sops.RemoveSpaceCapabilityByID(installedId, capability.ID)
+		if err != nil {
+			return err
+		}
+
+		evict(capability.Name, capability.SpaceID)
+	}
+
+	return nil
+}
+
+func capabilityKey(name string, spaceId int64) string {
+	return fmt.Sprintf("%s:%d", name, spaceId)
+}
+
+// migrationFolders are the folders of the package xMigrator capabilities
+func (c *Controller) migrationFolders(installedId int64) []string {
+	caps, err := c.database.GetSpaceOps().QuerySpaceCapabilities(installedId, map[any]any{
+		"capability_type": migrator.Name,
+	})
+	if err != nil {
+		return nil
+	}
+
+	folders := []string{}
+	seen := make(map[string]bool)
+
+	for _, capability := range caps {
+		opts := migrator.MigratorOptions{}
+		json.Unmarshal([]byte(capability.Options), &opts)
+
+		if opts.Folder == "" {
+			opts.Folder = "migrations"
+		}
+
+		if !seen[opts.Folder] {
+			seen[opts.Folder] = true
+			folders = append(folders, opts.Folder)
+		}
+	}
+
+	return folders
+}
+
+func (c *Controller) versionManifest(versionId int64) (*models.PotatoPackage, error) {
+	raw, err := c.database.GetPackageFileOps().GetFileContentByPath(versionId, "", "potato.json")
+	if err != nil {
+		return nil, fmt.Errorf("could not read manifest of version %d: %w", versionId, err)
+	}
+
+	manifest := &models.PotatoPackage{}
+	err = json.Unmarshal(raw, manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// findVersionSnapshot is the newest snapshot taken while versionId was active
+func (c *Controller) findVersionSnapshot(installedId, versionId int64) (*dbmodels.PackageSnapshot, error) {
+	snapshots, err := c.database.GetPackageInstallOps().ListPackageSnapshots(installedId)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range snapshots {
+		if snapshots[i].VersionId == versionId {
+			return &snapshots[i], nil
+		}
+	}
+
+	return nil, ErrNoSnapshot
+}
+
+// pruneSnapshots drops snapshots of versions that are gone and keeps the
+// newest few of the rest
+func (c *Controller) pruneSnapshots(installedId int64) {
+	pops := c.database.GetPackageInstallOps()
+
+	snapshots, err := pops.ListPackageSnapshots(installedId)
+	if err != nil {
+		c.logger.Error("failed to list package snapshots", "error", err)
+		return
+	}
+
+	versions, err := pops.ListPackageVersionsByPackageId(installedId)
+	if err != nil {
+		c.logger.Error("failed to list package versions", "error", err)
+		return
+	}
+
+	kept := make(map[int64]bool)
+	for _, version := range versions {
+		kept[version.ID] = true
+	}
+
+	count := 0
+	for _, snapshot := range snapshots {
+		if kept[snapshot.VersionId] && count < maxPackageSnapshots {
+			count++
+			continue
+		}
+
+		err = pops.DeletePackageSnapshot(snapshot.ID)
+		if err != nil {
+			c.logger.Error("failed to delete package snapshot", "snapshot_id", snapshot.ID, "error", err)
+		}
+	}
+}
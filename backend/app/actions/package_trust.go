@@ -0,0 +1,260 @@
+package actions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/blue-monads/potatoverse/backend/engine/hubs/repohub/reposign"
+	"github.com/blue-monads/potatoverse/backend/engine/hubs/repohub/repotypes"
+	"github.com/blue-monads/potatoverse/backend/services/datahub/dbmodels"
+)
+
+// publisher keys live in GlobalConfig, key is the reposign key id
+const publisherKeysGroup = "PUBLISHER_KEYS"
+
+var ErrPackageNotTrusted = errors.New("package failed verification, an admin can install it with allow_unsigned")
+
+type TrustedKey struct {
+	Id      int64     `json:"id"`
+	KeyId   string    `json:"key_id"`
+	Name    string    `json:"name"`
+	AddedBy int64     `json:"added_by"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+type trustedKeyValue struct {
+	Name    string    `json:"name"`
+	AddedBy int64     `json:"added_by"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+func (c *Controller) ListTrustedKeys(userId int64) ([]TrustedKey, error) {
+	err := c.isAdmin(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.listTrustedKeys()
+}
+
+func (c *Controller) AddTrustedKey(userId int64, key string, name string) (*TrustedKey, error) {
+	err := c.isAdmin(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	keyId, err := reposign.ParseKeyId(key)
+	if err != nil {
+		return nil, err
+	}
+
+	trusted, err := c.isTrustedKey(keyId)
+	if err != nil {
+		return nil, err
+	}
+
+	if trusted {
+		return nil, fmt.Errorf("key already trusted: %s", keyId)
+	}
+
+	value := trustedKeyValue{
+		Name:    name,
+		AddedBy: userId,
+		AddedAt: time.Now(),
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := c.database.GetGlobalOps().AddGlobalConfig(&dbmodels.GlobalConfig{
+		Key:       keyId,
+		GroupName: publisherKeysGroup,
+		Value:     string(data),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TrustedKey{
+		Id:      id,
+		KeyId:   keyId,
+		Name:    value.Name,
+		AddedBy: value.AddedBy,
+		AddedAt: value.AddedAt,
+	}, nil
+}
+
+func (c *Controller) RemoveTrustedKey(userId int64, id int64) error {
+	err := c.isAdmin(userId)
+	if err != nil {
+		return err
+	}
+
+	keys, err := c.listTrustedKeys()
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if key.Id == id {
+			return c.database.GetGlobalOps().DeleteGlobalConfig(id)
+		}
+	}
+
+	return fmt.Errorf("trusted key not found: %d", id)
+}
+
+func (c *Controller) listTrustedKeys() ([]TrustedKey, error) {
+	configs, err := c.database.GetGlobalOps().ListGlobalConfigs(publisherKeysGroup, 0, 1000)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]TrustedKey, 0, len(configs))
+	for _, config := range configs {
+		value := trustedKeyValue{}
+		json.Unmarshal([]byte(config.Value), &value)
+
+		keys = append(keys, TrustedKey{
+			Id:      config.ID,
+			KeyId:   config.Key,
+			Name:    value.Name,
+			AddedBy: value.AddedBy,
+			AddedAt: value.AddedAt,
+		})
+	}
+
+	return keys, nil
+}
+
+func (c *Controller) isTrustedKey(keyId string) (bool, error) {
+	keys, err := c.listTrustedKeys()
+	if err != nil {
+		return false, err
+	}
+
+	for _, key := range keys {
+		if key.KeyId == keyId {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// verifyPackage refuses packages that are unsigned, signed by an unknown
+// key or do not match their checksum, an admin can push through with
+// allowUnsigned
+func (c *Controller) verifyPackage(userId int64, pf *repotypes.PackageFile, allowUnsigned bool) error {
+	if pf.Builtin {
+		return nil
+	}
+
+	problem := c.packageProblem(pf)
+	if problem == nil {
+		return nil
+	}
+
+	if !allowUnsigned {
+		return fmt.Errorf("%w: %s", ErrPackageNotTrusted, problem.Error())
+	}
+
+	err := c.isAdmin(userId)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrPackageNotTrusted, problem.Error())
+	}
+
+	c.logger.Warn("installing unverified package", "user_id", userId, "problem", problem.Error())
+
+	return nil
+}
+
+func (c *Controller) packageProblem(pf *repotypes.PackageFile) error {
+	if pf.SignatureErr != nil {
+		return pf.SignatureErr
+	}
+
+	if pf.SignedBy == "" || pf.Checksum == "" {
+		return reposign.ErrUnsigned
+	}
+
+	digest, err := reposign.DigestFile(pf.Path)
+	if err != nil {
+		return err
+	}
+
+	// indexes may list the hex digest in upper case
+	if !strings.EqualFold(digest, pf.Checksum) {
+		return reposign.ErrChecksumMismatch
+	}
+
+	trusted, err := c.isTrustedKey(pf.SignedBy)
+	if err != nil {
+		return err
+	}
+
+	if !trusted {
+		return fmt.Errorf("%w: %s", reposign.ErrUntrustedKey, pf.SignedBy)
+	}
+
+	return nil
+}
+
+// VerifyPackageZip checks an uploaded zip against its detached signature,
+// rawSignature is the .sig content and may be empty
+func (c *Controller) VerifyPackageZip(userId int64, file string, rawSignature string, allowUnsigned bool) error {
+	pf := &repotypes.PackageFile{Path: file}
+
+	if rawSignature != "" {
+		c.fillDetachedSignature(pf, []byte(rawSignature))
+	}
+
+	return c.verifyPackage(userId, pf, allowUnsigned)
+}
+
+// fillDetachedSignature checks a zip signature and records the result the
+// same way a signed repo index would
+func (c *Controller) fillDetachedSignature(pf *repotypes.PackageFile, rawSignature []byte) {
+	sig, err := reposign.ParseSignature(rawSignature)
+	if err != nil {
+		pf.SignatureErr = err
+		return
+	}
+
+	digest, err := reposign.DigestFile(pf.Path)
+	if err != nil {
+		pf.SignatureErr = err
+		return
+	}
+
+	err = reposign.Verify(sig, digest)
+	if err != nil {
+		pf.SignatureErr = err
+		return
+	}
+
+	pf.Checksum = digest
+	pf.SignedBy = sig.KeyId()
+}
+
+// fetchDetachedSignature gets <url>.sig, a missing one is not an error
+func fetchDetachedSignature(url string) ([]byte, error) {
+	resp, err := http.Get(url + reposign.SignatureSuffix)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+}
@@ -0,0 +1,94 @@
+package actions
+
+import (
+	"errors"
+
+	"github.com/blue-monads/potatoverse/backend/engine/hubs/repohub"
+)
+
+var _ repohub.PackageUpgrader = (*Controller)(nil)
+
+var ErrPackageNotFromRepo = errors.New("package was not installed from a repo")
+
+// ListPackageUpdates returns what the last update check found
+func (c *Controller) ListPackageUpdates(userId int64) ([]repohub.PackageUpdate, error) {
+	err := c.isAdmin(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	pops := c.database.GetPackageInstallOps()
+
+	pkgs, err := pops.ListPackages()
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make([]repohub.PackageUpdate, 0)
+	for _, pkg := range pkgs {
+		if pkg.AvailableVersion == "" {
+			continue
+		}
+
+		current := ""
+		pversion, err := pops.GetPackageVersion(pkg.ActiveInstallID)
+		if err == nil {
+			current = pversion.Version
+		}
+
+		updates = append(updates, repohub.PackageUpdate{
+			PackageId:      pkg.ID,
+			Name:           pkg.Name,
+			Slug:           pkg.Slug,
+			RepoSlug:       pkg.InstallRepo,
+			CurrentVersion: current,
+			LatestVersion:  pkg.AvailableVersion,
+			AutoUpgrade:    pkg.AutoUpgrade,
+		})
+	}
+
+	return updates, nil
+}
+
+// CheckPackageUpdates runs an update check now instead of waiting for the
+// next scheduled one
+func (c *Controller) CheckPackageUpdates(userId int64) ([]repohub.PackageUpdate, error) {
+	err := c.isAdmin(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.engine.GetRepoHub().CheckUpdates()
+}
+
+func (c *Controller) SetPackageAutoUpgrade(userId int64, packageId int64, enabled bool) error {
+	err := c.isAdmin(userId)
+	if err != nil {
+		return err
+	}
+
+	pkg, err := c.database.GetPackageInstallOps().GetPackage(packageId)
+	if err != nil {
+		return err
+	}
+
+	if pkg.InstallRepo == "" && enabled {
+		return ErrPackageNotFromRepo
+	}
+
+	return c.database.GetPackageInstallOps().UpdatePackageData(packageId, map[string]any{
+		"auto_upgrade": enabled,
+	})
+}
+
+// AutoUpgradePackage is called by the update checker, it upgrades as the
+// user who installed the package and never skips verification
+func (c *Controller) AutoUpgradePackage(installedId int64, repoSlug string, version string) error {
+	pkg, err := c.database.GetPackageInstallOps().GetPackage(installedId)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.UpgradePackageRepo(pkg.InstalledBy, repoSlug, version, installedId, false)
+	return err
+}
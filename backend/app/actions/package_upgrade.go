@@ -3,9 +3,12 @@ package actions
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"sort"
 
+	"github.com/blue-monads/potatoverse/backend/engine/hubs/repohub"
+	"github.com/blue-monads/potatoverse/backend/services/datahub/dbmodels"
 	xutils "github.com/blue-monads/potatoverse/backend/utils"
 	"github.com/blue-monads/potatoverse/backend/xtypes/models"
 )
@@ -18,7 +21,7 @@ type UpgradePackageResult struct {
 	RootSpaceId      int64             `json:"root_space_id"`
 }
 
-func (c *Controller) UpgradePackageRepo(userId int64, repoSlug, version string, installedId int64) (*UpgradePackageResult, error) {
+func (c *Controller) UpgradePackageRepo(userId int64, repoSlug, version string, installedId int64, allowUnsigned bool) (*UpgradePackageResult, error) {
 
 	pkg, err := c.database.GetPackageInstallOps().GetPackage(installedId)
 	if err != nil {
@@ -28,41 +31,151 @@ func (c *Controller) UpgradePackageRepo(userId int64, repoSlug, version string,
 	packageSlug := pkg.Slug
 
 	rhub := c.engine.GetRepoHub()
-	file, err := rhub.ZipPackage(repoSlug, packageSlug, version)
+	pf, err := rhub.ZipPackage(repoSlug, packageSlug, version)
 	if err != nil {
 		return nil, err
 	}
 
-	defer os.Remove(file)
+	defer os.Remove(pf.Path)
 
-	return c.UpgradePackage(userId, file, installedId, true)
+	err = c.verifyPackage(userId, pf, allowUnsigned)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.UpgradePackage(userId, pf.Path, installedId, true)
 
 }
 
+// UpgradePackage snapshots package data first, when the upgrade fails the
+// previous version and its data are put back
 func (c *Controller) UpgradePackage(userId int64, file string, installedId int64, recreateArtifacts bool) (*UpgradePackageResult, error) {
+	pops := c.database.GetPackageInstallOps()
 
-	pvid, err := c.database.GetPackageInstallOps().UpdatePackage(installedId, file)
+	ipkg, err := pops.GetPackage(installedId)
 	if err != nil {
 		return nil, err
 	}
 
-	rawPkg, err := xutils.GetPackageManifest(file)
+	snapshotId, err := pops.SnapshotPackageData(installedId, ipkg.ActiveInstallID, SnapshotReasonUpgrade)
+	if err != nil {
+		return nil, fmt.Errorf("could not snapshot package data: %w", err)
+	}
+
+	result, pvid, err := c.upgradePackage(userId, file, installedId, recreateArtifacts)
 	if err != nil {
+		c.logger.Error("upgrade failed, reverting", "installed_id", installedId, "error", err)
+
+		rerr := c.revertUpgrade(userId, installedId, ipkg.ActiveInstallID, pvid, snapshotId)
+		if rerr != nil {
+			c.logger.Error("could not revert failed upgrade", "installed_id", installedId, "error", rerr)
+			return nil, fmt.Errorf("%w (revert failed: %s)", err, rerr.Error())
+		}
+
 		return nil, err
 	}
 
+	c.pruneSnapshots(installedId)
+
+	return result, nil
+}
+
+func (c *Controller) upgradePackage(userId int64, file string, installedId int64, recreateArtifacts bool) (*UpgradePackageResult, int64, error) {
+
+	pvid, err := c.database.GetPackageInstallOps().UpdatePackage(installedId, file)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rawPkg, err := xutils.GetPackageManifest(file)
+	if err != nil {
+		return nil, pvid, err
+	}
+
 	pkg := &models.PotatoPackage{}
 	err = json.Unmarshal(rawPkg, pkg)
 	if err != nil {
-		return nil, err
+		return nil, pvid, err
 	}
 
+	oldSpaces, err := c.syncPackageSpaces(userId, installedId, pkg.Spaces, recreateArtifacts)
+	if err != nil {
+		return nil, pvid, err
+	}
+
+	pops := c.database.GetPackageInstallOps()
+	err = pops.UpdateActiveInstallId(installedId, pvid)
+	if err != nil {
+		return nil, pvid, err
+	}
+
+	// reaching the version the update checker found clears it
+	installed, err := pops.GetPackage(installedId)
+	if err == nil && installed.AvailableVersion != "" && repohub.CompareVersions(pkg.Version, installed.AvailableVersion) >= 0 {
+		pops.UpdatePackageData(installedId, map[string]any{"available_version": ""})
+	}
+
+	// delete old versions, keeping 3 latest versions
+
+	allPVersions, err := pops.ListPackageVersionsByPackageId(installedId)
+	if err != nil {
+		return nil, pvid, err
+	}
+
+	if len(allPVersions) > 3 {
+		sort.Slice(allPVersions, func(i, j int) bool {
+			return allPVersions[i].ID > allPVersions[j].ID
+		})
+
+		for _, pversion := range allPVersions[3:] {
+			err = pops.DeletePackageVersion(pversion.ID)
+			if err != nil {
+				c.logger.Error("failed to delete old package version", "error", err)
+				continue
+			}
+		}
+	}
+
+	c.engine.LoadRoutingIndexForPackages(installedId)
+
+	rootSpaceId := int64(0)
+	for _, s := range oldSpaces {
+		if s.NamespaceKey == pkg.Slug {
+			rootSpaceId = s.ID
+			break
+		}
+	}
+
+	pversion, err := pops.GetPackageVersion(pvid)
+	if err != nil {
+		return nil, pvid, err
+	}
+
+	specialPages := map[string]string{}
+	err = json.Unmarshal([]byte(pversion.SpecialPages), &specialPages)
+	if err != nil {
+		return nil, pvid, err
+	}
+
+	return &UpgradePackageResult{
+		PackageVersionId: pvid,
+		SpecialPages:     specialPages,
+		KeySpace:         pkg.Slug,
+		RootSpaceId:      rootSpaceId,
+	}, pvid, nil
+
+}
+
+// syncPackageSpaces makes the package spaces match the manifest, spaces the
+// manifest no longer has are left alone so their data is kept. it returns the
+// spaces as they were before.
+func (c *Controller) syncPackageSpaces(userId int64, installedId int64, spaces []models.PotatoSpace, recreateArtifacts bool) ([]dbmodels.Space, error) {
 	oldSpaces, err := c.database.GetSpaceOps().ListSpacesByPackageId(installedId)
 	if err != nil {
 		return nil, err
 	}
 
-	for _, space := range pkg.Spaces {
+	for _, space := range spaces {
 		currentArtifactIndex := -1
 
 		for i, oldSpace := range oldSpaces {
@@ -116,59 +229,5 @@ func (c *Controller) UpgradePackage(userId int64, file string, installedId int64
 
 	}
 
-	pops := c.database.GetPackageInstallOps()
-	err = pops.UpdateActiveInstallId(installedId, pvid)
-	if err != nil {
-		return nil, err
-	}
-
-	// delete old versions, keeping 3 latest versions
-
-	allPVersions, err := pops.ListPackageVersionsByPackageId(installedId)
-	if err != nil {
-		return nil, err
-	}
-
-	if len(allPVersions) > 3 {
-		sort.Slice(allPVersions, func(i, j int) bool {
-			return allPVersions[i].ID > allPVersions[j].ID
-		})
-
-		for _, pversion := range allPVersions[3:] {
-			err = pops.DeletePackageVersion(pversion.ID)
-			if err != nil {
-				c.logger.Error("failed to delete old package version", "error", err)
-				continue
-			}
-		}
-	}
-
-	c.engine.LoadRoutingIndexForPackages(installedId)
-
-	rootSpaceId := int64(0)
-	for _, s := range oldSpaces {
-		if s.NamespaceKey == pkg.Slug {
-			rootSpaceId = s.ID
-			break
-		}
-	}
-
-	pversion, err := pops.GetPackageVersion(pvid)
-	if err != nil {
-		return nil, err
-	}
-
-	specialPages := map[string]string{}
-	err = json.Unmarshal([]byte(pversion.SpecialPages), &specialPages)
-	if err != nil {
-		return nil, err
-	}
-
-	return &UpgradePackageResult{
-		PackageVersionId: pvid,
-		SpecialPages:     specialPages,
-		KeySpace:         pkg.Slug,
-		RootSpaceId:      rootSpaceId,
-	}, nil
-
+	return oldSpaces, nil
 }
@@ -0,0 +1,237 @@
+package actions
+
+import (
+	"errors"
+	"time"
+
+	"github.com/blue-monads/potatoverse/backend/services/datahub/dbmodels"
+	"github.com/blue-monads/potatoverse/backend/services/signer"
+)
+
+/*
+
+sessions are UserDevices rows of dtype session. login hands out a short lived
+access token and a refresh token, both carry the device id. every refresh
+rotates the refresh token, token_hash always holds the latest one. revoking
+a device sets revoked_at and tells the signer, so access tokens already out
+stop working right away instead of when they expire.
+
+*/
+
+var (
+	ErrSessionRevoked     = errors.New("session revoked")
+	ErrSessionExpired     = errors.New("session expired")
+	ErrRefreshTokenReused = errors.New("refresh token reused, session revoked")
+	ErrRefreshRotated     = errors.New("refresh token already rotated")
+	ErrUserDisabled       = errors.New("user is disabled")
+)
+
+// concurrent refreshes (two tabs) within this window get ErrRefreshRotated
+// instead of revoking the session
+const refreshReuseGrace = 30 * time.Second
+
+// used for expires_on when refresh tokens never expire
+const noExpiry = 10 * 365 * 24 * time.Hour
+
+func (c *Controller) sessionExpiry(now time.Time) time.Time {
+	ttl := c.signer.TTL(signer.TokenTypeRefresh)
+	if ttl == 0 {
+		ttl = noExpiry
+	}
+	return now.Add(ttl)
+}
+
+// issueSession signs a new access and refresh token pair for the device and
+// rotates its token_hash
+func (c *Controller) issueSession(user *dbmodels.User, deviceId int64, clientIP string) (*LoginResponse, error) {
+	accessToken, err := c.signer.SignAccess(&signer.AccessClaim{
+		UserId:   user.ID,
+		DeviceId: deviceId,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := c.signer.SignRefresh(&signer.RefreshClaim{
+		UserId:   user.ID,
+		DeviceId: deviceId,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	uops := c.database.GetUserOps()
+
+	device, err := uops.GetUserDevice(deviceId)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	err = uops.UpdateUserDevice(deviceId, map[string]any{
+		"token_hash":      HashToken(refreshToken),
+		"prev_token_hash": device.TokenHash,
+		"last_ip":         clientIP,
+		"last_login":      now.Format(time.RFC3339),
+		"expires_on":      c.sessionExpiry(now),
+		"updated_at":      now,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	user.Password = ""
+	user.ExtraMeta = ""
+
+	return &LoginResponse{
+		AccessToken:    accessToken,
+		RefreshToken:   refreshToken,
+		ExpiresIn:      int64(c.signer.TTL(signer.TokenTypeAccess).Seconds()),
+		UserInfo:       user,
+		PortalPageType: "login",
+	}, nil
+}
+
+// RefreshSession trades a refresh token for a new token pair. a refresh
+// token that was already rotated means it leaked or was replayed, the whole
+// session is revoked then.
+func (c *Controller) RefreshSession(refreshToken string, clientIP string) (*LoginResponse, error) {
+	claim, err := c.signer.ParseRefresh(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	uops := c.database.GetUserOps()
+
+	device, err := uops.GetUserDevice(claim.DeviceId)
+	if err != nil || device.UserId != claim.UserId {
+		return nil, ErrSessionRevoked
+	}
+
+	if device.RevokedAt != nil {
+		return nil, ErrSessionRevoked
+	}
+
+	if device.ExpiresOn != nil && time.Now().After(*device.ExpiresOn) {
+		return nil, ErrSessionExpired
+	}
+
+	hash := HashToken(refreshToken)
+	if device.TokenHash != hash {
+		if hash == device.PrevTokenHash && device.UpdatedAt != nil && time.Since(*device.UpdatedAt) < refreshReuseGrace {
+			return nil, ErrRefreshRotated
+		}
+
+		c.logger.Warn("refresh token reused, revoking session", "user_id", device.UserId, "device_id", device.ID)
+
+		err = c.revokeDevices([]dbmodels.UserDevice{*device})
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, ErrRefreshTokenReused
+	}
+
+	user, err := uops.GetUser(claim.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Disabled || user.IsDeleted {
+		return nil, ErrUserDisabled
+	}
+
+	return c.issueSession(user, device.ID, clientIP)
+}
+
+// Logout revokes the session the access token belongs to
+func (c *Controller) Logout(userId int64, deviceId int64) error {
+	if deviceId == 0 {
+		return nil
+	}
+
+	return c.RevokeSelfDevice(userId, deviceId)
+}
+
+// LogoutAll revokes every session and device token of the user
+func (c *Controller) LogoutAll(userId int64) error {
+	devices, err := c.database.GetUserOps().ListUserDevice(userId)
+	if err != nil {
+		return err
+	}
+
+	return c.revokeDevices(devices)
+}
+
+func (c *Controller) RevokeSelfDevice(userId int64, deviceId int64) error {
+	device, err := c.database.GetUserOps().GetUserDevice(deviceId)
+	if err != nil {
+		return err
+	}
+
+	if device.UserId != userId {
+		return ErrUserNotAllowed
+	}
+
+	if device.RevokedAt != nil {
+		return nil
+	}
+
+	return c.revokeDevices([]dbmodels.UserDevice{*device})
+}
+
+// RevokeUserSessions is logout-all of another user, for admins
+func (c *Controller) RevokeUserSessions(adminId int64, userId int64) error {
+	err := c.isAdmin(adminId)
+	if err != nil {
+		return err
+	}
+
+	return c.LogoutAll(userId)
+}
+
+func (c *Controller) revokeDevices(devices []dbmodels.UserDevice) error {
+	uops := c.database.GetUserOps()
+	now := time.Now()
+
+	for _, device := range devices {
+		err := uops.UpdateUserDevice(device.ID, map[string]any{
+			"revoked_at": now,
+			"updated_at": now,
+		})
+		if err != nil {
+			return err
+		}
+
+		c.signer.RevokeDevice(device.ID, now)
+	}
+
+	return nil
+}
+
+// LoadRevokedDevices hands devices revoked while their access tokens could
+// still be alive to the signer, older revoked rows are deleted
+func (c *Controller) LoadRevokedDevices() error {
+	uops := c.database.GetUserOps()
+
+	devices, err := uops.ListRevokedUserDevices()
+	if err != nil {
+		return err
+	}
+
+	ttl := c.signer.TTL(signer.TokenTypeAccess)
+
+	for _, device := range devices {
+		if ttl != 0 && time.Since(*device.RevokedAt) > ttl {
+			err = uops.DeleteUserDevice(device.ID)
+			if err != nil {
+				c.logger.Warn("failed to delete revoked device", "device_id", device.ID, "error", err)
+			}
+			continue
+		}
+
+		c.signer.RevokeDevice(device.ID, *device.RevokedAt)
+	}
+
+	return nil
+}
@@ -1,11 +1,21 @@
 package actions
 
 import (
+	"encoding/json"
+	"errors"
+
+	"github.com/blue-monads/potatoverse/backend/engine/hubs/eventhub/rengine"
+	"github.com/blue-monads/potatoverse/backend/engine/hubs/eventhub/transform"
 	"github.com/blue-monads/potatoverse/backend/services/datahub/dbmodels"
 )
 
 func (c *Controller) CreateEventSubscription(installId int64, data *dbmodels.MQSubscription) (*dbmodels.MQSubscription, error) {
 
+	err := rengine.ValidateRules(data.Rules)
+	if err != nil {
+		return nil, err
+	}
+
 	id, err := c.database.GetSpaceOps().AddEventSubscription(installId, data)
 	if err != nil {
 		return nil, err
@@ -24,6 +34,13 @@ func (c *Controller) UpdateEventSubscriptionByID(installId int64, eventSubscript
 		return nil, err
 	}
 
+	if rules, ok := data["rules"].(string); ok {
+		err = rengine.ValidateRules(rules)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Update
 	err = c.database.GetSpaceOps().UpdateEventSubscription(installId, eventSubscriptionId, data)
 	if err != nil {
@@ -52,3 +69,103 @@ func (c *Controller) QueryEventSubscriptions(installId int64, cond map[any]any)
 func (c *Controller) GetEventSubscriptionByID(installId int64, eventSubscriptionId int64) (*dbmodels.MQSubscription, error) {
 	return c.database.GetSpaceOps().GetEventSubscription(installId, eventSubscriptionId)
 }
+
+// dead letter
+
+func (c *Controller) QueryDeadEventTargets(installId int64, subscriptionId int64, offset int, limit int) ([]dbmodels.MQEventTarget, error) {
+	return c.database.GetMQSynk().QueryDeadTargets(installId, subscriptionId, offset, limit)
+}
+
+func (c *Controller) ListEventTargetAttempts(installId int64, targetId int64) ([]dbmodels.MQEventTargetAttempt, error) {
+	sink := c.database.GetMQSynk()
+
+	// make sure the target belongs to the install
+	if err := c.verifyEventTargetInstall(installId, targetId); err != nil {
+		return nil, err
+	}
+
+	return sink.ListTargetAttempts(targetId)
+}
+
+func (c *Controller) ReplayDeadEventTargets(installId int64, subscriptionId int64, targetIds []int64) ([]int64, error) {
+	ids, err := c.database.GetMQSynk().ReplayDeadTargets(installId, subscriptionId, targetIds)
+	if err != nil {
+		return nil, err
+	}
+
+	c.engine.WakeEventHub()
+
+	return ids, nil
+}
+
+func (c *Controller) DiscardDeadEventTargets(installId int64, subscriptionId int64, targetIds []int64) ([]int64, error) {
+	return c.database.GetMQSynk().DiscardDeadTargets(installId, subscriptionId, targetIds)
+}
+
+func (c *Controller) verifyEventTargetInstall(installId int64, targetId int64) error {
+	sink := c.database.GetMQSynk()
+
+	target, err := sink.GetEventTarget(targetId)
+	if err != nil {
+		return err
+	}
+
+	event, err := sink.GetEvent(target.EventID)
+	if err != nil {
+		return err
+	}
+
+	if event.InstallID != installId {
+		return errors.New("event target not found")
+	}
+
+	return nil
+}
+
+type EventDryRunResult struct {
+	RulesMatch bool            `json:"rules_match"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+// DryRunEventSubscription runs the rules and transform of a subscription on a
+// sample payload without dispatching anything. Stored event is used when
+// eventId is set, rules and transform overrides preview unsaved edits.
+func (c *Controller) DryRunEventSubscription(installId int64, subscriptionId int64, eventId int64, payload []byte, rules, transformSpec *string) (*EventDryRunResult, error) {
+	sub, err := c.GetEventSubscriptionByID(installId, subscriptionId)
+	if err != nil {
+		return nil, err
+	}
+
+	if eventId != 0 {
+		event, err := c.database.GetMQSynk().GetEvent(eventId)
+		if err != nil {
+			return nil, err
+		}
+		if event.InstallID != installId {
+			return nil, errors.New("event not found")
+		}
+		payload = event.Payload
+	}
+
+	if rules == nil {
+		rules = &sub.Rules
+	}
+	if transformSpec == nil {
+		transformSpec = &sub.Transform
+	}
+
+	ok, err := rengine.RuleEngine(*rules, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := transform.Apply(*transformSpec, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EventDryRunResult{
+		RulesMatch: ok,
+		Payload:    out,
+	}, nil
+}
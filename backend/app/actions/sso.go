@@ -0,0 +1,414 @@
+package actions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/blue-monads/potatoverse/backend/services/datahub/dbmodels"
+	"github.com/blue-monads/potatoverse/backend/services/oidc"
+	"github.com/blue-monads/potatoverse/backend/services/signer"
+	xutils "github.com/blue-monads/potatoverse/backend/utils"
+	"github.com/blue-monads/potatoverse/backend/xtypes"
+)
+
+/*
+
+sso login through external openid connect providers (AppOptions.oidc). the
+callback resolves the idp account to a user, by an already linked
+UserIdentities row, then by verified email, else a new user is provisioned.
+the browser gets a login challenge (purpose sso) which is exchanged like a
+password login, so local 2fa still applies.
+
+*/
+
+const challengeSSO = "sso"
+
+var (
+	ErrSSOProviderNotFound = errors.New("sso provider not found")
+	ErrSSOStateMismatch    = errors.New("sso login state mismatch, try again")
+	ErrSSONoAccount        = errors.New("no account is linked to this sso login")
+)
+
+var ssoUsernameRegex = regexp.MustCompile(`^[a-zA-Z0-9_.-]{2,64}$`)
+
+type ssoProvider struct {
+	opts   xtypes.OIDCOptions
+	client *oidc.Provider
+}
+
+type SSOProviderInfo struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+}
+
+func (c *Controller) buildSSOProviders() map[string]*ssoProvider {
+	providers := make(map[string]*ssoProvider)
+	if c.AppOpts == nil {
+		return providers
+	}
+
+	for _, opts := range c.AppOpts.OIDC {
+		if opts.Name == "" || opts.Issuer == "" || opts.ClientId == "" {
+			c.logger.Warn("skipping incomplete oidc provider", "name", opts.Name)
+			continue
+		}
+
+		scopes := opts.Scopes
+		if len(scopes) == 0 {
+			scopes = []string{"openid", "email", "profile"}
+		}
+
+		redirectURL := opts.RedirectURL
+		if redirectURL == "" && len(c.AppOpts.Hosts) > 0 {
+			redirectURL = xutils.GetFullUrl(c.AppOpts.Hosts[0].Name, "/zz/api/core/auth/oidc/"+opts.Name+"/callback", c.AppOpts.Port, false)
+		}
+
+		providers[opts.Name] = &ssoProvider{
+			opts: opts,
+			client: oidc.New(oidc.Options{
+				Issuer:       opts.Issuer,
+				ClientId:     opts.ClientId,
+				ClientSecret: opts.ClientSecret,
+				RedirectURL:  redirectURL,
+				Scopes:       scopes,
+			}),
+		}
+	}
+
+	return providers
+}
+
+func (c *Controller) ListSSOProviders() []SSOProviderInfo {
+	out := make([]SSOProviderInfo, 0, len(c.ssoProviders))
+	if c.AppOpts == nil {
+		return out
+	}
+
+	for _, opts := range c.AppOpts.OIDC {
+		if _, ok := c.ssoProviders[opts.Name]; !ok {
+			continue
+		}
+
+		display := opts.DisplayName
+		if display == "" {
+			display = opts.Name
+		}
+		out = append(out, SSOProviderInfo{Name: opts.Name, DisplayName: display})
+	}
+	return out
+}
+
+// StartSSO returns the provider login url and the state the caller keeps
+// in a cookie until the callback
+func (c *Controller) StartSSO(ctx context.Context, providerName, redirect string) (string, string, error) {
+	provider := c.ssoProviders[providerName]
+	if provider == nil {
+		return "", "", ErrSSOProviderNotFound
+	}
+
+	state, err := oidc.RandomString()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := oidc.RandomString()
+	if err != nil {
+		return "", "", err
+	}
+
+	authURL, err := provider.client.AuthURL(ctx, state, nonce, oidc.PKCEChallenge(verifier))
+	if err != nil {
+		return "", "", err
+	}
+
+	stateToken, err := c.signer.SignOIDCState(&signer.OIDCStateClaim{
+		Provider: providerName,
+		State:    state,
+		Nonce:    nonce,
+		Verifier: verifier,
+		Redirect: safeRedirect(redirect),
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return authURL, stateToken, nil
+}
+
+type CompleteSSOOpts struct {
+	Provider   string
+	Code       string
+	State      string
+	StateToken string // from the cookie set by StartSSO
+}
+
+type CompleteSSOResult struct {
+	ChallengeToken string
+	Redirect       string
+}
+
+// CompleteSSO handles the provider callback, the returned challenge is
+// exchanged for a session with ExchangeSSOChallenge
+func (c *Controller) CompleteSSO(ctx context.Context, opts *CompleteSSOOpts) (*CompleteSSOResult, error) {
+	provider := c.ssoProviders[opts.Provider]
+	if provider == nil {
+		return nil, ErrSSOProviderNotFound
+	}
+
+	stateClaim, err := c.signer.ParseOIDCState(opts.StateToken)
+	if err != nil || stateClaim.Provider != opts.Provider || stateClaim.State == "" || stateClaim.State != opts.State {
+		return nil, ErrSSOStateMismatch
+	}
+
+	tokens, err := provider.client.Exchange(ctx, opts.Code, stateClaim.Verifier)
+	if err != nil {
+		c.logger.Warn("oidc token exchange failed", "provider", opts.Provider, "error", err)
+		return nil, oidc.ErrTokenExchange
+	}
+
+	claims, err := provider.client.VerifyIDToken(ctx, tokens.IDToken, stateClaim.Nonce)
+	if err != nil {
+		c.logger.Warn("oidc id token rejected", "provider", opts.Provider, "error", err)
+		return nil, oidc.ErrInvalidIDToken
+	}
+
+	// google and others leave email and groups to userinfo
+	if claims.Email == "" || len(claims.Strings(provider.groupsClaim())) == 0 {
+		info, err := provider.client.UserInfo(ctx, tokens.AccessToken)
+		if err != nil {
+			c.logger.Warn("oidc userinfo failed", "provider", opts.Provider, "error", err)
+		} else {
+			claims.Merge(info)
+		}
+	}
+
+	user, err := c.resolveSSOUser(provider, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	display := provider.opts.DisplayName
+	if display == "" {
+		display = provider.opts.Name
+	}
+
+	challenge, err := c.signer.SignLoginChallenge(&signer.LoginChallengeClaim{
+		UserId:     user.ID,
+		Purpose:    challengeSSO,
+		DeviceName: fmt.Sprintf("SSO (%s)", display),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &CompleteSSOResult{
+		ChallengeToken: challenge,
+		Redirect:       stateClaim.Redirect,
+	}, nil
+}
+
+// ExchangeSSOChallenge finishes an sso login like a password login, users
+// with 2fa get a verify challenge back
+func (c *Controller) ExchangeSSOChallenge(challengeToken string, clientIP string) (*LoginResponse, error) {
+	claim, user, err := c.parseChallenge(challengeToken, challengeSSO)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.finishLogin(user, &LoginOpts{
+		DeviceName: claim.DeviceName,
+		ClientIP:   clientIP,
+	})
+}
+
+func (c *Controller) ListSelfIdentities(userId int64) ([]dbmodels.UserIdentity, error) {
+	return c.database.GetUserOps().ListUserIdentities(userId)
+}
+
+func (c *Controller) UnlinkSelfIdentity(userId int64, id int64) error {
+	return c.database.GetUserOps().DeleteUserIdentity(userId, id)
+}
+
+// private
+
+func (c *Controller) resolveSSOUser(provider *ssoProvider, claims *oidc.Claims) (*dbmodels.User, error) {
+	uops := c.database.GetUserOps()
+	now := time.Now()
+
+	var user *dbmodels.User
+
+	identity, err := uops.GetUserIdentity(provider.opts.Name, claims.Subject)
+	if err == nil && identity != nil {
+		user, err = uops.GetUser(identity.UserId)
+		if err != nil {
+			return nil, ErrSSONoAccount
+		}
+
+		err = uops.UpdateUserIdentity(identity.ID, map[string]any{
+			"email":      claims.Email,
+			"last_login": now,
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		user, err = c.linkOrProvisionSSOUser(provider, claims)
+		if err != nil {
+			return nil, err
+		}
+
+		if user.Disabled || user.IsDeleted {
+			return nil, ErrUserDisabled
+		}
+
+		_, err = uops.AddUserIdentity(&dbmodels.UserIdentity{
+			UserId:    user.ID,
+			Provider:  provider.opts.Name,
+			Subject:   claims.Subject,
+			Email:     claims.Email,
+			LastLogin: &now,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if user.Disabled || user.IsDeleted {
+		return nil, ErrUserDisabled
+	}
+
+	ugroup := provider.mapGroup(claims)
+	if ugroup != "" && ugroup != user.Ugroup {
+		err = c.setSSOUgroup(user, ugroup)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+func (c *Controller) linkOrProvisionSSOUser(provider *ssoProvider, claims *oidc.Claims) (*dbmodels.User, error) {
+	uops := c.database.GetUserOps()
+
+	emailTrusted := claims.EmailVerified || provider.opts.TrustUnverifiedEmail
+
+	if claims.Email != "" && emailTrusted {
+		user, err := uops.GetUserByEmail(claims.Email)
+		if err == nil && user != nil {
+			c.logger.Info("linking sso identity by email", "provider", provider.opts.Name, "user_id", user.ID)
+			return user, nil
+		}
+	}
+
+	if provider.opts.DisableProvisioning {
+		return nil, ErrSSONoAccount
+	}
+
+	// an untrusted email could belong to an existing user, never reuse it
+	if claims.Email == "" || !emailTrusted {
+		return nil, ErrSSONoAccount
+	}
+
+	ugroup := provider.mapGroup(claims)
+	if ugroup == "" {
+		ugroup = provider.opts.DefaultGroup
+	}
+	if ugroup == "" {
+		ugroup = "normal"
+	}
+
+	name := claims.Name
+	if name == "" {
+		name = strings.Split(claims.Email, "@")[0]
+	}
+
+	var username *string
+	if ssoUsernameRegex.MatchString(claims.PreferredUsername) {
+		existing, err := uops.GetUserByUsername(claims.PreferredUsername)
+		if err != nil || existing == nil {
+			username = &claims.PreferredUsername
+		}
+	}
+
+	// sso users log in through the provider, the random password only
+	// matters after a password reset
+	password, err := xutils.GenerateRandomString(32)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := c.addUser(&dbmodels.User{
+		Name:       name,
+		Email:      claims.Email,
+		Username:   username,
+		Utype:      "user",
+		Ugroup:     ugroup,
+		Password:   password,
+		IsVerified: true,
+		ExtraMeta:  "{}",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.logger.Info("provisioned sso user", "provider", provider.opts.Name, "user_id", id, "ugroup", ugroup)
+
+	return uops.GetUser(id)
+}
+
+func (c *Controller) setSSOUgroup(user *dbmodels.User, ugroup string) error {
+	_, err := c.database.GetUserOps().GetUserGroup(ugroup)
+	if err != nil {
+		c.logger.Warn("sso group map points to unknown ugroup", "ugroup", ugroup)
+		return nil
+	}
+
+	err = c.database.GetUserOps().UpdateUser(user.ID, map[string]any{
+		"ugroup": ugroup,
+	})
+	if err != nil {
+		return err
+	}
+
+	c.logger.Info("sso group mapping changed ugroup", "user_id", user.ID, "from", user.Ugroup, "to", ugroup)
+	user.Ugroup = ugroup
+
+	return nil
+}
+
+func (p *ssoProvider) groupsClaim() string {
+	if p.opts.GroupsClaim != "" {
+		return p.opts.GroupsClaim
+	}
+	return "groups"
+}
+
+// mapGroup returns the ugroup of the first group map entry the user has,
+// empty when none match
+func (p *ssoProvider) mapGroup(claims *oidc.Claims) string {
+	groups := claims.Strings(p.groupsClaim())
+	for _, m := range p.opts.GroupMap {
+		if slices.Contains(groups, m.Group) {
+			return m.Ugroup
+		}
+	}
+	return ""
+}
+
+// safeRedirect only keeps local paths, so the sso flow can't be used as an
+// open redirect
+func safeRedirect(redirect string) string {
+	if !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") || strings.HasPrefix(redirect, "/\\") {
+		return ""
+	}
+	return redirect
+}
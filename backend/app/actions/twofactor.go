@@ -0,0 +1,587 @@
+package actions
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blue-monads/potatoverse/backend/services/datahub/dbmodels"
+	"github.com/blue-monads/potatoverse/backend/services/signer"
+	"github.com/blue-monads/potatoverse/backend/utils/passhash"
+	"github.com/blue-monads/potatoverse/backend/utils/totp"
+)
+
+/*
+
+two factor state lives in the user's UserConfig under the reserved __auth
+group, packages can not read or touch it. a user with 2fa enabled gets a
+short lived challenge token instead of a session after the password step and
+trades it plus a totp or recovery code for the session. groups can require
+2fa (UserGroupConfig require_2fa), users of such a group without 2fa enrolled
+get an enroll challenge and have to set it up before they get a session.
+
+*/
+
+const (
+	AuthConfigGroup = "__auth"
+
+	authKeyTotpSecret        = "totp_secret"
+	authKeyTotpPendingSecret = "totp_pending_secret"
+	authKeyTotpEnabled       = "totp_enabled"
+	authKeyTotpLastStep      = "totp_last_step"
+	authKeyRecoveryCodes     = "recovery_codes"
+
+	groupKeyRequire2FA = "require_2fa"
+
+	challengeVerify = "verify"
+	challengeEnroll = "enroll"
+
+	recoveryCodeCount = 10
+
+	maxTwoFactorFailures = 5
+	twoFactorLockout     = 5 * time.Minute
+)
+
+var (
+	ErrInvalidCredentials      = errors.New("invalid username or password")
+	ErrInvalidTwoFactorCode    = errors.New("invalid two factor code")
+	ErrTwoFactorLocked         = errors.New("too many failed two factor attempts, try again later")
+	ErrTwoFactorNotEnabled     = errors.New("two factor authentication is not enabled")
+	ErrTwoFactorAlreadyEnabled = errors.New("two factor authentication is already enabled")
+	ErrTwoFactorRequired       = errors.New("two factor authentication is required for your group")
+	ErrInvalidChallenge        = errors.New("invalid login challenge")
+)
+
+type TwoFactorSetup struct {
+	Secret     string `json:"secret"`
+	OtpauthUrl string `json:"otpauth_url"`
+}
+
+type TwoFactorStatus struct {
+	Enabled           bool `json:"enabled"`
+	Required          bool `json:"required"`
+	RecoveryCodesLeft int  `json:"recovery_codes_left"`
+}
+
+type VerifyTwoFactorOpts struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code"`
+	ClientIP       string `json:"-"`
+}
+
+// twoFactorFailures counts failed code attempts per user, kept in memory
+// so a restart resets it
+type twoFactorFailures struct {
+	mu    sync.Mutex
+	users map[int64]*failureWindow
+}
+
+type failureWindow struct {
+	count int
+	since time.Time
+}
+
+func (f *twoFactorFailures) locked(userId int64) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w := f.users[userId]
+	if w == nil {
+		return false
+	}
+
+	if time.Since(w.since) > twoFactorLockout {
+		delete(f.users, userId)
+		return false
+	}
+
+	return w.count >= maxTwoFactorFailures
+}
+
+func (f *twoFactorFailures) fail(userId int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.users == nil {
+		f.users = make(map[int64]*failureWindow)
+	}
+
+	w := f.users[userId]
+	if w == nil || time.Since(w.since) > twoFactorLockout {
+		w = &failureWindow{since: time.Now()}
+		f.users[userId] = w
+	}
+	w.count++
+}
+
+func (f *twoFactorFailures) reset(userId int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.users, userId)
+}
+
+// finishLogin runs after the password step, it either starts the session or
+// hands out a challenge when a second factor is needed
+func (c *Controller) finishLogin(user *dbmodels.User, opts *LoginOpts) (*LoginResponse, error) {
+	enabled := c.twoFactorEnabled(user.ID)
+
+	purpose := ""
+	switch {
+	case enabled:
+		purpose = challengeVerify
+	case c.groupRequiresTwoFactor(user.Ugroup):
+		purpose = challengeEnroll
+	default:
+		return c.startSession(user, opts.DeviceName, opts.OldToken, opts.ClientIP)
+	}
+
+	challenge, err := c.signer.SignLoginChallenge(&signer.LoginChallengeClaim{
+		UserId:     user.ID,
+		Purpose:    purpose,
+		DeviceName: opts.DeviceName,
+		OldToken:   opts.OldToken,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &LoginResponse{
+		ChallengeToken:         challenge,
+		TwoFactorRequired:      purpose == challengeVerify,
+		TwoFactorSetupRequired: purpose == challengeEnroll,
+		PortalPageType:         "login",
+	}, nil
+}
+
+// VerifyTwoFactor is the second login step of users with 2fa enabled
+func (c *Controller) VerifyTwoFactor(opts *VerifyTwoFactorOpts) (*LoginResponse, error) {
+	claim, user, err := c.parseChallenge(opts.ChallengeToken, challengeVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.RecoveryCode != "" {
+		err = c.useRecoveryCode(user.ID, opts.RecoveryCode)
+	} else {
+		err = c.checkTotp(user.ID, opts.Code)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return c.startSession(user, claim.DeviceName, claim.OldToken, opts.ClientIP)
+}
+
+// EnrollTwoFactorChallenge starts the forced enrollment of a user whose group
+// requires 2fa
+func (c *Controller) EnrollTwoFactorChallenge(challengeToken string) (*TwoFactorSetup, error) {
+	_, user, err := c.parseChallenge(challengeToken, challengeEnroll)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.beginEnroll(user)
+}
+
+// ConfirmTwoFactorChallenge finishes the forced enrollment and starts the
+// session, the response carries the recovery codes
+func (c *Controller) ConfirmTwoFactorChallenge(opts *VerifyTwoFactorOpts) (*LoginResponse, error) {
+	claim, user, err := c.parseChallenge(opts.ChallengeToken, challengeEnroll)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, err := c.confirmEnroll(user.ID, opts.Code)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.startSession(user, claim.DeviceName, claim.OldToken, opts.ClientIP)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.RecoveryCodes = codes
+	return resp, nil
+}
+
+// self
+
+func (c *Controller) GetTwoFactorStatus(userId int64) (*TwoFactorStatus, error) {
+	user, err := c.database.GetUserOps().GetUser(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorStatus{
+		Enabled:           c.twoFactorEnabled(userId),
+		Required:          c.groupRequiresTwoFactor(user.Ugroup),
+		RecoveryCodesLeft: len(c.recoveryCodes(userId)),
+	}, nil
+}
+
+func (c *Controller) BeginTwoFactorEnroll(userId int64) (*TwoFactorSetup, error) {
+	user, err := c.database.GetUserOps().GetUser(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.beginEnroll(user)
+}
+
+func (c *Controller) ConfirmTwoFactorEnroll(userId int64, code string) ([]string, error) {
+	return c.confirmEnroll(userId, code)
+}
+
+func (c *Controller) DisableTwoFactor(userId int64, password string, code string) error {
+	user, err := c.database.GetUserOps().GetUser(userId)
+	if err != nil {
+		return err
+	}
+
+	if c.groupRequiresTwoFactor(user.Ugroup) {
+		return ErrTwoFactorRequired
+	}
+
+	ok, _ := passhash.Verify(user.Password, password)
+	if !ok {
+		return ErrInvalidCredentials
+	}
+
+	err = c.checkTotp(userId, code)
+	if err != nil {
+		return err
+	}
+
+	return c.clearTwoFactor(userId)
+}
+
+func (c *Controller) RegenerateRecoveryCodes(userId int64, code string) ([]string, error) {
+	err := c.checkTotp(userId, code)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.newRecoveryCodes(userId)
+}
+
+// admin
+
+func (c *Controller) SetGroupRequireTwoFactor(adminId int64, group string, required bool) error {
+	err := c.isAdmin(adminId)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.database.GetUserOps().GetUserGroup(group)
+	if err != nil {
+		return err
+	}
+
+	return c.database.GetUserOps().SetUserGroupConfig(group, groupKeyRequire2FA, strconv.FormatBool(required))
+}
+
+// ResetUserTwoFactor drops a user's 2fa, for users who lost both their
+// authenticator and recovery codes
+func (c *Controller) ResetUserTwoFactor(adminId int64, userId int64) error {
+	err := c.isAdmin(adminId)
+	if err != nil {
+		return err
+	}
+
+	err = c.clearTwoFactor(userId)
+	if err != nil {
+		return err
+	}
+
+	c.twoFactorFails.reset(userId)
+
+	return c.LogoutAll(userId)
+}
+
+// private
+
+func (c *Controller) parseChallenge(token string, purpose string) (*signer.LoginChallengeClaim, *dbmodels.User, error) {
+	claim, err := c.signer.ParseLoginChallenge(token)
+	if err != nil {
+		return nil, nil, ErrInvalidChallenge
+	}
+
+	if claim.Purpose != purpose {
+		return nil, nil, ErrInvalidChallenge
+	}
+
+	user, err := c.database.GetUserOps().GetUser(claim.UserId)
+	if err != nil {
+		return nil, nil, ErrInvalidChallenge
+	}
+
+	if user.Disabled || user.IsDeleted {
+		return nil, nil, ErrUserDisabled
+	}
+
+	return claim, user, nil
+}
+
+func (c *Controller) beginEnroll(user *dbmodels.User) (*TwoFactorSetup, error) {
+	if c.twoFactorEnabled(user.ID) {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.database.GetUserOps().SetUserConfig(user.ID, AuthConfigGroup, authKeyTotpPendingSecret, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	account := user.Email
+	if account == "" && user.Username != nil {
+		account = *user.Username
+	}
+
+	return &TwoFactorSetup{
+		Secret:     secret,
+		OtpauthUrl: totp.URL(secret, c.issuer(), account),
+	}, nil
+}
+
+func (c *Controller) confirmEnroll(userId int64, code string) ([]string, error) {
+	if c.twoFactorEnabled(userId) {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	if c.twoFactorFails.locked(userId) {
+		return nil, ErrTwoFactorLocked
+	}
+
+	uops := c.database.GetUserOps()
+
+	secret, err := uops.GetUserConfig(userId, AuthConfigGroup, authKeyTotpPendingSecret)
+	if err != nil || secret == "" {
+		return nil, errors.New("no two factor enrollment in progress")
+	}
+
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		c.twoFactorFails.fail(userId)
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	c.twoFactorFails.reset(userId)
+
+	err = uops.SetUserConfig(userId, AuthConfigGroup, authKeyTotpSecret, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	err = uops.SetUserConfig(userId, AuthConfigGroup, authKeyTotpLastStep, strconv.FormatInt(step, 10))
+	if err != nil {
+		return nil, err
+	}
+
+	err = uops.DeleteUserConfig(userId, AuthConfigGroup, authKeyTotpPendingSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, err := c.newRecoveryCodes(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	err = uops.SetUserConfig(userId, AuthConfigGroup, authKeyTotpEnabled, "true")
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// checkTotp validates a code against the enabled secret, a code (time step)
+// is only accepted once
+func (c *Controller) checkTotp(userId int64, code string) error {
+	if !c.twoFactorEnabled(userId) {
+		return ErrTwoFactorNotEnabled
+	}
+
+	if c.twoFactorFails.locked(userId) {
+		return ErrTwoFactorLocked
+	}
+
+	uops := c.database.GetUserOps()
+
+	secret, err := uops.GetUserConfig(userId, AuthConfigGroup, authKeyTotpSecret)
+	if err != nil {
+		return err
+	}
+
+	lastStep := int64(-1)
+	if last, err := uops.GetUserConfig(userId, AuthConfigGroup, authKeyTotpLastStep); err == nil {
+		if v, err := strconv.ParseInt(last, 10, 64); err == nil {
+			lastStep = v
+		}
+	}
+
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok || step <= lastStep {
+		c.twoFactorFails.fail(userId)
+		return ErrInvalidTwoFactorCode
+	}
+
+	c.twoFactorFails.reset(userId)
+
+	return uops.SetUserConfig(userId, AuthConfigGroup, authKeyTotpLastStep, strconv.FormatInt(step, 10))
+}
+
+func (c *Controller) useRecoveryCode(userId int64, code string) error {
+	if !c.twoFactorEnabled(userId) {
+		return ErrTwoFactorNotEnabled
+	}
+
+	if c.twoFactorFails.locked(userId) {
+		return ErrTwoFactorLocked
+	}
+
+	hash := HashToken(normalizeRecoveryCode(code))
+	codes := c.recoveryCodes(userId)
+
+	for i, stored := range codes {
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(hash)) != 1 {
+			continue
+		}
+
+		remaining := append(codes[:i:i], codes[i+1:]...)
+		err := c.saveRecoveryCodes(userId, remaining)
+		if err != nil {
+			return err
+		}
+
+		c.twoFactorFails.reset(userId)
+		return nil
+	}
+
+	c.twoFactorFails.fail(userId)
+	return ErrInvalidTwoFactorCode
+}
+
+func (c *Controller) newRecoveryCodes(userId int64) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, HashToken(code))
+	}
+
+	err := c.saveRecoveryCodes(userId, hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func (c *Controller) recoveryCodes(userId int64) []string {
+	raw, err := c.database.GetUserOps().GetUserConfig(userId, AuthConfigGroup, authKeyRecoveryCodes)
+	if err != nil || raw == "" {
+		return nil
+	}
+
+	hashes := make([]string, 0)
+	err = json.Unmarshal([]byte(raw), &hashes)
+	if err != nil {
+		return nil
+	}
+
+	return hashes
+}
+
+func (c *Controller) saveRecoveryCodes(userId int64, hashes []string) error {
+	raw, err := json.Marshal(hashes)
+	if err != nil {
+		return err
+	}
+
+	return c.database.GetUserOps().SetUserConfig(userId, AuthConfigGroup, authKeyRecoveryCodes, string(raw))
+}
+
+func (c *Controller) clearTwoFactor(userId int64) error {
+	uops := c.database.GetUserOps()
+
+	for _, key := range []string{
+		authKeyTotpEnabled,
+		authKeyTotpSecret,
+		authKeyTotpPendingSecret,
+		authKeyTotpLastStep,
+		authKeyRecoveryCodes,
+	} {
+		err := uops.DeleteUserConfig(userId, AuthConfigGroup, key)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Controller) twoFactorEnabled(userId int64) bool {
+	enabled, err := c.database.GetUserOps().GetUserConfig(userId, AuthConfigGroup, authKeyTotpEnabled)
+	return err == nil && enabled == "true"
+}
+
+func (c *Controller) groupRequiresTwoFactor(group string) bool {
+	required, err := c.database.GetUserOps().GetUserGroupConfig(group, groupKeyRequire2FA)
+	return err == nil && required == "true"
+}
+
+func (c *Controller) issuer() string {
+	if c.AppOpts != nil && c.AppOpts.Name != "" {
+		return c.AppOpts.Name
+	}
+	return "Potatoverse"
+}
+
+const recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// generateRecoveryCode returns a code like k3fq-9zmw
+func generateRecoveryCode() (string, error) {
+	buf := make([]byte, 8)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+
+	out := make([]byte, 0, 9)
+	for i, b := range buf {
+		if i == 4 {
+			out = append(out, '-')
+		}
+		out = append(out, recoveryCodeAlphabet[int(b)%len(recoveryCodeAlphabet)])
+	}
+
+	return string(out), nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.ReplaceAll(code, " ", "")
+	if len(code) == 8 && !strings.Contains(code, "-") {
+		code = code[:4] + "-" + code[4:]
+	}
+	return code
+}
@@ -34,6 +34,11 @@ func (a *Server) bindRoutes() {
 	a.selfUserRoutes(coreApi.Group("/self"))
 	a.engineRoutes(zroot, coreApi)
 	a.spaceFileRoutes(coreApi.Group("/space_file"))
+	a.buddyUsageRoutes(coreApi.Group("/buddy"))
+
+	if a.ctrl.OIDCProviderEnabled() {
+		a.oidcProviderRoutes(zroot.Group("/oidc"), coreApi.Group("/oidc"))
+	}
 
 	a.buddyRoutes.AttachRoutes(zroot)
 
@@ -69,11 +74,41 @@ func (a *Server) authRoutes(g *gin.RouterGroup) {
 
 	g.POST("/login", a.login)
 	g.POST("/device-token", a.loginWithDeviceToken)
+	g.POST("/refresh", a.refreshSession)
+	g.POST("/logout", a.withAccessTokenFn(a.logout))
+	g.POST("/2fa/verify", a.verifyTwoFactor)
+	g.POST("/2fa/enroll", a.enrollTwoFactorChallenge)
+	g.POST("/2fa/enroll/confirm", a.confirmTwoFactorChallenge)
+	g.GET("/oidc/providers", a.listSSOProviders)
+	g.POST("/oidc/exchange", a.exchangeSSOChallenge)
+	g.GET("/oidc/:provider/start", a.startSSO)
+	g.GET("/oidc/:provider/callback", a.ssoCallback)
 	g.GET("/invite/:token", a.getInviteInfo)
 	g.POST("/invite/:token", a.acceptInvite)
 
 }
 
+func (a *Server) oidcProviderRoutes(g *gin.RouterGroup, api *gin.RouterGroup) {
+	g.GET("/.well-known/openid-configuration", a.oidcDiscovery)
+	g.GET("/jwks", a.oidcJWKS)
+	g.GET("/authorize", a.oidcAuthorize)
+	g.POST("/token", a.oidcToken)
+	g.GET("/userinfo", a.oidcUserInfo)
+	g.POST("/userinfo", a.oidcUserInfo)
+	g.OPTIONS("/*path", a.oidcPreflight)
+
+	// consent page
+	api.GET("/authorize", a.withAccessTokenFn(a.oidcAuthorizeInfo))
+	api.POST("/authorize", a.withAccessTokenFn(a.oidcAuthorizeDecide))
+
+	// client registrations of a space
+	api.GET("/clients", a.withAccessTokenFn(a.listOIDCClients))
+	api.POST("/clients", a.withAccessTokenFn(a.createOIDCClient))
+	api.PUT("/clients/:id", a.withAccessTokenFn(a.updateOIDCClient))
+	api.DELETE("/clients/:id", a.withAccessTokenFn(a.deleteOIDCClient))
+	api.POST("/clients/:id/rotate-secret", a.withAccessTokenFn(a.rotateOIDCClientSecret))
+}
+
 func (a *Server) userRoutes(g *gin.RouterGroup) {
 	g.GET("/", a.withAccessTokenFn(a.listUsers))
 	g.GET("/:id", a.withAccessTokenFn(a.getUser))
@@ -88,6 +123,8 @@ func (a *Server) userRoutes(g *gin.RouterGroup) {
 
 	// Create User Directly
 	g.POST("/create", a.withAccessTokenFn(a.createUserDirectly))
+	g.POST("/:id/logout-all", a.withAccessTokenFn(a.revokeUserSessions))
+	g.POST("/:id/2fa/reset", a.withAccessTokenFn(a.resetUserTwoFactor))
 
 	// User Groups
 	g.GET("/groups", a.withAccessTokenFn(a.listUserGroups))
@@ -95,6 +132,7 @@ func (a *Server) userRoutes(g *gin.RouterGroup) {
 	g.POST("/groups", a.withAccessTokenFn(a.addUserGroup))
 	g.PUT("/groups/:name", a.withAccessTokenFn(a.updateUserGroup))
 	g.DELETE("/groups/:name", a.withAccessTokenFn(a.deleteUserGroup))
+	g.PUT("/groups/:name/require-2fa", a.withAccessTokenFn(a.setUserGroupRequire2FA))
 
 	g.GET("/messages", a.withAccessTokenFn(a.listUserMessages))
 	g.GET("/messages/new", a.withAccessTokenFn(a.queryNewMessages))
@@ -115,6 +153,21 @@ func (a *Server) selfUserRoutes(g *gin.RouterGroup) {
 	g.PUT("/bio", a.withAccessTokenFn(a.updateSelfBio))
 	g.GET("/devices", a.withAccessTokenFn(a.selfListDevices))
 	g.POST("/devices", a.withAccessTokenFn(a.selfCreateDevice))
+	g.DELETE("/devices/:id", a.withAccessTokenFn(a.selfRevokeDevice))
+	g.POST("/logout-all", a.withAccessTokenFn(a.selfLogoutAll))
+	g.GET("/2fa", a.withAccessTokenFn(a.selfTwoFactorStatus))
+	g.GET("/identities", a.withAccessTokenFn(a.selfListIdentities))
+	g.DELETE("/identities/:id", a.withAccessTokenFn(a.selfUnlinkIdentity))
+	g.POST("/2fa/enroll", a.withAccessTokenFn(a.selfTwoFactorEnroll))
+	g.POST("/2fa/confirm", a.withAccessTokenFn(a.selfTwoFactorConfirm))
+	g.POST("/2fa/disable", a.withAccessTokenFn(a.selfTwoFactorDisable))
+	g.POST("/2fa/recovery-codes", a.withAccessTokenFn(a.selfTwoFactorRecoveryCodes))
+}
+
+func (a *Server) buddyUsageRoutes(g *gin.RouterGroup) {
+	g.GET("/usage", a.withAccessTokenFn(a.listBuddyUsage))
+	g.GET("/usage/:pubkey", a.withAccessTokenFn(a.getBuddyUsage))
+	g.POST("/usage/:pubkey/reset", a.withAccessTokenFn(a.resetBuddyUsage))
 }
 
 func (a *Server) extraRoutes(g *gin.RouterGroup) {
@@ -134,6 +187,11 @@ func (a *Server) engineRoutes(zg *gin.RouterGroup, coreApi *gin.RouterGroup) {
 	coreApi.POST("/package/:id/upgrade/zip", a.withAccessTokenFn(a.UpgradePackageZip))
 	coreApi.POST("/package/:id/upgrade/repo", a.withAccessTokenFn(a.UpgradePackageRepo))
 	coreApi.GET("/package/:id/versions", a.withAccessTokenFn(a.GetPackageAvailableVersions))
+	coreApi.POST("/package/:id/rollback", a.withAccessTokenFn(a.RollbackPackage))
+	coreApi.GET("/package/:id/snapshots", a.withAccessTokenFn(a.ListPackageSnapshots))
+	coreApi.PUT("/package/:id/auto-upgrade", a.withAccessTokenFn(a.SetPackageAutoUpgrade))
+	coreApi.GET("/package/updates", a.withAccessTokenFn(a.ListPackageUpdates))
+	coreApi.POST("/package/updates/check", a.withAccessTokenFn(a.CheckPackageUpdates))
 
 	coreApi.GET("/package/:id/envs", a.withAccessTokenFn(a.GetPackageEnvs))
 	coreApi.PUT("/package/:id/envs", a.withAccessTokenFn(a.UpdatePackageEnvs))
@@ -145,6 +203,9 @@ func (a *Server) engineRoutes(zg *gin.RouterGroup, coreApi *gin.RouterGroup) {
 	coreApi.GET("/package/list", a.withAccessTokenFn(a.ListEPackages))
 
 	coreApi.GET("/repo/list", a.withAccessTokenFn(a.ListRepos))
+	coreApi.GET("/repo/trust", a.withAccessTokenFn(a.ListTrustedKeys))
+	coreApi.POST("/repo/trust", a.withAccessTokenFn(a.AddTrustedKey))
+	coreApi.DELETE("/repo/trust/:id", a.withAccessTokenFn(a.RemoveTrustedKey))
 	coreApi.GET("/space/installed", a.withAccessTokenFn(a.ListInstalledSpaces))
 	coreApi.POST("/space/authorize/:space_key", a.withAccessTokenFn(a.AuthorizeSpace))
 	coreApi.GET("/package/:id/info", a.withAccessTokenFn(a.GetInstalledPackageInfo))
@@ -197,6 +258,14 @@ func (a *Server) engineRoutes(zg *gin.RouterGroup, coreApi *gin.RouterGroup) {
 	coreApi.POST("/space/:install_id/events", a.withAccessTokenFn(a.CreateEventSubscription))
 	coreApi.PUT("/space/:install_id/events/:subscriptionId", a.withAccessTokenFn(a.UpdateEventSubscription))
 	coreApi.DELETE("/space/:install_id/events/:subscriptionId", a.withAccessTokenFn(a.DeleteEventSubscription))
+	coreApi.POST("/space/:install_id/events/:subscriptionId/dry_run", a.withAccessTokenFn(a.DryRunEventSubscription))
+
+	// Event Targets dead letter API
+	coreApi.GET("/space/:install_id/event_targets/dead", a.withAccessTokenFn(a.ListDeadEventTargets))
+	coreApi.GET("/space/:install_id/event_targets/:targetId/attempts", a.withAccessTokenFn(a.ListEventTargetAttempts))
+	coreApi.POST("/space/:install_id/event_targets/replay", a.withAccessTokenFn(a.ReplayDeadEventTargets))
+	coreApi.POST("/space/:install_id/event_targets/discard", a.withAccessTokenFn(a.DiscardDeadEventTargets))
+
 	coreApi.GET("/space/:install_id/spec.json", a.withAccessTokenFn(a.GetSpaceSpec))
 	coreApi.POST("/space/:install_id/export", (a.ExportState))
 	coreApi.POST("/space/:install_id/import", (a.ImportState))
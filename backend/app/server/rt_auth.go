@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/blue-monads/potatoverse/backend/app/actions"
+	"github.com/blue-monads/potatoverse/backend/services/signer"
 	"github.com/blue-monads/potatoverse/backend/utils/libx/easyerr"
 	"github.com/blue-monads/potatoverse/backend/utils/libx/httpx"
 	"github.com/gin-gonic/gin"
@@ -45,6 +46,80 @@ func (a *Server) loginWithDeviceToken(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, resp)
 }
 
+func (a *Server) refreshSession(ctx *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		httpx.WriteAuthErr(ctx, err)
+		return
+	}
+	resp, err := a.ctrl.RefreshSession(req.RefreshToken, ctx.ClientIP())
+	if err != nil {
+		httpx.WriteAuthErr(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, resp)
+}
+
+func (a *Server) verifyTwoFactor(ctx *gin.Context) {
+	data := &actions.VerifyTwoFactorOpts{}
+	if err := ctx.ShouldBindJSON(data); err != nil {
+		httpx.WriteAuthErr(ctx, err)
+		return
+	}
+	data.ClientIP = ctx.ClientIP()
+
+	resp, err := a.ctrl.VerifyTwoFactor(data)
+	if err != nil {
+		httpx.WriteAuthErr(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, resp)
+}
+
+func (a *Server) enrollTwoFactorChallenge(ctx *gin.Context) {
+	var req struct {
+		ChallengeToken string `json:"challenge_token" binding:"required"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		httpx.WriteAuthErr(ctx, err)
+		return
+	}
+
+	resp, err := a.ctrl.EnrollTwoFactorChallenge(req.ChallengeToken)
+	if err != nil {
+		httpx.WriteAuthErr(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, resp)
+}
+
+func (a *Server) confirmTwoFactorChallenge(ctx *gin.Context) {
+	data := &actions.VerifyTwoFactorOpts{}
+	if err := ctx.ShouldBindJSON(data); err != nil {
+		httpx.WriteAuthErr(ctx, err)
+		return
+	}
+	data.ClientIP = ctx.ClientIP()
+
+	resp, err := a.ctrl.ConfirmTwoFactorChallenge(data)
+	if err != nil {
+		httpx.WriteAuthErr(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, resp)
+}
+
+func (a *Server) logout(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
+	err := a.ctrl.Logout(claim.UserId, claim.DeviceId)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{"message": "Logged out"}, nil
+}
+
 func (a *Server) getInviteInfo(ctx *gin.Context) {
 	token := ctx.Param("token")
 
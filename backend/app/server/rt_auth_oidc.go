@@ -0,0 +1,115 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/blue-monads/potatoverse/backend/app/actions"
+	"github.com/blue-monads/potatoverse/backend/services/signer"
+	"github.com/blue-monads/potatoverse/backend/utils/libx/httpx"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	oidcStateCookie     = "potato_oidc_state"
+	oidcStateCookiePath = "/zz/api/core/auth/oidc"
+	oidcLoginPage       = "/zz/pages/auth/login"
+)
+
+func (a *Server) listSSOProviders(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, a.ctrl.ListSSOProviders())
+}
+
+func (a *Server) startSSO(ctx *gin.Context) {
+	authURL, stateToken, err := a.ctrl.StartSSO(ctx.Request.Context(), ctx.Param("provider"), ctx.Query("redirect"))
+	if err != nil {
+		a.redirectSSOError(ctx, err)
+		return
+	}
+
+	// lax so the cookie comes back on the provider's top level redirect
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(oidcStateCookie, stateToken, 600, oidcStateCookiePath, "", ctx.Request.TLS != nil, true)
+
+	ctx.Redirect(http.StatusFound, authURL)
+}
+
+func (a *Server) ssoCallback(ctx *gin.Context) {
+	stateToken, _ := ctx.Cookie(oidcStateCookie)
+	ctx.SetCookie(oidcStateCookie, "", -1, oidcStateCookiePath, "", ctx.Request.TLS != nil, true)
+
+	if errMsg := ctx.Query("error"); errMsg != "" {
+		desc := ctx.Query("error_description")
+		if desc != "" {
+			errMsg = errMsg + ": " + desc
+		}
+		a.redirectSSOErrorString(ctx, errMsg)
+		return
+	}
+
+	result, err := a.ctrl.CompleteSSO(ctx.Request.Context(), &actions.CompleteSSOOpts{
+		Provider:   ctx.Param("provider"),
+		Code:       ctx.Query("code"),
+		State:      ctx.Query("state"),
+		StateToken: stateToken,
+	})
+	if err != nil {
+		a.redirectSSOError(ctx, err)
+		return
+	}
+
+	// fragment, so the challenge stays out of server and proxy logs
+	frag := url.Values{}
+	frag.Set("sso", result.ChallengeToken)
+	if result.Redirect != "" {
+		frag.Set("redirect", result.Redirect)
+	}
+
+	ctx.Redirect(http.StatusFound, oidcLoginPage+"#"+frag.Encode())
+}
+
+func (a *Server) exchangeSSOChallenge(ctx *gin.Context) {
+	var req struct {
+		ChallengeToken string `json:"challenge_token" binding:"required"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		httpx.WriteAuthErr(ctx, err)
+		return
+	}
+
+	resp, err := a.ctrl.ExchangeSSOChallenge(req.ChallengeToken, ctx.ClientIP())
+	if err != nil {
+		httpx.WriteAuthErr(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, resp)
+}
+
+func (a *Server) redirectSSOError(ctx *gin.Context, err error) {
+	a.redirectSSOErrorString(ctx, err.Error())
+}
+
+func (a *Server) redirectSSOErrorString(ctx *gin.Context, msg string) {
+	frag := url.Values{}
+	frag.Set("sso_error", msg)
+	ctx.Redirect(http.StatusFound, oidcLoginPage+"#"+frag.Encode())
+}
+
+func (s *Server) selfListIdentities(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
+	return s.ctrl.ListSelfIdentities(claim.UserId)
+}
+
+func (s *Server) selfUnlinkIdentity(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.ctrl.UnlinkSelfIdentity(claim.UserId, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{"message": "Identity unlinked"}, nil
+}
@@ -4,6 +4,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/blue-monads/potatoverse/backend/app/server/rt_buddy/webdav"
 	"github.com/blue-monads/potatoverse/backend/services/buddyhub"
 	"github.com/blue-monads/potatoverse/backend/services/datahub/lazysyncer/selfcdc"
 	"github.com/blue-monads/potatoverse/backend/utils/nostrutils"
@@ -25,6 +26,7 @@ type BuddyRouteServer struct {
 	allowAnyBuddy bool
 
 	reverseBuddyIdToPubkey map[string]string
+	storageServers         map[string]*webdav.WebdavServer
 	rLock                  sync.RWMutex
 }
 
@@ -34,6 +36,7 @@ func New(buddyhub *buddyhub.BuddyHub, port int) *BuddyRouteServer {
 		port:     port,
 
 		reverseBuddyIdToPubkey: map[string]string{},
+		storageServers:         map[string]*webdav.WebdavServer{},
 		rLock:                  sync.RWMutex{},
 		allowAnyBuddy:          true,
 	}
@@ -48,6 +51,12 @@ func (a *BuddyRouteServer) AttachRoutes(g *gin.RouterGroup) {
 	g.Any("/buddy/route", a.handleBuddyRoute)
 	g.GET("/buddy/register", a.registerBuddyNode)
 
+	// storage
+	a.attachStorageRoutes(g)
+
+	// sockd backplane
+	g.POST("/buddy/sockd/backplane", a.handleBuddyBackplane)
+
 	// lazysync
 	g.POST("/buddy/lazycdc/sync/data", a.handleBuddyLazySyncData)
 	g.GET("/buddy/lazycdc/sync/meta", a.handleBuddyLazySyncMeta)
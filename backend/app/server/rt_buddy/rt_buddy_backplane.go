@@ -0,0 +1,41 @@
+package rtbuddy
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+const (
+	MaxBackplaneMessageSize = 4 * 1024 * 1024
+)
+
+func (a *BuddyRouteServer) handleBuddyBackplane(ctx *gin.Context) {
+	event, err := verifyNostrAuthCtx(ctx, BuddyAuthExpiry)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	pubkey, err := nip19.EncodePublicKey(event.PubKey)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(ctx.Request.Body, MaxBackplaneMessageSize))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = a.buddyhub.HandleBackplaneMessage(pubkey, data)
+	if err != nil {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"ok": true})
+}
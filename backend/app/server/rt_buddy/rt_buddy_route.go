@@ -8,6 +8,7 @@ import (
 	"net/url"
 	"strings"
 
+	xutils "github.com/blue-monads/potatoverse/backend/utils"
 	"github.com/blue-monads/potatoverse/backend/utils/nostrutils"
 	"github.com/blue-monads/potatoverse/backend/utils/qq"
 	"github.com/gin-gonic/gin"
@@ -51,11 +52,8 @@ func (a *BuddyRouteServer) BuddyAutoRouteMW() gin.HandlerFunc {
 
 	nodeId := nostrutils.PubKeyToNodeId(pubkey1)
 
-	routeToBuddy := func(subdomain string, ctx *gin.Context) {
+	routeToBuddy := func(extractedNodeId string, ctx *gin.Context) {
 
-		qq.Println("@routeToBuddy", 1)
-
-		extractedNodeId := strings.Split(subdomain, "buddy-")[1]
 		qq.Println("@routeToBuddy", extractedNodeId)
 
 		if nodeId == extractedNodeId {
@@ -69,7 +67,9 @@ func (a *BuddyRouteServer) BuddyAutoRouteMW() gin.HandlerFunc {
 		qq.Println("@routeToBuddy", cpubkey)
 
 		if cpubkey == "" {
-			panic("Could not map pubkey")
+			ctx.String(http.StatusBadGateway, "buddy not connected")
+			ctx.Abort()
+			return
 		}
 
 		if cpubkey == pubkey1 {
@@ -79,6 +79,8 @@ func (a *BuddyRouteServer) BuddyAutoRouteMW() gin.HandlerFunc {
 
 		}
 
+		// Host is kept as is, so zz-<space_id>-buddy-<nodeid> sub origins
+		// resolve to the same space on the node
 		a.buddyhub.HandleFunnelRoute(cpubkey, ctx)
 		ctx.Abort()
 	}
@@ -122,13 +124,8 @@ func (a *BuddyRouteServer) BuddyAutoRouteMW() gin.HandlerFunc {
 
 		// buddy start
 
-		if strings.HasPrefix(subdomain, "buddy-") {
-			routeToBuddy(subdomain, ctx)
-			return
-		}
-
-		if strings.HasPrefix(subdomain, "zz-") && strings.Contains(subdomain, "buddy-") {
-			routeToBuddy(subdomain, ctx)
+		if buddyNodeId, _, ok := xutils.ParseBuddySubdomain(subdomain); ok {
+			routeToBuddy(buddyNodeId, ctx)
 			return
 		}
 	}
@@ -0,0 +1,149 @@
+package rtbuddy
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/blue-monads/potatoverse/backend/app/server/rt_buddy/webdav"
+	"github.com/blue-monads/potatoverse/backend/services/buddyhub"
+	"github.com/blue-monads/potatoverse/backend/utils/qq"
+	"github.com/gin-gonic/gin"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+const (
+	BuddyStoragePrefix = "/zz/buddy/storage"
+)
+
+var errContentLengthRequired = errors.New("content length is required")
+
+var storageMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions,
+	"PROPFIND", "PROPPATCH", "MKCOL", "COPY", "MOVE", "LOCK", "UNLOCK",
+}
+
+// methods which change the storage folder, usage is recounted after them
+var storageWriteMethods = map[string]bool{
+	http.MethodPut:    true,
+	http.MethodDelete: true,
+	"PROPPATCH":       true,
+	"MKCOL":           true,
+	"COPY":            true,
+	"MOVE":            true,
+}
+
+func (a *BuddyRouteServer) attachStorageRoutes(g *gin.RouterGroup) {
+	for _, method := range storageMethods {
+		g.Handle(method, "/buddy/storage/*path", a.handleBuddyStorage)
+	}
+}
+
+func (a *BuddyRouteServer) handleBuddyStorage(ctx *gin.Context) {
+	event, err := verifyNostrAuthCtx(ctx, BuddyAuthExpiry)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	pubkey, err := nip19.EncodePublicKey(event.PubKey)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	method := ctx.Request.Method
+
+	// reads are allowed as long as storage is, so a buddy over its
+	// quota can still fetch and delete its files
+	err = a.buddyhub.CheckStorage(pubkey)
+	if err != nil {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	if storageWriteMethods[method] && method != http.MethodDelete {
+		size, err := a.storageWriteSize(ctx, pubkey)
+		if errors.Is(err, errContentLengthRequired) {
+			ctx.JSON(http.StatusLengthRequired, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// held until usage is recounted below so parallel writes see it
+		release, err := a.buddyhub.ReserveStorage(pubkey, size)
+		if err != nil {
+			buddyhub.WriteQuotaExceeded(ctx, err, 0)
+			return
+		}
+		defer release()
+
+		// the body can not grow past what was reserved
+		if method == http.MethodPut {
+			ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, size)
+		}
+	}
+
+	server, err := a.getStorageServer(pubkey)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	server.Handle(ctx)
+
+	if storageWriteMethods[method] {
+		_, err = a.buddyhub.RefreshStorageUsage(pubkey)
+		if err != nil {
+			qq.Println("@handleBuddyStorage/refresh", pubkey, err)
+		}
+	}
+}
+
+// storageWriteSize is how many bytes a write may add, PUT must declare
+// its length and COPY/MOVE count the source, a move can fall back to
+// copy and delete so it needs room for the source while it runs
+func (a *BuddyRouteServer) storageWriteSize(ctx *gin.Context, pubkey string) (int64, error) {
+	switch ctx.Request.Method {
+	case http.MethodPut:
+		if ctx.Request.ContentLength < 0 {
+			return 0, errContentLengthRequired
+		}
+		return ctx.Request.ContentLength, nil
+	case "COPY", "MOVE":
+		return a.buddyhub.StorageSize(pubkey, ctx.Param("path"))
+	}
+
+	return 0, nil
+}
+
+func (a *BuddyRouteServer) getStorageServer(pubkey string) (*webdav.WebdavServer, error) {
+	a.rLock.RLock()
+	server, ok := a.storageServers[pubkey]
+	a.rLock.RUnlock()
+
+	if ok {
+		return server, nil
+	}
+
+	dir, err := a.buddyhub.PrepareStorageDir(pubkey)
+	if err != nil {
+		return nil, err
+	}
+
+	a.rLock.Lock()
+	defer a.rLock.Unlock()
+
+	if server, ok := a.storageServers[pubkey]; ok {
+		return server, nil
+	}
+
+	server = webdav.New(dir, BuddyStoragePrefix)
+	server.Build()
+
+	a.storageServers[pubkey] = server
+
+	return server, nil
+}
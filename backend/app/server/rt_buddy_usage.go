@@ -0,0 +1,18 @@
+package server
+
+import (
+	"github.com/blue-monads/potatoverse/backend/services/signer"
+	"github.com/gin-gonic/gin"
+)
+
+func (s *Server) listBuddyUsage(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
+	return s.ctrl.ListBuddyUsage(claim.UserId)
+}
+
+func (s *Server) getBuddyUsage(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
+	return s.ctrl.GetBuddyUsage(claim.UserId, ctx.Param("pubkey"))
+}
+
+func (s *Server) resetBuddyUsage(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
+	return s.ctrl.ResetBuddyUsage(claim.UserId, ctx.Param("pubkey"))
+}
@@ -22,9 +22,13 @@ import (
 )
 
 type InstallPackageRequest struct {
-	URL string `json:"url"`
+	URL           string `json:"url"`
+	AllowUnsigned bool   `json:"allow_unsigned,omitempty"`
 }
 
+// PackageSignatureHeader carries the detached .sig of an uploaded zip
+const PackageSignatureHeader = "X-Package-Signature"
+
 func (a *Server) InstallPackage(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
 	var req InstallPackageRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
@@ -32,7 +36,7 @@ func (a *Server) InstallPackage(claim *signer.AccessClaim, ctx *gin.Context) (an
 		return nil, err
 	}
 
-	ipackage, err := a.ctrl.InstallPackageByUrl(claim.UserId, req.URL)
+	ipackage, err := a.ctrl.InstallPackageByUrl(claim.UserId, req.URL, req.AllowUnsigned)
 	if err != nil {
 		return nil, err
 	}
@@ -53,6 +57,12 @@ func (a *Server) InstallPackageZip(claim *signer.AccessClaim, ctx *gin.Context)
 	if err != nil {
 		return nil, err
 	}
+
+	err = a.ctrl.VerifyPackageZip(claim.UserId, tempFile.Name(), ctx.GetHeader(PackageSignatureHeader), ctx.Query("allow_unsigned") == "true")
+	if err != nil {
+		return nil, err
+	}
+
 	ipackage, err := a.ctrl.InstallPackageByFile(claim.UserId, "", tempFile.Name())
 	if err != nil {
 		return nil, err
@@ -78,6 +88,12 @@ func (a *Server) UpgradePackageZip(claim *signer.AccessClaim, ctx *gin.Context)
 	if err != nil {
 		return nil, err
 	}
+
+	err = a.ctrl.VerifyPackageZip(claim.UserId, tempFile.Name(), ctx.GetHeader(PackageSignatureHeader), ctx.Query("allow_unsigned") == "true")
+	if err != nil {
+		return nil, err
+	}
+
 	ipackage, err := a.ctrl.UpgradePackage(claim.UserId, tempFile.Name(), packageId, true)
 	if err != nil {
 		return nil, err
@@ -97,7 +113,7 @@ func (a *Server) UpgradePackageRepo(claim *signer.AccessClaim, ctx *gin.Context)
 		return nil, err
 	}
 
-	ipackage, err := a.ctrl.UpgradePackageRepo(claim.UserId, req.RepoSlug, req.Version, packageId)
+	ipackage, err := a.ctrl.UpgradePackageRepo(claim.UserId, req.RepoSlug, req.Version, packageId, req.AllowUnsigned)
 	if err != nil {
 		return nil, err
 	}
@@ -114,6 +130,55 @@ func (a *Server) GetPackageAvailableVersions(claim *signer.AccessClaim, ctx *gin
 	return a.ctrl.ListPackageAvailableVersions(packageId)
 }
 
+func (a *Server) RollbackPackage(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
+	packageId, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts actions.RollbackOptions
+	if err := ctx.ShouldBindJSON(&opts); err != nil {
+		return nil, err
+	}
+
+	return a.ctrl.RollbackPackage(claim.UserId, packageId, opts)
+}
+
+func (a *Server) ListPackageSnapshots(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
+	packageId, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.ctrl.ListPackageSnapshots(claim.UserId, packageId)
+}
+
+func (a *Server) ListPackageUpdates(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
+	return a.ctrl.ListPackageUpdates(claim.UserId)
+}
+
+func (a *Server) CheckPackageUpdates(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
+	return a.ctrl.CheckPackageUpdates(claim.UserId)
+}
+
+type AutoUpgradeRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+func (a *Server) SetPackageAutoUpgrade(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
+	packageId, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	var req AutoUpgradeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		return nil, err
+	}
+
+	return nil, a.ctrl.SetPackageAutoUpgrade(claim.UserId, packageId, req.Enabled)
+}
+
 func (a *Server) GetPackageEnvs(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
 
 	packageId, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
@@ -154,9 +219,10 @@ func (a *Server) UpdatePackageEnvs(claim *signer.AccessClaim, ctx *gin.Context)
 }
 
 type InstallRequest struct {
-	Name     string `json:"name"`
-	RepoSlug string `json:"repo_slug,omitempty"`
-	Version  string `json:"version,omitempty"`
+	Name          string `json:"name"`
+	RepoSlug      string `json:"repo_slug,omitempty"`
+	Version       string `json:"version,omitempty"`
+	AllowUnsigned bool   `json:"allow_unsigned,omitempty"`
 }
 
 func (a *Server) InstallPackageRepo(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
@@ -165,7 +231,7 @@ func (a *Server) InstallPackageRepo(claim *signer.AccessClaim, ctx *gin.Context)
 		return nil, err
 	}
 
-	ipackage, err := a.ctrl.InstallPackageRepo(claim.UserId, req.Name, req.RepoSlug)
+	ipackage, err := a.ctrl.InstallPackageRepo(claim.UserId, req.Name, req.RepoSlug, req.AllowUnsigned)
 	if err != nil {
 		return nil, err
 	}
@@ -192,6 +258,33 @@ func (a *Server) ListRepos(claim *signer.AccessClaim, ctx *gin.Context) (any, er
 	return repos, nil
 }
 
+func (a *Server) ListTrustedKeys(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
+	return a.ctrl.ListTrustedKeys(claim.UserId)
+}
+
+type AddTrustedKeyRequest struct {
+	Key  string `json:"key"`
+	Name string `json:"name"`
+}
+
+func (a *Server) AddTrustedKey(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
+	var req AddTrustedKeyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		return nil, err
+	}
+
+	return a.ctrl.AddTrustedKey(claim.UserId, req.Key, req.Name)
+}
+
+func (a *Server) RemoveTrustedKey(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, a.ctrl.RemoveTrustedKey(claim.UserId, id)
+}
+
 func (a *Server) ListInstalledSpaces(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
 
 	spaces, err := a.ctrl.ListInstalledSpaces(claim.UserId)
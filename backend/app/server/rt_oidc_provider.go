@@ -0,0 +1,209 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/blue-monads/potatoverse/backend/app/actions"
+	"github.com/blue-monads/potatoverse/backend/services/signer"
+	"github.com/blue-monads/potatoverse/backend/utils/libx/httpx"
+	"github.com/gin-gonic/gin"
+)
+
+// standard endpoints, called by relying parties (often from other origins)
+
+func (a *Server) oidcDiscovery(ctx *gin.Context) {
+	ctx.Header("Access-Control-Allow-Origin", "*")
+	ctx.JSON(http.StatusOK, a.ctrl.OIDCDiscovery())
+}
+
+func (a *Server) oidcJWKS(ctx *gin.Context) {
+	jwks, err := a.ctrl.OIDCJWKS()
+	if err != nil {
+		httpx.WriteErr(ctx, err)
+		return
+	}
+
+	ctx.Header("Access-Control-Allow-Origin", "*")
+	ctx.JSON(http.StatusOK, jwks)
+}
+
+func (a *Server) oidcAuthorize(ctx *gin.Context) {
+	req := &actions.OIDCAuthorizeRequest{}
+	if err := ctx.ShouldBindQuery(req); err != nil {
+		httpx.WriteErr(ctx, err)
+		return
+	}
+
+	target, err := a.ctrl.OIDCAuthorizeRedirect(req)
+	if err != nil {
+		httpx.WriteErr(ctx, err)
+		return
+	}
+
+	ctx.Redirect(http.StatusFound, target)
+}
+
+func (a *Server) oidcToken(ctx *gin.Context) {
+	ctx.Header("Access-Control-Allow-Origin", "*")
+	ctx.Header("Cache-Control", "no-store")
+
+	opts := &actions.OIDCTokenOpts{
+		GrantType:    ctx.PostForm("grant_type"),
+		Code:         ctx.PostForm("code"),
+		RedirectURI:  ctx.PostForm("redirect_uri"),
+		ClientId:     ctx.PostForm("client_id"),
+		ClientSecret: ctx.PostForm("client_secret"),
+		CodeVerifier: ctx.PostForm("code_verifier"),
+	}
+
+	// client_secret_basic, form encoded as rfc 6749 2.3.1 wants
+	if id, secret, ok := ctx.Request.BasicAuth(); ok {
+		opts.ClientId, _ = url.QueryUnescape(id)
+		opts.ClientSecret, _ = url.QueryUnescape(secret)
+	}
+
+	resp, err := a.ctrl.OIDCToken(opts)
+	if err != nil {
+		writeOIDCErr(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
+
+func (a *Server) oidcUserInfo(ctx *gin.Context) {
+	ctx.Header("Access-Control-Allow-Origin", "*")
+
+	token, ok := bearerToken(ctx.GetHeader("Authorization"))
+	if !ok {
+		token = ctx.PostForm("access_token")
+	}
+
+	claims, err := a.ctrl.OIDCUserInfo(token)
+	if err != nil {
+		ctx.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeOIDCErr(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, claims)
+}
+
+func (a *Server) oidcPreflight(ctx *gin.Context) {
+	ctx.Header("Access-Control-Allow-Origin", "*")
+	ctx.Header("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	ctx.Header("Access-Control-Allow-Headers", "Authorization, Content-Type")
+	ctx.Status(http.StatusNoContent)
+}
+
+// consent page
+
+func (s *Server) oidcAuthorizeInfo(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
+	req := &actions.OIDCAuthorizeRequest{}
+	if err := ctx.ShouldBindQuery(req); err != nil {
+		return nil, err
+	}
+
+	return s.ctrl.GetOIDCAuthorizeInfo(claim.UserId, req)
+}
+
+func (s *Server) oidcAuthorizeDecide(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
+	var req struct {
+		actions.OIDCAuthorizeRequest
+		Approve bool `json:"approve"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		return nil, err
+	}
+
+	redirectURL, err := s.ctrl.OIDCAuthorize(claim.UserId, &req.OIDCAuthorizeRequest, req.Approve)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{"redirect_url": redirectURL}, nil
+}
+
+// client registrations
+
+func (s *Server) listOIDCClients(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
+	spaceId, err := strconv.ParseInt(ctx.Query("space_id"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.ctrl.ListOIDCClients(claim.UserId, spaceId)
+}
+
+func (s *Server) createOIDCClient(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
+	opts := &actions.CreateOIDCClientOpts{}
+	if err := ctx.ShouldBindJSON(opts); err != nil {
+		return nil, err
+	}
+
+	return s.ctrl.CreateOIDCClient(claim.UserId, opts)
+}
+
+func (s *Server) updateOIDCClient(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &actions.UpdateOIDCClientOpts{}
+	if err := ctx.ShouldBindJSON(opts); err != nil {
+		return nil, err
+	}
+
+	return s.ctrl.UpdateOIDCClient(claim.UserId, id, opts)
+}
+
+func (s *Server) deleteOIDCClient(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.ctrl.DeleteOIDCClient(claim.UserId, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{"message": "Client deleted"}, nil
+}
+
+func (s *Server) rotateOIDCClientSecret(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.ctrl.RotateOIDCClientSecret(claim.UserId, id)
+}
+
+func writeOIDCErr(ctx *gin.Context, err error) {
+	oerr := &actions.OIDCError{}
+	if !errors.As(err, &oerr) {
+		ctx.JSON(http.StatusInternalServerError, actions.OIDCError{Code: "server_error"})
+		return
+	}
+
+	status := http.StatusBadRequest
+	if oerr.Code == "invalid_client" || oerr.Code == "invalid_token" {
+		status = http.StatusUnauthorized
+	}
+
+	ctx.JSON(status, oerr)
+}
+
+func bearerToken(header string) (string, bool) {
+	const prefix = "Bearer "
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", false
+	}
+	return header[len(prefix):], true
+}
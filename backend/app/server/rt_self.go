@@ -1,6 +1,8 @@
 package server
 
 import (
+	"strconv"
+
 	"github.com/blue-monads/potatoverse/backend/services/signer"
 	"github.com/gin-gonic/gin"
 )
@@ -66,3 +68,83 @@ func (s *Server) selfCreateDevice(claim *signer.AccessClaim, ctx *gin.Context) (
 	}
 	return s.ctrl.CreateNewDevice(claim.UserId, req.Name)
 }
+
+func (s *Server) selfRevokeDevice(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.ctrl.RevokeSelfDevice(claim.UserId, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{"message": "Device revoked"}, nil
+}
+
+func (s *Server) selfLogoutAll(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
+	err := s.ctrl.LogoutAll(claim.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{"message": "Logged out everywhere"}, nil
+}
+
+func (s *Server) selfTwoFactorStatus(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
+	return s.ctrl.GetTwoFactorStatus(claim.UserId)
+}
+
+func (s *Server) selfTwoFactorEnroll(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
+	return s.ctrl.BeginTwoFactorEnroll(claim.UserId)
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+func (s *Server) selfTwoFactorConfirm(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
+	var req TwoFactorCodeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		return nil, err
+	}
+
+	codes, err := s.ctrl.ConfirmTwoFactorEnroll(claim.UserId, req.Code)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{"recovery_codes": codes}, nil
+}
+
+func (s *Server) selfTwoFactorDisable(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
+	var req struct {
+		Password string `json:"password" binding:"required"`
+		Code     string `json:"code" binding:"required"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		return nil, err
+	}
+
+	err := s.ctrl.DisableTwoFactor(claim.UserId, req.Password, req.Code)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{"message": "Two factor authentication disabled"}, nil
+}
+
+func (s *Server) selfTwoFactorRecoveryCodes(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
+	var req TwoFactorCodeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		return nil, err
+	}
+
+	codes, err := s.ctrl.RegenerateRecoveryCodes(claim.UserId, req.Code)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{"recovery_codes": codes}, nil
+}
@@ -213,8 +213,6 @@ func (a *Server) adminUploadFileWithPresigned(ctx *gin.Context) {
 		return
 	}
 
-	// TODO: Add expiry validation based on claim.Expiry
-
 	// Parse multipart form
 	err = ctx.Request.ParseMultipartForm(32 << 20) // 32 MB max
 	if err != nil {
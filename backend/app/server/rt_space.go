@@ -1,6 +1,7 @@
 package server
 
 import (
+	"encoding/json"
 	"errors"
 	"strconv"
 
@@ -481,3 +482,142 @@ func (a *Server) DeleteEventSubscription(claim *signer.AccessClaim, ctx *gin.Con
 
 	return gin.H{"message": "Event subscription deleted successfully"}, nil
 }
+
+type deadTargetsRequest struct {
+	SubscriptionId int64   `json:"subscription_id"`
+	TargetIds      []int64 `json:"target_ids"`
+	All            bool    `json:"all"`
+}
+
+// ListDeadEventTargets lists dead lettered event targets of a space/package
+func (a *Server) ListDeadEventTargets(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
+	installId, err := strconv.ParseInt(ctx.Param("install_id"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	err = a.ctrl.IsUserPackageAdmin(claim.UserId, installId)
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptionId, _ := strconv.ParseInt(ctx.Query("subscription_id"), 10, 64)
+	offset, _ := strconv.Atoi(ctx.Query("offset"))
+	limit, _ := strconv.Atoi(ctx.Query("limit"))
+
+	return a.ctrl.QueryDeadEventTargets(installId, subscriptionId, offset, limit)
+}
+
+// ListEventTargetAttempts lists delivery attempts of an event target
+func (a *Server) ListEventTargetAttempts(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
+	installId, err := strconv.ParseInt(ctx.Param("install_id"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	targetId, err := strconv.ParseInt(ctx.Param("targetId"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	err = a.ctrl.IsUserPackageAdmin(claim.UserId, installId)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.ctrl.ListEventTargetAttempts(installId, targetId)
+}
+
+// ReplayDeadEventTargets moves dead targets back to the queue
+func (a *Server) ReplayDeadEventTargets(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
+	installId, req, err := bindDeadTargetsRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = a.ctrl.IsUserPackageAdmin(claim.UserId, installId)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := a.ctrl.ReplayDeadEventTargets(installId, req.SubscriptionId, req.TargetIds)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{"target_ids": ids}, nil
+}
+
+// DiscardDeadEventTargets drops dead targets without delivering them
+func (a *Server) DiscardDeadEventTargets(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
+	installId, req, err := bindDeadTargetsRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = a.ctrl.IsUserPackageAdmin(claim.UserId, installId)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := a.ctrl.DiscardDeadEventTargets(installId, req.SubscriptionId, req.TargetIds)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{"target_ids": ids}, nil
+}
+
+func bindDeadTargetsRequest(ctx *gin.Context) (int64, *deadTargetsRequest, error) {
+	installId, err := strconv.ParseInt(ctx.Param("install_id"), 10, 64)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	req := &deadTargetsRequest{}
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		return 0, nil, err
+	}
+
+	// bulk actions over everything must be asked for explicitly
+	if len(req.TargetIds) == 0 && !req.All {
+		return 0, nil, errors.New("target_ids or all is required")
+	}
+
+	return installId, req, nil
+}
+
+type eventDryRunRequest struct {
+	EventId   int64           `json:"event_id"`
+	Payload   json.RawMessage `json:"payload"`
+	Rules     *string         `json:"rules"`
+	Transform *string         `json:"transform"`
+}
+
+// DryRunEventSubscription shows the rule result and transformed payload of a
+// subscription for a sample event
+func (a *Server) DryRunEventSubscription(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
+	installId, err := strconv.ParseInt(ctx.Param("install_id"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptionId, err := strconv.ParseInt(ctx.Param("subscriptionId"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	// event_id reads a stored payload, so this needs the same rights as
+	// the rest of the install's event routes
+	err = a.ctrl.IsUserPackageAdmin(claim.UserId, installId)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &eventDryRunRequest{}
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		return nil, err
+	}
+
+	return a.ctrl.DryRunEventSubscription(installId, subscriptionId, req.EventId, req.Payload, req.Rules, req.Transform)
+}
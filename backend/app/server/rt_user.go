@@ -167,6 +167,34 @@ func (s *Server) createUserDirectly(claim *signer.AccessClaim, ctx *gin.Context)
 	return user, nil
 }
 
+func (s *Server) revokeUserSessions(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.ctrl.RevokeUserSessions(claim.UserId, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{"message": "User sessions revoked"}, nil
+}
+
+func (s *Server) resetUserTwoFactor(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.ctrl.ResetUserTwoFactor(claim.UserId, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{"message": "Two factor authentication reset"}, nil
+}
+
 /*
 AddUser
 ResetUserPassword
@@ -85,3 +85,25 @@ func (s *Server) deleteUserGroup(claim *signer.AccessClaim, ctx *gin.Context) (a
 
 	return gin.H{"message": "User group deleted successfully"}, nil
 }
+
+func (s *Server) setUserGroupRequire2FA(claim *signer.AccessClaim, ctx *gin.Context) (any, error) {
+	name := ctx.Param("name")
+	if name == "" {
+		return nil, errors.New("name parameter is required")
+	}
+
+	var req struct {
+		Required bool `json:"required"`
+	}
+
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		return nil, err
+	}
+
+	err := s.ctrl.SetGroupRequireTwoFactor(claim.UserId, name, req.Required)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{"message": "User group updated successfully"}, nil
+}
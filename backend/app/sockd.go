@@ -0,0 +1,96 @@
+package app
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/blue-monads/potatoverse/backend/services/sockd"
+	"github.com/blue-monads/potatoverse/backend/services/sockd/backplane"
+	"github.com/blue-monads/potatoverse/backend/utils/nostrutils"
+)
+
+// newSockd picks the backplane from config, sockets of peer nodes are only
+// reached with the sqlite or buddy backplane
+func newSockd(opt Option) *sockd.Sockd {
+	sopts := opt.AppOpts.Sockd
+	if sopts == nil || sopts.Backplane == "" || sopts.Backplane == "local" {
+		return sockd.NewSockd()
+	}
+
+	bp, err := newBackplane(opt)
+	if err != nil {
+		opt.Logger.Error("Failed to start sockd backplane, falling back to local", "backplane", sopts.Backplane, "err", err)
+		return sockd.NewSockd()
+	}
+
+	return sockd.NewClusterSockd(bp)
+}
+
+func newBackplane(opt Option) (backplane.Backplane, error) {
+	sopts := opt.AppOpts.Sockd
+
+	nodeId := backplaneNodeId(opt)
+
+	switch sopts.Backplane {
+	case "sqlite":
+		var sdb *sql.DB
+
+		if sopts.SqliteFile != "" {
+			db, err := sql.Open("sqlite3", sopts.SqliteFile)
+			if err != nil {
+				return nil, err
+			}
+			sdb = db
+		} else {
+			sdb = opt.Database.GetSession().Driver().(*sql.DB)
+		}
+
+		return backplane.NewSQLite(backplane.SQLiteOptions{
+			NodeId:       nodeId,
+			DB:           sdb,
+			PollInterval: time.Duration(sopts.PollInterval) * time.Millisecond,
+		})
+
+	case "buddy":
+		bhub := opt.BuddyHub
+		privkey := bhub.GetPrivkey()
+
+		bp := backplane.NewBuddy(backplane.BuddyOptions{
+			NodeId: nodeId,
+			Peers:  sopts.Peers,
+			Sender: bhub,
+			Sign: func(req *http.Request) error {
+				token, err := nostrutils.GenerateNostrAuthToken(privkey, req.URL.String(), req.Method)
+				if err != nil {
+					return err
+				}
+				req.Header.Set("X-Buddy-Auth", token)
+				return nil
+			},
+		})
+
+		bhub.SetBackplaneReceiver(bp.Receive)
+
+		return bp, nil
+	}
+
+	return nil, fmt.Errorf("unknown sockd backplane: %s", sopts.Backplane)
+}
+
+// backplaneNodeId is unique per process, several processes may run with
+// the same node keys on one sqlite file
+func backplaneNodeId(opt Option) string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+
+	pubkey := "node"
+	if opt.BuddyHub != nil {
+		pubkey = opt.BuddyHub.GetPubkey()
+	}
+
+	return pubkey + "/" + hex.EncodeToString(suffix)
+}
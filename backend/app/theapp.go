@@ -55,7 +55,7 @@ func New(opt Option) *App {
 		HttpPort:      opt.AppOpts.Port,
 	})
 
-	sockd := sockd.NewSockd()
+	sockd := newSockd(opt)
 
 	happ := &App{
 		db:     opt.Database,
@@ -68,6 +68,7 @@ func New(opt Option) *App {
 			AppOpts:  opt.AppOpts,
 			Engine:   engine,
 			Mailer:   opt.Mailer,
+			BuddyHub: opt.BuddyHub,
 		}),
 		engine:  engine,
 		sockd:   sockd,
@@ -153,6 +154,12 @@ func (h *App) Start() error {
 		h.logger.Warn("Master secret hash has changed, updating fingerprint")
 	}
 
+	err = h.ctrl.LoadRevokedDevices()
+	if err != nil {
+		h.logger.Error("Failed to load revoked devices", "err", err)
+		return err
+	}
+
 	err = h.coreHub.Run()
 	if err != nil {
 		h.logger.Error("Failed to run core hub", "err", err)
@@ -163,6 +170,14 @@ func (h *App) Start() error {
 
 }
 
+// Stop stops background work started by Start, the http server is left to
+// exit with the process
+func (h *App) Stop() {
+	h.engine.Stop()
+
+	h.logger.Info("HeadLess application stopped")
+}
+
 // shared methods for App
 
 func (h *App) Database() datahub.Database {
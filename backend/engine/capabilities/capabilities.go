@@ -7,6 +7,10 @@ import (
 	_ "github.com/blue-monads/potatoverse/backend/engine/capabilities/xDatabase/xSeeder/xAutoSeeder"
 	_ "github.com/blue-monads/potatoverse/backend/engine/capabilities/xDatabase/xSeeder/xStaticSeeder"
 
+	// xextern
+	_ "github.com/blue-monads/potatoverse/backend/engine/capabilities/xExtern/xLlm"
+	_ "github.com/blue-monads/potatoverse/backend/engine/capabilities/xExtern/xShell"
+
 	// xfiles
 	_ "github.com/blue-monads/potatoverse/backend/engine/capabilities/xFiles"
 	_ "github.com/blue-monads/potatoverse/backend/engine/capabilities/xFiles/xFileRelay"
@@ -14,6 +18,7 @@ import (
 	// xsystem
 	_ "github.com/blue-monads/potatoverse/backend/engine/capabilities/xSystem/xCorn"
 	_ "github.com/blue-monads/potatoverse/backend/engine/capabilities/xSystem/xEngine/xLua"
+	_ "github.com/blue-monads/potatoverse/backend/engine/capabilities/xSystem/xLock"
 	_ "github.com/blue-monads/potatoverse/backend/engine/capabilities/xSystem/xPing"
 	_ "github.com/blue-monads/potatoverse/backend/engine/capabilities/xSystem/xSqlite"
 
@@ -23,5 +28,7 @@ import (
 
 	// xwebsocket
 	_ "github.com/blue-monads/potatoverse/backend/engine/capabilities/xWebsocket"
+	_ "github.com/blue-monads/potatoverse/backend/engine/capabilities/xWebsocket/fanout"
+	_ "github.com/blue-monads/potatoverse/backend/engine/capabilities/xWebsocket/relayws"
 	_ "github.com/blue-monads/potatoverse/backend/engine/capabilities/xWebsocket/xEasyWS"
 )
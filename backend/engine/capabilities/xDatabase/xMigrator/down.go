@@ -0,0 +1,124 @@
+package migrator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/blue-monads/potatoverse/backend/services/datahub"
+	"github.com/blue-monads/potatoverse/backend/services/datahub/dbmodels"
+)
+
+/*
+
+down migrations sit next to their up migration, 003_todos.sql is reverted
+by 003_todos.down.sql. they only run on package rollback, run_migrations
+never picks them up.
+
+*/
+
+const downSuffix = ".down.sql"
+
+func isUpMigration(file dbmodels.FileMeta) bool {
+	name := strings.ToLower(file.Name)
+	return !file.IsFolder && strings.HasSuffix(name, ".sql") && !strings.HasSuffix(name, downSuffix)
+}
+
+func downMigrationName(name string) string {
+	return strings.TrimSuffix(name, ".sql") + downSuffix
+}
+
+// RollbackMigrations reverts executed migrations that exist in the fromPvId
+// version but not in toPvId, newest first, using the down files shipped with
+// fromPvId. it returns the reverted migration file names.
+func RollbackMigrations(database datahub.Database, installId, fromPvId, toPvId int64, folder string) ([]string, error) {
+	if folder == "" {
+		folder = "migrations"
+	}
+
+	pkgFileOps := database.GetPackageFileOps()
+
+	fromFiles, err := pkgFileOps.ListFiles(fromPvId, folder)
+	if err != nil {
+		return nil, err
+	}
+
+	toFiles, err := pkgFileOps.ListFiles(toPvId, folder)
+	if err != nil {
+		return nil, err
+	}
+
+	kept := make(map[string]bool)
+	for _, file := range toFiles {
+		if isUpMigration(file) {
+			kept[file.Name] = true
+		}
+	}
+
+	downFiles := make(map[string]dbmodels.FileMeta)
+	upFiles := []dbmodels.FileMeta{}
+	for _, file := range fromFiles {
+		if file.IsFolder {
+			continue
+		}
+		if strings.HasSuffix(strings.ToLower(file.Name), downSuffix) {
+			downFiles[file.Name] = file
+			continue
+		}
+		if isUpMigration(file) && !kept[file.Name] {
+			upFiles = append(upFiles, file)
+		}
+	}
+
+	sort.Slice(upFiles, func(i, j int) bool {
+		return upFiles[i].Name > upFiles[j].Name
+	})
+
+	kvOps := database.GetSpaceKVOps()
+
+	executed, err := kvOps.QuerySpaceKV(installId, map[any]any{"group": "migrations"}, 0, 1000)
+	if err != nil {
+		return nil, err
+	}
+
+	executedKeys := make(map[string]bool)
+	for _, mig := range executed {
+		executedKeys[mig.Key] = true
+	}
+
+	db := database.GetLowPackageDBOps(installId)
+	reverted := []string{}
+
+	for _, file := range upFiles {
+		migrationKey := getMigrationKey(folder, file)
+		if !executedKeys[migrationKey] {
+			continue
+		}
+
+		down, ok := downFiles[downMigrationName(file.Name)]
+		if !ok {
+			return reverted, fmt.Errorf("no down migration for %s", file.Name)
+		}
+
+		content, err := pkgFileOps.GetFileContentByPath(fromPvId, down.Path, down.Name)
+		if err != nil {
+			return reverted, fmt.Errorf("failed to read down migration %s: %w", down.Name, err)
+		}
+
+		if strings.TrimSpace(string(content)) != "" {
+			_, err = db.Exec(string(content))
+			if err != nil {
+				return reverted, fmt.Errorf("failed to execute down migration %s: %w", down.Name, err)
+			}
+		}
+
+		err = kvOps.RemoveSpaceKV(installId, "migrations", migrationKey)
+		if err != nil {
+			return reverted, err
+		}
+
+		reverted = append(reverted, file.Name)
+	}
+
+	return reverted, nil
+}
@@ -61,7 +61,7 @@ func (m *MigratorCapability) Execute(name string, params lazydata.LazyData) (any
 
 		migrations := []map[string]any{}
 		for _, file := range files {
-			if !file.IsFolder && strings.HasSuffix(strings.ToLower(file.Name), ".sql") {
+			if isUpMigration(file) {
 
 				migrationKey := getMigrationKey(folder, file)
 				migrations = append(migrations, map[string]any{
@@ -82,10 +82,17 @@ func (m *MigratorCapability) Execute(name string, params lazydata.LazyData) (any
 
 func (m *MigratorCapability) Reload(model *dbmodels.SpaceCapability) (xcapability.Capability, error) {
 
+	// the package may have been upgraded or rolled back since the last build
+	installPvId := m.installPvId
+	pkg, err := m.builder.app.Database().GetPackageInstallOps().GetPackage(m.installId)
+	if err == nil {
+		installPvId = pkg.ActiveInstallID
+	}
+
 	return &MigratorCapability{
 		folder:       m.folder,
 		builder:      m.builder,
-		installPvId:  m.installPvId,
+		installPvId:  installPvId,
 		installId:    m.installId,
 		spaceId:      m.spaceId,
 		capabilityId: m.capabilityId,
@@ -129,7 +136,7 @@ func (m *MigratorCapability) performMigration(folder string) error {
 	// Filter only .sql files
 	sqlFiles := []dbmodels.FileMeta{}
 	for _, file := range files {
-		if !file.IsFolder && strings.HasSuffix(strings.ToLower(file.Name), ".sql") {
+		if isUpMigration(file) {
 			sqlFiles = append(sqlFiles, file)
 		}
 	}
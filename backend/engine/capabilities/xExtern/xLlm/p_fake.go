@@ -0,0 +1,113 @@
+package xLlm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"strings"
+)
+
+// fake is an in-process deterministic provider so apps can be developed and
+// tested offline, the same request always produces the same output.
+
+const fakeEmbedDims = 16
+
+func init() {
+	RegisterProvider("fake", func(cfg *ProviderConfig) (Provider, error) {
+		return &FakeProvider{}, nil
+	})
+}
+
+type FakeProvider struct{}
+
+func (p *FakeProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	prompt := ""
+	for i := len(req.Messages) - 1; i >= 0; i-- {
+		if req.Messages[i].Role == "user" {
+			prompt = req.Messages[i].Content
+			break
+		}
+	}
+
+	promptTokens := 0
+	for _, msg := range req.Messages {
+		promptTokens += countTokens(msg.Content)
+	}
+
+	return p.respond(req.Model, prompt, promptTokens, req.MaxTokens), nil
+}
+
+func (p *FakeProvider) ChatStream(ctx context.Context, req *ChatRequest, onDelta func(delta string)) (*ChatResponse, error) {
+	resp, err := p.Chat(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	words := strings.SplitAfter(resp.Content, " ")
+	for _, word := range words {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		onDelta(word)
+	}
+
+	return resp, nil
+}
+
+func (p *FakeProvider) Complete(ctx context.Context, req *CompleteRequest) (*ChatResponse, error) {
+	return p.respond(req.Model, req.Prompt, countTokens(req.Prompt), req.MaxTokens), nil
+}
+
+func (p *FakeProvider) Embed(ctx context.Context, req *EmbedRequest) (*EmbedResponse, error) {
+	out := &EmbedResponse{
+		Model:      fakeModel(req.Model),
+		Embeddings: make([][]float64, 0, len(req.Input)),
+	}
+
+	for _, input := range req.Input {
+		sum := sha256.Sum256([]byte(input))
+		vec := make([]float64, fakeEmbedDims)
+		for i := range vec {
+			v := binary.BigEndian.Uint16(sum[(i*2)%len(sum):])
+			vec[i] = float64(v)/32767.5 - 1
+		}
+		out.Embeddings = append(out.Embeddings, vec)
+		out.Usage.PromptTokens += countTokens(input)
+	}
+
+	out.Usage.TotalTokens = out.Usage.PromptTokens
+
+	return out, nil
+}
+
+func (p *FakeProvider) respond(model, prompt string, promptTokens, maxTokens int) *ChatResponse {
+	words := strings.Fields("echo: " + prompt)
+	finish := "stop"
+
+	if maxTokens > 0 && len(words) > maxTokens {
+		words = words[:maxTokens]
+		finish = "length"
+	}
+
+	return &ChatResponse{
+		Model:        fakeModel(model),
+		Content:      strings.Join(words, " "),
+		FinishReason: finish,
+		Usage: Usage{
+			PromptTokens:     promptTokens,
+			CompletionTokens: len(words),
+			TotalTokens:      promptTokens + len(words),
+		},
+	}
+}
+
+func fakeModel(model string) string {
+	if model == "" {
+		return "fake"
+	}
+	return model
+}
+
+func countTokens(s string) int {
+	return len(strings.Fields(s))
+}
@@ -0,0 +1,216 @@
+package xLlm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+func init() {
+	RegisterProvider("ollama", func(cfg *ProviderConfig) (Provider, error) {
+		baseURL := cfg.BaseURL
+		if baseURL == "" {
+			baseURL = "http://localhost:11434"
+		}
+
+		return &OllamaProvider{
+			baseURL: strings.TrimRight(baseURL, "/"),
+			apiKey:  cfg.ApiKey,
+			client:  &http.Client{Timeout: cfg.Timeout},
+		}, nil
+	})
+}
+
+type OllamaProvider struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+type ollamaOptions struct {
+	NumPredict  int      `json:"num_predict,omitempty"`
+	Temperature float64  `json:"temperature,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+}
+
+type ollamaRequest struct {
+	Model    string         `json:"model"`
+	Messages []Message      `json:"messages,omitempty"`
+	Prompt   string         `json:"prompt,omitempty"`
+	Stream   bool           `json:"stream"`
+	Options  *ollamaOptions `json:"options,omitempty"`
+}
+
+type ollamaResponse struct {
+	Model   string `json:"model"`
+	Message struct {
+		Content string `json:"content"`
+	} `json:"message"`
+	Response        string `json:"response"`
+	Done            bool   `json:"done"`
+	DoneReason      string `json:"done_reason"`
+	PromptEvalCount int    `json:"prompt_eval_count"`
+	EvalCount       int    `json:"eval_count"`
+}
+
+func (r *ollamaResponse) usage() Usage {
+	return Usage{
+		PromptTokens:     r.PromptEvalCount,
+		CompletionTokens: r.EvalCount,
+		TotalTokens:      r.PromptEvalCount + r.EvalCount,
+	}
+}
+
+func (p *OllamaProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	resp := &ollamaResponse{}
+	err := p.post(ctx, "/api/chat", &ollamaRequest{
+		Model:    req.Model,
+		Messages: req.Messages,
+		Options:  &ollamaOptions{NumPredict: req.MaxTokens, Temperature: req.Temperature, Stop: req.Stop},
+	}, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ChatResponse{
+		Model:        resp.Model,
+		Content:      resp.Message.Content,
+		FinishReason: resp.DoneReason,
+		Usage:        resp.usage(),
+	}, nil
+}
+
+func (p *OllamaProvider) ChatStream(ctx context.Context, req *ChatRequest, onDelta func(delta string)) (*ChatResponse, error) {
+	body, err := p.do(ctx, "/api/chat", &ollamaRequest{
+		Model:    req.Model,
+		Messages: req.Messages,
+		Stream:   true,
+		Options:  &ollamaOptions{NumPredict: req.MaxTokens, Temperature: req.Temperature, Stop: req.Stop},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	out := &ChatResponse{Model: req.Model}
+	var content strings.Builder
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		chunk := &ollamaResponse{}
+		if err := json.Unmarshal(scanner.Bytes(), chunk); err != nil {
+			continue
+		}
+
+		if chunk.Message.Content != "" {
+			content.WriteString(chunk.Message.Content)
+			onDelta(chunk.Message.Content)
+		}
+
+		if chunk.Done {
+			out.Model = chunk.Model
+			out.FinishReason = chunk.DoneReason
+			out.Usage = chunk.usage()
+			break
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	out.Content = content.String()
+
+	return out, nil
+}
+
+func (p *OllamaProvider) Complete(ctx context.Context, req *CompleteRequest) (*ChatResponse, error) {
+	resp := &ollamaResponse{}
+	err := p.post(ctx, "/api/generate", &ollamaRequest{
+		Model:   req.Model,
+		Prompt:  req.Prompt,
+		Options: &ollamaOptions{NumPredict: req.MaxTokens, Temperature: req.Temperature, Stop: req.Stop},
+	}, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ChatResponse{
+		Model:        resp.Model,
+		Content:      resp.Response,
+		FinishReason: resp.DoneReason,
+		Usage:        resp.usage(),
+	}, nil
+}
+
+func (p *OllamaProvider) Embed(ctx context.Context, req *EmbedRequest) (*EmbedResponse, error) {
+	resp := &struct {
+		Model           string      `json:"model"`
+		Embeddings      [][]float64 `json:"embeddings"`
+		PromptEvalCount int         `json:"prompt_eval_count"`
+	}{}
+
+	err := p.post(ctx, "/api/embed", map[string]any{
+		"model": req.Model,
+		"input": req.Input,
+	}, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EmbedResponse{
+		Model:      resp.Model,
+		Embeddings: resp.Embeddings,
+		Usage: Usage{
+			PromptTokens: resp.PromptEvalCount,
+			TotalTokens:  resp.PromptEvalCount,
+		},
+	}, nil
+}
+
+func (p *OllamaProvider) post(ctx context.Context, path string, payload any, target any) error {
+	body, err := p.do(ctx, path, payload)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	return json.NewDecoder(body).Decode(target)
+}
+
+func (p *OllamaProvider) do(ctx context.Context, path string, payload any) (io.ReadCloser, error) {
+	out, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+path, bytes.NewReader(out))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("llm request failed: %d %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	return resp.Body, nil
+}
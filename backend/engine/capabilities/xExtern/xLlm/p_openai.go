@@ -0,0 +1,173 @@
+package xLlm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/blue-monads/potatoverse/backend/engine/executors/luaz/binds/bllm"
+	openrouter "github.com/revrost/go-openrouter"
+)
+
+// openai compatible endpoints (openai, openrouter, vllm, llama.cpp etc),
+// talks through the same client as the lua llm binding
+
+func init() {
+	RegisterProvider("openai", func(cfg *ProviderConfig) (Provider, error) {
+		baseURL := cfg.BaseURL
+		if baseURL == "" {
+			baseURL = "https://api.openai.com/v1"
+		}
+
+		return &OpenAIProvider{
+			client: bllm.NewClient(cfg.ApiKey, strings.TrimRight(baseURL, "/"), &http.Client{Timeout: cfg.Timeout}),
+		}, nil
+	})
+}
+
+type OpenAIProvider struct {
+	client *openrouter.Client
+}
+
+func (p *OpenAIProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	resp, err := p.client.CreateChatCompletion(ctx, chatCompletionRequest(req))
+	if err != nil {
+		return nil, err
+	}
+
+	out := &ChatResponse{Model: resp.Model, Usage: fromUsage(resp.Usage)}
+	if len(resp.Choices) > 0 {
+		out.Content = resp.Choices[0].Message.Content.Text
+		out.FinishReason = string(resp.Choices[0].FinishReason)
+	}
+
+	return out, nil
+}
+
+func (p *OpenAIProvider) ChatStream(ctx context.Context, req *ChatRequest, onDelta func(delta string)) (*ChatResponse, error) {
+	creq := chatCompletionRequest(req)
+	creq.StreamOptions = &openrouter.StreamOptions{IncludeUsage: true}
+
+	stream, err := p.client.CreateChatCompletionStream(ctx, creq)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	out := &ChatResponse{Model: req.Model}
+	var content strings.Builder
+
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if chunk.Model != "" {
+			out.Model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			out.Usage = fromUsage(chunk.Usage)
+		}
+
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content != "" {
+				content.WriteString(choice.Delta.Content)
+				onDelta(choice.Delta.Content)
+			}
+			if choice.FinishReason != "" {
+				out.FinishReason = string(choice.FinishReason)
+			}
+		}
+	}
+
+	// the client ends the stream quietly on a cancelled context
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	out.Content = content.String()
+
+	return out, nil
+}
+
+// Complete does not send stop, the client has no field for it on completions
+func (p *OpenAIProvider) Complete(ctx context.Context, req *CompleteRequest) (*ChatResponse, error) {
+	resp, err := p.client.CreateCompletion(ctx, openrouter.CompletionRequest{
+		Model:       req.Model,
+		Prompt:      req.Prompt,
+		MaxTokens:   req.MaxTokens,
+		Temperature: float32(req.Temperature),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := &ChatResponse{Model: resp.Model, Usage: fromUsage(resp.Usage)}
+	if len(resp.Choices) > 0 {
+		out.Content = resp.Choices[0].Text
+		out.FinishReason = string(resp.Choices[0].FinishReason)
+	}
+
+	return out, nil
+}
+
+func (p *OpenAIProvider) Embed(ctx context.Context, req *EmbedRequest) (*EmbedResponse, error) {
+	resp, err := p.client.CreateEmbeddings(ctx, openrouter.EmbeddingsRequest{
+		Model:          req.Model,
+		Input:          req.Input,
+		EncodingFormat: openrouter.EmbeddingsEncodingFormatFloat,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := &EmbedResponse{
+		Model:      resp.Model,
+		Embeddings: make([][]float64, len(req.Input)),
+	}
+
+	for _, d := range resp.Data {
+		if d.Index >= 0 && d.Index < len(out.Embeddings) {
+			out.Embeddings[d.Index] = d.Embedding.Vector
+		}
+	}
+
+	if resp.Usage != nil {
+		out.Usage = Usage{PromptTokens: resp.Usage.PromptTokens, TotalTokens: resp.Usage.TotalTokens}
+	}
+
+	return out, nil
+}
+
+func chatCompletionRequest(req *ChatRequest) openrouter.ChatCompletionRequest {
+	messages := make([]openrouter.ChatCompletionMessage, 0, len(req.Messages))
+	for _, m := range req.Messages {
+		messages = append(messages, bllm.Message(m.Role, m.Content))
+	}
+
+	return openrouter.ChatCompletionRequest{
+		Model:       req.Model,
+		Messages:    messages,
+		MaxTokens:   req.MaxTokens,
+		Temperature: float32(req.Temperature),
+		Stop:        req.Stop,
+	}
+}
+
+func fromUsage(usage *openrouter.Usage) Usage {
+	if usage == nil {
+		return Usage{}
+	}
+
+	return Usage{
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TotalTokens:      usage.TotalTokens,
+	}
+}
@@ -0,0 +1,108 @@
+package xLlm
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type ChatRequest struct {
+	Model       string    `json:"model"`
+	Messages    []Message `json:"messages"`
+	MaxTokens   int       `json:"max_tokens"`
+	Temperature float64   `json:"temperature"`
+	Stop        []string  `json:"stop"`
+}
+
+type CompleteRequest struct {
+	Model       string   `json:"model"`
+	Prompt      string   `json:"prompt"`
+	MaxTokens   int      `json:"max_tokens"`
+	Temperature float64  `json:"temperature"`
+	Stop        []string `json:"stop"`
+}
+
+type EmbedRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type ChatResponse struct {
+	Model        string `json:"model"`
+	Content      string `json:"content"`
+	FinishReason string `json:"finish_reason"`
+	Usage        Usage  `json:"usage"`
+}
+
+type EmbedResponse struct {
+	Model      string      `json:"model"`
+	Embeddings [][]float64 `json:"embeddings"`
+	Usage      Usage       `json:"usage"`
+}
+
+// Provider is a llm backend, ChatStream calls onDelta with each piece of
+// generated text and returns the assembled response once done.
+type Provider interface {
+	Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error)
+	ChatStream(ctx context.Context, req *ChatRequest, onDelta func(delta string)) (*ChatResponse, error)
+	Complete(ctx context.Context, req *CompleteRequest) (*ChatResponse, error)
+	Embed(ctx context.Context, req *EmbedRequest) (*EmbedResponse, error)
+}
+
+type ProviderConfig struct {
+	BaseURL string
+	ApiKey  string
+	Timeout time.Duration
+}
+
+type ProviderFactory func(cfg *ProviderConfig) (Provider, error)
+
+var (
+	providers     = make(map[string]ProviderFactory)
+	providersLock sync.RWMutex
+)
+
+func RegisterProvider(name string, factory ProviderFactory) {
+	providersLock.Lock()
+	defer providersLock.Unlock()
+
+	providers[name] = factory
+}
+
+func GetProvider(name string, cfg *ProviderConfig) (Provider, error) {
+	providersLock.RLock()
+	factory, ok := providers[name]
+	providersLock.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("llm provider not found: %s", name)
+	}
+
+	return factory(cfg)
+}
+
+func ProviderNames() []string {
+	providersLock.RLock()
+	defer providersLock.RUnlock()
+
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,117 @@
+package xLlm
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxStreamWait = 10 * time.Second
+	// finished streams nobody read are dropped after this
+	streamRetention = 5 * time.Minute
+)
+
+type llmStream struct {
+	id     string
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	text   strings.Builder
+	result *ChatResponse
+	err    error
+
+	// signalled on every delta and on completion
+	notify chan struct{}
+	done   chan struct{}
+}
+
+type StreamChunk struct {
+	StreamId     string `json:"stream_id"`
+	Delta        string `json:"delta"`
+	Offset       int    `json:"offset"`
+	Done         bool   `json:"done"`
+	Error        string `json:"error,omitempty"`
+	FinishReason string `json:"finish_reason,omitempty"`
+	Usage        *Usage `json:"usage,omitempty"`
+}
+
+func newStream(id string, cancel context.CancelFunc) *llmStream {
+	return &llmStream{
+		id:     id,
+		cancel: cancel,
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+}
+
+func (s *llmStream) push(delta string) {
+	s.mu.Lock()
+	s.text.WriteString(delta)
+	s.mu.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *llmStream) finish(result *ChatResponse, err error) {
+	s.mu.Lock()
+	s.result = result
+	s.err = err
+	s.mu.Unlock()
+
+	close(s.done)
+}
+
+// read returns text generated after offset, when nothing new is available
+// it waits up to wait for more.
+func (s *llmStream) read(offset int, wait time.Duration) *StreamChunk {
+	if wait > 0 && !s.hasNew(offset) {
+		select {
+		case <-s.notify:
+		case <-s.done:
+		case <-time.After(wait):
+		}
+	}
+
+	done := false
+	select {
+	case <-s.done:
+		done = true
+	default:
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	text := s.text.String()
+	offset = min(max(offset, 0), len(text))
+
+	chunk := &StreamChunk{
+		StreamId: s.id,
+		Delta:    text[offset:],
+		Offset:   len(text),
+		Done:     done,
+	}
+
+	if done {
+		if s.err != nil {
+			chunk.Error = s.err.Error()
+		}
+		if s.result != nil {
+			chunk.FinishReason = s.result.FinishReason
+			chunk.Usage = &s.result.Usage
+		}
+	}
+
+	return chunk
+}
+
+func (s *llmStream) hasNew(offset int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.text.Len() > offset
+}
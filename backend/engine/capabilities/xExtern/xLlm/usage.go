@@ -0,0 +1,52 @@
+package xLlm
+
+import (
+	"time"
+)
+
+// token usage is kept per install, day and model in one db for all xLlm
+// capabilities, an install with several of them (one per space) gets a
+// single total and rebuilding a capability does not reset it.
+const usageOwner = "xllm"
+
+const usageDDL = `CREATE TABLE IF NOT EXISTS llm_usage (
+	install_id INTEGER NOT NULL,
+	day TEXT NOT NULL,
+	model TEXT NOT NULL,
+	requests INTEGER NOT NULL DEFAULT 0,
+	prompt_tokens INTEGER NOT NULL DEFAULT 0,
+	completion_tokens INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (install_id, day, model)
+)`
+
+func (c *LlmCapability) recordUsage(model string, usage Usage) {
+	day := time.Now().UTC().Format("2006-01-02")
+
+	_, err := c.db.Exec(
+		`INSERT INTO llm_usage (install_id, day, model, requests, prompt_tokens, completion_tokens) VALUES (?, ?, ?, 1, ?, ?)
+		ON CONFLICT (install_id, day, model) DO UPDATE SET requests = requests + 1, prompt_tokens = prompt_tokens + ?, completion_tokens = completion_tokens + ?`,
+		c.installId, day, model, usage.PromptTokens, usage.CompletionTokens, usage.PromptTokens, usage.CompletionTokens,
+	)
+	if err != nil {
+		c.logger.Warn("could not record llm usage", "model", model, "err", err)
+	}
+}
+
+// usage returns the install's per model totals since the given day
+// (YYYY-MM-DD), all time when empty
+func (c *LlmCapability) usage(since string) ([]map[string]any, error) {
+	rows, err := c.db.RunQuery(
+		`SELECT model, SUM(requests) AS requests, SUM(prompt_tokens) AS prompt_tokens, SUM(completion_tokens) AS completion_tokens
+		FROM llm_usage WHERE install_id = ? AND day >= ? GROUP BY model ORDER BY model`,
+		c.installId, since,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if rows == nil {
+		return []map[string]any{}, nil
+	}
+
+	return rows, nil
+}
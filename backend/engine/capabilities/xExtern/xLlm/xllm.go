@@ -1 +1,453 @@
 package xLlm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/blue-monads/potatoverse/backend/registry"
+	"github.com/blue-monads/potatoverse/backend/services/datahub"
+	"github.com/blue-monads/potatoverse/backend/services/datahub/dbmodels"
+	xutils "github.com/blue-monads/potatoverse/backend/utils"
+	"github.com/blue-monads/potatoverse/backend/xtypes"
+	"github.com/blue-monads/potatoverse/backend/xtypes/lazydata"
+	"github.com/blue-monads/potatoverse/backend/xtypes/xcapability"
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	Name         = "xLlm"
+	Icon         = `<i class="fa-solid fa-robot"></i>`
+	OptionFields = []xcapability.CapabilityOptionField{
+		{
+			Name:        "Provider",
+			Key:         "provider",
+			Description: "LLM backend, openai works with any OpenAI compatible endpoint, fake is a deterministic offline provider for testing",
+			Type:        "select",
+			Default:     "openai",
+			Options:     []string{"openai", "ollama", "fake"},
+			Required:    true,
+		},
+		{
+			Name:        "Base URL",
+			Key:         "base_url",
+			Description: "Endpoint base url (e.g. https://openrouter.ai/api/v1 or http://localhost:11434)",
+			Type:        "text",
+			Default:     "",
+		},
+		{
+			Name:        "API Key",
+			Key:         "api_key",
+			Description: "API key sent as bearer token",
+			Type:        "api_key",
+			Default:     "",
+		},
+		{
+			Name:        "Model",
+			Key:         "model",
+			Description: "Default model for chat and complete",
+			Type:        "text",
+			Default:     "",
+		},
+		{
+			Name:        "Embed Model",
+			Key:         "embed_model",
+			Description: "Default model for embed",
+			Type:        "text",
+			Default:     "",
+		},
+		{
+			Name:        "Max Tokens",
+			Key:         "max_tokens",
+			Description: "Upper bound for max_tokens of a single request, 0 for no limit",
+			Type:        "number",
+			Default:     "0",
+		},
+		{
+			Name:        "Timeout",
+			Key:         "timeout",
+			Description: "Request timeout (e.g. '120s')",
+			Type:        "text",
+			Default:     "120s",
+		},
+	}
+)
+
+func init() {
+	registry.RegisterCapability(xcapability.CapabilityBuilderFactory{
+		Builder: func(app any) (xcapability.CapabilityBuilder, error) {
+			appTyped := app.(xtypes.App)
+			return &LlmBuilder{app: appTyped}, nil
+		},
+		Name:         Name,
+		Icon:         Icon,
+		OptionFields: OptionFields,
+	})
+}
+
+type LlmBuilder struct {
+	app xtypes.App
+}
+
+type LlmOptions struct {
+	Provider   string `json:"provider"`
+	BaseURL    string `json:"base_url"`
+	ApiKey     string `json:"api_key"`
+	Model      string `json:"model"`
+	EmbedModel string `json:"embed_model"`
+	MaxTokens  any    `json:"max_tokens"`
+	Timeout    string `json:"timeout"`
+}
+
+func (b *LlmBuilder) Name() string {
+	return Name
+}
+
+func (b *LlmBuilder) Build(handle xcapability.XCapabilityHandle) (xcapability.Capability, error) {
+	model := handle.GetModel()
+
+	var opts LlmOptions
+	if err := handle.GetOptions(&opts); err != nil {
+		return nil, fmt.Errorf("failed to parse options: %w", err)
+	}
+
+	if opts.Provider == "" {
+		opts.Provider = "openai"
+	}
+
+	timeout := 120 * time.Second
+	if opts.Timeout != "" {
+		dur, err := time.ParseDuration(opts.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout: %w", err)
+		}
+		timeout = dur
+	}
+
+	provider, err := GetProvider(opts.Provider, &ProviderConfig{
+		BaseURL: opts.BaseURL,
+		ApiKey:  opts.ApiKey,
+		Timeout: timeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	db := b.app.Database().GetLowDBOps("C", usageOwner)
+	if err := db.RunDDL(usageDDL); err != nil {
+		return nil, fmt.Errorf("failed to create usage table: %w", err)
+	}
+
+	maxTokens := 0
+	switch v := opts.MaxTokens.(type) {
+	case float64:
+		maxTokens = int(v)
+	case string:
+		fmt.Sscanf(v, "%d", &maxTokens)
+	}
+
+	return &LlmCapability{
+		builder:    b,
+		handle:     handle,
+		logger:     b.app.Logger().With("capability", Name, "capability_id", model.ID),
+		db:         db,
+		installId:  model.InstallID,
+		provider:   provider,
+		model:      opts.Model,
+		embedModel: opts.EmbedModel,
+		maxTokens:  maxTokens,
+		timeout:    timeout,
+		streams:    make(map[string]*llmStream),
+	}, nil
+}
+
+func (b *LlmBuilder) Serve(ctx *gin.Context) {}
+
+func (b *LlmBuilder) GetDebugData() map[string]any {
+	return map[string]any{
+		"name":      Name,
+		"providers": ProviderNames(),
+	}
+}
+
+type LlmCapability struct {
+	builder *LlmBuilder
+	handle  xcapability.XCapabilityHandle
+	logger  *slog.Logger
+
+	// usage db shared by every xLlm capability, rows are per install
+	db        datahub.DBLowOps
+	installId int64
+
+	provider   Provider
+	model      string
+	embedModel string
+	maxTokens  int
+	timeout    time.Duration
+
+	streams   map[string]*llmStream
+	streamsMu sync.Mutex
+}
+
+func (c *LlmCapability) Handle(ctx *gin.Context) {}
+
+func (c *LlmCapability) Reload(model *dbmodels.SpaceCapability) (xcapability.Capability, error) {
+	newCap, err := c.builder.Build(c.handle)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Close()
+
+	return newCap, nil
+}
+
+func (c *LlmCapability) Close() error {
+	c.streamsMu.Lock()
+	defer c.streamsMu.Unlock()
+
+	for id, s := range c.streams {
+		s.cancel()
+		delete(c.streams, id)
+	}
+
+	return nil
+}
+
+func (c *LlmCapability) ListActions() ([]string, error) {
+	return []string{
+		"chat",
+		"complete",
+		"embed",
+		"chat_stream",
+		"stream_read",
+		"stream_cancel",
+		"usage",
+	}, nil
+}
+
+func (c *LlmCapability) Execute(name string, params lazydata.LazyData) (any, error) {
+	switch name {
+	case "chat":
+		return c.chat(params)
+	case "complete":
+		return c.complete(params)
+	case "embed":
+		return c.embed(params)
+	case "chat_stream":
+		return c.chatStream(params)
+	case "stream_read":
+		return c.streamRead(params)
+	case "stream_cancel":
+		return c.streamCancel(params)
+	case "usage":
+		return c.usage(params.GetFieldAsString("since"))
+	default:
+		return nil, errors.New("unknown action: " + name)
+	}
+}
+
+func (c *LlmCapability) chat(params lazydata.LazyData) (*ChatResponse, error) {
+	req, err := c.chatRequest(params)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	resp, err := c.provider.Chat(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	c.recordUsage(req.Model, resp.Usage)
+
+	return resp, nil
+}
+
+func (c *LlmCapability) complete(params lazydata.LazyData) (*ChatResponse, error) {
+	req := &CompleteRequest{}
+	if err := params.AsJson(req); err != nil {
+		return nil, err
+	}
+
+	if req.Prompt == "" {
+		return nil, errors.New("prompt is required")
+	}
+
+	req.Model = c.pickModel(req.Model, c.model)
+	req.MaxTokens = c.capTokens(req.MaxTokens)
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	resp, err := c.provider.Complete(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	c.recordUsage(req.Model, resp.Usage)
+
+	return resp, nil
+}
+
+func (c *LlmCapability) embed(params lazydata.LazyData) (*EmbedResponse, error) {
+	req := &EmbedRequest{}
+	if err := params.AsJson(req); err != nil {
+		return nil, err
+	}
+
+	// a single string is accepted as text
+	if len(req.Input) == 0 {
+		if text := params.GetFieldAsString("text"); text != "" {
+			req.Input = []string{text}
+		}
+	}
+
+	if len(req.Input) == 0 {
+		return nil, errors.New("input is required")
+	}
+
+	req.Model = c.pickModel(req.Model, c.embedModel)
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	resp, err := c.provider.Embed(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	c.recordUsage(req.Model, resp.Usage)
+
+	return resp, nil
+}
+
+// chatStream starts generation in the background and returns a stream_id,
+// the text is then pulled with stream_read using the returned offsets.
+func (c *LlmCapability) chatStream(params lazydata.LazyData) (any, error) {
+	req, err := c.chatRequest(params)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := xutils.GenerateRandomString(16)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	stream := newStream(id, cancel)
+
+	c.streamsMu.Lock()
+	c.streams[id] = stream
+	c.streamsMu.Unlock()
+
+	go func() {
+		defer cancel()
+
+		resp, err := c.provider.ChatStream(ctx, req, stream.push)
+		if err == nil {
+			c.recordUsage(req.Model, resp.Usage)
+		}
+
+		stream.finish(resp, err)
+
+		time.AfterFunc(streamRetention, func() { c.removeStream(id) })
+	}()
+
+	return map[string]any{"stream_id": id}, nil
+}
+
+// stream_read params: stream_id, offset, wait (seconds, capped at 10s)
+func (c *LlmCapability) streamRead(params lazydata.LazyData) (*StreamChunk, error) {
+	stream, err := c.getStream(params.GetFieldAsString("stream_id"))
+	if err != nil {
+		return nil, err
+	}
+
+	wait := min(time.Duration(params.GetFieldAsFloat("wait")*float64(time.Second)), maxStreamWait)
+
+	chunk := stream.read(params.GetFieldAsInt("offset"), wait)
+	if chunk.Done {
+		c.removeStream(stream.id)
+	}
+
+	return chunk, nil
+}
+
+func (c *LlmCapability) streamCancel(params lazydata.LazyData) (any, error) {
+	stream, err := c.getStream(params.GetFieldAsString("stream_id"))
+	if err != nil {
+		return nil, err
+	}
+
+	stream.cancel()
+	c.removeStream(stream.id)
+
+	return map[string]any{"cancelled": stream.id}, nil
+}
+
+func (c *LlmCapability) chatRequest(params lazydata.LazyData) (*ChatRequest, error) {
+	req := &ChatRequest{}
+	if err := params.AsJson(req); err != nil {
+		return nil, err
+	}
+
+	// shorthand for a single user message
+	if len(req.Messages) == 0 {
+		if prompt := params.GetFieldAsString("prompt"); prompt != "" {
+			req.Messages = []Message{{Role: "user", Content: prompt}}
+		}
+	}
+
+	if len(req.Messages) == 0 {
+		return nil, errors.New("messages are required")
+	}
+
+	req.Model = c.pickModel(req.Model, c.model)
+	req.MaxTokens = c.capTokens(req.MaxTokens)
+
+	return req, nil
+}
+
+func (c *LlmCapability) pickModel(requested, fallback string) string {
+	if requested != "" {
+		return requested
+	}
+	return fallback
+}
+
+func (c *LlmCapability) capTokens(requested int) int {
+	if c.maxTokens <= 0 {
+		return requested
+	}
+
+	if requested <= 0 || requested > c.maxTokens {
+		return c.maxTokens
+	}
+
+	return requested
+}
+
+func (c *LlmCapability) getStream(id string) (*llmStream, error) {
+	c.streamsMu.Lock()
+	defer c.streamsMu.Unlock()
+
+	stream, ok := c.streams[id]
+	if !ok {
+		return nil, errors.New("stream not found")
+	}
+
+	return stream, nil
+}
+
+func (c *LlmCapability) removeStream(id string) {
+	c.streamsMu.Lock()
+	delete(c.streams, id)
+	c.streamsMu.Unlock()
+}
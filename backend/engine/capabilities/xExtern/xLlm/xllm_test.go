@@ -0,0 +1,217 @@
+package xLlm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blue-monads/potatoverse/backend/services/datahub"
+	"github.com/blue-monads/potatoverse/backend/xtypes/lazydata"
+)
+
+// usageDB records the usage writes, other DBLowOps methods are not used
+type usageDB struct {
+	datahub.DBLowOps
+
+	mu   sync.Mutex
+	rows [][]any
+}
+
+func (d *usageDB) Exec(query string, data ...any) (any, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.rows = append(d.rows, data)
+	return nil, nil
+}
+
+func (d *usageDB) recorded() [][]any {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.rows
+}
+
+func newTestCapability(provider Provider) (*LlmCapability, *usageDB) {
+	db := &usageDB{}
+
+	return &LlmCapability{
+		logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		db:        db,
+		installId: 7,
+		provider:  provider,
+		model:     "m1",
+		maxTokens: 4,
+		timeout:   5 * time.Second,
+		streams:   make(map[string]*llmStream),
+	}, db
+}
+
+func params(v string) lazydata.LazyData {
+	return lazydata.LazyDataBytes(v)
+}
+
+func TestFakeChat(t *testing.T) {
+	c, db := newTestCapability(&FakeProvider{})
+
+	out, err := c.Execute("chat", params(`{"prompt": "one two three four five"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := out.(*ChatResponse)
+
+	// max_tokens is capped at the capability limit
+	if resp.Content != "echo: one two three" || resp.FinishReason != "length" {
+		t.Fatalf("chat = %q (%s), want capped echo", resp.Content, resp.FinishReason)
+	}
+
+	again, err := c.Execute("chat", params(`{"prompt": "one two three four five"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.(*ChatResponse).Content != resp.Content {
+		t.Fatal("fake provider is not deterministic")
+	}
+
+	rows := db.recorded()
+	if len(rows) != 2 {
+		t.Fatalf("recorded %d usage rows, want 2", len(rows))
+	}
+	if rows[0][0] != int64(7) || rows[0][2] != "m1" || rows[0][3] != 5 || rows[0][4] != 4 {
+		t.Fatalf("usage row = %v, want install 7, model m1, 5 prompt and 4 completion tokens", rows[0])
+	}
+}
+
+func TestFakeEmbed(t *testing.T) {
+	c, _ := newTestCapability(&FakeProvider{})
+
+	out, err := c.Execute("embed", params(`{"input": ["a", "b", "a"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := out.(*EmbedResponse)
+	if len(resp.Embeddings) != 3 || len(resp.Embeddings[0]) != fakeEmbedDims {
+		t.Fatalf("embeddings shape = %d, want 3 of %d", len(resp.Embeddings), fakeEmbedDims)
+	}
+	if fmt.Sprint(resp.Embeddings[0]) != fmt.Sprint(resp.Embeddings[2]) {
+		t.Fatal("same input embedded differently")
+	}
+	if fmt.Sprint(resp.Embeddings[0]) == fmt.Sprint(resp.Embeddings[1]) {
+		t.Fatal("different inputs embedded the same")
+	}
+}
+
+func TestFakeChatStream(t *testing.T) {
+	c, db := newTestCapability(&FakeProvider{})
+	c.maxTokens = 0
+
+	out, err := c.Execute("chat_stream", params(`{"prompt": "hello there"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := out.(map[string]any)["stream_id"].(string)
+
+	text := ""
+	offset := 0
+	for range 20 {
+		chunk, err := c.Execute("stream_read", params(fmt.Sprintf(`{"stream_id": %q, "offset": %d, "wait": 1}`, id, offset)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sc := chunk.(*StreamChunk)
+		text += sc.Delta
+		offset = sc.Offset
+		if sc.Done {
+			if sc.Error != "" {
+				t.Fatal(sc.Error)
+			}
+			break
+		}
+	}
+
+	if text != "echo: hello there" {
+		t.Fatalf("streamed %q, want echo", text)
+	}
+	if len(db.recorded()) != 1 {
+		t.Fatal("stream usage was not recorded")
+	}
+
+	// a finished stream is dropped once read to the end
+	if _, err := c.Execute("stream_read", params(fmt.Sprintf(`{"stream_id": %q}`, id))); err == nil {
+		t.Fatal("expected stream not found")
+	}
+}
+
+func TestOpenAIProvider(t *testing.T) {
+	var gotAuth string
+	var gotBody map[string]any
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&gotBody)
+
+		if r.URL.Path != "/v1/chat/completions" {
+			http.NotFound(w, r)
+			return
+		}
+
+		if stream, _ := gotBody["stream"].(bool); stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "data: {\"model\":\"m2\",\"choices\":[{\"delta\":{\"content\":\"hi \"}}]}\n\n")
+			fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"there\"},\"finish_reason\":\"stop\"}]}\n\n")
+			fmt.Fprint(w, "data: {\"choices\":[],\"usage\":{\"prompt_tokens\":3,\"completion_tokens\":2,\"total_tokens\":5}}\n\n")
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+
+		fmt.Fprint(w, `{"model":"m2","choices":[{"message":{"role":"assistant","content":"hi there"},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`)
+	}))
+	defer srv.Close()
+
+	provider, err := GetProvider("openai", &ProviderConfig{BaseURL: srv.URL + "/v1/", ApiKey: "k1", Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := &ChatRequest{Model: "m2", Messages: []Message{{Role: "system", Content: "be brief"}, {Role: "user", Content: "hello"}}}
+
+	resp, err := provider.Chat(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Content != "hi there" || resp.Usage.TotalTokens != 5 {
+		t.Fatalf("chat = %+v", resp)
+	}
+	if gotAuth != "Bearer k1" {
+		t.Fatalf("authorization = %q", gotAuth)
+	}
+	if msgs, _ := gotBody["messages"].([]any); len(msgs) != 2 {
+		t.Fatalf("sent messages = %v", gotBody["messages"])
+	}
+
+	var deltas []string
+	resp, err = provider.ChatStream(context.Background(), req, func(delta string) {
+		deltas = append(deltas, delta)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(deltas, "") != "hi there" || resp.Content != "hi there" || resp.FinishReason != "stop" {
+		t.Fatalf("stream = %q, %+v", deltas, resp)
+	}
+	if resp.Model != "m2" || resp.Usage.TotalTokens != 5 {
+		t.Fatalf("stream usage = %+v", resp)
+	}
+}
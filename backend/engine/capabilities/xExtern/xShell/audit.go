@@ -0,0 +1,63 @@
+package xshell
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const auditDDL = `CREATE TABLE IF NOT EXISTS shell_audit (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	run_id TEXT NOT NULL,
+	command TEXT NOT NULL,
+	args TEXT NOT NULL DEFAULT '[]',
+	cwd TEXT NOT NULL DEFAULT '',
+	exit_code INTEGER NOT NULL DEFAULT -1,
+	error TEXT NOT NULL DEFAULT '',
+	duration_ms INTEGER NOT NULL DEFAULT 0,
+	stdout_bytes INTEGER NOT NULL DEFAULT 0,
+	stderr_bytes INTEGER NOT NULL DEFAULT 0,
+	started_at INTEGER NOT NULL DEFAULT 0
+)`
+
+// auditStart records the invocation before the process runs so a crash
+// or a killed run still leaves a trace.
+func (c *ShellCapability) auditStart(run *shellRun) int64 {
+	args, _ := json.Marshal(run.args)
+
+	c.logger.Info("shell command started", "run_id", run.id, "command", run.command, "cwd", run.dir)
+
+	id, err := c.db.Insert("shell_audit", map[string]any{
+		"run_id":     run.id,
+		"command":    run.command,
+		"args":       string(args),
+		"cwd":        run.dir,
+		"started_at": time.Now().UnixMilli(),
+	})
+	if err != nil {
+		c.logger.Warn("could not write audit record", "run_id", run.id, "err", err)
+		return 0
+	}
+
+	return id
+}
+
+func (c *ShellCapability) auditFinish(auditId int64, run *shellRun) {
+	out := run.output(0, 0)
+
+	c.logger.Info("shell command finished", "run_id", run.id, "command", run.command, "exit_code", out.ExitCode, "duration_ms", out.DurationMs)
+
+	if auditId == 0 {
+		return
+	}
+
+	err := c.db.UpdateById("shell_audit", auditId, map[string]any{
+		"exit_code":    out.ExitCode,
+		"error":        out.Error,
+		"duration_ms":  out.DurationMs,
+		"stdout_bytes": len(out.Stdout),
+		"stderr_bytes": len(out.Stderr),
+	})
+	if err != nil {
+		c.logger.Warn("could not update audit record", "run_id", run.id, "err", err)
+	}
+}
@@ -0,0 +1,156 @@
+package xshell
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/blue-monads/potatoverse/backend/registry"
+	"github.com/blue-monads/potatoverse/backend/xtypes"
+	"github.com/blue-monads/potatoverse/backend/xtypes/xcapability"
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	Name         = "xShell"
+	Icon         = `<i class="fa-solid fa-terminal"></i>`
+	OptionFields = []xcapability.CapabilityOptionField{
+		{
+			Name: "Commands",
+			Key:  "commands",
+			Description: `Allow-listed commands keyed by name, e.g. {"thumb": {"path": "/usr/bin/convert", ` +
+				`"args": ["{{input}}", "-resize", "{{size}}", "{{output}}"], "params": {"size": "^[0-9]+x[0-9]+$"}}}`,
+			Type:     "object",
+			Default:  "{}",
+			Required: true,
+		},
+		{
+			Name:        "Timeout",
+			Key:         "timeout",
+			Description: "Default timeout for a command run (e.g. '30s')",
+			Type:        "text",
+			Default:     "30s",
+		},
+		{
+			Name:        "Max Output",
+			Key:         "max_output",
+			Description: "Maximum bytes kept from each of stdout and stderr, extra output is dropped",
+			Type:        "number",
+			Default:     "1048576",
+		},
+		{
+			Name:        "Max Concurrent",
+			Key:         "max_concurrent",
+			Description: "Maximum number of commands running at the same time for this capability",
+			Type:        "number",
+			Default:     "4",
+		},
+	}
+)
+
+func init() {
+	registry.RegisterCapability(xcapability.CapabilityBuilderFactory{
+		Builder: func(app any) (xcapability.CapabilityBuilder, error) {
+			appTyped := app.(xtypes.App)
+			return &ShellBuilder{app: appTyped}, nil
+		},
+		Name:         Name,
+		Icon:         Icon,
+		OptionFields: OptionFields,
+	})
+}
+
+type ShellBuilder struct {
+	app xtypes.App
+}
+
+// CommandSpec is one allow-listed command, args are passed to the binary
+// as is (no shell) after {{param}} placeholders are filled in.
+type CommandSpec struct {
+	Path    string            `json:"path"`
+	Args    []string          `json:"args"`
+	Params  map[string]string `json:"params"` // param name -> regexp the value must match
+	Env     map[string]string `json:"env"`
+	Timeout string            `json:"timeout"`
+	// values starting with '-' are rejected unless allowed, so a param can
+	// not be turned into a flag
+	AllowDashValues bool `json:"allow_dash_values"`
+	AllowStdin      bool `json:"allow_stdin"`
+}
+
+type ShellOptions struct {
+	Commands      map[string]*CommandSpec `json:"commands"`
+	Timeout       string                  `json:"timeout"`
+	MaxOutput     json.Number             `json:"max_output"`
+	MaxConcurrent json.Number             `json:"max_concurrent"`
+}
+
+func (b *ShellBuilder) Name() string {
+	return Name
+}
+
+func (b *ShellBuilder) Build(handle xcapability.XCapabilityHandle) (xcapability.Capability, error) {
+	model := handle.GetModel()
+
+	var opts ShellOptions
+	if err := handle.GetOptions(&opts); err != nil {
+		return nil, fmt.Errorf("failed to parse options: %w", err)
+	}
+
+	commands, err := compileCommands(opts.Commands)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := 30 * time.Second
+	if opts.Timeout != "" {
+		timeout, err = time.ParseDuration(opts.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout: %w", err)
+		}
+	}
+
+	maxOutput := numberOr(opts.MaxOutput, 1<<20)
+	maxConcurrent := numberOr(opts.MaxConcurrent, 4)
+
+	db := b.app.Database().GetLowCapabilityDBOps(model.ID)
+	if err := db.RunDDL(auditDDL); err != nil {
+		return nil, fmt.Errorf("failed to create audit table: %w", err)
+	}
+
+	return &ShellCapability{
+		builder:   b,
+		handle:    handle,
+		installId: model.InstallID,
+		spaceId:   model.SpaceID,
+		db:        db,
+		logger:    b.app.Logger().With("capability", Name, "capability_id", model.ID),
+		commands:  commands,
+		timeout:   timeout,
+		maxOutput: int(maxOutput),
+		slots:     make(chan struct{}, maxConcurrent),
+		runs:      make(map[string]*shellRun),
+	}, nil
+}
+
+func (b *ShellBuilder) Serve(ctx *gin.Context) {}
+
+func (b *ShellBuilder) GetDebugData() map[string]any {
+	return map[string]any{
+		"name": Name,
+	}
+}
+
+func numberOr(n json.Number, fallback int64) int64 {
+	if n == "" {
+		return fallback
+	}
+
+	v, err := strconv.ParseInt(n.String(), 10, 64)
+	if err != nil || v <= 0 {
+		return fallback
+	}
+
+	return v
+}
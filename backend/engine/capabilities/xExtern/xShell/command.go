@@ -0,0 +1,99 @@
+package xshell
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var placeholderRe = regexp.MustCompile(`\{\{\s*([a-zA-Z0-9_]+)\s*\}\}`)
+
+type command struct {
+	name    string
+	spec    *CommandSpec
+	params  map[string]*regexp.Regexp
+	timeout time.Duration
+}
+
+func compileCommands(specs map[string]*CommandSpec) (map[string]*command, error) {
+	commands := make(map[string]*command, len(specs))
+
+	for name, spec := range specs {
+		if spec == nil || spec.Path == "" {
+			return nil, fmt.Errorf("command %s: path is required", name)
+		}
+
+		if !filepath.IsAbs(spec.Path) {
+			return nil, fmt.Errorf("command %s: path must be absolute", name)
+		}
+
+		cmd := &command{
+			name:   name,
+			spec:   spec,
+			params: make(map[string]*regexp.Regexp, len(spec.Params)),
+		}
+
+		for pname, pattern := range spec.Params {
+			re, err := regexp.Compile("^(?:" + pattern + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("command %s: param %s: %w", name, pname, err)
+			}
+			cmd.params[pname] = re
+		}
+
+		if spec.Timeout != "" {
+			dur, err := time.ParseDuration(spec.Timeout)
+			if err != nil {
+				return nil, fmt.Errorf("command %s: invalid timeout: %w", name, err)
+			}
+			cmd.timeout = dur
+		}
+
+		commands[name] = cmd
+	}
+
+	return commands, nil
+}
+
+// buildArgs fills every {{param}} placeholder of the arg templates, each
+// value is checked against the param pattern when the command declares one.
+func (c *command) buildArgs(values map[string]string) ([]string, error) {
+	for name, val := range values {
+		if strings.ContainsRune(val, 0) {
+			return nil, fmt.Errorf("param %s: contains NUL byte", name)
+		}
+
+		if !c.spec.AllowDashValues && strings.HasPrefix(val, "-") {
+			return nil, fmt.Errorf("param %s: value can not start with '-'", name)
+		}
+
+		if re, ok := c.params[name]; ok && !re.MatchString(val) {
+			return nil, fmt.Errorf("param %s: value not allowed", name)
+		}
+	}
+
+	args := make([]string, 0, len(c.spec.Args))
+
+	var missing []string
+
+	for _, tmpl := range c.spec.Args {
+		arg := placeholderRe.ReplaceAllStringFunc(tmpl, func(m string) string {
+			name := placeholderRe.FindStringSubmatch(m)[1]
+			val, ok := values[name]
+			if !ok {
+				missing = append(missing, name)
+			}
+			return val
+		})
+		args = append(args, arg)
+	}
+
+	if len(missing) > 0 {
+		return nil, errors.New("missing params: " + strings.Join(missing, ", "))
+	}
+
+	return args, nil
+}
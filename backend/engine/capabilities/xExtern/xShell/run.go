@@ -0,0 +1,169 @@
+package xshell
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+type shellRun struct {
+	id      string
+	command string
+	args    []string
+	dir     string
+
+	cmd    *exec.Cmd
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu        sync.Mutex
+	stdout    cappedBuffer
+	stderr    cappedBuffer
+	startedAt time.Time
+	endedAt   time.Time
+	exitCode  int
+	err       error
+	done      chan struct{}
+}
+
+type RunOutput struct {
+	RunId        string `json:"run_id"`
+	Done         bool   `json:"done"`
+	ExitCode     int    `json:"exit_code"`
+	Error        string `json:"error,omitempty"`
+	Stdout       string `json:"stdout"`
+	Stderr       string `json:"stderr"`
+	StdoutOffset int    `json:"stdout_offset"`
+	StderrOffset int    `json:"stderr_offset"`
+	Truncated    bool   `json:"truncated"`
+	DurationMs   int64  `json:"duration_ms"`
+}
+
+func (r *shellRun) start(stdin string) error {
+	if stdin != "" {
+		r.cmd.Stdin = strings.NewReader(stdin)
+	}
+
+	r.cmd.Stdout = &lockedWriter{mu: &r.mu, w: &r.stdout}
+	r.cmd.Stderr = &lockedWriter{mu: &r.mu, w: &r.stderr}
+
+	r.startedAt = time.Now()
+
+	if err := r.cmd.Start(); err != nil {
+		r.cancel()
+		return err
+	}
+
+	go func() {
+		err := r.cmd.Wait()
+		ctxErr := r.ctx.Err()
+		r.cancel()
+
+		r.mu.Lock()
+		r.endedAt = time.Now()
+		r.exitCode = r.cmd.ProcessState.ExitCode()
+		switch {
+		case errors.Is(ctxErr, context.DeadlineExceeded):
+			r.err = errors.New("timeout")
+		case errors.Is(ctxErr, context.Canceled):
+			r.err = errors.New("killed")
+		case err != nil:
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) {
+				r.err = err
+			}
+		}
+		r.mu.Unlock()
+
+		close(r.done)
+	}()
+
+	return nil
+}
+
+func (r *shellRun) isDone() bool {
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// output returns whatever was written after the given offsets, passing the
+// returned offsets back on the next read gives a stream of new output.
+func (r *shellRun) output(stdoutOffset, stderrOffset int) *RunOutput {
+	done := r.isDone()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := &RunOutput{
+		RunId:        r.id,
+		Done:         done,
+		Stdout:       r.stdout.from(stdoutOffset),
+		Stderr:       r.stderr.from(stderrOffset),
+		StdoutOffset: r.stdout.buf.Len(),
+		StderrOffset: r.stderr.buf.Len(),
+		Truncated:    r.stdout.truncated || r.stderr.truncated,
+		ExitCode:     -1,
+	}
+
+	if done {
+		out.ExitCode = r.exitCode
+		out.DurationMs = r.endedAt.Sub(r.startedAt).Milliseconds()
+		if r.err != nil {
+			out.Error = r.err.Error()
+		}
+	}
+
+	return out
+}
+
+type cappedBuffer struct {
+	buf       strings.Builder
+	limit     int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	remaining := b.limit - b.buf.Len()
+	if remaining <= 0 {
+		b.truncated = b.truncated || len(p) > 0
+		return len(p), nil
+	}
+
+	if len(p) > remaining {
+		b.buf.Write(p[:remaining])
+		b.truncated = true
+		return len(p), nil
+	}
+
+	b.buf.Write(p)
+	return len(p), nil
+}
+
+func (b *cappedBuffer) from(offset int) string {
+	s := b.buf.String()
+	if offset <= 0 {
+		return s
+	}
+	if offset >= len(s) {
+		return ""
+	}
+	return s[offset:]
+}
+
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  *cappedBuffer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
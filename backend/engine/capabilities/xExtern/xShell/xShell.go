@@ -1 +1,352 @@
 package xshell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/blue-monads/potatoverse/backend/services/datahub"
+	"github.com/blue-monads/potatoverse/backend/services/datahub/dbmodels"
+	xutils "github.com/blue-monads/potatoverse/backend/utils"
+	"github.com/blue-monads/potatoverse/backend/xtypes"
+	"github.com/blue-monads/potatoverse/backend/xtypes/lazydata"
+	"github.com/blue-monads/potatoverse/backend/xtypes/xcapability"
+	"github.com/gin-gonic/gin"
+)
+
+/*
+
+xShell runs only the commands an admin allow-listed in the capability
+options, never through a shell. `run` waits for the process, `start` returns
+a run_id and `read` streams output back in chunks using offsets.
+
+*/
+
+var (
+	ErrTooManyRuns = errors.New("too many commands running")
+	ErrRunNotFound = errors.New("run not found")
+)
+
+const (
+	maxReadWait = 10 * time.Second
+	// finished runs nobody read are dropped after this
+	runRetention = 5 * time.Minute
+)
+
+type ShellCapability struct {
+	builder *ShellBuilder
+	handle  xcapability.XCapabilityHandle
+	logger  *slog.Logger
+
+	installId int64
+	spaceId   int64
+	db        datahub.DBLowOps
+
+	commands  map[string]*command
+	timeout   time.Duration
+	maxOutput int
+	slots     chan struct{}
+
+	runs   map[string]*shellRun
+	runsMu sync.Mutex
+}
+
+type runParams struct {
+	Command string         `json:"command"`
+	Args    map[string]any `json:"args"`
+	Cwd     string         `json:"cwd"`
+	Stdin   string         `json:"stdin"`
+}
+
+func (c *ShellCapability) Handle(ctx *gin.Context) {}
+
+func (c *ShellCapability) Reload(model *dbmodels.SpaceCapability) (xcapability.Capability, error) {
+	newCap, err := c.builder.Build(c.handle)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Close()
+
+	return newCap, nil
+}
+
+func (c *ShellCapability) Close() error {
+	c.runsMu.Lock()
+	defer c.runsMu.Unlock()
+
+	for id, run := range c.runs {
+		run.cancel()
+		delete(c.runs, id)
+	}
+
+	return nil
+}
+
+func (c *ShellCapability) ListActions() ([]string, error) {
+	return []string{
+		"list_commands",
+		"run",
+		"start",
+		"read",
+		"kill",
+	}, nil
+}
+
+func (c *ShellCapability) Execute(name string, params lazydata.LazyData) (any, error) {
+	switch name {
+	case "list_commands":
+		return c.listCommands(), nil
+	case "run":
+		return c.run(params)
+	case "start":
+		return c.startRun(params)
+	case "read":
+		return c.read(params)
+	case "kill":
+		return c.kill(params)
+	default:
+		return nil, errors.New("unknown action: " + name)
+	}
+}
+
+func (c *ShellCapability) listCommands() []map[string]any {
+	result := make([]map[string]any, 0, len(c.commands))
+	for name, cmd := range c.commands {
+		params := make([]string, 0)
+		for _, tmpl := range cmd.spec.Args {
+			for _, m := range placeholderRe.FindAllStringSubmatch(tmpl, -1) {
+				params = append(params, m[1])
+			}
+		}
+
+		result = append(result, map[string]any{
+			"name":   name,
+			"params": params,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i]["name"].(string) < result[j]["name"].(string)
+	})
+
+	return result
+}
+
+// run starts the command and waits for it to finish
+func (c *ShellCapability) run(params lazydata.LazyData) (*RunOutput, error) {
+	run, err := c.spawn(params)
+	if err != nil {
+		return nil, err
+	}
+
+	<-run.done
+	c.removeRun(run.id)
+
+	return run.output(0, 0), nil
+}
+
+func (c *ShellCapability) startRun(params lazydata.LazyData) (any, error) {
+	run, err := c.spawn(params)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]any{"run_id": run.id}, nil
+}
+
+// read params: run_id, stdout_offset, stderr_offset, wait (seconds to block
+// for the run to finish, capped at 10s). Finished runs are dropped once their
+// final output was read.
+func (c *ShellCapability) read(params lazydata.LazyData) (*RunOutput, error) {
+	run, err := c.getRun(params.GetFieldAsString("run_id"))
+	if err != nil {
+		return nil, err
+	}
+
+	if wait := params.GetFieldAsFloat("wait"); wait > 0 {
+		dur := min(time.Duration(wait*float64(time.Second)), maxReadWait)
+		select {
+		case <-run.done:
+		case <-time.After(dur):
+		}
+	}
+
+	out := run.output(params.GetFieldAsInt("stdout_offset"), params.GetFieldAsInt("stderr_offset"))
+	if out.Done {
+		c.removeRun(run.id)
+	}
+
+	return out, nil
+}
+
+func (c *ShellCapability) kill(params lazydata.LazyData) (any, error) {
+	run, err := c.getRun(params.GetFieldAsString("run_id"))
+	if err != nil {
+		return nil, err
+	}
+
+	run.cancel()
+
+	return map[string]any{"killed": run.id}, nil
+}
+
+func (c *ShellCapability) spawn(params lazydata.LazyData) (*shellRun, error) {
+	var p runParams
+	if err := params.AsJson(&p); err != nil {
+		return nil, err
+	}
+
+	cmd, ok := c.commands[p.Command]
+	if !ok {
+		return nil, fmt.Errorf("command not allowed: %s", p.Command)
+	}
+
+	values := make(map[string]string, len(p.Args))
+	for k, v := range p.Args {
+		values[k] = fmt.Sprint(v)
+	}
+
+	args, err := cmd.buildArgs(values)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Stdin != "" && !cmd.spec.AllowStdin {
+		return nil, errors.New("stdin not allowed for command: " + p.Command)
+	}
+
+	dir, err := c.resolveDir(p.Cwd)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case c.slots <- struct{}{}:
+	default:
+		return nil, ErrTooManyRuns
+	}
+
+	id, err := xutils.GenerateRandomString(16)
+	if err != nil {
+		<-c.slots
+		return nil, err
+	}
+
+	timeout := c.timeout
+	if cmd.timeout > 0 {
+		timeout = cmd.timeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+
+	ecmd := exec.CommandContext(ctx, cmd.spec.Path, args...)
+	ecmd.Dir = dir
+	ecmd.Env = []string{"PATH=/usr/local/bin:/usr/bin:/bin", "HOME=" + dir}
+	for k, v := range cmd.spec.Env {
+		ecmd.Env = append(ecmd.Env, k+"="+v)
+	}
+
+	run := &shellRun{
+		id:      id,
+		command: p.Command,
+		args:    args,
+		dir:     dir,
+		cmd:     ecmd,
+		ctx:     ctx,
+		cancel:  cancel,
+		stdout:  cappedBuffer{limit: c.maxOutput},
+		stderr:  cappedBuffer{limit: c.maxOutput},
+		done:    make(chan struct{}),
+	}
+
+	auditId := c.auditStart(run)
+
+	if err := run.start(p.Stdin); err != nil {
+		<-c.slots
+		c.db.UpdateById("shell_audit", auditId, map[string]any{"error": err.Error()})
+		return nil, err
+	}
+
+	c.runsMu.Lock()
+	c.runs[id] = run
+	c.runsMu.Unlock()
+
+	go func() {
+		<-run.done
+		<-c.slots
+		c.auditFinish(auditId, run)
+		time.AfterFunc(runRetention, func() { c.removeRun(run.id) })
+	}()
+
+	return run, nil
+}
+
+// resolveDir confines cwd to the space working folder, the os.Root check
+// rejects paths (and symlinks) escaping it.
+func (c *ShellCapability) resolveDir(cwd string) (string, error) {
+	if c.spaceId == 0 {
+		return "", errors.New("capability is not bound to a space")
+	}
+
+	engine := c.builder.app.Engine().(xtypes.Engine)
+	wd, err := engine.GetSpaceWorkingFolder(c.spaceId)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(wd, 0755); err != nil {
+		return "", err
+	}
+
+	if cwd == "" || cwd == "." {
+		return wd, nil
+	}
+
+	cwd = filepath.Clean(cwd)
+	if !filepath.IsLocal(cwd) {
+		return "", errors.New("cwd must be a relative path inside the space folder")
+	}
+
+	root, err := os.OpenRoot(wd)
+	if err != nil {
+		return "", err
+	}
+	defer root.Close()
+
+	info, err := root.Stat(cwd)
+	if err != nil {
+		return "", err
+	}
+
+	if !info.IsDir() {
+		return "", errors.New("cwd is not a directory")
+	}
+
+	return filepath.Join(wd, cwd), nil
+}
+
+func (c *ShellCapability) getRun(id string) (*shellRun, error) {
+	c.runsMu.Lock()
+	defer c.runsMu.Unlock()
+
+	run, ok := c.runs[id]
+	if !ok {
+		return nil, ErrRunNotFound
+	}
+
+	return run, nil
+}
+
+func (c *ShellCapability) removeRun(id string) {
+	c.runsMu.Lock()
+	delete(c.runs, id)
+	c.runsMu.Unlock()
+}
@@ -1,6 +1,7 @@
 package xcorn
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/blue-monads/potatoverse/backend/registry"
@@ -15,6 +16,12 @@ var (
 	OptionFields = []xcapability.CapabilityOptionField{}
 )
 
+const (
+	OverlapSkip  = "skip"
+	OverlapQueue = "queue"
+	OverlapAllow = "allow"
+)
+
 func init() {
 
 	b := xcapability.CapabilityBuilderFactory{
@@ -44,21 +51,77 @@ func (b *CornBuilder) Build(handle xcapability.XCapabilityHandle) (xcapability.C
 		return nil, err
 	}
 
-	c := &CornCapability{builder: b, handle: handle, jobs: jobs}
+	model := handle.GetModel()
+
+	spaceId, err := b.resolveSpaceId(model.InstallID, model.SpaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	db := b.app.Database().GetLowCapabilityDBOps(model.ID)
+
+	if err := db.RunDDL(jobStateDDL); err != nil {
+		return nil, fmt.Errorf("failed to create job state table: %w", err)
+	}
+
+	c := &CornCapability{
+		builder:   b,
+		handle:    handle,
+		jobs:      jobs,
+		installId: model.InstallID,
+		spaceId:   spaceId,
+		db:        db,
+		logger:    b.app.Logger().With("capability", Name, "capability_id", model.ID),
+		reload:    make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+
+	c.restoreState()
 
 	go c.loop()
 
 	return c, nil
 }
 
+// resolveSpaceId picks the space jobs are emitted to, capabilities
+// not bound to a space fire into the first space of their install.
+func (b *CornBuilder) resolveSpaceId(installId, spaceId int64) (int64, error) {
+	if spaceId != 0 {
+		return spaceId, nil
+	}
+
+	spaces, err := b.app.Database().GetSpaceOps().ListSpacesByPackageId(installId)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(spaces) == 0 {
+		return 0, fmt.Errorf("no space found for install %d", installId)
+	}
+
+	return spaces[0].ID, nil
+}
+
 func (b *CornBuilder) Serve(ctx *gin.Context) {}
 
 func (b *CornBuilder) GetDebugData() map[string]any {
 	return map[string]any{}
 }
 
-// loadOptions parses free-form options where keys are job names
-// and values are Go duration strings (e.g. "30s", "5m", "1h").
+// loadOptions parses free-form options where keys are job names and values
+// are either a schedule string or an object for finer control.
+//
+//	"cleanup": "5m"
+//	"report":  "0 3 * * MON"
+//	"digest":  {
+//	    "schedule": "0 9 * * *",
+//	    "timezone": "Asia/Kathmandu",
+//	    "jitter":   "30s",
+//	    "overlap":  "skip",            // skip (default), queue, allow
+//	    "params":   {"kind": "daily"}
+//	}
+//
+// see parseSchedule for the accepted schedule formats.
 func loadOptions(handle xcapability.XCapabilityHandle) (map[string]*CornJob, error) {
 	opts := handle.GetOptionsAsLazyData()
 	if opts == nil {
@@ -73,25 +136,69 @@ func loadOptions(handle xcapability.XCapabilityHandle) (map[string]*CornJob, err
 	jobs := make(map[string]*CornJob)
 
 	for key, val := range optMap {
-		strVal, ok := val.(string)
-		if !ok {
+		job := &CornJob{
+			Name:     key,
+			Timezone: "UTC",
+			Overlap:  OverlapSkip,
+			Params:   make(map[string]string),
+		}
+
+		switch v := val.(type) {
+		case string:
+			job.Spec = v
+		case map[string]any:
+			if err := job.applyObject(v); err != nil {
+				return nil, fmt.Errorf("job %s: %w", key, err)
+			}
+		default:
 			continue
 		}
 
-		dur, err := time.ParseDuration(strVal)
+		job.schedule, err = parseSchedule(job.Spec)
 		if err != nil {
-			continue
+			return nil, fmt.Errorf("job %s: %w", key, err)
 		}
 
-		if existing, exists := jobs[key]; exists {
-			existing.Interval = dur
-		} else {
-			jobs[key] = &CornJob{
-				Name:     key,
-				Interval: dur,
-			}
+		job.location, err = time.LoadLocation(job.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("job %s: invalid timezone: %w", key, err)
 		}
+
+		jobs[key] = job
 	}
 
 	return jobs, nil
 }
+
+func (j *CornJob) applyObject(obj map[string]any) error {
+	j.Spec, _ = obj["schedule"].(string)
+
+	if tz, _ := obj["timezone"].(string); tz != "" {
+		j.Timezone = tz
+	}
+
+	if jitter, _ := obj["jitter"].(string); jitter != "" {
+		dur, err := time.ParseDuration(jitter)
+		if err != nil {
+			return fmt.Errorf("invalid jitter: %w", err)
+		}
+		j.Jitter = dur
+	}
+
+	if overlap, _ := obj["overlap"].(string); overlap != "" {
+		switch overlap {
+		case OverlapSkip, OverlapQueue, OverlapAllow:
+			j.Overlap = overlap
+		default:
+			return fmt.Errorf("invalid overlap policy: %s", overlap)
+		}
+	}
+
+	if params, ok := obj["params"].(map[string]any); ok {
+		for k, v := range params {
+			j.Params[k] = fmt.Sprint(v)
+		}
+	}
+
+	return nil
+}
@@ -1,6 +1,7 @@
 package xcorn
 
 import (
+	"math/rand/v2"
 	"time"
 
 	"github.com/blue-monads/potatoverse/backend/xtypes"
@@ -19,62 +20,131 @@ func (c *CornCapability) loop() {
 			continue
 		}
 
+		timer := time.NewTimer(dur)
+
 		select {
 		case <-c.reload:
-		case <-time.After(dur):
+			timer.Stop()
+		case now := <-timer.C:
 			job, ok := c.jobs[name]
 			if ok {
-				c.executeJob(job)
+				c.scheduleNext(job, now)
+				c.dispatchJob(job, now)
 			}
 		case <-c.done:
+			timer.Stop()
 			return
 		}
 	}
 }
 
 func (c *CornCapability) nextTick() (time.Duration, string) {
-	if len(c.jobs) == 0 {
-		return 0, ""
-	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
 	var (
-		shortest time.Duration = -1
+		earliest time.Time
 		next     string
 	)
 
-	now := time.Now()
 	for _, job := range c.jobs {
-		var wait time.Duration
-		if job.LastRun.IsZero() {
-			wait = 0
-		} else {
-			wait = max(job.LastRun.Add(job.Interval).Sub(now), 0)
+		if job.NextRun.IsZero() {
+			continue
 		}
 
-		if shortest < 0 || wait < shortest {
-			shortest = wait
+		if next == "" || job.NextRun.Before(earliest) {
+			earliest = job.NextRun
 			next = job.Name
 		}
 	}
 
-	return shortest, next
+	if next == "" {
+		return 0, ""
+	}
+
+	return max(time.Until(earliest), 0), next
+}
+
+// scheduleNext moves the job to its next activation after now, evaluated
+// in the job's timezone and pushed forward by a random jitter.
+func (c *CornCapability) scheduleNext(job *CornJob, now time.Time) {
+	c.mu.Lock()
+	next := job.schedule.Next(now.In(job.location))
+	if !next.IsZero() && job.Jitter > 0 {
+		next = next.Add(rand.N(job.Jitter))
+	}
+	job.NextRun = next
+	c.mu.Unlock()
+
+	c.saveState(job)
 }
 
-func (c *CornCapability) executeJob(job *CornJob) {
-	job.jLock.Lock()
-	defer job.jLock.Unlock()
+// maxQueuedRuns bounds how many runs of a queue policy job wait for the
+// one in progress, later runs are dropped until the queue drains
+const maxQueuedRuns = 8
 
+// dispatchJob runs the job according to its overlap policy, skip drops the
+// run if one is already in progress, queue waits for it and allow runs
+// concurrently.
+func (c *CornCapability) dispatchJob(job *CornJob, scheduledAt time.Time) {
+	switch job.Overlap {
+	case OverlapAllow:
+		go c.executeJob(job, scheduledAt)
+	case OverlapQueue:
+		if job.queued.Add(1) > maxQueuedRuns {
+			job.queued.Add(-1)
+			c.logger.Warn("skipping job, run queue is full", "job", job.Name)
+			return
+		}
+		go func() {
+			job.jLock.Lock()
+			job.queued.Add(-1)
+			defer job.jLock.Unlock()
+			c.executeJob(job, scheduledAt)
+		}()
+	default:
+		if !job.jLock.TryLock() {
+			c.logger.Warn("skipping job, previous run still in progress", "job", job.Name)
+			return
+		}
+		go func() {
+			defer job.jLock.Unlock()
+			c.executeJob(job, scheduledAt)
+		}()
+	}
+}
+
+func (c *CornCapability) executeJob(job *CornJob, scheduledAt time.Time) {
+	c.mu.Lock()
 	job.LastRun = time.Now()
 	job.RunCount++
+	job.Running++
+
+	params := make(map[string]string, len(job.Params)+2)
+	for k, v := range job.Params {
+		params[k] = v
+	}
+	c.mu.Unlock()
+
+	c.saveState(job)
+
+	params["job"] = job.Name
+	params["scheduled_at"] = scheduledAt.In(job.location).Format(time.RFC3339)
 
 	engine := c.builder.app.Engine().(xtypes.Engine)
 
-	engine.EmitActionEvent(&xtypes.ActionEventOptions{
-		SpaceId:    1,
+	err := engine.EmitActionEvent(&xtypes.ActionEventOptions{
+		SpaceId:    c.spaceId,
 		EventType:  "corn",
 		ActionName: job.Name,
-		Params:     make(map[string]string),
+		Params:     params,
 		Request:    nil,
 	})
+	if err != nil {
+		c.logger.Error("job failed", "job", job.Name, "err", err)
+	}
 
+	c.mu.Lock()
+	job.Running--
+	c.mu.Unlock()
 }
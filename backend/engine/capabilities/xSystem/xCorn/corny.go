@@ -3,19 +3,33 @@ package xcorn
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/blue-monads/potatoverse/backend/xtypes/lazydata"
 )
 
 type CornJob struct {
-	Name     string        `json:"name"`
-	Interval time.Duration `json:"interval"`
-	LastRun  time.Time     `json:"last_run"`
-	RunCount int64         `json:"run_count"`
+	Name     string            `json:"name"`
+	Spec     string            `json:"schedule"`
+	Timezone string            `json:"timezone"`
+	Jitter   time.Duration     `json:"jitter"`
+	Overlap  string            `json:"overlap"`
+	Params   map[string]string `json:"params"`
+	LastRun  time.Time         `json:"last_run"`
+	NextRun  time.Time         `json:"next_run"`
+	RunCount int64             `json:"run_count"`
+	Running  int               `json:"running"`
 
+	schedule Schedule
+	location *time.Location
+
+	// serializes runs for skip and queue overlap policies
 	jLock sync.Mutex
+	// runs waiting on jLock under the queue policy
+	queued atomic.Int32
 }
 
 func (c *CornCapability) ListActions() ([]string, error) {
@@ -39,24 +53,41 @@ func (c *CornCapability) Execute(name string, params lazydata.LazyData) (any, er
 func (c *CornCapability) listJobs() (any, error) {
 	type jobInfo struct {
 		Name     string `json:"name"`
-		Interval string `json:"interval"`
+		Schedule string `json:"schedule"`
+		Timezone string `json:"timezone"`
+		Overlap  string `json:"overlap"`
 		LastRun  string `json:"last_run,omitempty"`
+		NextRun  string `json:"next_run,omitempty"`
 		RunCount int64  `json:"run_count"`
+		Running  int    `json:"running"`
 	}
 
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	jobs := make([]jobInfo, 0, len(c.jobs))
 	for _, job := range c.jobs {
-		var lastRun string
-		if !job.LastRun.IsZero() {
-			lastRun = job.LastRun.Format(time.RFC3339)
-		}
-		jobs = append(jobs, jobInfo{
+		info := jobInfo{
 			Name:     job.Name,
-			Interval: job.Interval.String(),
-			LastRun:  lastRun,
+			Schedule: job.Spec,
+			Timezone: job.Timezone,
+			Overlap:  job.Overlap,
 			RunCount: job.RunCount,
-		})
+			Running:  job.Running,
+		}
+		if !job.LastRun.IsZero() {
+			info.LastRun = job.LastRun.In(job.location).Format(time.RFC3339)
+		}
+		if !job.NextRun.IsZero() {
+			info.NextRun = job.NextRun.In(job.location).Format(time.RFC3339)
+		}
+		jobs = append(jobs, info)
 	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Name < jobs[j].Name
+	})
+
 	return jobs, nil
 }
 
@@ -72,6 +103,6 @@ func (c *CornCapability) triggerJob(params lazydata.LazyData) (any, error) {
 		return nil, fmt.Errorf("job not found: %s", name)
 	}
 
-	c.executeJob(job)
+	c.dispatchJob(job, time.Now())
 	return map[string]any{"triggered": name}, nil
 }
@@ -0,0 +1,91 @@
+package xcorn
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestParseSchedule(t *testing.T) {
+	valid := []string{"30s", "@every 5m", "@daily", "@hourly", "0 3 * * MON", "*/15 9-17 * * 1-5", "0 0 * * 7", "5/10 * * * *"}
+	for _, spec := range valid {
+		if _, err := parseSchedule(spec); err != nil {
+			t.Errorf("%q: unexpected error %v", spec, err)
+		}
+	}
+
+	invalid := []string{"", "100ms", "* * *", "60 * * * *", "* 24 * * *", "0 0 0 * *", "5-1 * * * *", "*/0 * * * *", "0 0 * * FUN"}
+	for _, spec := range invalid {
+		if _, err := parseSchedule(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	utc := time.UTC
+
+	cases := []struct {
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{"0 3 * * *", time.Date(2026, 1, 1, 3, 0, 0, 0, utc), time.Date(2026, 1, 2, 3, 0, 0, 0, utc)},
+		{"*/15 * * * *", time.Date(2026, 1, 1, 10, 7, 30, 0, utc), time.Date(2026, 1, 1, 10, 15, 0, 0, utc)},
+		{"0 9 * * MON", time.Date(2026, 1, 1, 0, 0, 0, 0, utc), time.Date(2026, 1, 5, 9, 0, 0, 0, utc)},
+		{"0 0 1 1 *", time.Date(2026, 6, 1, 0, 0, 0, 0, utc), time.Date(2027, 1, 1, 0, 0, 0, 0, utc)},
+	}
+
+	for _, c := range cases {
+		sched, err := parseSchedule(c.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := sched.Next(c.from); !got.Equal(c.want) {
+			t.Errorf("%q from %s: got %s, want %s", c.spec, c.from, got, c.want)
+		}
+	}
+
+	sched, _ := parseSchedule("0 0 30 2 *")
+	if got := sched.Next(time.Date(2026, 1, 1, 0, 0, 0, 0, utc)); !got.IsZero() {
+		t.Errorf("impossible schedule should never fire, got %s", got)
+	}
+}
+
+func TestCronNextDST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2026-03-08 02:00 does not exist in new york
+	from := time.Date(2026, 3, 8, 1, 0, 0, 0, loc)
+
+	cases := []struct {
+		spec string
+		want time.Time
+	}{
+		{"30 2 * * *", time.Date(2026, 3, 9, 2, 30, 0, 0, loc)},
+		{"0 0 * * 7", time.Date(2026, 3, 15, 0, 0, 0, 0, loc)},
+		{"0 3 * * *", time.Date(2026, 3, 8, 3, 0, 0, 0, loc)},
+	}
+
+	for _, c := range cases {
+		sched, err := parseSchedule(c.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		done := make(chan time.Time, 1)
+		go func() { done <- sched.Next(from) }()
+
+		select {
+		case got := <-done:
+			if !got.Equal(c.want) {
+				t.Errorf("%q: got %s, want %s", c.spec, got, c.want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%q: Next did not return", c.spec)
+		}
+	}
+}
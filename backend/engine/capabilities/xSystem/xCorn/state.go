@@ -0,0 +1,94 @@
+package xcorn
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// jobState is persisted in the capability's own db (job_state table, one row
+// per job) so restarts keep the schedule instead of firing every job at
+// once. the space can not see or overwrite it.
+type jobState struct {
+	Schedule string    `json:"schedule"`
+	Timezone string    `json:"timezone"`
+	LastRun  time.Time `json:"last_run"`
+	NextRun  time.Time `json:"next_run"`
+	RunCount int64     `json:"run_count"`
+}
+
+const jobStateDDL = `CREATE TABLE IF NOT EXISTS job_state (
+	name TEXT PRIMARY KEY,
+	state TEXT NOT NULL DEFAULT ''
+)`
+
+func (c *CornCapability) restoreState() {
+	states := make(map[string]jobState)
+
+	rows, err := c.db.RunQuery("SELECT name, state FROM job_state")
+	if err != nil {
+		c.logger.Warn("could not load job state", "err", err)
+	}
+
+	for _, row := range rows {
+		state := jobState{}
+		if err := json.Unmarshal([]byte(asString(row["state"])), &state); err != nil {
+			continue
+		}
+		states[asString(row["name"])] = state
+	}
+
+	now := time.Now()
+
+	for _, job := range c.jobs {
+		state, ok := states[job.Name]
+		if ok {
+			job.LastRun = state.LastRun
+			job.RunCount = state.RunCount
+		}
+
+		// keep the stored next run if it is still ahead and the schedule did
+		// not change, missed runs are skipped rather than replayed
+		if ok && state.Schedule == job.Spec && state.Timezone == job.Timezone && state.NextRun.After(now) {
+			job.NextRun = state.NextRun
+			continue
+		}
+
+		c.scheduleNext(job, now)
+	}
+}
+
+func (c *CornCapability) saveState(job *CornJob) {
+	c.mu.Lock()
+	state := jobState{
+		Schedule: job.Spec,
+		Timezone: job.Timezone,
+		LastRun:  job.LastRun,
+		NextRun:  job.NextRun,
+		RunCount: job.RunCount,
+	}
+	c.mu.Unlock()
+
+	out, err := json.Marshal(state)
+	if err != nil {
+		return
+	}
+
+	_, err = c.db.Exec(
+		"INSERT OR REPLACE INTO job_state (name, state) VALUES (?, ?)",
+		job.Name, string(out),
+	)
+	if err != nil {
+		c.logger.Warn("could not save job state", "job", job.Name, "err", err)
+	}
+}
+
+func asString(v any) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case []byte:
+		return string(val)
+	default:
+		return ""
+	}
+}
@@ -1,8 +1,10 @@
 package xcorn
 
 import (
+	"log/slog"
 	"sync"
 
+	"github.com/blue-monads/potatoverse/backend/services/datahub"
 	"github.com/blue-monads/potatoverse/backend/services/datahub/dbmodels"
 	"github.com/blue-monads/potatoverse/backend/xtypes/xcapability"
 	"github.com/gin-gonic/gin"
@@ -11,8 +13,14 @@ import (
 type CornCapability struct {
 	builder *CornBuilder
 	handle  xcapability.XCapabilityHandle
+	logger  *slog.Logger
+
+	installId int64
+	spaceId   int64
+	db        datahub.DBLowOps
 
 	jobs      map[string]*CornJob
+	mu        sync.Mutex
 	reload    chan struct{}
 	done      chan struct{}
 	closeOnce sync.Once
@@ -33,7 +41,7 @@ func (c *CornCapability) Reload(model *dbmodels.SpaceCapability) (xcapability.Ca
 		return nil, err
 	}
 
-	c.done <- struct{}{}
+	c.Close()
 
 	return newCap, nil
 }
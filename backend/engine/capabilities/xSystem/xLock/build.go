@@ -0,0 +1,122 @@
+package xlock
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/blue-monads/potatoverse/backend/registry"
+	"github.com/blue-monads/potatoverse/backend/xtypes"
+	"github.com/blue-monads/potatoverse/backend/xtypes/xcapability"
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	Name         = "xLock"
+	Icon         = `<i class="fa-solid fa-lock"></i>`
+	OptionFields = []xcapability.CapabilityOptionField{
+		{
+			Name:        "Default TTL",
+			Key:         "default_ttl",
+			Description: "Lease duration used when acquire does not pass a ttl (e.g. '30s', '5m')",
+			Type:        "text",
+			Default:     "30s",
+		},
+		{
+			Name:        "Max TTL",
+			Key:         "max_ttl",
+			Description: "Upper bound for a single lease or renewal",
+			Type:        "text",
+			Default:     "10m",
+		},
+		{
+			Name:        "Max Wait",
+			Key:         "max_wait",
+			Description: "Upper bound for how long a blocking acquire may wait",
+			Type:        "text",
+			Default:     "30s",
+		},
+	}
+)
+
+func init() {
+	registry.RegisterCapability(xcapability.CapabilityBuilderFactory{
+		Builder: func(app any) (xcapability.CapabilityBuilder, error) {
+			appTyped := app.(xtypes.App)
+			return &LockBuilder{app: appTyped}, nil
+		},
+		Name:         Name,
+		Icon:         Icon,
+		OptionFields: OptionFields,
+	})
+}
+
+type LockBuilder struct {
+	app xtypes.App
+}
+
+type LockOptions struct {
+	DefaultTTL string `json:"default_ttl"`
+	MaxTTL     string `json:"max_ttl"`
+	MaxWait    string `json:"max_wait"`
+}
+
+func (b *LockBuilder) Name() string {
+	return Name
+}
+
+func (b *LockBuilder) Build(handle xcapability.XCapabilityHandle) (xcapability.Capability, error) {
+	model := handle.GetModel()
+
+	var opts LockOptions
+	if err := handle.GetOptions(&opts); err != nil {
+		return nil, fmt.Errorf("failed to parse options: %w", err)
+	}
+
+	defaultTTL, err := parseDurationOr(opts.DefaultTTL, 30*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("invalid default_ttl: %w", err)
+	}
+
+	maxTTL, err := parseDurationOr(opts.MaxTTL, 10*time.Minute)
+	if err != nil {
+		return nil, fmt.Errorf("invalid max_ttl: %w", err)
+	}
+
+	maxWait, err := parseDurationOr(opts.MaxWait, 30*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("invalid max_wait: %w", err)
+	}
+
+	db := b.app.Database().GetLowDBOps("C", locksOwner)
+
+	if err := db.RunDDL(locksDDL); err != nil {
+		return nil, fmt.Errorf("failed to create locks table: %w", err)
+	}
+
+	return &LockCapability{
+		builder:    b,
+		handle:     handle,
+		installId:  model.InstallID,
+		spaceId:    model.SpaceID,
+		db:         db,
+		defaultTTL: min(defaultTTL, maxTTL),
+		maxTTL:     maxTTL,
+		maxWait:    maxWait,
+	}, nil
+}
+
+func (b *LockBuilder) Serve(ctx *gin.Context) {}
+
+func (b *LockBuilder) GetDebugData() map[string]any {
+	return map[string]any{
+		"name": Name,
+	}
+}
+
+func parseDurationOr(val string, fallback time.Duration) (time.Duration, error) {
+	if val == "" {
+		return fallback, nil
+	}
+
+	return time.ParseDuration(val)
+}
@@ -0,0 +1,186 @@
+package xlock
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// locks of every install live in one db owned by xLock, so all xLock
+// capabilities of an install (one per space or install wide) share them and
+// rebuilding a capability keeps them. rows are kept after release so the
+// fencing token keeps increasing, a lease is free when owner is empty or
+// expires_at (unix ms) has passed.
+const locksOwner = "xlock"
+
+const locksDDL = `CREATE TABLE IF NOT EXISTS locks (
+	install_id INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	owner TEXT NOT NULL DEFAULT '',
+	token INTEGER NOT NULL DEFAULT 0,
+	expires_at INTEGER NOT NULL DEFAULT 0,
+	acquired_at INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (install_id, name)
+)`
+
+type lockRow struct {
+	Name       string
+	Owner      string
+	Token      int64
+	ExpiresAt  int64
+	AcquiredAt int64
+}
+
+func (r *lockRow) held(now int64) bool {
+	return r.Owner != "" && r.ExpiresAt > now
+}
+
+func (c *LockCapability) tryAcquire(name, leaseId string, ttl time.Duration) (*lockRow, bool, error) {
+	now := time.Now().UnixMilli()
+	expiresAt := now + ttl.Milliseconds()
+
+	_, err := c.db.Exec("INSERT OR IGNORE INTO locks (install_id, name) VALUES (?, ?)", c.installId, name)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// same lease acquiring again just extends it and keeps its token
+	ok, err := c.execAffected(
+		"UPDATE locks SET expires_at = ? WHERE install_id = ? AND name = ? AND owner = ? AND expires_at > ?",
+		expiresAt, c.installId, name, leaseId, now,
+	)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !ok {
+		ok, err = c.execAffected(
+			"UPDATE locks SET owner = ?, token = token + 1, expires_at = ?, acquired_at = ? WHERE install_id = ? AND name = ? AND (owner = '' OR expires_at <= ?)",
+			leaseId, expiresAt, now, c.installId, name, now,
+		)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	row, err := c.getLock(name)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return row, ok, nil
+}
+
+func (c *LockCapability) renewLease(name, leaseId string, ttl time.Duration) (*lockRow, error) {
+	now := time.Now().UnixMilli()
+
+	ok, err := c.execAffected(
+		"UPDATE locks SET expires_at = ? WHERE install_id = ? AND name = ? AND owner = ? AND expires_at > ?",
+		now+ttl.Milliseconds(), c.installId, name, leaseId, now,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, ErrLeaseNotHeld
+	}
+
+	return c.getLock(name)
+}
+
+func (c *LockCapability) releaseLease(name, leaseId string) error {
+	ok, err := c.execAffected(
+		"UPDATE locks SET owner = '', expires_at = 0 WHERE install_id = ? AND name = ? AND owner = ? AND expires_at > ?",
+		c.installId, name, leaseId, time.Now().UnixMilli(),
+	)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return ErrLeaseNotHeld
+	}
+
+	return nil
+}
+
+func (c *LockCapability) getLock(name string) (*lockRow, error) {
+	row, err := c.db.RunQueryOne("SELECT name, owner, token, expires_at, acquired_at FROM locks WHERE install_id = ? AND name = ?", c.installId, name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return &lockRow{Name: name}, nil
+		}
+		return nil, err
+	}
+
+	return toLockRow(row), nil
+}
+
+func (c *LockCapability) listHeld() ([]*lockRow, error) {
+	rows, err := c.db.RunQuery(
+		"SELECT name, owner, token, expires_at, acquired_at FROM locks WHERE install_id = ? AND owner != '' AND expires_at > ? ORDER BY name",
+		c.installId, time.Now().UnixMilli(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*lockRow, 0, len(rows))
+	for _, row := range rows {
+		result = append(result, toLockRow(row))
+	}
+
+	return result, nil
+}
+
+func (c *LockCapability) execAffected(query string, args ...any) (bool, error) {
+	res, err := c.db.Exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+
+	sres, ok := res.(sql.Result)
+	if !ok {
+		return false, errors.New("unexpected exec result")
+	}
+
+	affected, err := sres.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+func toLockRow(row map[string]any) *lockRow {
+	return &lockRow{
+		Name:       asString(row["name"]),
+		Owner:      asString(row["owner"]),
+		Token:      asInt64(row["token"]),
+		ExpiresAt:  asInt64(row["expires_at"]),
+		AcquiredAt: asInt64(row["acquired_at"]),
+	}
+}
+
+func asString(v any) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case []byte:
+		return string(val)
+	}
+	return ""
+}
+
+func asInt64(v any) int64 {
+	switch val := v.(type) {
+	case int64:
+		return val
+	case int:
+		return int64(val)
+	case float64:
+		return int64(val)
+	}
+	return 0
+}
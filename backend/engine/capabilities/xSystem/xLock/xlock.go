@@ -1 +1,288 @@
 package xlock
+
+import (
+	"errors"
+	"time"
+
+	"github.com/blue-monads/potatoverse/backend/services/datahub"
+	"github.com/blue-monads/potatoverse/backend/services/datahub/dbmodels"
+	xutils "github.com/blue-monads/potatoverse/backend/utils"
+	"github.com/blue-monads/potatoverse/backend/xtypes/lazydata"
+	"github.com/blue-monads/potatoverse/backend/xtypes/xcapability"
+	"github.com/gin-gonic/gin"
+)
+
+/*
+
+xLock gives named leases scoped to the install, every xLock capability of
+the install sees the same locks.
+acquire/try_lock hand out a lease_id which must be passed back to renew and
+release, since lua states are pooled the lease_id is the only notion of owner.
+Every successful acquire bumps a per name fencing token, resources guarded by
+the lock can reject writes carrying an older token via check_token.
+
+*/
+
+var (
+	ErrLeaseNotHeld = errors.New("lease not held")
+)
+
+const pollInterval = 50 * time.Millisecond
+
+type LockCapability struct {
+	builder *LockBuilder
+	handle  xcapability.XCapabilityHandle
+
+	installId int64
+	spaceId   int64
+	db        datahub.DBLowOps
+
+	defaultTTL time.Duration
+	maxTTL     time.Duration
+	maxWait    time.Duration
+}
+
+type LockResult struct {
+	Name      string `json:"name"`
+	Acquired  bool   `json:"acquired"`
+	LeaseId   string `json:"lease_id,omitempty"`
+	Token     int64  `json:"token"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+type LockStatus struct {
+	Name       string `json:"name"`
+	Locked     bool   `json:"locked"`
+	Token      int64  `json:"token"`
+	ExpiresAt  int64  `json:"expires_at,omitempty"`
+	AcquiredAt int64  `json:"acquired_at,omitempty"`
+}
+
+func (c *LockCapability) Handle(ctx *gin.Context) {}
+
+func (c *LockCapability) Reload(model *dbmodels.SpaceCapability) (xcapability.Capability, error) {
+	newCap, err := c.builder.Build(c.handle)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Close()
+
+	return newCap, nil
+}
+
+func (c *LockCapability) Close() error {
+	return nil
+}
+
+func (c *LockCapability) ListActions() ([]string, error) {
+	return []string{
+		"acquire",
+		"try_lock",
+		"renew",
+		"release",
+		"status",
+		"check_token",
+		"list",
+	}, nil
+}
+
+func (c *LockCapability) Execute(name string, params lazydata.LazyData) (any, error) {
+	switch name {
+	case "acquire":
+		wait := c.maxWait
+		if w := params.GetFieldAsFloat("wait"); w > 0 {
+			wait = min(secondsToDuration(w), c.maxWait)
+		}
+		return c.acquire(params, wait)
+	case "try_lock":
+		return c.acquire(params, 0)
+	case "renew":
+		return c.renew(params)
+	case "release":
+		return c.release(params)
+	case "status":
+		return c.status(params)
+	case "check_token":
+		return c.checkToken(params)
+	case "list":
+		return c.list()
+	default:
+		return nil, errors.New("unknown action: " + name)
+	}
+}
+
+// acquire params: name, ttl (seconds), wait (seconds), lease_id (optional,
+// reusing one extends an already held lease)
+func (c *LockCapability) acquire(params lazydata.LazyData, wait time.Duration) (*LockResult, error) {
+	name := params.GetFieldAsString("name")
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+
+	leaseId := params.GetFieldAsString("lease_id")
+	if leaseId == "" {
+		id, err := xutils.GenerateRandomString(20)
+		if err != nil {
+			return nil, err
+		}
+		leaseId = id
+	}
+
+	ttl := c.ttlFrom(params)
+	deadline := time.Now().Add(wait)
+
+	for {
+		row, ok, err := c.tryAcquire(name, leaseId, ttl)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			return &LockResult{
+				Name:      name,
+				Acquired:  true,
+				LeaseId:   leaseId,
+				Token:     row.Token,
+				ExpiresAt: row.ExpiresAt,
+			}, nil
+		}
+
+		if !time.Now().Before(deadline) {
+			return &LockResult{
+				Name:      name,
+				Acquired:  false,
+				Token:     row.Token,
+				ExpiresAt: row.ExpiresAt,
+			}, nil
+		}
+
+		time.Sleep(min(pollInterval, time.Until(deadline)))
+	}
+}
+
+func (c *LockCapability) renew(params lazydata.LazyData) (*LockResult, error) {
+	name := params.GetFieldAsString("name")
+	leaseId := params.GetFieldAsString("lease_id")
+	if name == "" || leaseId == "" {
+		return nil, errors.New("name and lease_id are required")
+	}
+
+	row, err := c.renewLease(name, leaseId, c.ttlFrom(params))
+	if err != nil {
+		return nil, err
+	}
+
+	return &LockResult{
+		Name:      name,
+		Acquired:  true,
+		LeaseId:   leaseId,
+		Token:     row.Token,
+		ExpiresAt: row.ExpiresAt,
+	}, nil
+}
+
+func (c *LockCapability) release(params lazydata.LazyData) (any, error) {
+	name := params.GetFieldAsString("name")
+	leaseId := params.GetFieldAsString("lease_id")
+	if name == "" || leaseId == "" {
+		return nil, errors.New("name and lease_id are required")
+	}
+
+	if err := c.releaseLease(name, leaseId); err != nil {
+		return nil, err
+	}
+
+	return map[string]any{"released": name}, nil
+}
+
+func (c *LockCapability) status(params lazydata.LazyData) (*LockStatus, error) {
+	name := params.GetFieldAsString("name")
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+
+	row, err := c.getLock(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return toStatus(row), nil
+}
+
+// checkToken reports whether token is the fencing token of the current
+// holder, a stale holder whose lease expired gets valid=false.
+func (c *LockCapability) checkToken(params lazydata.LazyData) (any, error) {
+	name := params.GetFieldAsString("name")
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+
+	token := int64(params.GetFieldAsInt("token"))
+
+	row, err := c.getLock(name)
+	if err != nil {
+		return nil, err
+	}
+
+	valid := row.held(time.Now().UnixMilli()) && row.Token == token
+
+	return map[string]any{
+		"valid":         valid,
+		"current_token": row.Token,
+	}, nil
+}
+
+func (c *LockCapability) list() ([]*LockStatus, error) {
+	rows, err := c.listHeld()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*LockStatus, 0, len(rows))
+	for _, row := range rows {
+		result = append(result, toStatus(row))
+	}
+
+	return result, nil
+}
+
+func (c *LockCapability) ttlFrom(params lazydata.LazyData) time.Duration {
+	ttl := c.defaultTTL
+	if t := params.GetFieldAsFloat("ttl"); t > 0 {
+		ttl = secondsToDuration(t)
+	}
+
+	return min(ttl, c.maxTTL)
+}
+
+func toStatus(row *lockRow) *LockStatus {
+	status := &LockStatus{
+		Name:  row.Name,
+		Token: row.Token,
+	}
+
+	if row.held(time.Now().UnixMilli()) {
+		status.Locked = true
+		status.ExpiresAt = row.ExpiresAt
+		status.AcquiredAt = row.AcquiredAt
+	}
+
+	return status
+}
+
+func validateName(name string) error {
+	if name == "" {
+		return errors.New("name is required")
+	}
+
+	if len(name) > 255 {
+		return errors.New("name too long")
+	}
+
+	return nil
+}
+
+func secondsToDuration(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,274 @@
+package xlock
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blue-monads/potatoverse/backend/services/datahub"
+	"github.com/blue-monads/potatoverse/backend/services/datahub/enforcer"
+	"github.com/blue-monads/potatoverse/backend/xtypes/lazydata"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteDB runs the queries xLock uses through the enforcer like the low
+// db does, other DBLowOps methods are not used
+type sqliteDB struct {
+	datahub.DBLowOps
+	db *sql.DB
+}
+
+func (d *sqliteDB) transform(query string) string {
+	out, err := enforcer.TransformQuery("C", locksOwner, query)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+func (d *sqliteDB) RunDDL(ddl string) error {
+	_, err := d.db.Exec(d.transform(ddl))
+	return err
+}
+
+func (d *sqliteDB) Exec(query string, data ...any) (any, error) {
+	return d.db.Exec(d.transform(query), data...)
+}
+
+func (d *sqliteDB) RunQuery(query string, data ...any) ([]map[string]any, error) {
+	rows, err := d.db.Query(d.transform(query), data...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var results []map[string]any
+	for rows.Next() {
+		values := make([]any, len(columns))
+		ptrs := make([]any, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+
+		row := make(map[string]any, len(columns))
+		for i, column := range columns {
+			row[column] = values[i]
+		}
+		results = append(results, row)
+	}
+
+	return results, rows.Err()
+}
+
+func (d *sqliteDB) RunQueryOne(query string, data ...any) (map[string]any, error) {
+	rows, err := d.RunQuery(query, data...)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return rows[0], nil
+}
+
+func setupLockDB(t *testing.T) *sqliteDB {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "xlock.sqlite"))
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	// one connection, sqlite serializes writers anyway
+	db.SetMaxOpenConns(1)
+
+	ldb := &sqliteDB{db: db}
+	if err := ldb.RunDDL(locksDDL); err != nil {
+		t.Fatalf("create locks table: %v", err)
+	}
+
+	return ldb
+}
+
+func newTestLock(db *sqliteDB, installId int64) *LockCapability {
+	return &LockCapability{
+		installId:  installId,
+		db:         db,
+		defaultTTL: 30 * time.Second,
+		maxTTL:     time.Minute,
+		maxWait:    2 * time.Second,
+	}
+}
+
+func params(format string, args ...any) lazydata.LazyData {
+	return lazydata.LazyDataBytes(fmt.Sprintf(format, args...))
+}
+
+func mustRun(t *testing.T, c *LockCapability, action string, p lazydata.LazyData) any {
+	t.Helper()
+	out, err := c.Execute(action, p)
+	if err != nil {
+		t.Fatalf("%s: %v", action, err)
+	}
+	return out
+}
+
+func TestAcquireRelease(t *testing.T) {
+	c := newTestLock(setupLockDB(t), 1)
+
+	first := mustRun(t, c, "try_lock", params(`{"name": "job"}`)).(*LockResult)
+	if !first.Acquired || first.LeaseId == "" || first.Token != 1 {
+		t.Fatalf("first lock = %+v, want acquired with token 1", first)
+	}
+
+	// held, a second caller does not get it
+	second := mustRun(t, c, "try_lock", params(`{"name": "job"}`)).(*LockResult)
+	if second.Acquired {
+		t.Fatal("lock handed out twice")
+	}
+
+	// the holder acquiring again extends the lease and keeps the token
+	again := mustRun(t, c, "try_lock", params(`{"name": "job", "lease_id": %q}`, first.LeaseId)).(*LockResult)
+	if !again.Acquired || again.Token != first.Token {
+		t.Fatalf("re-acquire = %+v, want same token", again)
+	}
+
+	if _, err := c.Execute("release", params(`{"name": "job", "lease_id": "other"}`)); err != ErrLeaseNotHeld {
+		t.Fatalf("release by other lease = %v, want ErrLeaseNotHeld", err)
+	}
+
+	mustRun(t, c, "release", params(`{"name": "job", "lease_id": %q}`, first.LeaseId))
+
+	next := mustRun(t, c, "try_lock", params(`{"name": "job"}`)).(*LockResult)
+	if !next.Acquired || next.Token != 2 {
+		t.Fatalf("lock after release = %+v, want token 2", next)
+	}
+
+	check := mustRun(t, c, "check_token", params(`{"name": "job", "token": 1}`)).(map[string]any)
+	if check["valid"] != false {
+		t.Fatal("stale fencing token reported valid")
+	}
+}
+
+func TestLeaseExpiry(t *testing.T) {
+	c := newTestLock(setupLockDB(t), 1)
+
+	held := mustRun(t, c, "try_lock", params(`{"name": "job", "ttl": 0.1}`)).(*LockResult)
+	if !held.Acquired {
+		t.Fatal("lock not acquired")
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	status := mustRun(t, c, "status", params(`{"name": "job"}`)).(*LockStatus)
+	if status.Locked {
+		t.Fatal("expired lease still reported locked")
+	}
+
+	if _, err := c.Execute("renew", params(`{"name": "job", "lease_id": %q}`, held.LeaseId)); err != ErrLeaseNotHeld {
+		t.Fatalf("renew of expired lease = %v, want ErrLeaseNotHeld", err)
+	}
+
+	taken := mustRun(t, c, "try_lock", params(`{"name": "job"}`)).(*LockResult)
+	if !taken.Acquired || taken.Token != held.Token+1 {
+		t.Fatalf("lock after expiry = %+v, want the next token", taken)
+	}
+}
+
+func TestContention(t *testing.T) {
+	db := setupLockDB(t)
+	c := newTestLock(db, 1)
+
+	const workers = 8
+
+	var mu sync.Mutex
+	inside := 0
+	maxInside := 0
+	tokens := make(map[int64]bool)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			res, err := c.Execute("acquire", params(`{"name": "job", "wait": 2}`))
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			lock := res.(*LockResult)
+			if !lock.Acquired {
+				errs <- fmt.Errorf("acquire timed out")
+				return
+			}
+
+			mu.Lock()
+			inside++
+			maxInside = max(maxInside, inside)
+			tokens[lock.Token] = true
+			mu.Unlock()
+
+			time.Sleep(5 * time.Millisecond)
+
+			mu.Lock()
+			inside--
+			mu.Unlock()
+
+			_, err = c.Execute("release", params(`{"name": "job", "lease_id": %q}`, lock.LeaseId))
+			if err != nil {
+				errs <- err
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	if maxInside != 1 {
+		t.Fatalf("%d holders at once, want 1", maxInside)
+	}
+	if len(tokens) != workers {
+		t.Fatalf("got %d distinct tokens, want %d", len(tokens), workers)
+	}
+}
+
+func TestInstallScope(t *testing.T) {
+	db := setupLockDB(t)
+
+	// two capabilities of one install share locks, another install does not
+	a := newTestLock(db, 1)
+	b := newTestLock(db, 1)
+	other := newTestLock(db, 2)
+
+	if !mustRun(t, a, "try_lock", params(`{"name": "job"}`)).(*LockResult).Acquired {
+		t.Fatal("lock not acquired")
+	}
+
+	if mustRun(t, b, "try_lock", params(`{"name": "job"}`)).(*LockResult).Acquired {
+		t.Fatal("same install got a held lock")
+	}
+
+	if !mustRun(t, other, "try_lock", params(`{"name": "job"}`)).(*LockResult).Acquired {
+		t.Fatal("other install blocked by a lock it does not share")
+	}
+}
@@ -2,6 +2,7 @@ package xugroup
 
 import (
 	"errors"
+	"strings"
 
 	"github.com/blue-monads/potatoverse/backend/services/corehub"
 	"github.com/blue-monads/potatoverse/backend/services/datahub/dbmodels"
@@ -88,6 +89,14 @@ func (c *UgroupCapability) isAllowedGroup(group string) bool {
 	return false
 }
 
+// config groups starting with __ are reserved for core (eg. __auth holds
+// two factor secrets), packages can not see or change them
+func isReservedConfigGroup(group string) bool {
+	return strings.HasPrefix(group, "__")
+}
+
+var errReservedConfigGroup = errors.New("access denied: reserved config group")
+
 func (c *UgroupCapability) checkUserAccess(userId int64) (*dbmodels.User, error) {
 	user, err := c.app.Database().GetUserOps().GetUser(userId)
 	if err != nil {
@@ -209,13 +218,17 @@ func (c *UgroupCapability) queryUserConfig(params lazydata.LazyData) (any, error
 	}
 
 	configs := make([]userConfig, 0)
+	if isReservedConfigGroup(p.ConfigGroup) {
+		return nil, errReservedConfigGroup
+	}
+
 	cond := db.Cond{"user_id": p.UserID}
 	if p.ConfigGroup != "" {
 		cond["group"] = p.ConfigGroup
 	}
 
 	err := c.app.Database().Table("UserConfig").
-		Find(cond).
+		Find(db.And(cond, db.Raw(`substr("group", 1, 2) != '__'`))).
 		Offset(p.Offset).
 		Limit(p.Limit).
 		All(&configs)
@@ -243,6 +256,10 @@ func (c *UgroupCapability) updateUserConfig(params lazydata.LazyData) (any, erro
 		return nil, errors.New("config_key is required")
 	}
 
+	if isReservedConfigGroup(p.ConfigGroup) {
+		return nil, errReservedConfigGroup
+	}
+
 	existing := &userConfig{}
 	err := c.app.Database().Table("UserConfig").
 		Find(db.Cond{"user_id": p.UserID, "group": p.ConfigGroup, "key": p.ConfigKey}).
@@ -284,6 +301,10 @@ func (c *UgroupCapability) deleteUserConfig(params lazydata.LazyData) (any, erro
 		return nil, err
 	}
 
+	if isReservedConfigGroup(p.ConfigGroup) {
+		return nil, errReservedConfigGroup
+	}
+
 	err := c.app.Database().Table("UserConfig").
 		Find(db.Cond{"user_id": p.UserID, "group": p.ConfigGroup, "key": p.ConfigKey}).
 		Delete()
@@ -0,0 +1,139 @@
+package fanout
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+
+	"github.com/blue-monads/potatoverse/backend/xtypes/lazydata"
+)
+
+var ok = map[string]any{"success": true}
+
+type PublishParams struct {
+	Topic   string          `json:"topic"`
+	Message json.RawMessage `json:"message"`
+	Binary  bool            `json:"binary"`
+	// UserIds narrows delivery to clients of these users
+	UserIds []int64 `json:"user_ids"`
+}
+
+// envelope is what text clients get, binary messages go out as is
+type envelope struct {
+	Topic string          `json:"topic"`
+	Data  json.RawMessage `json:"data"`
+}
+
+func (c *FanoutCapability) ListActions() ([]string, error) {
+	return []string{
+		"publish",
+		"list_clients",
+		"disconnect",
+	}, nil
+}
+
+func (c *FanoutCapability) Execute(name string, params lazydata.LazyData) (any, error) {
+	switch name {
+	case "publish":
+		var p PublishParams
+		if err := params.AsJson(&p); err != nil {
+			return nil, err
+		}
+		if p.Topic == "" {
+			return nil, errors.New("topic is required")
+		}
+
+		delivered, err := c.publish(&p)
+		if err != nil {
+			return nil, err
+		}
+
+		return map[string]any{"success": true, "delivered": delivered}, nil
+
+	case "list_clients":
+		return c.listClients(), nil
+
+	case "disconnect":
+		connId := params.GetFieldAsString("conn_id")
+		if connId == "" {
+			return nil, errors.New("conn_id is required")
+		}
+
+		c.mu.RLock()
+		cl := c.clients[connId]
+		c.mu.RUnlock()
+
+		if cl != nil {
+			c.removeClient(connId, cl)
+		}
+
+		return ok, nil
+
+	default:
+		return nil, errors.New("unknown action: " + name)
+	}
+}
+
+func (c *FanoutCapability) publish(p *PublishParams) (int, error) {
+	msg := &message{binary: p.Binary}
+
+	if p.Binary {
+		// binary messages carry the raw bytes, a json string is unwrapped
+		var raw string
+		if err := json.Unmarshal(p.Message, &raw); err == nil {
+			msg.data = []byte(raw)
+		} else {
+			msg.data = p.Message
+		}
+	} else {
+		data := p.Message
+		if len(data) == 0 {
+			data = json.RawMessage("null")
+		}
+
+		out, err := json.Marshal(envelope{Topic: p.Topic, Data: data})
+		if err != nil {
+			return 0, err
+		}
+		msg.data = out
+	}
+
+	c.mu.RLock()
+	clients := make([]*client, 0, len(c.clients))
+	for _, cl := range c.clients {
+		if len(p.UserIds) > 0 && !slices.Contains(p.UserIds, cl.userId) {
+			continue
+		}
+		clients = append(clients, cl)
+	}
+	c.mu.RUnlock()
+
+	delivered := 0
+	for _, cl := range clients {
+		if !cl.matches(p.Topic) {
+			continue
+		}
+
+		if cl.push(msg) {
+			delivered++
+		}
+	}
+
+	return delivered, nil
+}
+
+func (c *FanoutCapability) listClients() []map[string]any {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	result := make([]map[string]any, 0, len(c.clients))
+	for _, cl := range c.clients {
+		result = append(result, map[string]any{
+			"conn_id": cl.connId,
+			"user_id": cl.userId,
+			"topics":  cl.getFilters(),
+		})
+	}
+
+	return result
+}
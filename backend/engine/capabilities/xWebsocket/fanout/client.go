@@ -0,0 +1,138 @@
+package fanout
+
+import (
+	"encoding/json"
+	"slices"
+
+	"github.com/blue-monads/potatoverse/backend/utils/qq"
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+)
+
+// controlMessage is the only thing clients send, fanout is push only
+type controlMessage struct {
+	Type   string   `json:"type"`
+	Topics []string `json:"topics"`
+}
+
+type controlReply struct {
+	Type   string   `json:"type"`
+	Topics []string `json:"topics,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+func (cl *client) writePump() {
+	defer cl.cap.removeClient(cl.connId, cl)
+
+	for {
+		select {
+		case <-cl.closed:
+			return
+		case msg := <-cl.send:
+			var err error
+			if msg.binary {
+				err = wsutil.WriteServerBinary(cl.conn, msg.data)
+			} else {
+				err = wsutil.WriteServerText(cl.conn, msg.data)
+			}
+
+			if err != nil {
+				qq.Println("@fanout/write_error", cl.connId, err)
+				return
+			}
+		}
+	}
+}
+
+func (cl *client) readPump() {
+	defer cl.cap.removeClient(cl.connId, cl)
+
+	for {
+		data, opCode, err := wsutil.ReadClientData(cl.conn)
+		if err != nil {
+			return
+		}
+
+		switch opCode {
+		case ws.OpClose:
+			return
+		case ws.OpPing:
+			wsutil.WriteServerMessage(cl.conn, ws.OpPong, nil)
+		case ws.OpText:
+			cl.handleControl(data)
+		}
+	}
+}
+
+func (cl *client) handleControl(data []byte) {
+	msg := controlMessage{}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		cl.reply(controlReply{Type: "error", Error: "invalid message"})
+		return
+	}
+
+	current := cl.getFilters()
+
+	switch msg.Type {
+	case "subscribe":
+		filters, err := cl.cap.allowedFilters(cl.claim, msg.Topics)
+		if err != nil {
+			cl.reply(controlReply{Type: "error", Error: err.Error()})
+			return
+		}
+
+		for _, filter := range filters {
+			if !slices.Contains(current, filter) {
+				current = append(current, filter)
+			}
+		}
+
+	case "unsubscribe":
+		kept := make([]string, 0, len(current))
+		for _, filter := range current {
+			if !slices.Contains(msg.Topics, filter) {
+				kept = append(kept, filter)
+			}
+		}
+		current = kept
+
+	case "topics":
+
+	default:
+		cl.reply(controlReply{Type: "error", Error: "unknown message type"})
+		return
+	}
+
+	cl.setFilters(current)
+	cl.reply(controlReply{Type: "topics", Topics: current})
+}
+
+func (cl *client) reply(r controlReply) {
+	out, _ := json.Marshal(r)
+	cl.push(&message{data: out})
+}
+
+// push never blocks, a client that does not keep up loses messages
+// instead of holding up the publisher
+func (cl *client) push(msg *message) bool {
+	select {
+	case <-cl.closed:
+		return false
+	default:
+	}
+
+	select {
+	case cl.send <- msg:
+		return true
+	default:
+		qq.Println("@fanout/drop_message", cl.connId)
+		return false
+	}
+}
+
+func (cl *client) teardown() {
+	cl.closeOnce.Do(func() {
+		close(cl.closed)
+		cl.conn.Close()
+	})
+}
@@ -1 +1,347 @@
 package fanout
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/blue-monads/potatoverse/backend/registry"
+	"github.com/blue-monads/potatoverse/backend/services/datahub/dbmodels"
+	"github.com/blue-monads/potatoverse/backend/services/signer"
+	"github.com/blue-monads/potatoverse/backend/utils/libx/httpx"
+	"github.com/blue-monads/potatoverse/backend/utils/qq"
+	"github.com/blue-monads/potatoverse/backend/xtypes"
+	"github.com/blue-monads/potatoverse/backend/xtypes/xcapability"
+	"github.com/gin-gonic/gin"
+	"github.com/gobwas/ws"
+)
+
+/*
+
+fanout pushes server side events to many websocket clients, the space
+publishes to a topic and every client whose filters match gets it.
+
+clients connect with ?token=<capability token>&topics=a.b,c.*
+topics allowed for a client come from the token extrameta "topics",
+filters are dot separated, * matches one segment and > the rest
+
+*/
+
+var (
+	Name = "xFanout"
+	Icon = `<i class="fa-solid fa-tower-broadcast"></i>`
+
+	OptionFields = []xcapability.CapabilityOptionField{
+		{
+			Name:        "Require Topic Claim",
+			Key:         "require_topic_claim",
+			Description: "Only allow topics listed in the token extrameta topics, without it tokens with no topics can subscribe to anything",
+			Type:        "boolean",
+		},
+		{
+			Name:        "Send Buffer",
+			Key:         "send_buffer",
+			Description: "Messages queued per client before it is considered slow and messages are dropped",
+			Type:        "number",
+			Default:     "64",
+		},
+	}
+)
+
+var (
+	ErrInvalidToken     = errors.New("invalid token")
+	ErrTopicNotAllowed  = errors.New("topic not allowed")
+	ErrNoTopicRequested = errors.New("at least one topic is required")
+)
+
+const defaultSendBuffer = 64
+
+func init() {
+	registry.RegisterCapability(xcapability.CapabilityBuilderFactory{
+		Builder: func(app any) (xcapability.CapabilityBuilder, error) {
+			appTyped := app.(xtypes.App)
+			return &FanoutBuilder{
+				app:    appTyped,
+				signer: appTyped.Signer(),
+			}, nil
+		},
+		Name:         Name,
+		Icon:         Icon,
+		OptionFields: OptionFields,
+	})
+}
+
+type FanoutBuilder struct {
+	app    xtypes.App
+	signer *signer.Signer
+}
+
+func (b *FanoutBuilder) Build(handle xcapability.XCapabilityHandle) (xcapability.Capability, error) {
+	model := handle.GetModel()
+	opts := handle.GetOptionsAsLazyData()
+
+	sendBuffer := opts.GetFieldAsInt("send_buffer")
+	if sendBuffer <= 0 {
+		sendBuffer = defaultSendBuffer
+	}
+
+	return &FanoutCapability{
+		builder:           b,
+		handle:            handle,
+		spaceId:           model.SpaceID,
+		installId:         model.InstallID,
+		capabilityId:      model.ID,
+		requireTopicClaim: opts.GetFieldAsBool("require_topic_claim"),
+		sendBuffer:        sendBuffer,
+		clients:           make(map[string]*client),
+	}, nil
+}
+
+func (b *FanoutBuilder) Serve(ctx *gin.Context) {}
+
+func (b *FanoutBuilder) Name() string {
+	return Name
+}
+
+func (b *FanoutBuilder) GetDebugData() map[string]any {
+	return map[string]any{}
+}
+
+type FanoutCapability struct {
+	builder      *FanoutBuilder
+	handle       xcapability.XCapabilityHandle
+	spaceId      int64
+	installId    int64
+	capabilityId int64
+
+	requireTopicClaim bool
+	sendBuffer        int
+
+	// clients: ConnId -> client
+	clients map[string]*client
+	mu      sync.RWMutex
+}
+
+func (c *FanoutCapability) Handle(ctx *gin.Context) {
+	token := ctx.Request.URL.Query().Get("token")
+	if token == "" {
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	claim, err := c.parseToken(token)
+	if err != nil {
+		qq.Println("@fanout/invalid_token", err)
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	requested := splitTopics(ctx.Request.URL.Query().Get("topics"))
+
+	filters, err := c.allowedFilters(claim, requested)
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	conn, _, _, err := ws.UpgradeHTTP(ctx.Request, ctx.Writer)
+	if err != nil {
+		httpx.WriteErrString(ctx, "failed to upgrade websocket")
+		return
+	}
+
+	cl := &client{
+		cap:     c,
+		connId:  claim.ResourceId,
+		userId:  claim.UserId,
+		claim:   claim,
+		conn:    conn,
+		filters: filters,
+		send:    make(chan *message, c.sendBuffer),
+		closed:  make(chan struct{}),
+	}
+
+	c.mu.Lock()
+	existing := c.clients[cl.connId]
+	c.clients[cl.connId] = cl
+	c.mu.Unlock()
+
+	if existing != nil {
+		existing.teardown()
+	}
+
+	go cl.writePump()
+	go cl.readPump()
+}
+
+func (c *FanoutCapability) parseToken(token string) (*signer.CapabilityClaim, error) {
+	claim, err := c.builder.signer.ParseCapability(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if claim.SpaceId != c.spaceId {
+		return nil, ErrInvalidToken
+	}
+
+	if claim.InstallId != c.installId {
+		return nil, ErrInvalidToken
+	}
+
+	if claim.CapabilityId != c.capabilityId {
+		return nil, ErrInvalidToken
+	}
+
+	if claim.ResourceId == "" {
+		return nil, ErrInvalidToken
+	}
+
+	return claim, nil
+}
+
+// allowedFilters checks the requested filters against the topics the
+// token grants, every requested filter has to fall under a granted one
+func (c *FanoutCapability) allowedFilters(claim *signer.CapabilityClaim, requested []string) ([]string, error) {
+	granted := claimTopics(claim)
+
+	if len(requested) == 0 {
+		requested = granted
+	}
+
+	if len(requested) == 0 {
+		return nil, ErrNoTopicRequested
+	}
+
+	if len(granted) == 0 {
+		if c.requireTopicClaim {
+			return nil, ErrTopicNotAllowed
+		}
+		return requested, nil
+	}
+
+	for _, filter := range requested {
+		if !filterAllowed(granted, filter) {
+			return nil, ErrTopicNotAllowed
+		}
+	}
+
+	return requested, nil
+}
+
+func (c *FanoutCapability) removeClient(connId string, cl *client) {
+	c.mu.Lock()
+	current, exists := c.clients[connId]
+	if exists && current == cl {
+		delete(c.clients, connId)
+	}
+	c.mu.Unlock()
+
+	cl.teardown()
+}
+
+func (c *FanoutCapability) Reload(model *dbmodels.SpaceCapability) (xcapability.Capability, error) {
+	newCap, err := c.builder.Build(c.handle)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Close()
+
+	return newCap, nil
+}
+
+func (c *FanoutCapability) Close() error {
+	c.mu.Lock()
+	clients := c.clients
+	c.clients = make(map[string]*client)
+	c.mu.Unlock()
+
+	for _, cl := range clients {
+		cl.teardown()
+	}
+
+	return nil
+}
+
+type message struct {
+	data   []byte
+	binary bool
+}
+
+type client struct {
+	cap    *FanoutCapability
+	connId string
+	userId int64
+	claim  *signer.CapabilityClaim
+	conn   net.Conn
+
+	filters []string
+	fLock   sync.RWMutex
+
+	send      chan *message
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (cl *client) matches(topic string) bool {
+	cl.fLock.RLock()
+	defer cl.fLock.RUnlock()
+
+	for _, filter := range cl.filters {
+		if matchTopic(filter, topic) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (cl *client) setFilters(filters []string) {
+	cl.fLock.Lock()
+	cl.filters = filters
+	cl.fLock.Unlock()
+}
+
+func (cl *client) getFilters() []string {
+	cl.fLock.RLock()
+	defer cl.fLock.RUnlock()
+
+	out := make([]string, len(cl.filters))
+	copy(out, cl.filters)
+	return out
+}
+
+func splitTopics(raw string) []string {
+	topics := make([]string, 0)
+	for _, topic := range strings.Split(raw, ",") {
+		topic = strings.TrimSpace(topic)
+		if topic != "" {
+			topics = append(topics, topic)
+		}
+	}
+
+	return topics
+}
+
+func claimTopics(claim *signer.CapabilityClaim) []string {
+	if claim.ExtraMeta == nil {
+		return nil
+	}
+
+	switch v := claim.ExtraMeta["topics"].(type) {
+	case string:
+		return splitTopics(v)
+	case []any:
+		topics := make([]string, 0, len(v))
+		for _, topic := range v {
+			if s, ok := topic.(string); ok && s != "" {
+				topics = append(topics, s)
+			}
+		}
+		return topics
+	}
+
+	return nil
+}
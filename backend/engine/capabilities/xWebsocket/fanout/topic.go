@@ -0,0 +1,68 @@
+package fanout
+
+import "strings"
+
+// matchTopic reports whether topic falls under filter, * matches exactly
+// one segment and > matches one or more trailing segments
+func matchTopic(filter, topic string) bool {
+	fparts := strings.Split(filter, ".")
+	tparts := strings.Split(topic, ".")
+
+	for i, fpart := range fparts {
+		if fpart == ">" {
+			return len(tparts) > i
+		}
+
+		if i >= len(tparts) {
+			return false
+		}
+
+		if fpart != "*" && fpart != tparts[i] {
+			return false
+		}
+	}
+
+	return len(fparts) == len(tparts)
+}
+
+// covers reports whether everything filter can match is also matched by
+// granted, used to check client filters against the token
+func covers(granted, filter string) bool {
+	gparts := strings.Split(granted, ".")
+	fparts := strings.Split(filter, ".")
+
+	for i, gpart := range gparts {
+		if gpart == ">" {
+			return len(fparts) > i
+		}
+
+		if i >= len(fparts) {
+			return false
+		}
+
+		switch fparts[i] {
+		case ">":
+			return false
+		case "*":
+			if gpart != "*" {
+				return false
+			}
+		default:
+			if gpart != "*" && gpart != fparts[i] {
+				return false
+			}
+		}
+	}
+
+	return len(gparts) == len(fparts)
+}
+
+func filterAllowed(granted []string, filter string) bool {
+	for _, g := range granted {
+		if covers(g, filter) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,166 @@
+package relayws
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/blue-monads/potatoverse/backend/xtypes/lazydata"
+	"github.com/blue-monads/potatoverse/backend/xtypes/xcapability/easyaction"
+	"github.com/gobwas/ws"
+)
+
+var ok = map[string]any{"success": true}
+
+type SendParams struct {
+	ConnId  string          `json:"conn_id"`
+	Message json.RawMessage `json:"message"`
+	Binary  bool            `json:"binary"`
+}
+
+// payload turns the message param into wire bytes, a json string is sent
+// as its text so handlers can pass plain strings
+func (p *SendParams) payload() (ws.OpCode, []byte) {
+	op := ws.OpText
+	if p.Binary {
+		op = ws.OpBinary
+	}
+
+	var text string
+	if err := json.Unmarshal(p.Message, &text); err == nil {
+		return op, []byte(text)
+	}
+
+	return op, p.Message
+}
+
+func (c *RelayWsCapability) ListActions() ([]string, error) {
+	return []string{
+		"list_relays",
+		"close_relay",
+		"send_to_client",
+		"send_to_upstream",
+	}, nil
+}
+
+func (c *RelayWsCapability) Execute(name string, params lazydata.LazyData) (any, error) {
+	switch name {
+	case "list_relays":
+		return c.listRelays(), nil
+
+	case "close_relay":
+		connId := params.GetFieldAsString("conn_id")
+		if connId == "" {
+			return nil, errors.New("conn_id is required")
+		}
+
+		if r := c.getRelay(connId); r != nil {
+			c.removeRelay(r)
+		}
+
+		return ok, nil
+
+	case "send_to_client", "send_to_upstream":
+		var p SendParams
+		if err := params.AsJson(&p); err != nil {
+			return nil, err
+		}
+		if p.ConnId == "" {
+			return nil, errors.New("conn_id is required")
+		}
+
+		r := c.getRelay(p.ConnId)
+		if r == nil {
+			return nil, errors.New("relay not found")
+		}
+
+		op, data := p.payload()
+		if name == "send_to_client" {
+			return ok, r.writeClient(op, data)
+		}
+		return ok, r.writeUpstream(op, data)
+
+	default:
+		return nil, errors.New("unknown action: " + name)
+	}
+}
+
+func (c *RelayWsCapability) listRelays() []map[string]any {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	result := make([]map[string]any, 0, len(c.relays))
+	for _, r := range c.relays {
+		result = append(result, map[string]any{
+			"conn_id": r.connId,
+			"user_id": r.userId,
+		})
+	}
+
+	return result
+}
+
+// messageCtx is the ActionRequest for relay_client_message and
+// relay_upstream_message, the handler reads the payload with easyaction
+// methods and may drop or replace it before it is forwarded
+type messageCtx struct {
+	relay   *relay
+	payload []byte
+
+	dropped     bool
+	replacement []byte
+}
+
+func (m *messageCtx) ListActions() ([]string, error) {
+	return append(easyaction.Methods,
+		"drop",
+		"replace",
+		"send_to_client",
+		"send_to_upstream",
+		"list_relays",
+		"close_relay",
+	), nil
+}
+
+func (m *messageCtx) ExecuteAction(name string, params lazydata.LazyData) (any, error) {
+	switch name {
+	case "drop":
+		m.dropped = true
+		return ok, nil
+
+	case "replace":
+		var p SendParams
+		if err := params.AsJson(&p); err != nil {
+			return nil, err
+		}
+
+		_, data := p.payload()
+		m.replacement = data
+		m.dropped = false
+		return ok, nil
+
+	case "send_to_client", "send_to_upstream":
+		var p SendParams
+		if err := params.AsJson(&p); err != nil {
+			return nil, err
+		}
+
+		op, data := p.payload()
+		if name == "send_to_client" {
+			return ok, m.relay.writeClient(op, data)
+		}
+		return ok, m.relay.writeUpstream(op, data)
+
+	case "list_relays", "close_relay":
+		return m.relay.cap.Execute(name, params)
+
+	default:
+		resp, err := easyaction.BytelazyDataActions(m.payload, name, params)
+		if err != nil {
+			if errors.Is(err, easyaction.ErrUnknownAction) {
+				return nil, errors.New("unknown action: " + name)
+			}
+			return nil, err
+		}
+		return resp, nil
+	}
+}
@@ -0,0 +1,148 @@
+package relayws
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/blue-monads/potatoverse/backend/utils/qq"
+	"github.com/blue-monads/potatoverse/backend/xtypes"
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+)
+
+const (
+	directionClient   = "client"
+	directionUpstream = "upstream"
+)
+
+type relay struct {
+	cap    *RelayWsCapability
+	connId string
+	userId int64
+
+	client   net.Conn
+	upstream net.Conn
+
+	// writes come from the pumps and from actions, one lock per side
+	clientLock   sync.Mutex
+	upstreamLock sync.Mutex
+
+	closeOnce sync.Once
+}
+
+// clientPump forwards client messages upstream
+func (r *relay) clientPump() {
+	defer r.cap.removeRelay(r)
+
+	for {
+		data, op, err := wsutil.ReadClientData(r.client)
+		if err != nil {
+			return
+		}
+
+		if op != ws.OpText && op != ws.OpBinary {
+			continue
+		}
+
+		if r.cap.opts.InspectClient {
+			data = r.inspect(directionClient, data, op == ws.OpBinary)
+			if data == nil {
+				continue
+			}
+		}
+
+		if err := r.writeUpstream(op, data); err != nil {
+			qq.Println("@relayws/upstream_write_error", r.connId, err)
+			return
+		}
+	}
+}
+
+// upstreamPump forwards upstream messages to the client
+func (r *relay) upstreamPump() {
+	defer r.cap.removeRelay(r)
+
+	for {
+		data, op, err := wsutil.ReadServerData(r.upstream)
+		if err != nil {
+			return
+		}
+
+		if op != ws.OpText && op != ws.OpBinary {
+			continue
+		}
+
+		if r.cap.opts.InspectUpstream {
+			data = r.inspect(directionUpstream, data, op == ws.OpBinary)
+			if data == nil {
+				continue
+			}
+		}
+
+		if err := r.writeClient(op, data); err != nil {
+			qq.Println("@relayws/client_write_error", r.connId, err)
+			return
+		}
+	}
+}
+
+// inspect hands the message to the space, nil means it was dropped
+func (r *relay) inspect(direction string, data []byte, binary bool) []byte {
+	mctx := &messageCtx{
+		relay:   r,
+		payload: data,
+	}
+
+	err := r.cap.builder.engine.EmitActionEvent(&xtypes.ActionEventOptions{
+		SpaceId:    r.cap.spaceId,
+		EventType:  "capability",
+		ActionName: "relay_" + direction + "_message",
+		Params: map[string]string{
+			"conn_id":       r.connId,
+			"capability_id": fmt.Sprintf("%d", r.cap.capabilityId),
+			"capability":    "relayws",
+			"user_id":       fmt.Sprintf("%d", r.userId),
+			"direction":     direction,
+			"binary":        fmt.Sprintf("%t", binary),
+		},
+		Request: mctx,
+	})
+
+	// a failing handler does not break the relay, the message goes as is
+	if err != nil {
+		qq.Println("@relayws/inspect_error", r.connId, err)
+		return data
+	}
+
+	if mctx.dropped {
+		return nil
+	}
+
+	if mctx.replacement != nil {
+		return mctx.replacement
+	}
+
+	return data
+}
+
+func (r *relay) writeClient(op ws.OpCode, data []byte) error {
+	r.clientLock.Lock()
+	defer r.clientLock.Unlock()
+
+	return wsutil.WriteServerMessage(r.client, op, data)
+}
+
+func (r *relay) writeUpstream(op ws.OpCode, data []byte) error {
+	r.upstreamLock.Lock()
+	defer r.upstreamLock.Unlock()
+
+	return wsutil.WriteClientMessage(r.upstream, op, data)
+}
+
+func (r *relay) teardown() {
+	r.closeOnce.Do(func() {
+		r.client.Close()
+		r.upstream.Close()
+	})
+}
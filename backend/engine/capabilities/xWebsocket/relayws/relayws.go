@@ -1 +1,339 @@
 package relayws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/blue-monads/potatoverse/backend/registry"
+	"github.com/blue-monads/potatoverse/backend/services/datahub/dbmodels"
+	"github.com/blue-monads/potatoverse/backend/services/signer"
+	"github.com/blue-monads/potatoverse/backend/utils/libx/httpx"
+	"github.com/blue-monads/potatoverse/backend/utils/netguard"
+	"github.com/blue-monads/potatoverse/backend/utils/qq"
+	"github.com/blue-monads/potatoverse/backend/xtypes"
+	"github.com/blue-monads/potatoverse/backend/xtypes/xcapability"
+	"github.com/gin-gonic/gin"
+	"github.com/gobwas/ws"
+)
+
+/*
+
+relayws proxies a client websocket to an upstream websocket endpoint,
+clients connect with ?token=<capability token> and every message is
+passed through, optionally via the space on_action for inspection
+
+*/
+
+var (
+	Name = "xRelayWS"
+	Icon = `<i class="fa-solid fa-right-left"></i>`
+
+	OptionFields = []xcapability.CapabilityOptionField{
+		{
+			Name:        "Upstream URL",
+			Key:         "upstream_url",
+			Description: "Websocket endpoint to relay to (e.g. wss://example.com/socket)",
+			Type:        "text",
+			Required:    true,
+		},
+		{
+			Name:        "Upstream Authorization",
+			Key:         "upstream_auth",
+			Description: "Sent as the Authorization header when dialing upstream",
+			Type:        "api_key",
+		},
+		{
+			Name:        "Forward Subpath",
+			Key:         "forward_subpath",
+			Description: "Append the request subpath and query (without token) to the upstream url",
+			Type:        "boolean",
+		},
+		{
+			Name:        "Inspect Client Messages",
+			Key:         "inspect_client",
+			Description: "Emit relay_client_message for every message going upstream",
+			Type:        "boolean",
+		},
+		{
+			Name:        "Inspect Upstream Messages",
+			Key:         "inspect_upstream",
+			Description: "Emit relay_upstream_message for every message going to the client",
+			Type:        "boolean",
+		},
+		{
+			Name:        "Dial Timeout",
+			Key:         "dial_timeout",
+			Description: "Upstream connect timeout (e.g. '10s')",
+			Type:        "text",
+			Default:     "10s",
+		},
+	}
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+func init() {
+	registry.RegisterCapability(xcapability.CapabilityBuilderFactory{
+		Builder: func(app any) (xcapability.CapabilityBuilder, error) {
+			appTyped := app.(xtypes.App)
+
+			allowPrivate := false
+			if config, ok := appTyped.Config().(*xtypes.AppOptions); ok {
+				allowPrivate = config.AllowPrivateUpstreams
+			}
+
+			return &RelayWsBuilder{
+				app:          appTyped,
+				signer:       appTyped.Signer(),
+				engine:       appTyped.Engine().(xtypes.Engine),
+				allowPrivate: allowPrivate,
+			}, nil
+		},
+		Name:         Name,
+		Icon:         Icon,
+		OptionFields: OptionFields,
+	})
+}
+
+type RelayWsBuilder struct {
+	app    xtypes.App
+	signer *signer.Signer
+	engine xtypes.Engine
+	// upstreams may be loopback or private network addresses
+	allowPrivate bool
+}
+
+type RelayWsOptions struct {
+	UpstreamUrl     string `json:"upstream_url"`
+	UpstreamAuth    string `json:"upstream_auth"`
+	ForwardSubpath  bool   `json:"forward_subpath"`
+	InspectClient   bool   `json:"inspect_client"`
+	InspectUpstream bool   `json:"inspect_upstream"`
+	DialTimeout     string `json:"dial_timeout"`
+}
+
+func (b *RelayWsBuilder) Build(handle xcapability.XCapabilityHandle) (xcapability.Capability, error) {
+	model := handle.GetModel()
+
+	var opts RelayWsOptions
+	if err := handle.GetOptions(&opts); err != nil {
+		return nil, fmt.Errorf("failed to parse options: %w", err)
+	}
+
+	upstream, err := url.Parse(opts.UpstreamUrl)
+	if err != nil || (upstream.Scheme != "ws" && upstream.Scheme != "wss") {
+		return nil, fmt.Errorf("upstream_url must be a ws:// or wss:// url")
+	}
+
+	dialTimeout := 10 * time.Second
+	if opts.DialTimeout != "" {
+		dur, err := time.ParseDuration(opts.DialTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dial_timeout: %w", err)
+		}
+		dialTimeout = dur
+	}
+
+	return &RelayWsCapability{
+		builder:      b,
+		handle:       handle,
+		spaceId:      model.SpaceID,
+		installId:    model.InstallID,
+		capabilityId: model.ID,
+		opts:         opts,
+		upstream:     upstream,
+		dialTimeout:  dialTimeout,
+		relays:       make(map[string]*relay),
+	}, nil
+}
+
+func (b *RelayWsBuilder) Serve(ctx *gin.Context) {}
+
+func (b *RelayWsBuilder) Name() string {
+	return Name
+}
+
+func (b *RelayWsBuilder) GetDebugData() map[string]any {
+	return map[string]any{}
+}
+
+type RelayWsCapability struct {
+	builder      *RelayWsBuilder
+	handle       xcapability.XCapabilityHandle
+	spaceId      int64
+	installId    int64
+	capabilityId int64
+
+	opts        RelayWsOptions
+	upstream    *url.URL
+	dialTimeout time.Duration
+
+	// relays: ConnId -> relay
+	relays map[string]*relay
+	mu     sync.RWMutex
+	nextId atomic.Int64
+}
+
+func (c *RelayWsCapability) Handle(ctx *gin.Context) {
+	token := ctx.Request.URL.Query().Get("token")
+	if token == "" {
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	claim, err := c.parseToken(token)
+	if err != nil {
+		qq.Println("@relayws/invalid_token", err)
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	connId := claim.ResourceId
+	if connId == "" {
+		connId = fmt.Sprintf("relay-%d", c.nextId.Add(1))
+	}
+
+	// dial first so a dead upstream is a plain http error for the client
+	dialCtx, cancel := context.WithTimeout(ctx.Request.Context(), c.dialTimeout)
+	defer cancel()
+
+	dialer := ws.Dialer{}
+	if !c.builder.allowPrivate {
+		// upstream_url comes from the package, keep it off internal hosts
+		netDialer := &net.Dialer{Control: netguard.Control}
+		dialer.NetDial = netDialer.DialContext
+	}
+	if c.opts.UpstreamAuth != "" {
+		dialer.Header = ws.HandshakeHeaderHTTP(http.Header{
+			"Authorization": []string{c.opts.UpstreamAuth},
+		})
+	}
+
+	upstreamConn, _, _, err := dialer.Dial(dialCtx, c.upstreamUrl(ctx))
+	if err != nil {
+		qq.Println("@relayws/dial_error", err)
+		httpx.WriteErrString(ctx, "failed to connect upstream")
+		return
+	}
+
+	clientConn, _, _, err := ws.UpgradeHTTP(ctx.Request, ctx.Writer)
+	if err != nil {
+		upstreamConn.Close()
+		httpx.WriteErrString(ctx, "failed to upgrade websocket")
+		return
+	}
+
+	r := &relay{
+		cap:      c,
+		connId:   connId,
+		userId:   claim.UserId,
+		client:   clientConn,
+		upstream: upstreamConn,
+	}
+
+	c.mu.Lock()
+	existing := c.relays[connId]
+	c.relays[connId] = r
+	c.mu.Unlock()
+
+	if existing != nil {
+		existing.teardown()
+	}
+
+	go r.clientPump()
+	go r.upstreamPump()
+}
+
+func (c *RelayWsCapability) upstreamUrl(ctx *gin.Context) string {
+	if !c.opts.ForwardSubpath {
+		return c.upstream.String()
+	}
+
+	u := *c.upstream
+
+	subpath := strings.TrimPrefix(ctx.Param("subpath"), "/")
+	if subpath != "" {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + subpath
+	}
+
+	query := u.Query()
+	for key, values := range ctx.Request.URL.Query() {
+		if key == "token" {
+			continue
+		}
+		query[key] = values
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+func (c *RelayWsCapability) parseToken(token string) (*signer.CapabilityClaim, error) {
+	claim, err := c.builder.signer.ParseCapability(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if claim.SpaceId != c.spaceId {
+		return nil, ErrInvalidToken
+	}
+
+	if claim.InstallId != c.installId {
+		return nil, ErrInvalidToken
+	}
+
+	if claim.CapabilityId != c.capabilityId {
+		return nil, ErrInvalidToken
+	}
+
+	return claim, nil
+}
+
+func (c *RelayWsCapability) removeRelay(r *relay) {
+	c.mu.Lock()
+	if current := c.relays[r.connId]; current == r {
+		delete(c.relays, r.connId)
+	}
+	c.mu.Unlock()
+
+	r.teardown()
+}
+
+func (c *RelayWsCapability) getRelay(connId string) *relay {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.relays[connId]
+}
+
+func (c *RelayWsCapability) Reload(model *dbmodels.SpaceCapability) (xcapability.Capability, error) {
+	newCap, err := c.builder.Build(c.handle)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Close()
+
+	return newCap, nil
+}
+
+func (c *RelayWsCapability) Close() error {
+	c.mu.Lock()
+	relays := c.relays
+	c.relays = make(map[string]*relay)
+	c.mu.Unlock()
+
+	for _, r := range relays {
+		r.teardown()
+	}
+
+	return nil
+}
@@ -2,6 +2,7 @@ package engine
 
 import (
 	"errors"
+	"fmt"
 	"log/slog"
 	"maps"
 	"path"
@@ -103,6 +104,24 @@ func (e *Engine) EmitActionEvent(opts *xtypes.ActionEventOptions) error {
 	return e.runtime.ExecAction(opts)
 }
 
+func (e *Engine) GetSpaceWorkingFolder(spaceId int64) (string, error) {
+	space, err := e.db.GetSpaceOps().GetSpace(spaceId)
+	if err != nil {
+		return "", err
+	}
+
+	pkg, err := e.db.GetPackageInstallOps().GetPackage(space.InstalledId)
+	if err != nil {
+		return "", err
+	}
+
+	return e.spaceWorkingFolder(space.NamespaceKey, pkg.ActiveInstallID), nil
+}
+
+func (e *Engine) spaceWorkingFolder(spaceKey string, packageVersionId int64) string {
+	return path.Join(e.workingFolder, "work_dir", spaceKey, fmt.Sprintf("%d", packageVersionId))
+}
+
 func (e *Engine) Start(app xtypes.App) error {
 	e.app = app
 	e.runtime.parent = e
@@ -315,6 +334,15 @@ func buildPackageFilePath(filePath string, ropt *models.PotatoRouteOptions) (str
 	return name, ppath
 }
 
+// Stop stops the background loops of the hubs
+func (e *Engine) Stop() {
+	e.repoHub.Stop()
+
+	if e.eventHub != nil {
+		e.eventHub.Stop()
+	}
+}
+
 func (e *Engine) GetCapabilityHub() any {
 	return e.capHub
 }
@@ -333,3 +361,7 @@ func (e *Engine) PublishEvent(opts *xtypes.EventOptions) error {
 func (e *Engine) RefreshEventIndex() {
 	e.eventHub.RefreshFullIndex()
 }
+
+func (e *Engine) WakeEventHub() {
+	e.eventHub.Wake()
+}
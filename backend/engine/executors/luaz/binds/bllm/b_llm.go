@@ -3,6 +3,7 @@ package bllm
 import (
 	"context"
 	"encoding/json"
+	"net/http"
 
 	openrouter "github.com/revrost/go-openrouter"
 	luajit "github.com/yuin/gopher-lua"
@@ -13,6 +14,33 @@ type Provider struct {
 	model  string
 }
 
+// NewClient is the openrouter client llm.new uses, it speaks the openai
+// api so it works for any compatible endpoint. empty baseURL is openrouter,
+// nil httpClient the library default. also used by the xLlm capability.
+func NewClient(apiKey, baseURL string, httpClient *http.Client) *openrouter.Client {
+	cfg := openrouter.DefaultConfig(apiKey)
+	if baseURL != "" {
+		cfg.BaseURL = baseURL
+	}
+	if httpClient != nil {
+		cfg.HTTPClient = httpClient
+	}
+
+	return openrouter.NewClientWithConfig(*cfg)
+}
+
+// Message builds a chat message, unknown roles are sent as user
+func Message(role, content string) openrouter.ChatCompletionMessage {
+	switch role {
+	case "system":
+		return openrouter.SystemMessage(content)
+	case "assistant":
+		return openrouter.AssistantMessage(content)
+	default:
+		return openrouter.UserMessage(content)
+	}
+}
+
 func New(L *luajit.LState) int {
 	cfg := L.CheckTable(1)
 	if cfg == nil {
@@ -33,7 +61,7 @@ func New(L *luajit.LState) int {
 		apiKey = apiKeyVal.String()
 	}
 
-	client := openrouter.NewClientWithConfig(*openrouter.DefaultConfig(apiKey))
+	client := NewClient(apiKey, "", nil)
 
 	provider := &Provider{
 		client: client,
@@ -72,21 +100,7 @@ func (p *Provider) GenerateV1(L *luajit.LState) int {
 				continue
 			}
 
-			role := roleVal.String()
-			content := contentVal.String()
-
-			var msg openrouter.ChatCompletionMessage
-			switch role {
-			case "system":
-				msg = openrouter.SystemMessage(content)
-			case "user":
-				msg = openrouter.UserMessage(content)
-			case "assistant":
-				msg = openrouter.AssistantMessage(content)
-			default:
-				msg = openrouter.UserMessage(content)
-			}
-			messages = append(messages, msg)
+			messages = append(messages, Message(roleVal.String(), contentVal.String()))
 		}
 	}
 
@@ -109,6 +109,21 @@ func (gh *CapabilityHub) Reload(installId int64, spaceId int64, name string) err
 	return nil
 }
 
+// Evict closes and drops a cached instance, the next use builds it again
+// from its current row
+func (gh *CapabilityHub) Evict(name string, spaceId int64) {
+	key := fmt.Sprintf("%s:%d", name, spaceId)
+
+	gh.glock.Lock()
+	instance, ok := gh.goodies[key]
+	delete(gh.goodies, key)
+	gh.glock.Unlock()
+
+	if ok && instance != nil {
+		instance.Close()
+	}
+}
+
 func (gh *CapabilityHub) Handle(installId, spaceId int64, name string, ctx *gin.Context) {
 	gs, err := gh.get(name, installId, spaceId)
 	if err != nil {
@@ -0,0 +1,29 @@
+package eslayer
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	minRetryDelay = time.Second
+	maxRetryDelay = 6 * time.Hour
+)
+
+// backoffDelay doubles the subscription retry_delay (seconds) on every retry
+// and picks a random point in the upper half of it so targets failing
+// together do not retry in lockstep.
+func backoffDelay(retryDelay int64, retryCount int64) time.Duration {
+	delay := max(time.Duration(retryDelay)*time.Second, minRetryDelay)
+
+	for range min(retryCount, 32) {
+		delay *= 2
+		if delay >= maxRetryDelay {
+			delay = maxRetryDelay
+			break
+		}
+	}
+
+	half := delay / 2
+	return half + rand.N(half+1)
+}
@@ -6,109 +6,106 @@ import (
 	"github.com/blue-monads/potatoverse/backend/utils/qq"
 )
 
-// fixme => add system for processing delayed targets
-
 func (e *ESLayer) eventLoop() {
+	e.wg.Add(2 + e.opts.Workers)
+
 	go e.rootEventWatcher()
 	go e.eventProcessLoop()
 
-	for range 10 {
+	for range e.opts.Workers {
 		go e.targetProcessLoop()
 	}
 
 }
 
+// rootEventWatcher scans the db for work that did not come through
+// NotifyNewEvent, on wake up, when the earliest delayed target is due and on
+// a slow fallback interval for anything left behind by a crash.
 func (e *ESLayer) rootEventWatcher() {
+	defer e.wg.Done()
 
 	sink := e.datahandle.GetMQSynk()
 
-	checkForEvents := func() {
-		events, err := sink.QueryNewEvents()
-		if err != nil {
-			qq.Println("@rootEventWatcher/checkForEvents/error", err)
-		} else {
-			qq.Println("@rootEventWatcher/checkForEvents: found", len(events), "new events")
-			for _, event := range events {
-				select {
-				case e.eventProcessChan <- event:
-					qq.Println("@rootEventWatcher/checkForEvents: sent event", event)
-				case <-e.ctx.Done():
-					return
-				}
-			}
-		}
-	}
-
-	checkForTargets := func() {
-		targets, err := sink.QueryNewEventTargets()
-		if err != nil {
-			qq.Println("@rootEventWatcher/QueryNewEventTargets/error", err)
-		} else {
-			for _, target := range targets {
-				select {
-				case e.eventTargetProcessChan <- target:
-				case <-e.ctx.Done():
-					return
-				}
-			}
-		}
-	}
-
-	checkForDelayedTargets := func() {
-		targets, err := sink.QueryDelayExpiredTargets()
-		if err != nil {
-			qq.Println("@rootEventWatcher/QueryDelayExpiredTargets/error", err)
-		} else {
-			for _, target := range targets {
-				select {
-				case e.eventTargetProcessChan <- target:
-				case <-e.ctx.Done():
-					return
-				}
-			}
-		}
-	}
+	// first scan right away, picks up whatever was pending before start
+	pollTimer := time.NewTimer(0)
+	defer pollTimer.Stop()
 
-	fallbackTimer := time.NewTimer(time.Second * 20)
-	defer fallbackTimer.Stop()
-
-	counter := 0
+	delayTimer := time.NewTimer(e.opts.PollInterval)
+	defer delayTimer.Stop()
 
 	for {
-
-		qq.Println("@couner/start", counter)
-
-		// Reset timer for next iteration
-		fallbackTimer.Reset(time.Second * 20)
-
 		select {
 		case <-e.ctx.Done():
 			return
-		case <-fallbackTimer.C:
-
-			qq.Println("@checkForEvents")
-			checkForEvents()
+		case <-e.wakeChan:
+			qq.Println("@rootEventWatcher: woken up")
+		case <-pollTimer.C:
+			qq.Println("@rootEventWatcher: fallback poll")
+		case <-delayTimer.C:
+			qq.Println("@rootEventWatcher: delay due")
+		}
 
-			qq.Println("@checkForTargets")
-			checkForTargets()
+		if !e.scan() {
+			return
+		}
 
-			qq.Println("@checkForDelayedTargets")
-			checkForDelayedTargets()
+		pollTimer.Reset(e.opts.PollInterval)
 
+		nextDelay := e.opts.PollInterval
+		nextAt, err := sink.QueryNextDelayedAt()
+		if err != nil {
+			qq.Println("@rootEventWatcher/QueryNextDelayedAt/error", err)
+		} else if nextAt > 0 {
+			nextDelay = min(max(time.Until(time.Unix(nextAt, 0)), 0), e.opts.PollInterval)
 		}
 
-		qq.Println("@couner/end", counter)
+		delayTimer.Reset(nextDelay)
+	}
+
+}
 
-		counter = counter + 1
+// scan queues new events, new targets and expired delayed targets, returns
+// false if the layer is stopping
+func (e *ESLayer) scan() bool {
+	sink := e.datahandle.GetMQSynk()
 
+	events, err := sink.QueryNewEvents()
+	if err != nil {
+		qq.Println("@scan/QueryNewEvents/error", err)
+	} else {
+		for _, event := range events {
+			select {
+			case e.eventProcessChan <- event:
+			case <-e.ctx.Done():
+				return false
+			}
+		}
 	}
 
+	targets, err := sink.QueryNewEventTargets()
+	if err != nil {
+		qq.Println("@scan/QueryNewEventTargets/error", err)
+	} else {
+		for _, target := range targets {
+			e.targets.push(target.InstallID, target.ID)
+		}
+	}
+
+	delayed, err := sink.QueryDelayExpiredTargets()
+	if err != nil {
+		qq.Println("@scan/QueryDelayExpiredTargets/error", err)
+	} else {
+		for _, target := range delayed {
+			e.targets.push(target.InstallID, target.ID)
+		}
+	}
+
+	return true
 }
 
 // new, scheduled, processed
 
 func (e *ESLayer) eventProcessLoop() {
-	e.wg.Add(1)
 	defer e.wg.Done()
 
 	sink := e.datahandle.GetMQSynk()
@@ -155,38 +152,26 @@ func (e *ESLayer) eventProcessLoop() {
 
 			qq.Println("@eventProcessLoop: created", len(targets), "targets for event", eventId)
 			for _, targetId := range targets {
-				select {
-				case e.eventTargetProcessChan <- targetId:
-					qq.Println("@eventProcessLoop: sent target", targetId)
-				case <-e.ctx.Done():
-					return
-				}
+				e.targets.push(evt.InstallID, targetId)
 			}
 		}
 	}
 }
 
 func (e *ESLayer) targetProcessLoop() {
-	e.wg.Add(1)
 	defer e.wg.Done()
 
 	for {
-		select {
-		case <-e.ctx.Done():
+		installId, targetId, ok := e.targets.next(e.ctx)
+		if !ok {
 			return
-		case targetId, ok := <-e.eventTargetProcessChan:
-			if !ok {
-				return
-			}
-			if targetId == 0 {
-				continue
-			}
+		}
 
-			err := e.targetProcessor(targetId)
-			if err != nil {
-				qq.Println("@targetProcessLoop/targetProcessor/error", err)
-				continue
-			}
+		err := e.targetProcessor(targetId)
+		e.targets.done(installId, targetId)
+
+		if err != nil {
+			qq.Println("@targetProcessLoop/targetProcessor/error", err)
 		}
 	}
 
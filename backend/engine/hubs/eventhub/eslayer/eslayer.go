@@ -3,37 +3,63 @@ package eslayer
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/blue-monads/potatoverse/backend/engine/hubs/eventhub/evtype"
 	"github.com/blue-monads/potatoverse/backend/services/datahub"
 	qq "github.com/blue-monads/potatoverse/backend/utils/qq"
 )
 
+type Options struct {
+	// number of target workers, defaults to 10
+	Workers int
+	// max targets of a single install processed at once, defaults to half the workers
+	MaxPerInstall int
+	// interval of the fallback scan for work missed by notifications (eg. after crash), defaults to 1 minute
+	PollInterval time.Duration
+}
+
 type ESLayer struct {
 	datahandle evtype.DataHandle
 
 	handlers map[string]evtype.Handler
+	opts     Options
+
+	eventProcessChan chan int64
+	targets          *fairQueue
 
-	eventProcessChan       chan int64
-	eventTargetProcessChan chan int64
+	// wakes the root watcher to rescan the db
+	wakeChan chan struct{}
 
 	ctx    context.Context
 	cancel context.CancelFunc
 	wg     sync.WaitGroup
 }
 
-func NewESLayer(db datahub.Database, handlers map[string]evtype.Handler) *ESLayer {
+func NewESLayer(db datahub.Database, handlers map[string]evtype.Handler, opts Options) *ESLayer {
+
+	if opts.Workers <= 0 {
+		opts.Workers = 10
+	}
+	if opts.MaxPerInstall <= 0 {
+		opts.MaxPerInstall = max(opts.Workers/2, 1)
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Minute
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 
 	return &ESLayer{
-		datahandle:             db,
-		handlers:               handlers,
-		eventProcessChan:       make(chan int64, 20),
-		eventTargetProcessChan: make(chan int64, 20),
-		ctx:                    ctx,
-		cancel:                 cancel,
-		wg:                     sync.WaitGroup{},
+		datahandle:       db,
+		handlers:         handlers,
+		opts:             opts,
+		eventProcessChan: make(chan int64, 100),
+		targets:          newFairQueue(opts.MaxPerInstall),
+		wakeChan:         make(chan struct{}, 1),
+		ctx:              ctx,
+		cancel:           cancel,
+		wg:               sync.WaitGroup{},
 	}
 }
 
@@ -52,7 +78,18 @@ func (e *ESLayer) NotifyNewEvent(eventId int64) {
 	select {
 	case e.eventProcessChan <- eventId:
 		qq.Println("@NotifyNewEvent: sent event", eventId)
-	case <-e.ctx.Done():
-		qq.Println("@NotifyNewEvent: context done")
+	default:
+		// backed up, event is stored as new so a rescan picks it up
+		qq.Println("@NotifyNewEvent: queue full, waking watcher")
+		e.Wake()
+	}
+}
+
+// Wake makes the watcher rescan for new events, new targets and expired
+// delays right away, for work that was added to the db from outside (eg. replay).
+func (e *ESLayer) Wake() {
+	select {
+	case e.wakeChan <- struct{}{}:
+	default:
 	}
 }
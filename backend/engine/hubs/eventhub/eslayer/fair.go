@@ -0,0 +1,124 @@
+package eslayer
+
+import (
+	"context"
+	"sync"
+)
+
+// fairQueue hands targets to workers round robin across installs and caps
+// how many targets of one install run at once, so a noisy app can not take
+// all the workers. Targets already queued or running are not queued again,
+// the fallback poll finds them still in new status.
+type fairQueue struct {
+	mu            sync.Mutex
+	maxPerInstall int
+
+	pending map[int64][]int64
+	order   []int64 // installs with pending targets, in round robin order
+	running map[int64]int
+	known   map[int64]struct{}
+
+	signal chan struct{}
+}
+
+func newFairQueue(maxPerInstall int) *fairQueue {
+	return &fairQueue{
+		maxPerInstall: maxPerInstall,
+		pending:       make(map[int64][]int64),
+		running:       make(map[int64]int),
+		known:         make(map[int64]struct{}),
+		signal:        make(chan struct{}, 1),
+	}
+}
+
+func (q *fairQueue) push(installId, targetId int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.known[targetId]; ok {
+		return
+	}
+
+	q.known[targetId] = struct{}{}
+
+	if len(q.pending[installId]) == 0 {
+		q.order = append(q.order, installId)
+	}
+	q.pending[installId] = append(q.pending[installId], targetId)
+
+	q.notify()
+}
+
+// next blocks until a target can be run or ctx is done
+func (q *fairQueue) next(ctx context.Context) (int64, int64, bool) {
+	for {
+		installId, targetId, ok := q.take()
+		if ok {
+			return installId, targetId, true
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0, 0, false
+		case <-q.signal:
+		}
+	}
+}
+
+func (q *fairQueue) done(installId, targetId int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.known, targetId)
+
+	q.running[installId]--
+	if q.running[installId] <= 0 {
+		delete(q.running, installId)
+	}
+
+	// a slot of this install freed up, its pending targets may run now
+	if len(q.pending[installId]) > 0 {
+		q.notify()
+	}
+}
+
+func (q *fairQueue) take() (int64, int64, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, installId := range q.order {
+		if q.maxPerInstall > 0 && q.running[installId] >= q.maxPerInstall {
+			continue
+		}
+
+		targets := q.pending[installId]
+		targetId := targets[0]
+
+		q.order = append(q.order[:i], q.order[i+1:]...)
+		if len(targets) > 1 {
+			q.pending[installId] = targets[1:]
+			// back of the line
+			q.order = append(q.order, installId)
+		} else {
+			delete(q.pending, installId)
+		}
+
+		q.running[installId]++
+
+		// wake another worker if there is more to do
+		if len(q.order) > 0 {
+			q.notify()
+		}
+
+		return installId, targetId, true
+	}
+
+	return 0, 0, false
+}
+
+func (q *fairQueue) notify() {
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+}
@@ -6,6 +6,8 @@ import (
 
 	"github.com/blue-monads/potatoverse/backend/engine/hubs/eventhub/evtype"
 	"github.com/blue-monads/potatoverse/backend/engine/hubs/eventhub/rengine"
+	"github.com/blue-monads/potatoverse/backend/engine/hubs/eventhub/transform"
+	"github.com/blue-monads/potatoverse/backend/services/datahub/dbmodels"
 	qq "github.com/blue-monads/potatoverse/backend/utils/qq"
 )
 
@@ -33,17 +35,6 @@ func (e *ESLayer) targetProcessor(targetId int64) error {
 		return err
 	}
 
-	ok, err := rengine.RuleEngine(sub.Rules, event.Payload)
-	if err != nil {
-		sink.TransitionTargetFail(event.ID, targetId, err.Error())
-		qq.Println("@targetProcessor/RuleEngine/error", err)
-		return err
-	}
-	if !ok {
-		qq.Println("@targetProcessor/RuleEngine: no match")
-		return nil
-	}
-
 	handler, ok := e.handlers[sub.TargetType]
 	if !ok {
 		err = fmt.Errorf("handler not found: %s", sub.TargetType)
@@ -51,17 +42,20 @@ func (e *ESLayer) targetProcessor(targetId int64) error {
 		return err
 	}
 
-	ectx := &evtype.TExecution{
-		Subscription: sub,
-		Target:       target,
-		Event:        event,
+	// collapsing targets wait out the collapse window so later events with
+	// the same key attach to them instead of getting their own delivery
+	collapsing := sub.CollapseInterval > 0 && target.CollapseKey != ""
+
+	delayWindow := sub.DelayStart
+	if collapsing {
+		delayWindow = max(delayWindow, sub.CollapseInterval)
 	}
 
-	if sub.DelayStart > 0 {
+	if delayWindow > 0 {
 		// Check if we have a delayed until time
 		if target.DelayedUntil == 0 {
 			// First time processing, set delay
-			delayStart := time.Now().Unix() + int64(sub.DelayStart)
+			delayStart := time.Now().Unix() + int64(delayWindow)
 			err = sink.TransitionTargetStartDelayed(targetId, event.ID, delayStart)
 			if err != nil {
 				sink.TransitionTargetFail(event.ID, targetId, err.Error())
@@ -69,6 +63,8 @@ func (e *ESLayer) targetProcessor(targetId int64) error {
 				return err
 			}
 			qq.Println("@targetProcessor: target", targetId, "delayed until", delayStart)
+			// let the watcher know about the new earliest delay
+			e.Wake()
 			return nil
 		} else {
 			// Check if delay has expired
@@ -82,14 +78,73 @@ func (e *ESLayer) targetProcessor(targetId int64) error {
 		}
 	}
 
+	events := []*dbmodels.MQEvent{event}
+	if collapsing {
+		followers, err := sink.ListCollapsedTargets(targetId)
+		if err != nil {
+			qq.Println("@targetProcessor/ListCollapsedTargets/error", err)
+			return err
+		}
+
+		for _, follower := range followers {
+			fevent, err := sink.GetEvent(follower.EventID)
+			if err != nil {
+				qq.Println("@targetProcessor/GetEvent/collapsed/error", err)
+				return err
+			}
+			events = append(events, fevent)
+		}
+	}
+
+	// rules run on the original payloads, targets get the transformed ones
+	payloads := make([][]byte, 0, len(events))
+	for _, evt := range events {
+		ok, err := rengine.RuleEngine(sub.Rules, evt.Payload)
+		if err != nil {
+			sink.TransitionTargetFail(event.ID, targetId, err.Error())
+			qq.Println("@targetProcessor/RuleEngine/error", err)
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		payload, err := transform.Apply(sub.Transform, evt.Payload)
+		if err != nil {
+			err = fmt.Errorf("transform failed: %w", err)
+			sink.TransitionTargetDead(event.ID, targetId, err.Error())
+			qq.Println("@targetProcessor/transform/error", err)
+			return err
+		}
+
+		payloads = append(payloads, payload)
+	}
+
+	if len(payloads) == 0 {
+		qq.Println("@targetProcessor/RuleEngine: no match")
+		return sink.TransitionTargetComplete(event.ID, targetId)
+	}
+
+	event.Payload = collapsePayloads(sub.CollapseMode, payloads)
+
+	ectx := &evtype.TExecution{
+		Subscription:   sub,
+		Target:         target,
+		Event:          event,
+		CollapsedCount: len(payloads),
+	}
+
 	qq.Println("@targetProcessor: calling handler for target", targetId)
+	startedAt := time.Now()
 	err = handler(ectx)
+	e.recordAttempt(ectx, startedAt, err)
+
 	if err != nil {
 		qq.Println("@targetProcessor/handler/error", err)
 		// Check if this is a retryable error
 		if ectx.RetryAble && sub.MaxRetries > 0 && target.RetryCount < sub.MaxRetries {
 			newRetryCount := target.RetryCount + 1
-			delayUntil := time.Now().Unix() + int64(sub.RetryDelay)
+			delayUntil := time.Now().Add(backoffDelay(sub.RetryDelay, target.RetryCount)).Unix()
 
 			err = sink.TransitionTargetDelay(targetId, event.ID, delayUntil, newRetryCount)
 			if err != nil {
@@ -97,10 +152,13 @@ func (e *ESLayer) targetProcessor(targetId int64) error {
 				return err
 			}
 			qq.Println("@targetProcessor: target", targetId, "retried, new count", newRetryCount)
+			e.Wake()
 			return nil
 		}
 
-		sink.TransitionTargetFail(event.ID, targetId, err.Error())
+		// out of retries or not retryable, park it in dead letter so it can
+		// be inspected and replayed or discarded
+		sink.TransitionTargetDead(event.ID, targetId, err.Error())
 		return err
 	}
 
@@ -114,3 +172,42 @@ func (e *ESLayer) targetProcessor(targetId int64) error {
 	qq.Println("@targetProcessor: target", targetId, "completed")
 	return nil
 }
+
+func (e *ESLayer) recordAttempt(ectx *evtype.TExecution, startedAt time.Time, herr error) {
+	attempt := &dbmodels.MQEventTargetAttempt{
+		TargetID:     ectx.Target.ID,
+		EventID:      ectx.Event.ID,
+		Attempt:      ectx.Target.RetryCount + 1,
+		Status:       "success",
+		ResponseCode: int64(ectx.ResponseCode),
+		DurationMs:   time.Since(startedAt).Milliseconds(),
+	}
+
+	if herr != nil {
+		attempt.Status = "error"
+		attempt.Error = herr.Error()
+	}
+
+	err := e.datahandle.GetMQSynk().AddTargetAttempt(attempt)
+	if err != nil {
+		qq.Println("@recordAttempt/AddTargetAttempt/error", err)
+	}
+}
+
+// collapsePayloads merges payloads of a collapsed batch, "list" sends them
+// all as a json array, anything else sends only the latest one
+func collapsePayloads(mode string, payloads [][]byte) []byte {
+	if mode != "list" {
+		return payloads[len(payloads)-1]
+	}
+
+	out := []byte{'['}
+	for i, payload := range payloads {
+		if i > 0 {
+			out = append(out, ',')
+		}
+		out = append(out, payload...)
+	}
+
+	return append(out, ']')
+}
@@ -3,6 +3,7 @@ package eventhub
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/blue-monads/potatoverse/backend/engine/hubs/eventhub/eslayer"
 	"github.com/blue-monads/potatoverse/backend/engine/hubs/eventhub/evtype"
@@ -52,7 +53,7 @@ func (e *EventHub) Start() error {
 		handlers[name] = builder(e.app)
 	}
 
-	e.eslayer = eslayer.NewESLayer(e.db, handlers)
+	e.eslayer = eslayer.NewESLayer(e.db, handlers, e.eslayerOptions())
 	err = e.eslayer.Start()
 	if err != nil {
 		qq.Println("@Start/eslayer.Start/error", err)
@@ -81,7 +82,7 @@ func (e *EventHub) Publish(opts *xtypes.EventOptions) error {
 
 	qq.Println("@Publish/3")
 
-	eventId, err := e.sink.AddEvent(installId, name, payload)
+	eventId, err := e.sink.AddEvent(installId, name, opts.CollapseKey, payload)
 	if err != nil {
 		qq.Println("@Publish/4")
 		return err
@@ -135,6 +136,26 @@ func (e *EventHub) needsProcessing(installId int64, name string) bool {
 	return e.activeEvents[key]
 }
 
+// Wake rescans the db for pending work, for targets changed outside the hub (eg. replay)
+func (e *EventHub) Wake() {
+	e.eslayer.Wake()
+}
+
+func (e *EventHub) eslayerOptions() eslayer.Options {
+	opts := eslayer.Options{}
+
+	config, ok := e.app.Config().(*xtypes.AppOptions)
+	if !ok || config.EventHub == nil {
+		return opts
+	}
+
+	opts.Workers = config.EventHub.Workers
+	opts.MaxPerInstall = config.EventHub.MaxPerInstall
+	opts.PollInterval = time.Duration(config.EventHub.PollInterval) * time.Second
+
+	return opts
+}
+
 func (e *EventHub) Stop() {
 	e.eslayer.Stop()
 }
@@ -11,6 +11,10 @@ type TExecution struct {
 	Target       *dbmodels.MQEventTarget
 	Event        *dbmodels.MQEvent
 	RetryAble    bool
+	// set by targets that talk http, recorded with the attempt
+	ResponseCode int
+	// number of events delivered by this execution, more than 1 when collapsed
+	CollapsedCount int
 }
 
 type Handler func(ex *TExecution) error
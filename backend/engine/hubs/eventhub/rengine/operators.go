@@ -0,0 +1,278 @@
+package rengine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+const (
+	ValueTypeAuto   = ""
+	ValueTypeString = "string"
+	ValueTypeNumber = "number"
+	ValueTypeDate   = "date"
+	ValueTypeField  = "field"
+)
+
+// incomparable is returned by compareTyped when values can not be read as
+// the requested type, it never equals -1, 0 or 1
+const incomparable = -2
+
+var dateFormats = []string{
+	time.RFC3339,
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	time.RFC1123,
+	time.RFC1123Z,
+}
+
+// compareTyped compares a and b as valueType. With auto type equality is
+// plain string equality and ordering tries numbers then strings, same as
+// before value types existed.
+func compareTyped(a, b, valueType string, equality bool) int {
+	switch valueType {
+	case ValueTypeNumber:
+		aNum, aErr := strconv.ParseFloat(a, 64)
+		bNum, bErr := strconv.ParseFloat(b, 64)
+		if aErr != nil || bErr != nil {
+			return incomparable
+		}
+		switch {
+		case aNum > bNum:
+			return 1
+		case aNum < bNum:
+			return -1
+		}
+		return 0
+
+	case ValueTypeString:
+		return strings.Compare(a, b)
+
+	case ValueTypeDate:
+		aTime, aOk := parseDate(a)
+		bTime, bOk := parseDate(b)
+		if !aOk || !bOk {
+			return incomparable
+		}
+		return aTime.Compare(bTime)
+
+	default:
+		if equality {
+			if a == b {
+				return 0
+			}
+			return 1
+		}
+		return compareValues(a, b)
+	}
+}
+
+// parseDate reads the date formats above, unix timestamps and relative
+// expressions like "now", "now-1h", "now+7d". Any integer string is taken
+// as a unix timestamp, in milliseconds when above 1e12 and seconds
+// otherwise, so a bare year like "2024" is 2024 seconds after the epoch,
+// write it as "2024-01-01" instead
+func parseDate(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+
+	if rest, ok := strings.CutPrefix(s, "now"); ok {
+		if rest == "" {
+			return time.Now(), true
+		}
+
+		sign := time.Duration(1)
+		switch rest[0] {
+		case '-':
+			sign = -1
+		case '+':
+		default:
+			return time.Time{}, false
+		}
+
+		d, err := parseDuration(rest[1:])
+		if err != nil {
+			return time.Time{}, false
+		}
+		return time.Now().Add(sign * d), true
+	}
+
+	if num, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if num > 1e12 {
+			return time.UnixMilli(num), true
+		}
+		return time.Unix(num, 0), true
+	}
+
+	for _, format := range dateFormats {
+		t, err := time.Parse(format, s)
+		if err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// parseDuration is time.ParseDuration plus whole days (d) and weeks (w)
+func parseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if num, ok := strings.CutSuffix(s, suffix); ok {
+			n, err := strconv.Atoi(num)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q", s)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+
+	return time.ParseDuration(s)
+}
+
+// parseWindow reads the value of within_* operators, "1h" or "last 1h"
+func parseWindow(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	value = strings.TrimPrefix(value, "last ")
+	value = strings.TrimPrefix(value, "next ")
+
+	d, err := parseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, errors.New("window must be positive")
+	}
+
+	return d, nil
+}
+
+func inWindow(operator string, at time.Time, window time.Duration) bool {
+	now := time.Now()
+
+	switch operator {
+	case "within_last":
+		return !at.Before(now.Add(-window)) && !at.After(now)
+	case "not_within_last":
+		return at.Before(now.Add(-window))
+	case "within_next":
+		return !at.Before(now) && !at.After(now.Add(window))
+	}
+
+	return false
+}
+
+// parseList reads a json array (`["a", 1]`) or a comma separated list
+func parseList(value string) ([]string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return []string{}, nil
+	}
+
+	if strings.HasPrefix(value, "[") {
+		items := []any{}
+		err := json.Unmarshal([]byte(value), &items)
+		if err != nil {
+			return nil, err
+		}
+
+		out := make([]string, len(items))
+		for i, item := range items {
+			out[i] = fmt.Sprint(item)
+		}
+		return out, nil
+	}
+
+	parts := strings.Split(value, ",")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+
+	return parts, nil
+}
+
+// resultList is the list side of in/contains_* operators, a field value type
+// reads an array field directly
+func resultList(expected gjson.Result, valueType string) ([]string, error) {
+	if valueType == ValueTypeField {
+		return arrayValues(expected), nil
+	}
+	return parseList(expected.String())
+}
+
+// arrayValues returns array elements as strings, a scalar is a one element list
+func arrayValues(value gjson.Result) []string {
+	if !value.Exists() {
+		return []string{}
+	}
+
+	if !value.IsArray() {
+		return []string{value.String()}
+	}
+
+	items := value.Array()
+	out := make([]string, len(items))
+	for i, item := range items {
+		out[i] = item.String()
+	}
+
+	return out
+}
+
+func containsList(actual, expected []string, all bool) bool {
+	if len(expected) == 0 {
+		return all
+	}
+
+	set := make(map[string]struct{}, len(actual))
+	for _, v := range actual {
+		set[v] = struct{}{}
+	}
+
+	for _, v := range expected {
+		_, ok := set[v]
+		if all && !ok {
+			return false
+		}
+		if !all && ok {
+			return true
+		}
+	}
+
+	return all
+}
+
+// parseRange reads "min,max" or "[min, max]", bounds are inclusive
+func parseRange(value string) (float64, float64, error) {
+	parts, err := parseList(value)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("range needs two numbers, got %q", value)
+	}
+
+	low, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid range start %q", parts[0])
+	}
+
+	high, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid range end %q", parts[1])
+	}
+
+	if low > high {
+		return 0, 0, fmt.Errorf("range start %v is after end %v", low, high)
+	}
+
+	return low, high, nil
+}
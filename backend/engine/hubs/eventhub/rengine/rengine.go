@@ -2,9 +2,10 @@ package rengine
 
 import (
 	"encoding/json"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/blue-monads/potatoverse/backend/utils/kosher"
 	"github.com/blue-monads/potatoverse/backend/utils/qq"
@@ -17,6 +18,9 @@ type Rule struct {
 	Operator string `json:"operator"`
 	Value    string `json:"value"`
 	ParentID string `json:"parent_id"`
+	// how Value is compared: "" (auto), string, number, date or field
+	// (Value is a path to another field of the payload)
+	ValueType string `json:"value_type,omitempty"`
 }
 
 // RuleNode represents a rule in the evaluation tree
@@ -153,14 +157,19 @@ func evaluateRule(rule Rule, jsonStr string) (bool, error) {
 	if value.Exists() {
 		actualValue = value.String()
 	}
-	expectedValue := rule.Value
+
+	expected := gjson.Result{Type: gjson.String, Str: rule.Value}
+	if rule.ValueType == ValueTypeField {
+		expected = gjson.Get(jsonStr, rule.Value)
+	}
+	expectedValue := expected.String()
 
 	switch rule.Operator {
 	case "equal_to":
-		return actualValue == expectedValue, nil
+		return compareTyped(actualValue, expectedValue, rule.ValueType, true) == 0, nil
 
 	case "not_equal_to":
-		return actualValue != expectedValue, nil
+		return compareTyped(actualValue, expectedValue, rule.ValueType, true) != 0, nil
 
 	case "contains":
 		return strings.Contains(actualValue, expectedValue), nil
@@ -169,18 +178,18 @@ func evaluateRule(rule Rule, jsonStr string) (bool, error) {
 		return !strings.Contains(actualValue, expectedValue), nil
 
 	case "greater_than":
-		return compareValues(actualValue, expectedValue) > 0, nil
+		return compareTyped(actualValue, expectedValue, rule.ValueType, false) == 1, nil
 
 	case "less_than":
-		return compareValues(actualValue, expectedValue) < 0, nil
+		return compareTyped(actualValue, expectedValue, rule.ValueType, false) == -1, nil
 
 	case "greater_than_or_equal":
-		comp := compareValues(actualValue, expectedValue)
-		return comp >= 0, nil
+		comp := compareTyped(actualValue, expectedValue, rule.ValueType, false)
+		return comp == 0 || comp == 1, nil
 
 	case "less_than_or_equal":
-		comp := compareValues(actualValue, expectedValue)
-		return comp <= 0, nil
+		comp := compareTyped(actualValue, expectedValue, rule.ValueType, false)
+		return comp == 0 || comp == -1, nil
 
 	case "before":
 		return compareDates(actualValue, expectedValue) < 0, nil
@@ -188,6 +197,61 @@ func evaluateRule(rule Rule, jsonStr string) (bool, error) {
 	case "after":
 		return compareDates(actualValue, expectedValue) > 0, nil
 
+	case "matches", "not_matches":
+		re, err := regexp.Compile(expectedValue)
+		if err != nil {
+			return false, err
+		}
+		return re.MatchString(actualValue) == (rule.Operator == "matches"), nil
+
+	case "in", "not_in":
+		if !value.Exists() {
+			return rule.Operator == "not_in", nil
+		}
+		list, err := resultList(expected, rule.ValueType)
+		if err != nil {
+			return false, err
+		}
+		return slices.Contains(list, actualValue) == (rule.Operator == "in"), nil
+
+	case "contains_any", "contains_all":
+		if !value.Exists() {
+			return false, nil
+		}
+		list, err := resultList(expected, rule.ValueType)
+		if err != nil {
+			return false, err
+		}
+		return containsList(arrayValues(value), list, rule.Operator == "contains_all"), nil
+
+	case "exists":
+		return value.Exists(), nil
+
+	case "not_exists":
+		return !value.Exists(), nil
+
+	case "between", "not_between":
+		low, high, err := parseRange(expectedValue)
+		if err != nil {
+			return false, err
+		}
+		num, err := strconv.ParseFloat(actualValue, 64)
+		if err != nil {
+			return false, nil
+		}
+		return (num >= low && num <= high) == (rule.Operator == "between"), nil
+
+	case "within_last", "within_next", "not_within_last":
+		window, err := parseWindow(expectedValue)
+		if err != nil {
+			return false, err
+		}
+		at, ok := parseDate(actualValue)
+		if !ok {
+			return false, nil
+		}
+		return inWindow(rule.Operator, at, window), nil
+
 	default:
 		qq.Println("RuleEngine: unknown operator", rule.Operator)
 		return false, nil
@@ -219,42 +283,12 @@ func compareValues(a, b string) int {
 
 // compareDates compares two date strings
 func compareDates(a, b string) int {
-	// Try various date formats
-	formats := []string{
-		time.RFC3339,
-		time.RFC3339Nano,
-		"2006-01-02T15:04:05Z07:00",
-		"2006-01-02 15:04:05",
-		"2006-01-02",
-		time.RFC1123,
-		time.RFC1123Z,
-	}
-
-	var aTime, bTime time.Time
-	var aErr, bErr error
-
-	for _, format := range formats {
-		aTime, aErr = time.Parse(format, a)
-		if aErr == nil {
-			break
-		}
-	}
-
-	for _, format := range formats {
-		bTime, bErr = time.Parse(format, b)
-		if bErr == nil {
-			break
-		}
-	}
+	aTime, aOk := parseDate(a)
+	bTime, bOk := parseDate(b)
 
 	// If both parsed successfully, compare
-	if aErr == nil && bErr == nil {
-		if aTime.After(bTime) {
-			return 1
-		} else if aTime.Before(bTime) {
-			return -1
-		}
-		return 0
+	if aOk && bOk {
+		return aTime.Compare(bTime)
 	}
 
 	// If parsing failed, fall back to string comparison
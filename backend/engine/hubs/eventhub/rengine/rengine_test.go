@@ -3,6 +3,7 @@ package rengine
 import (
 	"encoding/json"
 	"testing"
+	"time"
 )
 
 func TestRuleEngine_EmptyRules(t *testing.T) {
@@ -937,3 +938,249 @@ func TestRuleEngine_InvalidJSON(t *testing.T) {
 		})
 	}
 }
+
+func TestRuleEngine_NewOperators(t *testing.T) {
+	recent := time.Now().Add(-10 * time.Minute).UTC().Format(time.RFC3339)
+	payload := []byte(`{"email": "ann@example.com", "status": "active", "tags": ["a", "b", "c"], "count": 10, "seen": "` + recent + `", "old": "2020-01-01T00:00:00Z"}`)
+
+	tests := []struct {
+		name    string
+		rules   []Rule
+		want    bool
+		wantErr bool
+	}{
+		{
+			name:  "matches",
+			rules: []Rule{{ID: "1", Variable: "email", Operator: "matches", Value: `^[a-z]+@example\.com$`}},
+			want:  true,
+		},
+		{
+			name:  "not matches",
+			rules: []Rule{{ID: "1", Variable: "email", Operator: "not_matches", Value: `@potato\.dev$`}},
+			want:  true,
+		},
+		{
+			name:    "invalid regex",
+			rules:   []Rule{{ID: "1", Variable: "email", Operator: "matches", Value: `([`}},
+			want:    false,
+			wantErr: true,
+		},
+		{
+			name:  "in comma list",
+			rules: []Rule{{ID: "1", Variable: "status", Operator: "in", Value: "pending, active"}},
+			want:  true,
+		},
+		{
+			name:  "in json list",
+			rules: []Rule{{ID: "1", Variable: "count", Operator: "in", Value: `[5, 10]`}},
+			want:  true,
+		},
+		{
+			name:  "not in",
+			rules: []Rule{{ID: "1", Variable: "status", Operator: "not_in", Value: "deleted,banned"}},
+			want:  true,
+		},
+		{
+			name:  "not in missing field",
+			rules: []Rule{{ID: "1", Variable: "nope", Operator: "not_in", Value: "a"}},
+			want:  true,
+		},
+		{
+			name:  "contains any",
+			rules: []Rule{{ID: "1", Variable: "tags", Operator: "contains_any", Value: "x,c"}},
+			want:  true,
+		},
+		{
+			name:  "contains all no match",
+			rules: []Rule{{ID: "1", Variable: "tags", Operator: "contains_all", Value: "a,x"}},
+			want:  false,
+		},
+		{
+			name:  "contains all",
+			rules: []Rule{{ID: "1", Variable: "tags", Operator: "contains_all", Value: `["a", "c"]`}},
+			want:  true,
+		},
+		{
+			name:  "exists",
+			rules: []Rule{{ID: "1", Variable: "tags", Operator: "exists"}},
+			want:  true,
+		},
+		{
+			name:  "not exists",
+			rules: []Rule{{ID: "1", Variable: "nope", Operator: "not_exists"}},
+			want:  true,
+		},
+		{
+			name:  "between inclusive",
+			rules: []Rule{{ID: "1", Variable: "count", Operator: "between", Value: "1,10"}},
+			want:  true,
+		},
+		{
+			name:  "not between",
+			rules: []Rule{{ID: "1", Variable: "count", Operator: "not_between", Value: "[11, 20]"}},
+			want:  true,
+		},
+		{
+			name:  "within last",
+			rules: []Rule{{ID: "1", Variable: "seen", Operator: "within_last", Value: "1h"}},
+			want:  true,
+		},
+		{
+			name:  "within last old",
+			rules: []Rule{{ID: "1", Variable: "old", Operator: "within_last", Value: "7d"}},
+			want:  false,
+		},
+		{
+			name:  "not within last",
+			rules: []Rule{{ID: "1", Variable: "old", Operator: "not_within_last", Value: "1w"}},
+			want:  true,
+		},
+		{
+			name:  "after relative date",
+			rules: []Rule{{ID: "1", Variable: "seen", Operator: "after", Value: "now-1h"}},
+			want:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rulesJSON, _ := json.Marshal(tt.rules)
+			got, err := RuleEngine(string(rulesJSON), payload)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("RuleEngine() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("RuleEngine() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleEngine_ValueTypes(t *testing.T) {
+	payload := []byte(`{"count": "9", "price": 100, "budget": 80, "limit": 100, "code": "10", "created": "2024-01-15T10:00:00Z", "created_unix": 1705312800, "created_ms": "1705312800000", "allowed": ["a", "b"], "role": "b"}`)
+
+	tests := []struct {
+		name  string
+		rules []Rule
+		want  bool
+	}{
+		{
+			name:  "number equal ignores formatting",
+			rules: []Rule{{ID: "1", Variable: "price", Operator: "equal_to", Value: "100.0", ValueType: ValueTypeNumber}},
+			want:  true,
+		},
+		{
+			name:  "auto equal is string equality",
+			rules: []Rule{{ID: "1", Variable: "price", Operator: "equal_to", Value: "100.0"}},
+			want:  false,
+		},
+		{
+			name:  "string ordering",
+			rules: []Rule{{ID: "1", Variable: "count", Operator: "greater_than", Value: "10", ValueType: ValueTypeString}},
+			want:  true,
+		},
+		{
+			name:  "number ordering on string field",
+			rules: []Rule{{ID: "1", Variable: "count", Operator: "greater_than", Value: "10", ValueType: ValueTypeNumber}},
+			want:  false,
+		},
+		{
+			name:  "number with non numeric value",
+			rules: []Rule{{ID: "1", Variable: "created", Operator: "less_than", Value: "10", ValueType: ValueTypeNumber}},
+			want:  false,
+		},
+		{
+			name:  "date type",
+			rules: []Rule{{ID: "1", Variable: "created", Operator: "less_than", Value: "2024-02-01", ValueType: ValueTypeDate}},
+			want:  true,
+		},
+		{
+			name:  "date type unix seconds",
+			rules: []Rule{{ID: "1", Variable: "created_unix", Operator: "equal_to", Value: "2024-01-15T10:00:00Z", ValueType: ValueTypeDate}},
+			want:  true,
+		},
+		{
+			name:  "date type unix milliseconds",
+			rules: []Rule{{ID: "1", Variable: "created_ms", Operator: "equal_to", Value: "1705312800", ValueType: ValueTypeDate}},
+			want:  true,
+		},
+		{
+			name:  "date type bare year is a timestamp",
+			rules: []Rule{{ID: "1", Variable: "created", Operator: "greater_than", Value: "2030", ValueType: ValueTypeDate}},
+			want:  true,
+		},
+		{
+			name:  "field greater than",
+			rules: []Rule{{ID: "1", Variable: "price", Operator: "greater_than", Value: "budget", ValueType: ValueTypeField}},
+			want:  true,
+		},
+		{
+			name:  "field equal",
+			rules: []Rule{{ID: "1", Variable: "price", Operator: "equal_to", Value: "limit", ValueType: ValueTypeField}},
+			want:  true,
+		},
+		{
+			name:  "field in array",
+			rules: []Rule{{ID: "1", Variable: "role", Operator: "in", Value: "allowed", ValueType: ValueTypeField}},
+			want:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rulesJSON, _ := json.Marshal(tt.rules)
+			got, err := RuleEngine(string(rulesJSON), payload)
+			if err != nil {
+				t.Errorf("RuleEngine() error = %v", err)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("RuleEngine() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rulestr string
+		wantErr bool
+	}{
+		{name: "empty", rulestr: ""},
+		{name: "empty object", rulestr: "{}"},
+		{name: "empty list", rulestr: "[]"},
+		{
+			name:    "valid tree",
+			rulestr: `[{"id": "g", "variable": "$logical", "operator": "group", "value": "OR"}, {"id": "1", "variable": "a", "operator": "in", "value": "x,y", "parent_id": "g"}, {"id": "2", "variable": "b", "operator": "within_last", "value": "2d", "parent_id": "g"}]`,
+		},
+		{name: "invalid json", rulestr: `{invalid`, wantErr: true},
+		{name: "missing id", rulestr: `[{"variable": "a", "operator": "exists"}]`, wantErr: true},
+		{name: "duplicate id", rulestr: `[{"id": "1", "variable": "a", "operator": "exists"}, {"id": "1", "variable": "b", "operator": "exists"}]`, wantErr: true},
+		{name: "unknown operator", rulestr: `[{"id": "1", "variable": "a", "operator": "like"}]`, wantErr: true},
+		{name: "missing variable", rulestr: `[{"id": "1", "operator": "exists"}]`, wantErr: true},
+		{name: "bad group value", rulestr: `[{"id": "1", "variable": "$logical", "operator": "group", "value": "XOR"}]`, wantErr: true},
+		{name: "bad regex", rulestr: `[{"id": "1", "variable": "a", "operator": "matches", "value": "(["}]`, wantErr: true},
+		{name: "bad range", rulestr: `[{"id": "1", "variable": "a", "operator": "between", "value": "10,1"}]`, wantErr: true},
+		{name: "bad window", rulestr: `[{"id": "1", "variable": "a", "operator": "within_last", "value": "soon"}]`, wantErr: true},
+		{name: "bad number", rulestr: `[{"id": "1", "variable": "a", "operator": "greater_than", "value": "ten", "value_type": "number"}]`, wantErr: true},
+		{name: "unknown value type", rulestr: `[{"id": "1", "variable": "a", "operator": "equal_to", "value": "x", "value_type": "bool"}]`, wantErr: true},
+		{name: "missing parent", rulestr: `[{"id": "1", "variable": "a", "operator": "exists", "parent_id": "g"}]`, wantErr: true},
+		{name: "parent not a group", rulestr: `[{"id": "1", "variable": "a", "operator": "exists"}, {"id": "2", "variable": "b", "operator": "exists", "parent_id": "1"}]`, wantErr: true},
+		{
+			name:    "parent cycle",
+			rulestr: `[{"id": "g1", "variable": "$logical", "operator": "group", "value": "AND", "parent_id": "g2"}, {"id": "g2", "variable": "$logical", "operator": "group", "value": "AND", "parent_id": "g1"}]`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRules(tt.rulestr)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateRules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
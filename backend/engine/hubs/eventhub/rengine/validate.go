@@ -0,0 +1,176 @@
+package rengine
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+)
+
+var knownOperators = []string{
+	"equal_to",
+	"not_equal_to",
+	"contains",
+	"not_contains",
+	"greater_than",
+	"less_than",
+	"greater_than_or_equal",
+	"less_than_or_equal",
+	"before",
+	"after",
+	"matches",
+	"not_matches",
+	"in",
+	"not_in",
+	"contains_any",
+	"contains_all",
+	"exists",
+	"not_exists",
+	"between",
+	"not_between",
+	"within_last",
+	"within_next",
+	"not_within_last",
+}
+
+var knownValueTypes = []string{
+	ValueTypeAuto,
+	ValueTypeString,
+	ValueTypeNumber,
+	ValueTypeDate,
+	ValueTypeField,
+}
+
+// ValidateRules checks a rule tree before it is saved, so a broken
+// subscription is rejected upfront instead of failing on every event
+func ValidateRules(rulestr string) error {
+	if rulestr == "{}" || rulestr == "" || rulestr == `{"rules":[],"groups":[]}` {
+		return nil
+	}
+
+	rules := []Rule{}
+	err := json.Unmarshal([]byte(rulestr), &rules)
+	if err != nil {
+		return fmt.Errorf("invalid rules json: %w", err)
+	}
+
+	parents := make(map[string]string, len(rules))
+	groups := make(map[string]bool, len(rules))
+
+	for i, rule := range rules {
+		if rule.ID == "" {
+			return fmt.Errorf("rule %d: missing id", i)
+		}
+		if _, ok := parents[rule.ID]; ok {
+			return fmt.Errorf("rule %s: duplicate id", rule.ID)
+		}
+
+		parents[rule.ID] = rule.ParentID
+		groups[rule.ID] = rule.Variable == "$logical"
+
+		err := validateRule(rule)
+		if err != nil {
+			return fmt.Errorf("rule %s: %w", rule.ID, err)
+		}
+	}
+
+	for _, rule := range rules {
+		if rule.ParentID == "" {
+			continue
+		}
+
+		isGroup, ok := groups[rule.ParentID]
+		if !ok {
+			return fmt.Errorf("rule %s: parent %s not found", rule.ID, rule.ParentID)
+		}
+		if !isGroup {
+			return fmt.Errorf("rule %s: parent %s is not a group", rule.ID, rule.ParentID)
+		}
+
+		// walk up, a chain longer than the rule count is a cycle
+		current := rule.ParentID
+		for steps := 0; current != ""; steps++ {
+			if steps > len(rules) || current == rule.ID {
+				return fmt.Errorf("rule %s: parent cycle", rule.ID)
+			}
+			current = parents[current]
+		}
+	}
+
+	return nil
+}
+
+func validateRule(rule Rule) error {
+	if rule.Variable == "$logical" {
+		if rule.Operator != "group" {
+			return fmt.Errorf("logical rule needs group operator, got %q", rule.Operator)
+		}
+		if rule.Value != "AND" && rule.Value != "OR" {
+			return fmt.Errorf("group value must be AND or OR, got %q", rule.Value)
+		}
+		return nil
+	}
+
+	if rule.Variable == "" {
+		return fmt.Errorf("missing variable")
+	}
+
+	if !slices.Contains(knownOperators, rule.Operator) {
+		return fmt.Errorf("unknown operator %q", rule.Operator)
+	}
+
+	if !slices.Contains(knownValueTypes, rule.ValueType) {
+		return fmt.Errorf("unknown value type %q", rule.ValueType)
+	}
+
+	if rule.ValueType == ValueTypeField {
+		if rule.Value == "" {
+			return fmt.Errorf("field value type needs a field path")
+		}
+		return nil
+	}
+
+	switch rule.Operator {
+	case "matches", "not_matches":
+		_, err := regexp.Compile(rule.Value)
+		if err != nil {
+			return fmt.Errorf("invalid regex: %w", err)
+		}
+	case "in", "not_in", "contains_any", "contains_all":
+		_, err := parseList(rule.Value)
+		if err != nil {
+			return fmt.Errorf("invalid list: %w", err)
+		}
+	case "between", "not_between":
+		_, _, err := parseRange(rule.Value)
+		if err != nil {
+			return err
+		}
+	case "within_last", "within_next", "not_within_last":
+		_, err := parseWindow(rule.Value)
+		if err != nil {
+			return fmt.Errorf("invalid window: %w", err)
+		}
+	case "before", "after":
+		if _, ok := parseDate(rule.Value); !ok {
+			return fmt.Errorf("invalid date %q", rule.Value)
+		}
+	}
+
+	switch rule.Operator {
+	case "equal_to", "not_equal_to", "greater_than", "less_than", "greater_than_or_equal", "less_than_or_equal":
+		if rule.ValueType == ValueTypeNumber {
+			if _, err := strconv.ParseFloat(rule.Value, 64); err != nil {
+				return fmt.Errorf("invalid number %q", rule.Value)
+			}
+		}
+		if rule.ValueType == ValueTypeDate {
+			if _, ok := parseDate(rule.Value); !ok {
+				return fmt.Errorf("invalid date %q", rule.Value)
+			}
+		}
+	}
+
+	return nil
+}
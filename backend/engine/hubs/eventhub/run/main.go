@@ -301,7 +301,7 @@ func main() {
 
 	// Start the event layer
 	Show("\n=== Starting ESLayer ===")
-	eslayer := eslayer.NewESLayer(db, handlers)
+	eslayer := eslayer.NewESLayer(db, handlers, eslayer.Options{Workers: 4, PollInterval: 5 * time.Second})
 
 	err = eslayer.Start()
 	if err != nil {
@@ -329,7 +329,7 @@ func main() {
 	}
 
 	for _, evt := range events {
-		eventID, err := db.GetMQSynk().AddEvent(installID, evt.name, []byte(evt.payload))
+		eventID, err := db.GetMQSynk().AddEvent(installID, evt.name, "", []byte(evt.payload))
 		if err != nil {
 			Show("Failed to add event", evt.name, "err", err)
 		} else {
@@ -0,0 +1,42 @@
+package targets
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/blue-monads/potatoverse/backend/utils/netguard"
+)
+
+// newGuardedClient returns a client that refuses to connect to loopback,
+// private, link local and other non public addresses. The check runs on the
+// resolved address of every dial so redirects and dns rebinding are covered.
+func newGuardedClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	if !allowPrivate {
+		dialer.Control = netguard.Control
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			// no env proxies, the proxy would do the dialing for us
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			MaxIdleConns:          50,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			return nil
+		},
+	}
+}
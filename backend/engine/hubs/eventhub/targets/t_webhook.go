@@ -2,53 +2,108 @@ package targets
 
 import (
 	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/blue-monads/potatoverse/backend/engine/hubs/eventhub/evtype"
 	"github.com/blue-monads/potatoverse/backend/utils/kosher"
+	"github.com/blue-monads/potatoverse/backend/utils/netguard"
 	"github.com/blue-monads/potatoverse/backend/xtypes"
 )
 
+const (
+	defaultWebhookTimeout = 15 * time.Second
+	maxWebhookTimeout     = 2 * time.Minute
+
+	// receivers verify HMAC_SHA256(secret, "<timestamp>.<body>") from the
+	// v1 part of the signature header and reject stale timestamps
+	webhookSignatureHeader = "X-Potato-Signature"
+	webhookTimestampHeader = "X-Potato-Timestamp"
+	webhookEventHeader     = "X-Potato-Event"
+	webhookEventIdHeader   = "X-Potato-Event-Id"
+	webhookCollapsedHeader = "X-Potato-Collapsed"
+)
+
+// webhookOptions are read from the subscription target_options
+//
+//	{"secret": "...", "timeout": 30, "Header-X-Api-Key": "..."}
+type webhookOptions struct {
+	Secret  string
+	Timeout time.Duration
+	Headers map[string]string
+}
+
 func PerformWebhookTargetExecution(app xtypes.App) evtype.Handler {
 
+	allowPrivate := false
+	if config, ok := app.Config().(*xtypes.AppOptions); ok && config.EventHub != nil {
+		allowPrivate = config.EventHub.AllowPrivateWebhooks
+	}
+
+	client := newGuardedClient(allowPrivate)
+
 	return func(ectx *evtype.TExecution) error {
 		url := ectx.Subscription.TargetEndpoint
 
+		opts, err := parseWebhookOptions(ectx.Subscription.TargetOptions)
+		if err != nil {
+			return err
+		}
+
+		// already transformed by eslayer
 		bodyRaw := ectx.Event.Payload
-		rbody := bytes.NewReader(bodyRaw)
 
-		req, err := http.NewRequest(http.MethodPost, url, rbody)
+		ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(bodyRaw))
 		if err != nil {
 			return err
 		}
 
-		if ectx.Subscription.TargetOptions != "{}" && ectx.Subscription.TargetOptions != "" {
-			targetOptions := map[string]any{}
-			topts := ectx.Subscription.TargetOptions
-			err = json.Unmarshal(kosher.Byte(topts), &targetOptions)
-			if err != nil {
-				return err
-			}
-
-			for k, v := range targetOptions {
-				if after, ok := strings.CutPrefix(k, "Header-"); ok {
-					req.Header.Set(after, fmt.Sprintf("%v", v))
-					continue
-				}
-			}
+		for k, v := range opts.Headers {
+			req.Header.Set(k, v)
 		}
 
 		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(webhookEventHeader, ectx.Event.Name)
+		req.Header.Set(webhookEventIdHeader, strconv.FormatInt(ectx.Event.ID, 10))
+		if ectx.CollapsedCount > 1 {
+			req.Header.Set(webhookCollapsedHeader, strconv.Itoa(ectx.CollapsedCount))
+		}
+
+		if opts.Secret != "" {
+			ts := strconv.FormatInt(time.Now().Unix(), 10)
+			req.Header.Set(webhookTimestampHeader, ts)
+			req.Header.Set(webhookSignatureHeader, fmt.Sprintf("t=%s,v1=%s", ts, signWebhook(opts.Secret, ts, bodyRaw)))
+		}
 
-		resp, err := http.DefaultClient.Do(req)
+		resp, err := client.Do(req)
 		if err != nil {
+			// a blocked address will stay blocked
+			ectx.RetryAble = !errors.Is(err, netguard.ErrBlockedAddress)
 			return err
 		}
+		defer resp.Body.Close()
+
+		// drain so the connection can be reused
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+		ectx.ResponseCode = resp.StatusCode
 
-		if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			// client errors will fail the same way again, except throttling and timeouts
+			ectx.RetryAble = resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout
 			return fmt.Errorf("webhook failed with status code %d", resp.StatusCode)
 		}
 
@@ -56,3 +111,66 @@ func PerformWebhookTargetExecution(app xtypes.App) evtype.Handler {
 	}
 
 }
+
+func signWebhook(secret, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, kosher.Byte(secret))
+	mac.Write(kosher.Byte(ts))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func parseWebhookOptions(topts string) (*webhookOptions, error) {
+	opts := &webhookOptions{
+		Timeout: defaultWebhookTimeout,
+		Headers: map[string]string{},
+	}
+
+	if topts == "{}" || topts == "" {
+		return opts, nil
+	}
+
+	targetOptions := map[string]any{}
+	err := json.Unmarshal(kosher.Byte(topts), &targetOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range targetOptions {
+		if after, ok := strings.CutPrefix(k, "Header-"); ok {
+			opts.Headers[after] = fmt.Sprintf("%v", v)
+			continue
+		}
+
+		switch k {
+		case "secret":
+			opts.Secret = fmt.Sprintf("%v", v)
+		case "timeout":
+			timeout, err := parseTimeout(v)
+			if err != nil {
+				return nil, err
+			}
+			opts.Timeout = min(timeout, maxWebhookTimeout)
+		}
+	}
+
+	return opts, nil
+}
+
+// timeout is seconds as number or a duration string like "30s"
+func parseTimeout(v any) (time.Duration, error) {
+	switch tv := v.(type) {
+	case float64:
+		if tv <= 0 {
+			return defaultWebhookTimeout, nil
+		}
+		return time.Duration(tv * float64(time.Second)), nil
+	case string:
+		if tv == "" {
+			return defaultWebhookTimeout, nil
+		}
+		return time.ParseDuration(tv)
+	default:
+		return 0, fmt.Errorf("invalid timeout: %v", v)
+	}
+}
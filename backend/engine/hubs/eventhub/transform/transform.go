@@ -0,0 +1,128 @@
+package transform
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/blue-monads/potatoverse/backend/utils/kosher"
+	"github.com/tidwall/gjson"
+)
+
+// Spec is the transform column of a subscription, steps run in the order
+// pick, rename, extract, template, set. extract and template always read
+// from the original payload.
+//
+//	{
+//	  "pick": ["id", "user"],
+//	  "rename": {"user": "owner"},
+//	  "extract": {"email": "user.contact.email", "tags": "items.#.tag"},
+//	  "template": {"title": "order {{id}} by {{user.name}}"},
+//	  "set": {"source": "potato"}
+//	}
+type Spec struct {
+	// keep only these top level fields
+	Pick []string `json:"pick,omitempty"`
+	// old name -> new name
+	Rename map[string]string `json:"rename,omitempty"`
+	// field -> gjson path
+	Extract map[string]string `json:"extract,omitempty"`
+	// field -> string with {{gjson.path}} placeholders
+	Template map[string]string `json:"template,omitempty"`
+	// constant fields added to the payload
+	Set map[string]any `json:"set,omitempty"`
+}
+
+var placeholderRe = regexp.MustCompile(`{{\s*([^{}]+?)\s*}}`)
+
+func IsEmpty(specstr string) bool {
+	return specstr == "" || specstr == "{}"
+}
+
+func Parse(specstr string) (*Spec, error) {
+	spec := &Spec{}
+	if IsEmpty(specstr) {
+		return spec, nil
+	}
+
+	err := json.Unmarshal(kosher.Byte(specstr), spec)
+	if err != nil {
+		return nil, err
+	}
+
+	for field, path := range spec.Extract {
+		if strings.TrimSpace(path) == "" {
+			return nil, errors.New("empty extract path for " + field)
+		}
+	}
+
+	return spec, nil
+}
+
+// Apply transforms a json object payload, an empty spec returns the payload as is
+func Apply(specstr string, payload []byte) ([]byte, error) {
+	if IsEmpty(specstr) {
+		return payload, nil
+	}
+
+	spec, err := Parse(specstr)
+	if err != nil {
+		return nil, err
+	}
+
+	return spec.Apply(payload)
+}
+
+func (s *Spec) Apply(payload []byte) ([]byte, error) {
+	data := map[string]any{}
+	if len(payload) != 0 {
+		err := json.Unmarshal(payload, &data)
+		if err != nil {
+			return nil, errors.New("transform needs a json object payload")
+		}
+	}
+
+	if len(s.Pick) != 0 {
+		picked := make(map[string]any, len(s.Pick))
+		for _, key := range s.Pick {
+			if v, ok := data[key]; ok {
+				picked[key] = v
+			}
+		}
+		data = picked
+	}
+
+	for from, to := range s.Rename {
+		v, ok := data[from]
+		if !ok {
+			continue
+		}
+		delete(data, from)
+		data[to] = v
+	}
+
+	jsonStr := kosher.Str(payload)
+
+	for field, path := range s.Extract {
+		result := gjson.Get(jsonStr, path)
+		if !result.Exists() {
+			data[field] = nil
+			continue
+		}
+		data[field] = result.Value()
+	}
+
+	for field, tpl := range s.Template {
+		data[field] = placeholderRe.ReplaceAllStringFunc(tpl, func(m string) string {
+			path := placeholderRe.FindStringSubmatch(m)[1]
+			return gjson.Get(jsonStr, path).String()
+		})
+	}
+
+	for key, v := range s.Set {
+		data[key] = v
+	}
+
+	return json.Marshal(data)
+}
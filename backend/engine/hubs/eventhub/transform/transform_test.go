@@ -0,0 +1,88 @@
+package transform
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	payload := []byte(`{"id": 7, "user": {"name": "ann", "email": "ann@example.com"}, "items": [{"tag": "a"}, {"tag": "b"}], "secret": "x"}`)
+
+	tests := []struct {
+		name    string
+		spec    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "empty spec keeps payload",
+			spec: "{}",
+			want: string(payload),
+		},
+		{
+			name: "pick",
+			spec: `{"pick": ["id", "missing"]}`,
+			want: `{"id": 7}`,
+		},
+		{
+			name: "pick and rename",
+			spec: `{"pick": ["id", "user"], "rename": {"user": "owner"}}`,
+			want: `{"id": 7, "owner": {"name": "ann", "email": "ann@example.com"}}`,
+		},
+		{
+			name: "extract",
+			spec: `{"pick": ["id"], "extract": {"email": "user.email", "tags": "items.#.tag", "none": "nope"}}`,
+			want: `{"id": 7, "email": "ann@example.com", "tags": ["a", "b"], "none": null}`,
+		},
+		{
+			name: "template",
+			spec: `{"pick": [], "template": {"title": "order {{ id }} by {{user.name}}{{nope}}"}}`,
+			want: `{"id": 7, "user": {"name": "ann", "email": "ann@example.com"}, "items": [{"tag": "a"}, {"tag": "b"}], "secret": "x", "title": "order 7 by ann"}`,
+		},
+		{
+			name: "set overrides",
+			spec: `{"pick": ["id"], "set": {"id": 1, "source": "potato"}}`,
+			want: `{"id": 1, "source": "potato"}`,
+		},
+		{
+			name:    "invalid spec",
+			spec:    `{"pick": "id"}`,
+			wantErr: true,
+		},
+		{
+			name:    "empty extract path",
+			spec:    `{"extract": {"a": ""}}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply(tt.spec, payload)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Apply() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			var gotv, wantv any
+			if err := json.Unmarshal(got, &gotv); err != nil {
+				t.Fatalf("invalid output %s: %v", got, err)
+			}
+			json.Unmarshal([]byte(tt.want), &wantv)
+
+			if !reflect.DeepEqual(gotv, wantv) {
+				t.Errorf("Apply() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApply_NonObjectPayload(t *testing.T) {
+	_, err := Apply(`{"pick": ["a"]}`, []byte(`[1, 2]`))
+	if err == nil {
+		t.Error("expected error for array payload")
+	}
+}
@@ -22,6 +22,14 @@ func (r *EmbedRepo) ListPackages() ([]repotypes.PotatoPackage, error) {
 	return listEmbeddedPackagesFromFS(r.fs)
 }
 
-func (r *EmbedRepo) ZipPackage(packageName string, version string) (string, error) {
-	return zipEmbeddedPackageFromFS(r.fs, packageName)
+func (r *EmbedRepo) ZipPackage(packageName string, version string) (*repotypes.PackageFile, error) {
+	path, err := zipEmbeddedPackageFromFS(r.fs, packageName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &repotypes.PackageFile{
+		Path:    path,
+		Builtin: true,
+	}, nil
 }
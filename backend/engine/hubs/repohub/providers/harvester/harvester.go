@@ -2,6 +2,7 @@ package harvester
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -13,6 +14,7 @@ import (
 	"time"
 
 	repohub "github.com/blue-monads/potatoverse/backend/engine/hubs/repohub"
+	"github.com/blue-monads/potatoverse/backend/engine/hubs/repohub/reposign"
 	"github.com/blue-monads/potatoverse/backend/engine/hubs/repohub/repotypes"
 	"github.com/blue-monads/potatoverse/backend/utils/qq"
 	"github.com/blue-monads/potatoverse/backend/xtypes"
@@ -33,6 +35,10 @@ type HarvesterRepo struct {
 	cache      *PotatoField
 	cacheTime  time.Time
 	cacheMutex sync.Mutex
+
+	// signer of the cached index, see reposign
+	signedBy     string
+	signatureErr error
 }
 
 func NewHarvesterRepo(baseURL string) *HarvesterRepo {
@@ -45,38 +51,78 @@ func (r *HarvesterRepo) isCacheValid() bool {
 
 func (r *HarvesterRepo) getCache() (*PotatoField, error) {
 	r.cacheMutex.Lock()
+	defer r.cacheMutex.Unlock()
+
 	if r.cache != nil && r.isCacheValid() {
-		r.cacheMutex.Unlock()
 		return r.cache, nil
 	}
 
-	fullurl, err := url.JoinPath(r.baseURL, "harvest-index.json")
+	body, err := r.fetch(reposign.IndexFile)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := http.Get(fullurl)
+	var field PotatoField
+	err = json.Unmarshal(body, &field)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	r.signedBy, r.signatureErr = r.verifyIndex(body)
+
+	r.cache = &field
+	r.cacheTime = time.Now()
+
+	return &field, nil
+}
+
+// verifyIndex checks the detached index signature, a repo without one is
+// unsigned and not an error
+func (r *HarvesterRepo) verifyIndex(body []byte) (string, error) {
+	sigBody, err := r.fetch(reposign.IndexSignatureFile)
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	sig, err := reposign.ParseSignature(sigBody)
+	if err != nil {
+		return "", err
+	}
+
+	err = reposign.Verify(sig, reposign.Digest(body))
+	if err != nil {
+		return "", err
+	}
+
+	return sig.KeyId(), nil
+}
+
+var errNotFound = errors.New("not found")
+
+func (r *HarvesterRepo) fetch(name string) ([]byte, error) {
+	fullurl, err := url.JoinPath(r.baseURL, name)
 	if err != nil {
 		return nil, err
 	}
 
-	var field PotatoField
-	err = json.Unmarshal(body, &field)
+	resp, err := http.Get(fullurl)
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 
-	r.cache = &field
-	r.cacheTime = time.Now()
-	r.cacheMutex.Unlock()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errNotFound
+	}
 
-	return &field, nil
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s: %s", name, resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
 }
 
 func (r *HarvesterRepo) ListPackages() ([]repotypes.PotatoPackage, error) {
@@ -88,10 +134,10 @@ func (r *HarvesterRepo) ListPackages() ([]repotypes.PotatoPackage, error) {
 	return field.Potatoes, nil
 }
 
-func (r *HarvesterRepo) ZipPackage(packageName string, version string) (string, error) {
+func (r *HarvesterRepo) ZipPackage(packageName string, version string) (*repotypes.PackageFile, error) {
 	field, err := r.getCache()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	potatoIndex := slices.IndexFunc(field.Potatoes, func(p repotypes.PotatoPackage) bool {
@@ -99,7 +145,7 @@ func (r *HarvesterRepo) ZipPackage(packageName string, version string) (string,
 	})
 
 	if potatoIndex == -1 {
-		return "", fmt.Errorf("package not found: %s", packageName)
+		return nil, fmt.Errorf("package not found: %s", packageName)
 	}
 
 	potato := &field.Potatoes[potatoIndex]
@@ -117,27 +163,41 @@ func (r *HarvesterRepo) ZipPackage(packageName string, version string) (string,
 
 	fullurl, err := url.JoinPath(r.baseURL, tmplUrl)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	qq.Println("@fullurl", fullurl)
 
 	resp, err := http.Get(fullurl)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download package: %s", resp.Status)
+	}
+
 	tmpFile, err := os.CreateTemp("", "potato-package-*.zip")
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer tmpFile.Close()
 
 	_, err = io.Copy(tmpFile, resp.Body)
 	if err != nil {
-		return "", err
+		os.Remove(tmpFile.Name())
+		return nil, err
 	}
 
-	return tmpFile.Name(), nil
+	r.cacheMutex.Lock()
+	signedBy, signatureErr := r.signedBy, r.signatureErr
+	r.cacheMutex.Unlock()
+
+	return &repotypes.PackageFile{
+		Path:         tmpFile.Name(),
+		Checksum:     potato.Checksums[version],
+		SignedBy:     signedBy,
+		SignatureErr: signatureErr,
+	}, nil
 }
@@ -16,12 +16,15 @@ var (
 type RepoHub struct {
 	repos   map[string]repotypes.IRepo
 	options []xtypes.RepoOptions
+	logger  *slog.Logger
+	updater *updater
 }
 
 func NewRepoHub(repos []xtypes.RepoOptions, logger *slog.Logger, httpPort int) *RepoHub {
 	return &RepoHub{
 		repos:   make(map[string]repotypes.IRepo),
 		options: repos,
+		logger:  logger,
 	}
 }
 
@@ -44,9 +47,16 @@ func (h *RepoHub) Run(app xtypes.App) error {
 		}
 		h.repos[option.Slug] = repo
 	}
+
+	h.startUpdater(app)
+
 	return nil
 }
 
+func (h *RepoHub) Stop() {
+	h.stopUpdater()
+}
+
 func (h *RepoHub) ListRepos() []xtypes.RepoOptions {
 	return h.options
 }
@@ -72,10 +82,10 @@ func (h *RepoHub) ListPackages(repoSlug string) ([]repotypes.PotatoPackage, erro
 	return repo.ListPackages()
 }
 
-func (h *RepoHub) ZipPackage(repoSlug string, packageName string, version string) (string, error) {
+func (h *RepoHub) ZipPackage(repoSlug string, packageName string, version string) (*repotypes.PackageFile, error) {
 	repo := h.repos[repoSlug]
 	if repo == nil {
-		return "", fmt.Errorf("repo not found: %s", repoSlug)
+		return nil, fmt.Errorf("repo not found: %s", repoSlug)
 	}
 
 	return repo.ZipPackage(packageName, version)
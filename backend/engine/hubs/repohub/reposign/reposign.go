@@ -0,0 +1,238 @@
+package reposign
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+/*
+
+signatures are detached files next to what they sign, a repo serves
+harvest-index.json.sig for its index and a zip can come with <zip>.sig.
+
+both key types sign the sha256 of the file, ed25519 signs the raw digest
+and nostr keys sign a file metadata event carrying the digest in its x tag
+
+*/
+
+const (
+	AlgEd25519 = "ed25519"
+	AlgNostr   = "nostr"
+
+	SignatureSuffix    = ".sig"
+	IndexFile          = "harvest-index.json"
+	IndexSignatureFile = IndexFile + SignatureSuffix
+
+	// NIP-94 file metadata
+	kindFileMetadata = 1063
+)
+
+var (
+	ErrUnsigned         = errors.New("package is not signed")
+	ErrBadSignature     = errors.New("signature does not verify")
+	ErrChecksumMismatch = errors.New("package checksum does not match")
+	ErrUntrustedKey     = errors.New("signed by a key that is not trusted")
+	ErrInvalidKey       = errors.New("invalid publisher key")
+)
+
+type Signature struct {
+	Alg       string `json:"alg"`
+	PublicKey string `json:"public_key"`
+	// Sig is the hex ed25519 signature of the digest
+	Sig string `json:"sig,omitempty"`
+	// Event is the signed nostr event for nostr keys
+	Event *nostr.Event `json:"event,omitempty"`
+}
+
+// KeyId is how keys are stored in the trust store, alg:hex-pubkey
+func (s *Signature) KeyId() string {
+	return s.Alg + ":" + strings.ToLower(s.PublicKey)
+}
+
+func Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func DigestFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func SignEd25519(privkey ed25519.PrivateKey, digest string) (*Signature, error) {
+	raw, err := hex.DecodeString(digest)
+	if err != nil {
+		return nil, err
+	}
+
+	pub := privkey.Public().(ed25519.PublicKey)
+
+	return &Signature{
+		Alg:       AlgEd25519,
+		PublicKey: hex.EncodeToString(pub),
+		Sig:       hex.EncodeToString(ed25519.Sign(privkey, raw)),
+	}, nil
+}
+
+// SignNostr signs with a hex or nsec private key
+func SignNostr(privkey string, digest string) (*Signature, error) {
+	if strings.HasPrefix(privkey, "nsec") {
+		_, decoded, err := nip19.Decode(privkey)
+		if err != nil {
+			return nil, err
+		}
+		privkey = decoded.(string)
+	}
+
+	event := &nostr.Event{
+		Kind:      kindFileMetadata,
+		CreatedAt: nostr.Now(),
+		Tags: nostr.Tags{
+			{"x", digest},
+			{"alt", "potatoverse package signature"},
+		},
+	}
+
+	err := event.Sign(privkey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Signature{
+		Alg:       AlgNostr,
+		PublicKey: event.PubKey,
+		Event:     event,
+	}, nil
+}
+
+// Verify checks the signature covers digest, it says nothing about
+// whether the key is trusted
+func Verify(sig *Signature, digest string) error {
+	if sig == nil {
+		return ErrUnsigned
+	}
+
+	switch sig.Alg {
+	case AlgEd25519:
+		pub, err := hex.DecodeString(sig.PublicKey)
+		if err != nil || len(pub) != ed25519.PublicKeySize {
+			return ErrInvalidKey
+		}
+
+		raw, err := hex.DecodeString(digest)
+		if err != nil {
+			return err
+		}
+
+		sigBytes, err := hex.DecodeString(sig.Sig)
+		if err != nil {
+			return ErrBadSignature
+		}
+
+		if !ed25519.Verify(ed25519.PublicKey(pub), raw, sigBytes) {
+			return ErrBadSignature
+		}
+
+		return nil
+
+	case AlgNostr:
+		event := sig.Event
+		if event == nil || event.Kind != kindFileMetadata || event.PubKey != sig.PublicKey {
+			return ErrBadSignature
+		}
+
+		if event.Tags.FindWithValue("x", digest) == nil {
+			return ErrBadSignature
+		}
+
+		ok, err := event.CheckSignature()
+		if err != nil || !ok {
+			return ErrBadSignature
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("unknown signature algorithm: %s", sig.Alg)
+}
+
+// ParseSignature accepts the json of a .sig file, or the same base64
+// encoded when it has to fit in a header
+func ParseSignature(data []byte) (*Signature, error) {
+	trimmed := strings.TrimSpace(string(data))
+
+	if !strings.HasPrefix(trimmed, "{") {
+		decoded, err := base64.StdEncoding.DecodeString(trimmed)
+		if err != nil {
+			return nil, ErrBadSignature
+		}
+		trimmed = string(decoded)
+	}
+
+	sig := &Signature{}
+	err := json.Unmarshal([]byte(trimmed), sig)
+	if err != nil {
+		return nil, ErrBadSignature
+	}
+
+	return sig, nil
+}
+
+// ParseKeyId normalizes a publisher key given as ed25519:<hex>,
+// nostr:<hex> or npub into the trust store key id
+func ParseKeyId(key string) (string, error) {
+	key = strings.TrimSpace(key)
+
+	if strings.HasPrefix(key, "npub") {
+		_, decoded, err := nip19.Decode(key)
+		if err != nil {
+			return "", ErrInvalidKey
+		}
+		return AlgNostr + ":" + decoded.(string), nil
+	}
+
+	alg, pub, ok := strings.Cut(key, ":")
+	if !ok {
+		return "", ErrInvalidKey
+	}
+
+	pub = strings.ToLower(pub)
+
+	switch alg {
+	case AlgEd25519:
+		raw, err := hex.DecodeString(pub)
+		if err != nil || len(raw) != ed25519.PublicKeySize {
+			return "", ErrInvalidKey
+		}
+	case AlgNostr:
+		if !nostr.IsValidPublicKey(pub) {
+			return "", ErrInvalidKey
+		}
+	default:
+		return "", ErrInvalidKey
+	}
+
+	return alg + ":" + pub, nil
+}
@@ -0,0 +1,83 @@
+package reposign
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+func TestEd25519_SignVerify(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest := Digest([]byte("package zip"))
+
+	sig, err := SignEd25519(priv, digest)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	if err := Verify(sig, digest); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+
+	err = Verify(sig, Digest([]byte("tampered zip")))
+	if !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("expected ErrBadSignature, got %v", err)
+	}
+
+	keyId, err := ParseKeyId("ed25519:" + sig.PublicKey)
+	if err != nil || keyId != sig.KeyId() {
+		t.Fatalf("expected key id %s, got %s (%v)", sig.KeyId(), keyId, err)
+	}
+}
+
+func TestNostr_SignVerify(t *testing.T) {
+	priv := nostr.GeneratePrivateKey()
+	nsec, _ := nip19.EncodePrivateKey(priv)
+
+	digest := Digest([]byte("harvest index"))
+
+	sig, err := SignNostr(nsec, digest)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	// round trip through the header encoding
+	data, _ := json.Marshal(sig)
+	parsed, err := ParseSignature([]byte(base64.StdEncoding.EncodeToString(data)))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	if err := Verify(parsed, digest); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+
+	if err := Verify(parsed, Digest([]byte("other index"))); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("expected ErrBadSignature, got %v", err)
+	}
+
+	npub, _ := nip19.EncodePublicKey(sig.PublicKey)
+	keyId, err := ParseKeyId(npub)
+	if err != nil || keyId != sig.KeyId() {
+		t.Fatalf("expected key id %s, got %s (%v)", sig.KeyId(), keyId, err)
+	}
+}
+
+func TestVerify_Unsigned(t *testing.T) {
+	if err := Verify(nil, Digest(nil)); !errors.Is(err, ErrUnsigned) {
+		t.Fatalf("expected ErrUnsigned, got %v", err)
+	}
+
+	if _, err := ParseKeyId("rsa:abcd"); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("expected ErrInvalidKey, got %v", err)
+	}
+}
@@ -9,14 +9,27 @@ type IRepoHub interface {
 	ListRepos() []xtypes.RepoOptions
 	GetRepo(slug string) (*xtypes.RepoOptions, error)
 	ListPackages(repoSlug string) ([]PotatoPackage, error)
-	ZipPackage(repoSlug string, packageName string, version string) (string, error)
+	ZipPackage(repoSlug string, packageName string, version string) (*PackageFile, error)
 }
 
 type RepoProvider func(app xtypes.App, repoOptions *xtypes.RepoOptions) (IRepo, error)
 
 type IRepo interface {
 	ListPackages() ([]PotatoPackage, error)
-	ZipPackage(packageName string, version string) (string, error)
+	ZipPackage(packageName string, version string) (*PackageFile, error)
+}
+
+// PackageFile is a downloaded package zip with what its repo vouches for
+type PackageFile struct {
+	Path string
+	// Checksum is the sha256 the repo index lists for this version
+	Checksum string
+	// SignedBy is the key id that signed the index, empty when unsigned
+	SignedBy string
+	// SignatureErr is set when the index had a signature that did not verify
+	SignatureErr error
+	// Builtin packages ship inside the binary and need no signature
+	Builtin bool
 }
 
 type PotatoPackage struct {
@@ -32,4 +45,6 @@ type PotatoPackage struct {
 	License       string   `json:"license" yaml:"license"`
 	Version       string   `json:"version" yaml:"version"`
 	Versions      []string `json:"versions" yaml:"versions"`
+	// Checksums maps version to the sha256 of its zip
+	Checksums map[string]string `json:"checksums,omitempty" yaml:"checksums,omitempty"`
 }
@@ -0,0 +1,431 @@
+package repohub
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blue-monads/potatoverse/backend/engine/hubs/repohub/repotypes"
+	"github.com/blue-monads/potatoverse/backend/services/datahub"
+	"github.com/blue-monads/potatoverse/backend/services/datahub/dbmodels"
+	"github.com/blue-monads/potatoverse/backend/xtypes"
+	"golang.org/x/mod/semver"
+)
+
+/*
+
+the update checker walks packages installed from a repo, compares the
+active version against the repo index and stores the newest one in
+PackageInstalls.available_version. admins get a message the first time a
+version shows up. packages marked auto_upgrade are upgraded when a check
+lands inside the maintenance window, the loop wakes up when the window opens
+so a window shorter than the check interval is not skipped.
+
+*/
+
+const DefaultCheckInterval = 6 * time.Hour
+
+// PackageUpgrader is implemented by the controller, auto upgrades go
+// through it so they are verified the same way manual ones are
+type PackageUpgrader interface {
+	AutoUpgradePackage(installedId int64, repoSlug string, version string) error
+}
+
+type userMessenger interface {
+	UserSendMessage(msg *dbmodels.UserMessage) (int64, error)
+}
+
+type PackageUpdate struct {
+	PackageId      int64  `json:"package_id"`
+	Name           string `json:"name"`
+	Slug           string `json:"slug"`
+	RepoSlug       string `json:"repo_slug"`
+	CurrentVersion string `json:"current_version"`
+	LatestVersion  string `json:"latest_version"`
+	AutoUpgrade    bool   `json:"auto_upgrade"`
+}
+
+type updater struct {
+	hub       *RepoHub
+	db        datahub.Database
+	app       xtypes.App
+	interval  time.Duration
+	window    *maintenanceWindow
+	checkLock sync.Mutex
+	stop      chan struct{}
+	stopOnce  sync.Once
+}
+
+func (h *RepoHub) startUpdater(app xtypes.App) {
+	u := &updater{
+		hub:      h,
+		db:       app.Database(),
+		app:      app,
+		interval: DefaultCheckInterval,
+		stop:     make(chan struct{}),
+	}
+
+	h.updater = u
+
+	config, ok := app.Config().(*xtypes.AppOptions)
+	if ok && config.Updates != nil {
+		if config.Updates.Disabled {
+			return
+		}
+
+		if config.Updates.CheckInterval > 0 {
+			u.interval = time.Duration(config.Updates.CheckInterval) * time.Minute
+		}
+
+		if config.Updates.MaintenanceWindow != "" {
+			window, err := parseMaintenanceWindow(config.Updates.MaintenanceWindow)
+			if err != nil {
+				// better to never auto upgrade than to do it at the wrong time
+				h.logger.Error("invalid maintenance window, auto upgrades disabled", "error", err)
+				window = &maintenanceWindow{never: true}
+			}
+			u.window = window
+		}
+	}
+
+	go u.loop()
+}
+
+// CheckUpdates compares installed packages against their repos right away,
+// it does not auto upgrade
+func (h *RepoHub) CheckUpdates() ([]PackageUpdate, error) {
+	if h.updater == nil {
+		return nil, errors.New("update checker not running")
+	}
+
+	return h.updater.check()
+}
+
+func (h *RepoHub) stopUpdater() {
+	if h.updater == nil {
+		return
+	}
+
+	h.updater.stopOnce.Do(func() {
+		close(h.updater.stop)
+	})
+}
+
+func (u *updater) loop() {
+	// give repos and the rest of the app time to come up
+	if !u.sleep(time.Minute) {
+		return
+	}
+
+	for {
+		updates, err := u.check()
+		if err != nil {
+			u.hub.logger.Error("package update check failed", "error", err)
+		}
+
+		if len(updates) != 0 && u.window.contains(time.Now()) {
+			u.autoUpgrade(updates)
+		}
+
+		if !u.sleep(u.nextCheckIn(time.Now())) {
+			return
+		}
+	}
+}
+
+// nextCheckIn is the check interval, cut short when the maintenance window
+// opens before it is over
+func (u *updater) nextCheckIn(now time.Time) time.Duration {
+	wait := u.interval
+
+	if u.window != nil && !u.window.never {
+		untilOpen := u.window.nextStart(now).Sub(now)
+		if untilOpen < wait {
+			wait = untilOpen
+		}
+	}
+
+	return wait
+}
+
+// sleep waits for d, false when the updater was stopped meanwhile
+func (u *updater) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-u.stop:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (u *updater) check() ([]PackageUpdate, error) {
+	u.checkLock.Lock()
+	defer u.checkLock.Unlock()
+
+	pops := u.db.GetPackageInstallOps()
+
+	pkgs, err := pops.ListPackages()
+	if err != nil {
+		return nil, err
+	}
+
+	// one index fetch per repo per check
+	repoIndex := make(map[string][]repotypes.PotatoPackage)
+	updates := make([]PackageUpdate, 0)
+
+	for _, pkg := range pkgs {
+		if pkg.InstallRepo == "" {
+			continue
+		}
+
+		potatoes, ok := repoIndex[pkg.InstallRepo]
+		if !ok {
+			potatoes, err = u.hub.ListPackages(pkg.InstallRepo)
+			if err != nil {
+				u.hub.logger.Warn("could not list repo packages", "repo", pkg.InstallRepo, "error", err)
+			}
+			repoIndex[pkg.InstallRepo] = potatoes
+		}
+
+		// keep what the last good check found while the repo is down
+		if potatoes == nil {
+			continue
+		}
+
+		current := ""
+		pversion, err := pops.GetPackageVersion(pkg.ActiveInstallID)
+		if err == nil {
+			current = pversion.Version
+		}
+
+		latest := ""
+		for i := range potatoes {
+			if potatoes[i].Slug == pkg.Slug {
+				latest = LatestVersion(&potatoes[i])
+				break
+			}
+		}
+
+		available := ""
+		if latest != "" && CompareVersions(latest, current) > 0 {
+			available = latest
+		}
+
+		now := time.Now()
+		err = pops.UpdatePackageData(pkg.ID, map[string]any{
+			"available_version": available,
+			"update_checked_at": &now,
+		})
+		if err != nil {
+			u.hub.logger.Error("could not record package update", "package_id", pkg.ID, "error", err)
+		}
+
+		if available == "" {
+			continue
+		}
+
+		update := PackageUpdate{
+			PackageId:      pkg.ID,
+			Name:           pkg.Name,
+			Slug:           pkg.Slug,
+			RepoSlug:       pkg.InstallRepo,
+			CurrentVersion: current,
+			LatestVersion:  available,
+			AutoUpgrade:    pkg.AutoUpgrade,
+		}
+
+		updates = append(updates, update)
+
+		if available != pkg.AvailableVersion {
+			u.notifyAdmins("Update available: "+pkg.Name,
+				fmt.Sprintf("%s %s is available in repo %s, installed version is %s.", pkg.Name, available, pkg.InstallRepo, current),
+				0,
+			)
+		}
+	}
+
+	return updates, nil
+}
+
+func (u *updater) autoUpgrade(updates []PackageUpdate) {
+	upgrader, ok := u.app.Controller().(PackageUpgrader)
+	if !ok {
+		u.hub.logger.Warn("controller cannot upgrade packages, skipping auto upgrades")
+		return
+	}
+
+	for _, update := range updates {
+		if !update.AutoUpgrade {
+			continue
+		}
+
+		err := upgrader.AutoUpgradePackage(update.PackageId, update.RepoSlug, update.LatestVersion)
+		if err != nil {
+			u.hub.logger.Error("auto upgrade failed", "package_id", update.PackageId, "version", update.LatestVersion, "error", err)
+			u.notifyAdmins("Auto upgrade failed: "+update.Name,
+				fmt.Sprintf("Upgrading %s from %s to %s failed: %s", update.Name, update.CurrentVersion, update.LatestVersion, err.Error()),
+				1,
+			)
+			continue
+		}
+
+		u.hub.logger.Info("package auto upgraded", "package_id", update.PackageId, "version", update.LatestVersion)
+		u.notifyAdmins("Auto upgraded: "+update.Name,
+			fmt.Sprintf("%s was upgraded from %s to %s.", update.Name, update.CurrentVersion, update.LatestVersion),
+			0,
+		)
+	}
+}
+
+func (u *updater) notifyAdmins(title string, contents string, warnLevel int) {
+	admins, err := u.db.GetUserOps().ListUserByCond(map[any]any{"ugroup": "admin"}, 0, 100)
+	if err != nil {
+		u.hub.logger.Error("could not list admins", "error", err)
+		return
+	}
+
+	messenger, _ := u.app.CoreHub().(userMessenger)
+
+	for _, admin := range admins {
+		if admin.Disabled || admin.IsDeleted {
+			continue
+		}
+
+		msg := &dbmodels.UserMessage{
+			Title:     title,
+			Type:      "package_update",
+			Contents:  contents,
+			ToUser:    admin.ID,
+			WarnLevel: warnLevel,
+		}
+
+		// corehub also pushes it to connected sessions
+		if messenger != nil {
+			_, err = messenger.UserSendMessage(msg)
+		} else {
+			_, err = u.db.GetUserOps().AddUserMessage(msg)
+		}
+
+		if err != nil {
+			u.hub.logger.Error("could not notify admin", "user_id", admin.ID, "error", err)
+		}
+	}
+}
+
+// LatestVersion is the highest stable semver a repo lists for the package,
+// prereleases and versions that do not parse are skipped
+func LatestVersion(pkg *repotypes.PotatoPackage) string {
+	latest := ""
+
+	for _, version := range append([]string{pkg.Version}, pkg.Versions...) {
+		canonical := canonicalVersion(version)
+		if !semver.IsValid(canonical) || semver.Prerelease(canonical) != "" {
+			continue
+		}
+
+		if latest == "" || CompareVersions(version, latest) > 0 {
+			latest = version
+		}
+	}
+
+	return latest
+}
+
+// CompareVersions compares two semver strings with or without the v prefix,
+// an invalid version sorts before every valid one
+func CompareVersions(a, b string) int {
+	return semver.Compare(canonicalVersion(a), canonicalVersion(b))
+}
+
+func canonicalVersion(version string) string {
+	version = strings.TrimSpace(version)
+	if version == "" || strings.HasPrefix(version, "v") {
+		return version
+	}
+	return "v" + version
+}
+
+// maintenanceWindow is a daily local time range, it may wrap midnight,
+// nil means any time
+type maintenanceWindow struct {
+	start int // minutes since midnight
+	end   int
+	never bool
+}
+
+func parseMaintenanceWindow(window string) (*maintenanceWindow, error) {
+	from, to, ok := strings.Cut(window, "-")
+	if !ok {
+		return nil, fmt.Errorf("window must look like 02:00-04:00: %s", window)
+	}
+
+	start, err := parseClock(from)
+	if err != nil {
+		return nil, err
+	}
+
+	end, err := parseClock(to)
+	if err != nil {
+		return nil, err
+	}
+
+	// an empty window would never open, leave the option out for any time
+	if start == end {
+		return nil, fmt.Errorf("window start and end are the same: %s", window)
+	}
+
+	return &maintenanceWindow{start: start, end: end}, nil
+}
+
+func parseClock(clock string) (int, error) {
+	hh, mm, ok := strings.Cut(strings.TrimSpace(clock), ":")
+	if !ok {
+		return 0, fmt.Errorf("invalid time: %s", clock)
+	}
+
+	hour, err := strconv.Atoi(hh)
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, fmt.Errorf("invalid hour: %s", clock)
+	}
+
+	minute, err := strconv.Atoi(mm)
+	if err != nil || minute < 0 || minute > 59 {
+		return 0, fmt.Errorf("invalid minute: %s", clock)
+	}
+
+	return hour*60 + minute, nil
+}
+
+func (w *maintenanceWindow) contains(t time.Time) bool {
+	if w == nil {
+		return true
+	}
+
+	if w.never {
+		return false
+	}
+
+	now := t.Hour()*60 + t.Minute()
+
+	if w.start <= w.end {
+		return now >= w.start && now < w.end
+	}
+
+	return now >= w.start || now < w.end
+}
+
+// nextStart is the first time after t the window opens
+func (w *maintenanceWindow) nextStart(t time.Time) time.Time {
+	start := time.Date(t.Year(), t.Month(), t.Day(), w.start/60, w.start%60, 0, 0, t.Location())
+	if !start.After(t) {
+		start = start.AddDate(0, 0, 1)
+	}
+
+	return start
+}
@@ -0,0 +1,92 @@
+package repohub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/blue-monads/potatoverse/backend/engine/hubs/repohub/repotypes"
+)
+
+func TestLatestVersion(t *testing.T) {
+	pkg := &repotypes.PotatoPackage{
+		Version:  "0.9.0",
+		Versions: []string{"0.2.0", "1.10.0", "1.9.3", "2.0.0-beta.1", "not-a-version"},
+	}
+
+	if latest := LatestVersion(pkg); latest != "1.10.0" {
+		t.Fatalf("expected 1.10.0, got %s", latest)
+	}
+
+	if CompareVersions("v1.2.0", "1.10.0") >= 0 {
+		t.Fatal("expected v1.2.0 < 1.10.0")
+	}
+
+	if CompareVersions("1.0.0", "") <= 0 {
+		t.Fatal("expected a valid version to sort after an empty one")
+	}
+}
+
+func TestMaintenanceWindow(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 1, 1, hour, minute, 0, 0, time.Local)
+	}
+
+	window, err := parseMaintenanceWindow("02:00-04:30")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !window.contains(at(3, 15)) || window.contains(at(4, 30)) || window.contains(at(1, 59)) {
+		t.Fatal("02:00-04:30 window boundaries are wrong")
+	}
+
+	// wraps midnight
+	window, err = parseMaintenanceWindow("23:00-01:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !window.contains(at(23, 30)) || !window.contains(at(0, 30)) || window.contains(at(12, 0)) {
+		t.Fatal("23:00-01:00 window boundaries are wrong")
+	}
+
+	var anyTime *maintenanceWindow
+	if !anyTime.contains(at(12, 0)) {
+		t.Fatal("nil window should allow any time")
+	}
+
+	if _, err := parseMaintenanceWindow("25:00-01:00"); err == nil {
+		t.Fatal("expected invalid hour error")
+	}
+
+	if _, err := parseMaintenanceWindow("02:00-02:00"); err == nil {
+		t.Fatal("expected empty window error")
+	}
+}
+
+func TestNextCheckIn(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 1, 1, hour, minute, 0, 0, time.Local)
+	}
+
+	window, err := parseMaintenanceWindow("02:00-02:30")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u := &updater{interval: DefaultCheckInterval, window: window}
+
+	// a 30 minute window must not be slept over
+	if wait := u.nextCheckIn(at(23, 0)); wait != 3*time.Hour {
+		t.Fatalf("expected to wake at the window start, got %s", wait)
+	}
+
+	if wait := u.nextCheckIn(at(2, 10)); wait != DefaultCheckInterval {
+		t.Fatalf("expected the regular interval inside the window, got %s", wait)
+	}
+
+	u.window = nil
+	if wait := u.nextCheckIn(at(23, 0)); wait != DefaultCheckInterval {
+		t.Fatalf("expected the regular interval without a window, got %s", wait)
+	}
+}
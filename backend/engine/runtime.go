@@ -4,7 +4,6 @@ import (
 	"errors"
 	"fmt"
 	"os"
-	"path"
 	"sync"
 
 	"github.com/blue-monads/potatoverse/backend/utils/libx"
@@ -75,9 +74,7 @@ func (r *Runtime) GetExec(spaceid int64) (*RunningExec, error) {
 		return nil, errors.New("package not found")
 	}
 
-	spaceKey := space.NamespaceKey
-
-	wd := path.Join(r.parent.workingFolder, "work_dir", spaceKey, fmt.Sprintf("%d", pkg.ActiveInstallID))
+	wd := r.parent.spaceWorkingFolder(space.NamespaceKey, pkg.ActiveInstallID)
 
 	os.MkdirAll(wd, 0755)
 
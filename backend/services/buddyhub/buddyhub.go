@@ -1,12 +1,14 @@
 package buddyhub
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
 	"path"
+	"sync"
 	"time"
 
 	"github.com/blue-monads/potatoverse/backend/services/buddyhub/funnel"
@@ -30,9 +32,19 @@ type BuddyHub struct {
 	privkey       string
 	port          int
 	staticBuddies map[string]*xtypes.BuddyInfo
+	options       *xtypes.BuddyHubOptions
 
 	embeddedFunnel *funnel.Funnel
 
+	quota       *quotaTracker
+	discovery   *discovery
+	hosts       []string
+	softPercent int
+	stopChan    chan struct{}
+	stopOnce    sync.Once
+
+	backplaneReceiver func(pubkey string, data []byte) error
+
 	hqURl string
 }
 
@@ -61,20 +73,49 @@ func NewBuddyHub(config *xtypes.AppOptions, logger *slog.Logger) *BuddyHub {
 		funnelHQ = envHq
 	}
 
+	baseBuddyDir := path.Join(config.WorkingDir, "buddy")
+
 	bh := &BuddyHub{
 		logger:        logger,
-		baseBuddyDir:  path.Join(config.WorkingDir, "buddy"),
+		baseBuddyDir:  baseBuddyDir,
 		pubkey:        pubkey,
 		privkey:       pk,
 		port:          port,
 		staticBuddies: make(map[string]*xtypes.BuddyInfo),
+		options:       config.BuddyOptions,
 		hqURl:         funnelHQ,
+		softPercent:   DefaultSoftLimitPercent,
+		stopChan:      make(chan struct{}),
 	}
 
+	window := DefaultTrafficWindow
+
 	if config.BuddyOptions != nil {
 		for _, buddyInfo := range config.BuddyOptions.StaticBuddies {
 			bh.staticBuddies[buddyInfo.Pubkey] = buddyInfo
 		}
+
+		if config.BuddyOptions.TrafficWindowHours > 0 {
+			window = time.Duration(config.BuddyOptions.TrafficWindowHours) * time.Hour
+		}
+
+		if config.BuddyOptions.SoftLimitPercent > 0 {
+			bh.softPercent = config.BuddyOptions.SoftLimitPercent
+		}
+	}
+
+	for _, host := range config.Hosts {
+		bh.hosts = append(bh.hosts, host.Name)
+	}
+
+	bh.discovery = newDiscovery(config.BuddyOptions, pubkey, pk)
+
+	bh.quota = newQuotaTracker(path.Join(baseBuddyDir, "usage.json"), window)
+
+	err = bh.quota.load()
+	if err != nil {
+		// counters start over, limits are still enforced from now on
+		logger.Error("Failed to load buddy usage", "err", err)
 	}
 
 	return bh
@@ -112,13 +153,19 @@ func (bh *BuddyHub) Start() error {
 
 	if os.Getenv("POTATO_DISABLE_EMBED_FUNNEL") != "1" {
 		bh.embeddedFunnel = funnel.New()
+		bh.embeddedFunnel.SetTrafficHook(bh.quota.addTraffic)
 	}
 
+	go bh.flushUsageLoop()
+	go bh.announceLoop()
+
 	return nil
 }
 
 func (bh *BuddyHub) Stop() error {
-	return nil
+	bh.stopOnce.Do(func() { close(bh.stopChan) })
+
+	return bh.quota.save()
 }
 
 func (bh *BuddyHub) GetPubkey() string {
@@ -154,12 +201,12 @@ func (bh *BuddyHub) ListBuddies() ([]*xtypes.BuddyInfo, error) {
 
 func (bh *BuddyHub) SendBuddy(buddyPubkey string, req *http.Request) (*http.Response, error) {
 
-	buddyInfo, exists := bh.staticBuddies[buddyPubkey]
-	if !exists {
+	urls, err := bh.ResolveBuddy(req.Context(), buddyPubkey)
+	if err != nil {
 		return nil, fmt.Errorf("buddy not found: %s", buddyPubkey)
 	}
 
-	for _, url := range buddyInfo.URLs {
+	for _, url := range urls {
 		provider := url.Provider
 		if provider != "http" {
 			continue
@@ -185,6 +232,15 @@ func (bh *BuddyHub) HandleFunnelRoute(buddyPubkey string, ctx *gin.Context) {
 		return
 	}
 
+	state, retryAfter := bh.CheckTraffic(buddyPubkey)
+	switch state {
+	case QuotaHard:
+		WriteQuotaExceeded(ctx, ErrTrafficQuotaExceeded, retryAfter)
+		return
+	case QuotaSoft:
+		ctx.Header(QuotaHeader, string(QuotaSoft))
+	}
+
 	bh.embeddedFunnel.HandleRoute(buddyPubkey, ctx)
 
 }
@@ -194,5 +250,33 @@ func (bh *BuddyHub) HandleFunnelRegisterNode(buddyPubkey string, ctx *gin.Contex
 		return
 	}
 
+	limits := bh.GetBuddyLimits(buddyPubkey)
+	if !limits.AllowWebFunnel {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": ErrWebFunnelNotAllowed.Error()})
+		return
+	}
+
+	state, retryAfter := bh.CheckTraffic(buddyPubkey)
+	if state == QuotaHard {
+		WriteQuotaExceeded(ctx, ErrTrafficQuotaExceeded, retryAfter)
+		return
+	}
+
 	bh.embeddedFunnel.HandleServerWebSocket(buddyPubkey, ctx)
 }
+
+var ErrBackplaneNotEnabled = errors.New("sockd backplane is not enabled")
+
+// SetBackplaneReceiver sets where sockd backplane messages pushed by
+// buddies go
+func (bh *BuddyHub) SetBackplaneReceiver(fn func(pubkey string, data []byte) error) {
+	bh.backplaneReceiver = fn
+}
+
+func (bh *BuddyHub) HandleBackplaneMessage(buddyPubkey string, data []byte) error {
+	if bh.backplaneReceiver == nil {
+		return ErrBackplaneNotEnabled
+	}
+
+	return bh.backplaneReceiver(buddyPubkey, data)
+}
@@ -0,0 +1,180 @@
+package buddyhub
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/blue-monads/potatoverse/backend/services/buddyhub/rendezvous"
+	"github.com/blue-monads/potatoverse/backend/xtypes"
+)
+
+const (
+	// resolved urls are reused for a while so every request does not hit
+	// the relays
+	resolveCacheTTL = 5 * time.Minute
+)
+
+type resolvedBuddy struct {
+	urls      []xtypes.BuddyUrl
+	expiresAt time.Time
+}
+
+type discovery struct {
+	providers []rendezvous.Provider
+
+	cache map[string]*resolvedBuddy
+	lock  sync.Mutex
+}
+
+func newDiscovery(opts *xtypes.BuddyHubOptions, pubkey, privkey string) *discovery {
+	d := &discovery{
+		cache: make(map[string]*resolvedBuddy),
+	}
+
+	if opts == nil {
+		return d
+	}
+
+	rurls := make([]xtypes.RendezvousUrl, len(opts.RendezvousUrls))
+	copy(rurls, opts.RendezvousUrls)
+
+	sort.SliceStable(rurls, func(i, j int) bool {
+		return rurls[i].Priority > rurls[j].Priority
+	})
+
+	// all nostr relays go to one provider, so an announcement lands on
+	// every relay and resolving asks all of them
+	relays := make([]string, 0)
+	for _, rurl := range rurls {
+		switch rurl.Provider {
+		case "nostr":
+			relays = append(relays, rurl.URL)
+		default:
+			// udp, libp2p, tor etc are not supported yet
+		}
+	}
+
+	if len(relays) > 0 {
+		d.providers = append(d.providers, rendezvous.NewNostrProvider(rendezvous.NostrOptions{
+			Privkey: privkey,
+			Pubkey:  pubkey,
+			Relays:  relays,
+		}))
+	}
+
+	return d
+}
+
+func (d *discovery) announce(ctx context.Context, urls []xtypes.BuddyUrl) error {
+	errs := make([]error, 0, len(d.providers))
+
+	for _, provider := range d.providers {
+		err := provider.Announce(ctx, urls)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (d *discovery) resolve(ctx context.Context, pubkey string) ([]xtypes.BuddyUrl, error) {
+	d.lock.Lock()
+	cached, ok := d.cache[pubkey]
+	d.lock.Unlock()
+
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.urls, nil
+	}
+
+	for _, provider := range d.providers {
+		urls, err := provider.Resolve(ctx, pubkey)
+		if err != nil {
+			continue
+		}
+
+		d.lock.Lock()
+		d.cache[pubkey] = &resolvedBuddy{
+			urls:      urls,
+			expiresAt: time.Now().Add(resolveCacheTTL),
+		}
+		d.lock.Unlock()
+
+		return urls, nil
+	}
+
+	return nil, rendezvous.ErrNotFound
+}
+
+// selfUrls are the urls this node announces, the HQ tunnel and the
+// configured hosts
+func (bh *BuddyHub) selfUrls() []xtypes.BuddyUrl {
+	urls := make([]xtypes.BuddyUrl, 0, len(bh.hosts)+1)
+
+	if tdomain := bh.GetHQTunnelDomain(); tdomain != "" {
+		port := "80"
+		if hqurl, err := url.Parse(bh.hqURl); err == nil {
+			if hqurl.Port() != "" {
+				port = hqurl.Port()
+			} else if hqurl.Scheme == "https" {
+				port = "443"
+			}
+		}
+
+		urls = append(urls, xtypes.BuddyUrl{
+			Host:      tdomain,
+			Port:      port,
+			IsDefault: true,
+			Provider:  "funnel",
+		})
+	}
+
+	for _, host := range bh.hosts {
+		urls = append(urls, xtypes.BuddyUrl{
+			Host:     host,
+			Port:     strconv.Itoa(bh.port),
+			Priority: 1,
+			Provider: "http",
+		})
+	}
+
+	return urls
+}
+
+func (bh *BuddyHub) announceLoop() {
+	if len(bh.discovery.providers) == 0 {
+		return
+	}
+
+	// re announce well before the last one expires
+	ticker := time.NewTicker(rendezvous.DefaultAnnounceTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		err := bh.discovery.announce(context.Background(), bh.selfUrls())
+		if err != nil {
+			bh.logger.Warn("Failed to announce node on rendezvous", "err", err)
+		}
+
+		select {
+		case <-bh.stopChan:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ResolveBuddy returns where a buddy can be reached, static buddies use
+// their configured urls and others are looked up on the rendezvous
+func (bh *BuddyHub) ResolveBuddy(ctx context.Context, buddyPubkey string) ([]xtypes.BuddyUrl, error) {
+	if buddyInfo, ok := bh.staticBuddies[buddyPubkey]; ok && len(buddyInfo.URLs) > 0 {
+		return buddyInfo.URLs, nil
+	}
+
+	return bh.discovery.resolve(ctx, buddyPubkey)
+}
@@ -12,6 +12,7 @@ import (
 	"net/url"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/blue-monads/potatoverse/backend/services/buddyhub/packetwire"
 	"github.com/blue-monads/potatoverse/backend/utils/qq"
@@ -24,14 +25,15 @@ type FunnelClientOptions struct {
 	RemoteFunnelUrl string
 	NodeId          string
 	PoolSize        int
+
+	// per stream receive window and keepalive ping interval, zero uses defaults
+	Window            uint32
+	KeepAliveInterval time.Duration
 }
 
 type FunnelClient struct {
 	opts FunnelClientOptions
 
-	pendingRequests map[string]chan *packetwire.Packet
-	prLock          sync.Mutex
-
 	stopChan chan struct{}
 }
 
@@ -40,47 +42,11 @@ func NewFunnelClient(opts FunnelClientOptions) *FunnelClient {
 		opts.PoolSize = 4
 	}
 	return &FunnelClient{
-		opts:            opts,
-		pendingRequests: make(map[string]chan *packetwire.Packet),
-		prLock:          sync.Mutex{},
-		stopChan:        make(chan struct{}),
+		opts:     opts,
+		stopChan: make(chan struct{}),
 	}
 }
 
-func (c *FunnelClient) writePackets(conn net.Conn, writeChan chan *ServerWrite) {
-
-	errCount := 0
-
-	for {
-
-		sw := <-writeChan
-
-		if sw == nil {
-			break
-		}
-
-		if conn == nil {
-			qq.Println("@FunnelClient/writePackets/1{CONN_NIL}")
-			continue
-		}
-
-		err := packetwire.WritePacketFull(conn, sw.packet, sw.reqId)
-		if err != nil {
-			qq.Println("@FunnelClient/writePackets/1{ERROR}", err)
-			errCount++
-			if errCount > 10 {
-				qq.Println("@FunnelClient/writePackets/2{BREAK}")
-				break
-			}
-			continue
-		}
-
-		errCount = 0
-
-	}
-
-}
-
 func (c *FunnelClient) Start(token string) error {
 	// Parse remote funnel URL
 
@@ -122,7 +88,7 @@ func (c *FunnelClient) Start(token string) error {
 					return
 				default:
 					// Connect to remote funnel via websocket
-					conn, _, _, err := ws.Dial(context.Background(), finalUrl)
+					conn, br, _, err := ws.Dial(context.Background(), finalUrl)
 					if err != nil {
 						qq.Println("@FunnelClient/Start/Error{ID}", id, err)
 						errLock.Lock()
@@ -131,13 +97,9 @@ func (c *FunnelClient) Start(token string) error {
 						return
 					}
 
-					writeChan := make(chan *ServerWrite)
-					go c.writePackets(conn, writeChan)
-
 					// Start handling incoming requests from funnel
-					err = c.handleFunnelConnection(conn, writeChan)
+					err = c.handleFunnelConnection(wrapBuffered(conn, br))
 					conn.Close()
-					close(writeChan)
 
 					if err != nil {
 						qq.Println("@FunnelClient/ConnectionError{ID}", id, err)
@@ -163,102 +125,82 @@ func (c *FunnelClient) Stop() {
 	close(c.stopChan)
 }
 
-func (c *FunnelClient) handleFunnelConnection(conn net.Conn, writeChan chan *ServerWrite) error {
-	return c.handleFunnelConnectionReader(conn, writeChan)
-}
-
-func (c *FunnelClient) handleFunnelConnectionReader(conn io.Reader, writeChan chan *ServerWrite) error {
-	// Read request ID (16 bytes) first, then packet
-	reqIdBuf := make([]byte, 16)
+func (c *FunnelClient) handleFunnelConnection(conn net.Conn) error {
+	session, err := packetwire.NewClientSession(conn, packetwire.SessionOptions{
+		Window:            c.opts.Window,
+		KeepAliveInterval: c.opts.KeepAliveInterval,
+	})
+	if err != nil {
+		return err
+	}
+	defer session.Close()
 
-	for {
-		_, err := io.ReadFull(conn, reqIdBuf)
-		if err != nil {
-			return err
+	go func() {
+		select {
+		case <-c.stopChan:
+			session.Close()
+		case <-session.Done():
 		}
+	}()
 
-		reqId := string(reqIdBuf)
-
-		qq.Println("@FunnelClient/handleFunnelConnection/3{REQ_ID}", reqId)
-
-		// Read header packet
-		headerPacket, err := packetwire.ReadPacket(conn)
+	for {
+		stream, err := session.AcceptStream()
 		if err != nil {
 			return err
 		}
 
-		if headerPacket.PType != packetwire.PTypeSendHeader {
-
-			c.prLock.Lock()
-			pendingRequest := c.pendingRequests[reqId]
-			c.prLock.Unlock()
-
-			if pendingRequest == nil {
-				qq.Println("@FunnelClient/handleFunnelConnection/4{PENDING_REQUEST_NOT_FOUND}")
-				continue
-			}
+		go c.handleStream(stream)
+	}
+}
 
-			pendingRequest <- headerPacket
+func (c *FunnelClient) handleStream(stream *packetwire.Stream) {
+	defer stream.Close()
 
-			if headerPacket.PType == packetwire.PtypeEndBody || headerPacket.PType == packetwire.PtypeEndSocket {
-				c.prLock.Lock()
-				delete(c.pendingRequests, reqId)
-				c.prLock.Unlock()
-			}
+	header, err := stream.ReadHeader()
+	if err != nil {
+		return
+	}
 
-			continue
-		}
+	qq.Println("@FunnelClient/handleStream/1{STREAM_ID}", stream.ID())
 
-		// Parse request
-		reader := bytes.NewBuffer(headerPacket.Data)
-		req, err := http.ReadRequest(bufio.NewReader(reader))
-		if err != nil {
-			// Send error response
-			continue
-		}
+	// Parse request
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(header)))
+	if err != nil {
+		writeErrorResponse(stream, http.StatusBadRequest, "invalid request")
+		return
+	}
 
-		pendingReqChan := make(chan *packetwire.Packet)
-
-		c.prLock.Lock()
-		c.pendingRequests[reqId] = pendingReqChan
-		c.prLock.Unlock()
-
-		// Check if it's a websocket request
-		if req.Header.Get("Upgrade") == "websocket" {
-			qq.Println("@FunnelClient/handleFunnelConnection/4{WEBSOCKET_REQUEST}")
-			// Handle websocket request
-			go c.handleWebSocketRequest(pendingReqChan, reqId, req, writeChan)
-		} else {
-			qq.Println("@FunnelClient/handleFunnelConnection/5{HTTP_REQUEST}")
-			// Handle HTTP request
-			go c.handleHttpRequest(pendingReqChan, reqId, req, writeChan)
-		}
+	// Check if it's a websocket request
+	if req.Header.Get("Upgrade") == "websocket" {
+		qq.Println("@FunnelClient/handleStream/2{WEBSOCKET_REQUEST}")
+		c.handleWebSocketRequest(stream, req)
+	} else {
+		qq.Println("@FunnelClient/handleStream/3{HTTP_REQUEST}")
+		c.handleHttpRequest(stream, req)
 	}
 }
 
-func (c *FunnelClient) handleHttpRequest(pch chan *packetwire.Packet, reqId string, req *http.Request, writeChan chan *ServerWrite) {
-	// Modify request URL to point to local server
+func (c *FunnelClient) handleHttpRequest(stream *packetwire.Stream, req *http.Request) {
+	// Modify request URL to point to local server, Host header keeps the
+	// public host (zz-<space_id>-buddy-<nodeid>...) for sub origin routing
 	host := fmt.Sprintf("localhost:%d", c.opts.LocalHttpPort)
 	req.URL.Host = host
 	req.URL.Scheme = "http"
 	req.RequestURI = ""
-	req.Host = host
-
-	// Set up request body reader if needed
-	if req.ContentLength > 0 {
-
-		defer func() {
-			c.prLock.Lock()
-			delete(c.pendingRequests, reqId)
-			c.prLock.Unlock()
-		}()
+	if req.Host == "" {
+		req.Host = host
+	}
 
-		req.Body = &requestReader{
-			pendingRequest: pch,
-			buffer:         make([]byte, 0, packetwire.FragmentSize),
-		}
+	// body comes from the stream, chunked requests have -1 length
+	if req.ContentLength != 0 {
+		req.Body = io.NopCloser(stream)
+	} else {
+		req.Body = http.NoBody
 	}
 
+	// local request is canceled when funnel resets the stream
+	req = req.WithContext(stream.Context())
+
 	// fix encoding issue
 	req.Header.Del("Accept-Encoding")
 
@@ -266,6 +208,7 @@ func (c *FunnelClient) handleHttpRequest(pch chan *packetwire.Packet, reqId stri
 	resp, err := client.Do(req)
 	if err != nil {
 		qq.Println("@FunnelClient/handleHttpRequest/2{ERROR}", err)
+		writeErrorResponse(stream, http.StatusBadGateway, "local server error")
 		return
 	}
 	defer resp.Body.Close()
@@ -276,169 +219,39 @@ func (c *FunnelClient) handleHttpRequest(pch chan *packetwire.Packet, reqId stri
 		return
 	}
 
-	writeChan <- &ServerWrite{
-		packet: &packetwire.Packet{
-			PType:  packetwire.PTypeSendHeader,
-			Offset: 0,
-			Total:  int32(resp.ContentLength),
-			Data:   out,
-		},
-		reqId: reqId,
+	err = stream.WriteHeader(out)
+	if err != nil {
+		return
 	}
 
-	if resp.ContentLength == 0 {
-
-		qq.Println("@handleHttpRequest/case_zero_length")
-
-		writeChan <- &ServerWrite{
-			packet: &packetwire.Packet{
-				PType:  packetwire.PtypeEndBody,
-				Offset: 0,
-				Total:  0,
-				Data:   []byte{},
-			},
-			reqId: reqId,
-		}
-
+	// Write blocks while funnel is behind, so a slow client only holds
+	// this response back
+	_, err = io.Copy(stream, resp.Body)
+	if err != nil {
+		qq.Println("@FunnelClient/handleHttpRequest/3{ERROR}", err)
 		return
-
 	}
 
-	// Send response body
-	if resp.ContentLength > 0 {
-		qq.Println("@handleHttpRequest/case_positive_length")
-
-		offset := int32(0)
-
-		for {
-
-			fbuf := make([]byte, packetwire.FragmentSize)
-
-			qq.Println("@loop/1")
-
-			n, err := resp.Body.Read(fbuf)
-			if err != nil && err != io.EOF {
-				qq.Println("@loop/2{ERROR}", err)
-				return
-			}
-
-			qq.Println("@loop/3{N}", n)
-
-			if n == 0 {
-				// Send EndBody
-				qq.Println("@loop/4{SEND_END_BODY}")
-				writeChan <- &ServerWrite{
-					packet: &packetwire.Packet{
-						PType:  packetwire.PtypeEndBody,
-						Offset: offset,
-						Total:  int32(resp.ContentLength),
-						Data:   []byte{},
-					},
-					reqId: reqId,
-				}
-
-				qq.Println("@loop/6{BREAK}")
-
-				break
-			}
-
-			qq.Println("@loop/7{SEND_BODY}")
-
-			ptype := packetwire.PtypeSendBody
-			if err == io.EOF {
-				qq.Println("@loop/8{SEND_END_BODY}")
-				ptype = packetwire.PtypeEndBody
-			}
-
-			qq.Println("@loop/9{SEND_BODY}")
-
-			writeChan <- &ServerWrite{
-				packet: &packetwire.Packet{
-					PType:  ptype,
-					Offset: offset,
-					Total:  int32(resp.ContentLength),
-					Data:   fbuf[:n],
-				},
-				reqId: reqId,
-			}
-
-			qq.Println("@loop/11{OFFSET}", offset)
-
-			offset += int32(n)
-
-			if err == io.EOF {
-				qq.Println("@loop/12{BREAK}")
-				break
-			}
-
-			qq.Println("@loop/13{LOOP}")
-		}
-	} else {
-		qq.Println("@handleHttpRequest/case_negative_length/chunked")
-
-		offset := int32(0)
-
-		for {
-			fbuf := make([]byte, packetwire.FragmentSize)
-			n, err := resp.Body.Read(fbuf)
-			if err != nil && err != io.EOF {
-				return
-			}
-
-			if n == 0 {
-				// Send EndBody
-				writeChan <- &ServerWrite{
-					packet: &packetwire.Packet{
-						PType:  packetwire.PtypeEndBody,
-						Offset: offset,
-						Total:  -1,
-						Data:   []byte{},
-					},
-					reqId: reqId,
-				}
-				break
-			}
-
-			ptype := packetwire.PtypeSendBody
-			if err == io.EOF {
-				ptype = packetwire.PtypeEndBody
-			}
-
-			writeChan <- &ServerWrite{
-				packet: &packetwire.Packet{
-					PType:  ptype,
-					Offset: offset,
-					Total:  -1,
-					Data:   fbuf[:n],
-				},
-				reqId: reqId,
-			}
-
-			offset += int32(n)
-
-			if err == io.EOF {
-				break
-			}
-		}
-	}
+	stream.CloseWrite()
 }
 
-func (c *FunnelClient) handleWebSocketRequest(pch chan *packetwire.Packet, reqId string, req *http.Request, writeChan chan *ServerWrite) {
-
-	defer func() {
-		c.prLock.Lock()
-		delete(c.pendingRequests, reqId)
-		c.prLock.Unlock()
-	}()
+func (c *FunnelClient) handleWebSocketRequest(stream *packetwire.Stream, req *http.Request) {
 
 	qq.Println("@handleWebSocketRequest/1")
 
-	// Parse local websocket URL
-	port := strconv.Itoa(c.opts.LocalHttpPort)
+	// Parse local websocket URL, it carries the public host while the
+	// dialer below always connects to the local server
+	localAddr := net.JoinHostPort("localhost", strconv.Itoa(c.opts.LocalHttpPort))
+
+	wsHost := req.Host
+	if wsHost == "" {
+		wsHost = localAddr
+	}
 
-	lurl, err := url.Parse(fmt.Sprintf("ws://localhost:%s%s", port, req.URL.Path))
+	lurl, err := url.Parse(fmt.Sprintf("ws://%s%s", wsHost, req.URL.Path))
 	if err != nil {
 		qq.Println("@handleWebSocketRequest/2{ERROR}", err)
+		writeErrorResponse(stream, http.StatusBadRequest, "invalid websocket url")
 		return
 	}
 
@@ -449,158 +262,98 @@ func (c *FunnelClient) handleWebSocketRequest(pch chan *packetwire.Packet, reqId
 	qq.Println("@final_url", wsUrl)
 
 	// Connect to local websocket server using gobwas/ws
-	localWS, _, _, err := ws.Dial(context.TODO(), wsUrl)
+	dialer := ws.Dialer{
+		NetDial: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, localAddr)
+		},
+	}
+
+	localWS, _, _, err := dialer.Dial(stream.Context(), wsUrl)
 	if err != nil {
-		qq.Println("@handleWebSocketRequest/2")
-		// Could not connect to local websocket
+		qq.Println("@handleWebSocketRequest/2", err)
+		writeErrorResponse(stream, http.StatusBadGateway, "local websocket error")
 		return
 	}
 	defer localWS.Close()
 
+	// tell funnel to upgrade its side
+	err = stream.WriteHeader([]byte("HTTP/1.1 101 Switching Protocols\r\n\r\n"))
+	if err != nil {
+		return
+	}
+
 	qq.Println("@handleWebSocketRequest/3")
 
-	// After sending the header packet, websocket communication uses packets with request ID
 	// Forward from local WS to funnel
 	go func() {
-		for {
-			qq.Println("@handleWebSocketRequest/4{READ_LOCAL_WS}")
+		defer stream.CloseWrite()
 
+		for {
 			msg, op, err := wsutil.ReadServerData(localWS)
 			if err != nil {
-				if err == io.EOF {
-					qq.Println("@handleWebSocketRequest/4{LOCAL_WS_EOF}", err.Error())
-					break
-				}
 				qq.Println("@handleWebSocketRequest/4{READ_ERROR}", err.Error())
 				return
 			}
 
-			msgStr := ""
-			if len(msg) > 10 {
-				msgStr = string(msg[:10])
-			} else {
-				msgStr = string(msg)
-			}
-
 			// If we received an empty text/binary frame, skip sending a packet.
 			if len(msg) == 0 && (op == ws.OpText || op == ws.OpBinary) {
 				continue
 			}
 
-			qq.Println("@msgstr", msgStr)
-			qq.Println("@op", op)
-
-			ptype := packetwire.PtypeWebSocketBinData
-
+			kind := packetwire.MessageBinary
 			if op == ws.OpText {
-				ptype = packetwire.PtypeWebSocketTextData
+				kind = packetwire.MessageText
 			} else if op == ws.OpClose {
-				break
+				return
 			} else if op == ws.OpPing {
-				ptype = packetwire.PtypeWebSocketPing
+				kind = packetwire.MessagePing
 			} else if op == ws.OpPong {
-				ptype = packetwire.PtypeWebSocketPong
-			} else if op == ws.OpBinary {
-				ptype = packetwire.PtypeWebSocketBinData
+				kind = packetwire.MessagePong
 			}
 
-			// Write WebSocket data as packet
-			writeChan <- &ServerWrite{
-				packet: &packetwire.Packet{
-					PType:  ptype,
-					Offset: 0,
-					Total:  int32(len(msg)),
-					Data:   msg,
-				},
-				reqId: reqId,
+			// blocks while the funnel side client is slow
+			err = stream.WriteMessage(kind, msg)
+			if err != nil {
+				qq.Println("@handleWebSocketRequest/5{WRITE_ERROR}", err.Error())
+				return
 			}
 		}
 	}()
 
 	// Forward from funnel to local WS
 	for {
-		packet := <-pch
-		if packet == nil {
+		kind, msg, err := stream.ReadMessage()
+		if err != nil {
 			break
 		}
 
-		if packet.PType == packetwire.PtypeWebSocketTextData {
-			qq.Println("@routeWS/12/loop/write/text")
-			err = wsutil.WriteClientText(localWS, packet.Data)
-			if err != nil {
-				qq.Println("@routeWS/13/loop/write/break", err)
-				break
-			}
-		} else if packet.PType == packetwire.PtypeWebSocketBinData {
-			qq.Println("@routeWS/12/loop/write/binary")
-			err = wsutil.WriteClientBinary(localWS, packet.Data)
-			if err != nil {
-				qq.Println("@routeWS/13/loop/write/break", err)
-				break
-			}
-		} else if packet.PType == packetwire.PtypeWebSocketPing {
-			qq.Println("@routeWS/12/loop/write/ping")
-			err = wsutil.WriteClientMessage(localWS, ws.OpPing, packet.Data)
-			if err != nil {
-				qq.Println("@routeWS/13/loop/write/break", err)
-				break
-			}
-		} else if packet.PType == packetwire.PtypeWebSocketPong {
-			qq.Println("@routeWS/12/loop/write/pong")
-			err = wsutil.WriteClientMessage(localWS, ws.OpPong, packet.Data)
-			if err != nil {
-				qq.Println("@routeWS/13/loop/write/break", err)
-				break
-			}
+		switch kind {
+		case packetwire.MessageText:
+			err = wsutil.WriteClientText(localWS, msg)
+		case packetwire.MessageBinary:
+			err = wsutil.WriteClientBinary(localWS, msg)
+		case packetwire.MessagePing:
+			err = wsutil.WriteClientMessage(localWS, ws.OpPing, msg)
+		case packetwire.MessagePong:
+			err = wsutil.WriteClientMessage(localWS, ws.OpPong, msg)
 		}
 
-		qq.Println("@routeWS/13/loop/write/end")
-
-	}
-}
-
-// requestReader reads request body from packets
-type requestReader struct {
-	pendingRequest chan *packetwire.Packet
-	closed         bool
-	buffer         []byte
-}
-
-func (r *requestReader) Read(p []byte) (int, error) {
-	if r.closed {
-		if len(r.buffer) != 0 {
-			n := copy(p, r.buffer)
-			r.buffer = r.buffer[n:]
-
-			return n, nil
+		if err != nil {
+			qq.Println("@handleWebSocketRequest/6{WRITE_ERROR}", err)
+			break
 		}
-
-		return 0, io.EOF
-	}
-
-	// Check if we've already read all the data
-	packet, ok := <-r.pendingRequest
-	if !ok {
-
-		r.closed = true
-
-		return 0, io.EOF
 	}
+}
 
-	n := copy(p, packet.Data)
-
-	if n < len(packet.Data) {
-		r.buffer = packet.Data[n:]
-	}
+func writeErrorResponse(stream *packetwire.Stream, status int, msg string) {
+	header := fmt.Sprintf("HTTP/1.1 %d %s\r\nContent-Type: text/plain\r\nContent-Length: %d\r\n\r\n", status, http.StatusText(status), len(msg))
 
-	if packet.PType == packetwire.PtypeEndBody {
-		r.closed = true
+	err := stream.WriteHeader([]byte(header))
+	if err != nil {
+		return
 	}
 
-	return n, nil
-}
-
-func (r *requestReader) Close() error {
-	r.closed = true
-	return nil
+	stream.Write([]byte(msg))
+	stream.CloseWrite()
 }
@@ -1,6 +1,7 @@
 package funnel
 
 import (
+	"bufio"
 	"net"
 	"sync"
 
@@ -11,11 +12,11 @@ import (
 
 // Funnel is a service that routes all http requests to a node(server) which are connected
 // to the service through websocket becase the service is not accessible from the internet (behind NAT)
+// every routed request is a stream of a multiplexed session (see packetwire)
 
 type ServerHandle struct {
-	conn      net.Conn
-	writeChan chan *ServerWrite
-	nodeId    string
+	session *packetwire.Session
+	nodeId  string
 }
 
 type ServerPool struct {
@@ -24,33 +25,38 @@ type ServerPool struct {
 	index   int // for round-robin
 }
 
-type ServerWrite struct {
-	packet *packetwire.Packet
-	reqId  string
-}
-
 type Funnel struct {
 	serverPools map[string]*ServerPool
 	scLock      sync.RWMutex
-	pendingReq     map[string]chan *packetwire.Packet
-	pendingReqLock sync.Mutex
 
-	reqConnMap map[string]*ServerHandle
-	rcLock     sync.Mutex
+	sessionOpts packetwire.SessionOptions
+
+	onTraffic TrafficFunc
 }
 
+// TrafficFunc is called with bytes routed to a node (in) and bytes the
+// node sent back (out), it is called as data flows so it has to be cheap
+type TrafficFunc func(nodeId string, in, out int64)
+
 // New creates a new Funnel instance
 func New() *Funnel {
 	return &Funnel{
-		serverPools:    make(map[string]*ServerPool),
-		scLock:         sync.RWMutex{},
-		pendingReq:     make(map[string]chan *packetwire.Packet),
-		pendingReqLock: sync.Mutex{},
-		reqConnMap:     make(map[string]*ServerHandle),
-		rcLock:         sync.Mutex{},
+		serverPools: make(map[string]*ServerPool),
+		scLock:      sync.RWMutex{},
 	}
 }
 
+func (f *Funnel) SetTrafficHook(fn TrafficFunc) {
+	f.onTraffic = fn
+}
+
+func (f *Funnel) countTraffic(nodeId string, in, out int) {
+	if f.onTraffic == nil || (in == 0 && out == 0) {
+		return
+	}
+	f.onTraffic(nodeId, int64(in), int64(out))
+}
+
 func (f *Funnel) HandleServerWebSocket(nodeId string, c *gin.Context) {
 	qq.Println("@Funnel/HandleServerWebSocket/1{NODE_ID}", nodeId)
 
@@ -66,3 +72,20 @@ func (f *Funnel) HandleRoute(nodeId string, c *gin.Context) {
 
 	f.routeHttp(nodeId, c)
 }
+
+// bufferedConn keeps bytes the websocket handshake already read ahead
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (b *bufferedConn) Read(p []byte) (int, error) {
+	return b.reader.Read(p)
+}
+
+func wrapBuffered(conn net.Conn, reader *bufio.Reader) net.Conn {
+	if reader == nil || reader.Buffered() == 0 {
+		return conn
+	}
+	return &bufferedConn{Conn: conn, reader: reader}
+}
@@ -54,6 +54,13 @@ func setupLocalServer(t *testing.T) (*httptest.Server, int) {
 		w.Write(body)
 	})
 
+	// Host echo endpoint
+	mux.HandleFunc("/host", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(r.Host + "|" + r.Header.Get("X-Forwarded-Host")))
+	})
+
 	// WebSocket echo endpoint
 	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
 		conn, _, _, err := ws.UpgradeHTTP(r, w)
@@ -269,6 +276,47 @@ func TestFunnel_HTTP_PostRequest(t *testing.T) {
 	}
 }
 
+func TestFunnel_HTTP_PreservesHost(t *testing.T) {
+	localServer, localPort := setupLocalServer(t)
+	defer localServer.Close()
+
+	_, funnelServer, fport := setupFunnelServer(t)
+	defer funnelServer.Close()
+
+	client := NewFunnelClient(FunnelClientOptions{
+		LocalHttpPort:   localPort,
+		RemoteFunnelUrl: buildFunnelUrl("test-server", fport),
+		NodeId:          "test-server",
+	})
+	defer client.Stop()
+
+	go client.Start("")
+
+	time.Sleep(2 * time.Second)
+
+	clientHTTP := &http.Client{
+		Timeout: 5 * time.Second,
+	}
+
+	resp, err := clientHTTP.Get(buildFunnelBaseUrl("test-server", fport) + "/host")
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+
+	// sub origin routing on the node depends on the public host
+	host := "test-server.localhost:" + fport
+	expected := host + "|" + host
+	if string(body) != expected {
+		t.Fatalf("Expected %s, got %s", expected, string(body))
+	}
+}
+
 func TestFunnel_WebSocket(t *testing.T) {
 	t.Log("@TestFunnel_WebSocket/1")
 	// Setup local server
@@ -3,30 +3,20 @@ package funnel
 import (
 	"bufio"
 	"bytes"
-	"errors"
+	"context"
 	"io"
-	"log"
 	"maps"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"strconv"
 
 	"github.com/blue-monads/potatoverse/backend/services/buddyhub/packetwire"
 	"github.com/gin-gonic/gin"
-	"github.com/k0kubun/pp"
 )
 
-func DebugLog(a ...interface{}) (n int, err error) {
-
-	return 0, nil
-}
-
 // Route routes an HTTP request to the specified server and writes the response back to gin.Context
 func (f *Funnel) routeHttp(nodeId string, c *gin.Context) {
-	DebugLog("@routeHttp/1", nodeId)
-	// Generate request ID
-	reqId := packetwire.GetRequestId()
-
 	// Get server connection
 	serverConn := f.getServerConn(nodeId)
 	if serverConn == nil {
@@ -35,195 +25,120 @@ func (f *Funnel) routeHttp(nodeId string, c *gin.Context) {
 		return
 	}
 
-	f.rcLock.Lock()
-	f.reqConnMap[reqId] = serverConn
-	f.rcLock.Unlock()
-
-	defer func() {
-		f.rcLock.Lock()
-		delete(f.reqConnMap, reqId)
-		f.rcLock.Unlock()
-	}()
-
-	DebugLog("@routeHttp/2.1")
-
-	pendingReqChan := make(chan *packetwire.Packet)
-	f.pendingReqLock.Lock()
-	f.pendingReq[reqId] = pendingReqChan
-	f.pendingReqLock.Unlock()
-
-	defer func() {
-		DebugLog("@cleanup/1{REQ_ID}", reqId)
-		f.pendingReqLock.Lock()
-		delete(f.pendingReq, reqId)
-		f.pendingReqLock.Unlock()
-	}()
+	stream, err := serverConn.session.OpenStream()
+	if err != nil {
+		c.String(http.StatusBadGateway, "server not connected")
+		c.Abort()
+		return
+	}
 
-	DebugLog("@routeHttp/3")
+	// the node cancels its local request when the client goes away
+	stopCancel := context.AfterFunc(c.Request.Context(), func() {
+		stream.Close()
+	})
+	defer stopCancel()
 
-	// Dump request
+	// Dump request, Host stays the original so the node can resolve
+	// sub origin spaces
 	req := c.Request
+	setForwardedHeaders(req)
 	out, err := httputil.DumpRequest(req, false)
 	if err != nil {
+		stream.Close()
 		c.Error(err)
 		return
 	}
 
-	DebugLog("@routeHttp/4")
-
 	// Write request header packet
-
-	serverConn.writeChan <- &ServerWrite{
-		packet: &packetwire.Packet{
-			PType:  packetwire.PTypeSendHeader,
-			Offset: 0,
-			Total:  int32(req.ContentLength),
-			Data:   out,
-		},
-		reqId: reqId,
+	err = stream.WriteHeader(out)
+	if err != nil {
+		stream.Close()
+		c.String(http.StatusBadGateway, "server not connected")
+		return
 	}
 
-	DebugLog("@routeHttp/6")
+	f.countTraffic(nodeId, len(out), 0)
 
-	if req.ContentLength > 0 {
-
-		DebugLog("@routeHttp/7")
-
-		offset := int32(0)
-
-		for {
-			fbuf := make([]byte, packetwire.FragmentSize)
-
-			DebugLog("@routeHttp/8")
-
-			last := false
-			n, err := req.Body.Read(fbuf)
+	// Body is streamed while waiting for the response, node may answer
+	// early (like 413) without reading all of it
+	bodyDone := make(chan struct{})
+	go func() {
+		defer close(bodyDone)
+		if req.Body != nil && req.ContentLength != 0 {
+			n, err := io.Copy(stream, req.Body)
+			f.countTraffic(nodeId, int(n), 0)
 			if err != nil {
-				if err == io.EOF {
-					log.Println("EOF")
-					last = true
-				} else {
-					log.Println("@err/Read", err.Error())
-					panic(err)
-				}
-			}
-
-			if n == 0 && last {
-				// Send EndBody packet for EOF with no data
-				serverConn.writeChan <- &ServerWrite{
-					packet: &packetwire.Packet{
-						PType:  packetwire.PtypeEndBody,
-						Offset: int32(offset),
-						Total:  int32(req.ContentLength),
-						Data:   []byte{},
-					},
-					reqId: reqId,
-				}
-				break
+				return
 			}
-
-			if n == 0 {
-				// No data read, skip this iteration
-				continue
-			}
-
-			ptype := packetwire.PtypeSendBody
-			if last {
-				ptype = packetwire.PtypeEndBody
-			}
-
-			toSend := fbuf[:n]
-
-			serverConn.writeChan <- &ServerWrite{
-				packet: &packetwire.Packet{
-					PType:  ptype,
-					Offset: int32(offset),
-					Total:  int32(req.ContentLength),
-					Data:   toSend,
-				},
-				reqId: reqId,
-			}
-
-			offset += int32(n)
-
-			if offset >= int32(req.ContentLength) {
-				break
-			}
-
-			if last {
-				break
-			}
-
 		}
+		stream.CloseWrite()
+	}()
 
-	}
+	defer func() {
+		stream.Close()
+		<-bodyDone
+	}()
 
-	wpack := <-pendingReqChan
-	if wpack.PType != packetwire.PTypeSendHeader {
-		c.Error(errors.New("invalid packet type"))
+	header, err := stream.ReadHeader()
+	if err != nil {
+		c.String(http.StatusBadGateway, "server did not respond")
 		return
 	}
 
-	reader := bytes.NewReader(wpack.Data)
-	resp, err := http.ReadResponse(bufio.NewReader(reader), c.Request)
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(header)), c.Request)
 	if err != nil {
-		log.Println("@err/ReadResponse", err.Error())
-		panic(err)
+		c.String(http.StatusBadGateway, "invalid response from server")
+		return
 	}
 
-	DebugLog("@routeHttp/parseResponse/1{STATUS}", resp.StatusCode, "CONTENT_LENGTH", resp.ContentLength)
+	f.countTraffic(nodeId, 0, len(header))
 
-	header := c.Writer.Header()
-	maps.Copy(header, resp.Header)
+	writeHeader := c.Writer.Header()
+	maps.Copy(writeHeader, resp.Header)
 
 	// Ensure Content-Length is set correctly if it was in the response
 	// (maps.Copy should have already copied it, but we ensure it's correct)
 	if resp.ContentLength > -1 {
-		header.Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+		writeHeader.Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
 	}
 
-	DebugLog("@routeHttp/parseResponse/2{HEADERS_COPIED}")
-
 	c.Writer.WriteHeader(resp.StatusCode)
 
+	// a slow client only holds back this stream, the node stops sending
+	// once the window is used up
+	buf := make([]byte, packetwire.FrameDataSize)
 	for {
-		wpack := <-pendingReqChan
-		if wpack == nil {
-			break
-		}
-
-		DebugLog("@routeHttp/writeBody/1{PACKET_TYPE}", wpack.PType, "DATA_LEN", len(wpack.Data))
-
-		for {
-			n, err := c.Writer.Write(wpack.Data)
-			if err != nil {
-				pp.Println("@err/Write", err.Error())
-				break
-			}
-			DebugLog("@routeHttp/writeBody/2{WRITTEN}", n, "REMAINING", len(wpack.Data)-n)
-			wpack.Data = wpack.Data[n:]
-			if len(wpack.Data) == 0 {
-				break
+		n, err := stream.Read(buf)
+		if n > 0 {
+			f.countTraffic(nodeId, 0, n)
+			_, werr := c.Writer.Write(buf[:n])
+			if werr != nil {
+				return
 			}
+			c.Writer.Flush()
 		}
 
-		if wpack.PType == packetwire.PtypeEndBody {
-			DebugLog("@routeHttp/writeBody/3{END_BODY}")
-			break
+		if err != nil {
+			return
 		}
 	}
 
 }
 
-func (f *Funnel) dumpConnIds() {
-	f.scLock.RLock()
-	defer f.scLock.RUnlock()
+func setForwardedHeaders(req *http.Request) {
+	req.Header.Set("X-Forwarded-Host", req.Host)
 
-	keys := make([]string, 0, len(f.serverPools))
-	for k := range f.serverPools {
-		keys = append(keys, k)
+	// set from the connection, a client supplied value is not trusted
+	proto := "http"
+	if req.TLS != nil {
+		proto = "https"
 	}
+	req.Header.Set("X-Forwarded-Proto", proto)
 
-	DebugLog("@keys", keys)
-
+	if ip, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		if prior := req.Header.Get("X-Forwarded-For"); prior != "" {
+			ip = prior + ", " + ip
+		}
+		req.Header.Set("X-Forwarded-For", ip)
+	}
 }
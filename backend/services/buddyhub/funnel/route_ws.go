@@ -1,6 +1,8 @@
 package funnel
 
 import (
+	"bufio"
+	"bytes"
 	"io"
 	"net/http"
 	"net/http/httputil"
@@ -18,29 +20,28 @@ func (f *Funnel) getServerConn(nodeId string) *ServerHandle {
 	f.scLock.RUnlock()
 
 	if !exists {
-		qq.Println("@routeWS/1{SERVER_NOT_CONNECTED}")
-		f.dumpConnIds()
+		qq.Println("@routeWS/1{SERVER_NOT_CONNECTED}", nodeId)
 		return nil
 	}
 
 	pool.lock.Lock()
 	defer pool.lock.Unlock()
 
-	if len(pool.handles) == 0 {
-		return nil
-	}
+	for range pool.handles {
+		handle := pool.handles[pool.index%len(pool.handles)]
+		pool.index++
 
-	handle := pool.handles[pool.index%len(pool.handles)]
-	pool.index++
+		if !handle.session.IsClosed() {
+			return handle
+		}
+	}
 
-	return handle
+	return nil
 }
 
 func (f *Funnel) routeWS(nodeId string, c *gin.Context) {
 
 	qq.Println("@routeWS/1", nodeId)
-	// Generate request ID
-	reqId := packetwire.GetRequestId()
 
 	serverConn := f.getServerConn(nodeId)
 	if serverConn == nil {
@@ -49,20 +50,20 @@ func (f *Funnel) routeWS(nodeId string, c *gin.Context) {
 		return
 	}
 
-	f.rcLock.Lock()
-	f.reqConnMap[reqId] = serverConn
-	f.rcLock.Unlock()
+	stream, err := serverConn.session.OpenStream()
+	if err != nil {
+		c.String(http.StatusBadGateway, "server not connected")
+		c.Abort()
+		return
+	}
 
-	defer func() {
-		f.rcLock.Lock()
-		delete(f.reqConnMap, reqId)
-		f.rcLock.Unlock()
-	}()
+	defer stream.Close()
 
-	qq.Println("@routeWS/2")
+	qq.Println("@routeWS/2{STREAM_ID}", stream.ID())
 
 	// Dump request
 	req := c.Request
+	setForwardedHeaders(req)
 	out, err := httputil.DumpRequest(req, false)
 	if err != nil {
 		qq.Println("@routeWS/2{ERROR}", err)
@@ -70,33 +71,34 @@ func (f *Funnel) routeWS(nodeId string, c *gin.Context) {
 		return
 	}
 
-	qq.Println("@routeWS/4")
-
-	pendingReqChan := make(chan *packetwire.Packet)
-	f.pendingReqLock.Lock()
-	f.pendingReq[reqId] = pendingReqChan
-	f.pendingReqLock.Unlock()
+	// Write request header packet
+	err = stream.WriteHeader(out)
+	if err != nil {
+		c.String(http.StatusBadGateway, "server not connected")
+		return
+	}
 
-	qq.Println("@routeWS/5")
+	f.countTraffic(nodeId, len(out), 0)
 
-	defer func() {
-		qq.Println("@cleanup/1{REQ_ID}", reqId)
-		f.pendingReqLock.Lock()
-		delete(f.pendingReq, reqId)
-		f.pendingReqLock.Unlock()
-	}()
+	// node answers 101 once its local websocket is connected
+	header, err := stream.ReadHeader()
+	if err != nil {
+		qq.Println("@routeWS/3{ERROR}", err)
+		c.String(http.StatusBadGateway, "server did not respond")
+		return
+	}
 
-	qq.Println("@routeWS/6")
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(header)), req)
+	if err != nil {
+		c.String(http.StatusBadGateway, "invalid response from server")
+		return
+	}
 
-	// Write request header packet
-	serverConn.writeChan <- &ServerWrite{
-		packet: &packetwire.Packet{
-			PType:  packetwire.PTypeSendHeader,
-			Offset: 0,
-			Total:  int32(len(out)),
-			Data:   out,
-		},
-		reqId: reqId,
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		qq.Println("@routeWS/4{NOT_UPGRADED}", resp.StatusCode)
+		c.Status(resp.StatusCode)
+		io.Copy(c.Writer, stream)
+		return
 	}
 
 	qq.Println("@routeWS/7")
@@ -113,62 +115,40 @@ func (f *Funnel) routeWS(nodeId string, c *gin.Context) {
 
 	defer clientConn.Close()
 
-	qq.Println("@routeWS/9")
-
 	go func() {
-		for {
-
-			qq.Println("@routeWS/10/loop")
+		// ends the read loop below when the node side is gone
+		defer clientConn.Close()
 
-			packet := <-pendingReqChan
-			if packet == nil {
-				qq.Println("@routeWS/11/loop/break")
+		for {
+			kind, msg, err := stream.ReadMessage()
+			if err != nil {
+				qq.Println("@routeWS/11/loop/break", err)
 				break
 			}
 
-			qq.Println("@routeWS/12/loop/write")
-
-			if packet.PType == packetwire.PtypeWebSocketBinData {
-				qq.Println("@routeWS/12/loop/write/bin/data")
-				err = wsutil.WriteServerBinary(clientConn, packet.Data)
-				if err != nil {
-					qq.Println("@routeWS/13/loop/write/break", err)
-					break
-				}
-			} else if packet.PType == packetwire.PtypeWebSocketTextData {
-				qq.Println("@routeWS/12/loop/write/text/data")
-				err = wsutil.WriteServerText(clientConn, packet.Data)
-				if err != nil {
-					qq.Println("@routeWS/13/loop/write/break", err)
-					break
-				}
-			} else if packet.PType == packetwire.PtypeWebSocketPing {
-				qq.Println("@routeWS/12/loop/write/ping")
-				err = wsutil.WriteServerMessage(clientConn, ws.OpPing, packet.Data)
-				if err != nil {
-					qq.Println("@routeWS/13/loop/write/break", err)
-					break
-				}
-			} else if packet.PType == packetwire.PtypeWebSocketPong {
-				qq.Println("@routeWS/12/loop/write/pong")
-				err = wsutil.WriteServerMessage(clientConn, ws.OpPong, packet.Data)
-				if err != nil {
-					qq.Println("@routeWS/13/loop/write/break", err)
-					break
-				}
+			f.countTraffic(nodeId, 0, len(msg))
+
+			switch kind {
+			case packetwire.MessageBinary:
+				err = wsutil.WriteServerBinary(clientConn, msg)
+			case packetwire.MessageText:
+				err = wsutil.WriteServerText(clientConn, msg)
+			case packetwire.MessagePing:
+				err = wsutil.WriteServerMessage(clientConn, ws.OpPing, msg)
+			case packetwire.MessagePong:
+				err = wsutil.WriteServerMessage(clientConn, ws.OpPong, msg)
 			}
 
-			qq.Println("@routeWS/13/loop/write/end")
-
+			if err != nil {
+				qq.Println("@routeWS/13/loop/write/break", err)
+				break
+			}
 		}
 	}()
 
 	qq.Println("@routeWS/14")
 
 	for {
-
-		qq.Println("@routeWS/15/loop")
-
 		msg, op, err := wsutil.ReadClientData(clientConn)
 		if err != nil {
 			if err != io.EOF {
@@ -178,36 +158,26 @@ func (f *Funnel) routeWS(nodeId string, c *gin.Context) {
 			break
 		}
 
-		ptype := packetwire.PtypeWebSocketBinData
+		kind := packetwire.MessageBinary
 		if op == ws.OpText {
-			ptype = packetwire.PtypeWebSocketTextData
+			kind = packetwire.MessageText
 		} else if op == ws.OpClose {
 			break
 		} else if op == ws.OpPing {
-			ptype = packetwire.PtypeWebSocketPing
+			kind = packetwire.MessagePing
 		} else if op == ws.OpPong {
-			ptype = packetwire.PtypeWebSocketPong
-		}
-
-		qq.Println("@routeWS/17/loop/write")
-
-		// Write WebSocket data as packet
-		serverConn.writeChan <- &ServerWrite{
-			packet: &packetwire.Packet{
-				PType:  ptype,
-				Offset: 0,
-				Total:  int32(len(msg)),
-				Data:   msg,
-			},
-			reqId: reqId,
+			kind = packetwire.MessagePong
 		}
 
-		qq.Println("@routeWS/18/loop/write/end")
-
-		// If it's a close message, break
-		if op == ws.OpClose {
-			qq.Println("@routeWS/19/loop/break/close")
+		// blocks while the node is behind, which slows down this client only
+		err = stream.WriteMessage(kind, msg)
+		if err != nil {
+			qq.Println("@routeWS/18/loop/write/break", err)
 			break
 		}
+
+		f.countTraffic(nodeId, len(msg), 0)
 	}
+
+	stream.CloseWrite()
 }
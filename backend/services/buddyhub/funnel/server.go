@@ -1,9 +1,9 @@
 package funnel
 
 import (
-	"io"
 	"net"
 	"net/http"
+
 	"github.com/blue-monads/potatoverse/backend/services/buddyhub/packetwire"
 	"github.com/blue-monads/potatoverse/backend/utils/qq"
 	"github.com/gin-gonic/gin"
@@ -13,7 +13,7 @@ import (
 func (f *Funnel) handleServerWebSocket(nodeId string, c *gin.Context) {
 	qq.Println("@Funnel/handleServerWebSocket/1{SERVER_ID}", nodeId)
 	// Upgrade to websocket
-	conn, _, _, err := ws.UpgradeHTTP(c.Request, c.Writer)
+	conn, rw, _, err := ws.UpgradeHTTP(c.Request, c.Writer)
 	if err != nil {
 		qq.Println("@Funnel/handleServerWebSocket/3{ERROR}", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to upgrade websocket"})
@@ -22,12 +22,24 @@ func (f *Funnel) handleServerWebSocket(nodeId string, c *gin.Context) {
 
 	qq.Println("@Funnel/handleServerWebSocket/2{CONN}")
 
+	if rw != nil {
+		conn = wrapBuffered(conn, rw.Reader)
+	}
+
 	// Register the server connection
 	f.registerServer(nodeId, conn)
 }
 
 func (f *Funnel) registerServer(nodeId string, conn net.Conn) {
 	qq.Println("@Funnel/registerServer/1{SERVER_ID}", nodeId)
+
+	session, err := packetwire.NewServerSession(conn, f.sessionOpts)
+	if err != nil {
+		qq.Println("@Funnel/registerServer/2{HANDSHAKE_ERROR}", nodeId, err)
+		conn.Close()
+		return
+	}
+
 	f.scLock.Lock()
 
 	pool, exists := f.serverPools[nodeId]
@@ -37,104 +49,40 @@ func (f *Funnel) registerServer(nodeId string, conn net.Conn) {
 		}
 		f.serverPools[nodeId] = pool
 	}
-	f.scLock.Unlock()
 
-	swchan := make(chan *ServerWrite)
 	handle := &ServerHandle{
-		conn:      conn,
-		writeChan: swchan,
-		nodeId:    nodeId,
+		session: session,
+		nodeId:  nodeId,
 	}
 
 	pool.lock.Lock()
 	pool.handles = append(pool.handles, handle)
 	pool.lock.Unlock()
 
-	// Start goroutine to handle incoming responses from this server
-	go f.handleServerConnection(handle, true, func() {
+	f.scLock.Unlock()
+
+	// Remove the handle once the session is gone
+	go func() {
+		<-session.Done()
+
+		qq.Println("@Funnel/registerServer/3{SESSION_CLOSED}", nodeId)
+
 		pool.lock.Lock()
-		defer pool.lock.Unlock()
 		for i, h := range pool.handles {
 			if h == handle {
 				pool.handles = append(pool.handles[:i], pool.handles[i+1:]...)
 				break
 			}
 		}
+		pool.lock.Unlock()
 
-		if len(pool.handles) == 0 {
-			f.scLock.Lock()
-			if f.serverPools[nodeId] == pool {
-				delete(f.serverPools, nodeId)
-			}
-			f.scLock.Unlock()
-		}
-	})
-}
-
-// handleServerConnection handles incoming packets from a server connection
-func (f *Funnel) handleServerConnection(handle *ServerHandle, isWS bool, onExit func()) {
-	nodeId := handle.nodeId
-	conn := handle.conn
-	swchan := handle.writeChan
-	qq.Println("@handleServerConnection/1", nodeId)
-	defer func() {
-		conn.Close()
-		close(swchan)
-
-		qq.Println("@handleServerConnection/2", nodeId)
-		if onExit != nil {
-			onExit()
+		// same lock order as registering, pool checked again under both
+		f.scLock.Lock()
+		pool.lock.RLock()
+		if len(pool.handles) == 0 && f.serverPools[nodeId] == pool {
+			delete(f.serverPools, nodeId)
 		}
+		pool.lock.RUnlock()
+		f.scLock.Unlock()
 	}()
-
-	go func() {
-		for {
-			sw := <-swchan
-			if sw == nil {
-				break
-			}
-
-			err := packetwire.WritePacketFull(conn, sw.packet, sw.reqId)
-			if err != nil {
-				qq.Println("@handleServerConnection/5{ERROR}", err)
-				break
-			}
-
-			qq.Println("@write", isWS)
-
-		}
-	}()
-
-	for {
-
-		reqIdBuf := make([]byte, 16)
-		_, err := io.ReadFull(conn, reqIdBuf)
-		if err != nil {
-			qq.Println("@handleServerConnection/3", nodeId, err)
-			break
-		}
-
-		reqId := string(reqIdBuf)
-
-		qq.Println("@handleServerConnection/4{REQ_ID}", reqId, isWS)
-
-		packet, err := packetwire.ReadPacket(conn)
-		if err != nil {
-			qq.Println("@handleServerConnection/3", nodeId, err)
-			break
-		}
-
-		f.pendingReqLock.Lock()
-		pendingReqChan := f.pendingReq[reqId]
-		f.pendingReqLock.Unlock()
-
-		if pendingReqChan == nil {
-			qq.Println("@handleServerConnection/5{PENDING_REQ_NOT_FOUND}", reqId, "PACKET_TYPE", packet.PType)
-			continue
-		}
-
-		qq.Println("@handleServerConnection/6{ROUTING_PACKET}", reqId, "PACKET_TYPE", packet.PType, "DATA_LEN", len(packet.Data))
-		pendingReqChan <- packet
-	}
-
 }
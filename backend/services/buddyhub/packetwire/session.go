@@ -0,0 +1,380 @@
+package packetwire
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrSessionClosed    = errors.New("funnel session closed")
+	ErrKeepAliveTimeout = errors.New("funnel keepalive timeout")
+)
+
+const handshakeTimeout = 10 * time.Second
+
+type SessionOptions struct {
+	// per stream receive window, how many unread bytes the peer may send
+	Window uint32
+	// ping interval and how long the peer may stay silent before the
+	// session is dropped
+	KeepAliveInterval time.Duration
+	KeepAliveTimeout  time.Duration
+	// opened streams waiting for AcceptStream, more are refused
+	AcceptBacklog int
+}
+
+func (o *SessionOptions) setDefaults() {
+	if o.Window < FrameDataSize {
+		o.Window = DefaultWindow
+	}
+	if o.KeepAliveInterval <= 0 {
+		o.KeepAliveInterval = 20 * time.Second
+	}
+	if o.KeepAliveTimeout <= 0 {
+		o.KeepAliveTimeout = 3 * o.KeepAliveInterval
+	}
+	if o.AcceptBacklog <= 0 {
+		o.AcceptBacklog = 256
+	}
+}
+
+// Session multiplexes streams over one connection. Every stream has its own
+// flow control window so a slow reader only stalls its own stream, the
+// connection reader never blocks on a stream.
+type Session struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	opts   SessionOptions
+
+	// receive window of the peer, our initial send window
+	peerWindow uint32
+
+	streams      map[uint32]*Stream
+	sLock        sync.Mutex
+	nextId       uint32
+	lastAccepted uint32
+
+	acceptChan chan *Stream
+
+	// control frames are written before queued data
+	ctrlChan chan *Frame
+	dataChan chan *Frame
+
+	lastRecv atomic.Int64
+
+	closeOnce sync.Once
+	closeErr  error
+	done      chan struct{}
+}
+
+// NewServerSession is used by the side that opens streams (funnel)
+func NewServerSession(conn net.Conn, opts SessionOptions) (*Session, error) {
+	return newSession(conn, opts, 1)
+}
+
+// NewClientSession is used by the side that accepts streams (funnel client)
+func NewClientSession(conn net.Conn, opts SessionOptions) (*Session, error) {
+	return newSession(conn, opts, 2)
+}
+
+func newSession(conn net.Conn, opts SessionOptions, firstId uint32) (*Session, error) {
+	opts.setDefaults()
+
+	s := &Session{
+		conn:       conn,
+		reader:     bufio.NewReaderSize(conn, 64*1024),
+		opts:       opts,
+		streams:    make(map[uint32]*Stream),
+		nextId:     firstId,
+		acceptChan: make(chan *Stream, opts.AcceptBacklog),
+		ctrlChan:   make(chan *Frame, 64),
+		dataChan:   make(chan *Frame, 64),
+		done:       make(chan struct{}),
+	}
+
+	err := s.handshake()
+	if err != nil {
+		return nil, err
+	}
+
+	s.lastRecv.Store(time.Now().UnixNano())
+
+	go s.readLoop()
+	go s.writeLoop()
+	go s.keepAlive()
+
+	return s, nil
+}
+
+// both sides send hello first, so neither waits on the other
+func (s *Session) handshake() error {
+	s.conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer s.conn.SetDeadline(time.Time{})
+
+	err := WriteFrame(s.conn, helloFrame(s.opts.Window))
+	if err != nil {
+		return err
+	}
+
+	frame, err := ReadFrame(s.reader, handshakeFrameLimit)
+	if err != nil {
+		return err
+	}
+
+	window, err := parseHello(frame)
+	if err != nil {
+		return err
+	}
+
+	s.peerWindow = window
+
+	return nil
+}
+
+// OpenStream starts a new stream, the first frame sent on it should be a header
+func (s *Session) OpenStream() (*Stream, error) {
+	s.sLock.Lock()
+	defer s.sLock.Unlock()
+
+	if s.IsClosed() {
+		return nil, ErrSessionClosed
+	}
+
+	id := s.nextId
+	s.nextId += 2
+
+	stream := newStream(s, id)
+	s.streams[id] = stream
+
+	return stream, nil
+}
+
+// AcceptStream waits for a stream opened by the peer
+func (s *Session) AcceptStream() (*Stream, error) {
+	select {
+	case stream := <-s.acceptChan:
+		return stream, nil
+	case <-s.done:
+		return nil, s.closeErr
+	}
+}
+
+func (s *Session) NumStreams() int {
+	s.sLock.Lock()
+	defer s.sLock.Unlock()
+
+	return len(s.streams)
+}
+
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *Session) IsClosed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Session) Close() error {
+	s.closeWithErr(ErrSessionClosed)
+	return nil
+}
+
+func (s *Session) closeWithErr(err error) {
+	s.closeOnce.Do(func() {
+		s.closeErr = err
+		close(s.done)
+		s.conn.Close()
+
+		s.sLock.Lock()
+		streams := s.streams
+		s.streams = make(map[uint32]*Stream)
+		s.sLock.Unlock()
+
+		for _, stream := range streams {
+			stream.cancel(err)
+		}
+	})
+}
+
+func (s *Session) getStream(id uint32) *Stream {
+	s.sLock.Lock()
+	defer s.sLock.Unlock()
+
+	return s.streams[id]
+}
+
+func (s *Session) removeStream(id uint32) {
+	s.sLock.Lock()
+	defer s.sLock.Unlock()
+
+	delete(s.streams, id)
+}
+
+// acceptStream registers a stream opened by the peer, stale ids of already
+// finished streams are ignored
+func (s *Session) acceptStream(id uint32) *Stream {
+	s.sLock.Lock()
+	defer s.sLock.Unlock()
+
+	if id <= s.lastAccepted || id%2 == s.nextId%2 {
+		return nil
+	}
+
+	s.lastAccepted = id
+
+	stream := newStream(s, id)
+	s.streams[id] = stream
+
+	return stream
+}
+
+func (s *Session) readLoop() {
+	for {
+		// oversized frames are a protocol error, the session is dropped
+		frame, err := ReadFrame(s.reader, sessionFrameLimit)
+		if err != nil {
+			s.closeWithErr(err)
+			return
+		}
+
+		s.lastRecv.Store(time.Now().UnixNano())
+
+		switch frame.Type {
+		case FramePing:
+			s.trySendCtrl(&Frame{Type: FramePong, Data: frame.Data})
+			continue
+		case FramePong, FrameHello:
+			continue
+		}
+
+		stream := s.getStream(frame.StreamID)
+
+		if frame.Type == FrameHeader && stream == nil {
+			stream = s.acceptStream(frame.StreamID)
+			if stream == nil {
+				continue
+			}
+
+			stream.pushHeader(frame.Data)
+
+			select {
+			case s.acceptChan <- stream:
+			default:
+				s.removeStream(stream.id)
+				s.trySendCtrl(uint32Frame(FrameReset, stream.id, ResetRefused))
+			}
+			continue
+		}
+
+		// frames of finished streams are dropped
+		if stream == nil {
+			continue
+		}
+
+		switch frame.Type {
+		case FrameHeader:
+			stream.pushHeader(frame.Data)
+		case FrameData:
+			if !stream.pushData(frame.Flags, frame.Data) {
+				stream.resetWith(ResetFlowControl)
+			}
+		case FrameEnd:
+			stream.pushEnd()
+		case FrameReset:
+			s.removeStream(stream.id)
+			stream.cancel(&ResetError{Code: frameUint32(frame)})
+		case FrameWindowUpdate:
+			stream.addSendWindow(frameUint32(frame))
+		}
+	}
+}
+
+func (s *Session) writeLoop() {
+	writer := bufio.NewWriterSize(s.conn, 64*1024)
+
+	for {
+		var frame *Frame
+
+		select {
+		case frame = <-s.ctrlChan:
+		default:
+			select {
+			case frame = <-s.ctrlChan:
+			case frame = <-s.dataChan:
+			case <-s.done:
+				return
+			}
+		}
+
+		// a peer that stops reading counts as dead
+		s.conn.SetWriteDeadline(time.Now().Add(s.opts.KeepAliveTimeout))
+
+		err := WriteFrame(writer, frame)
+		if err == nil && len(s.ctrlChan) == 0 && len(s.dataChan) == 0 {
+			err = writer.Flush()
+		}
+
+		if err != nil {
+			s.closeWithErr(err)
+			return
+		}
+	}
+}
+
+func (s *Session) keepAlive() {
+	ticker := time.NewTicker(s.opts.KeepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			last := time.Unix(0, s.lastRecv.Load())
+			if time.Since(last) > s.opts.KeepAliveTimeout {
+				s.closeWithErr(ErrKeepAliveTimeout)
+				return
+			}
+
+			s.trySendCtrl(&Frame{Type: FramePing})
+		}
+	}
+}
+
+func (s *Session) sendCtrl(frame *Frame) error {
+	select {
+	case s.ctrlChan <- frame:
+		return nil
+	case <-s.done:
+		return s.closeErr
+	}
+}
+
+// trySendCtrl is used by the read loop which must never block
+func (s *Session) trySendCtrl(frame *Frame) {
+	select {
+	case s.ctrlChan <- frame:
+	default:
+	}
+}
+
+// sendData queues frames that must keep their order within a stream
+func (s *Session) sendData(frame *Frame, cancel <-chan struct{}) error {
+	select {
+	case s.dataChan <- frame:
+		return nil
+	case <-s.done:
+		return s.closeErr
+	case <-cancel:
+		return ErrStreamClosed
+	}
+}
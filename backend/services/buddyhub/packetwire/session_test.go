@@ -0,0 +1,273 @@
+package packetwire
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func tcpPair(t *testing.T) (net.Conn, net.Conn) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := ln.Accept()
+		accepted <- conn
+	}()
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+
+	return <-accepted, client
+}
+
+func sessionPair(t *testing.T, opts SessionOptions) (*Session, *Session) {
+	serverConn, clientConn := tcpPair(t)
+
+	type result struct {
+		s   *Session
+		err error
+	}
+
+	serverChan := make(chan result, 1)
+	go func() {
+		s, err := NewServerSession(serverConn, opts)
+		serverChan <- result{s, err}
+	}()
+
+	client, err := NewClientSession(clientConn, opts)
+	if err != nil {
+		t.Fatalf("client session: %v", err)
+	}
+
+	res := <-serverChan
+	if res.err != nil {
+		t.Fatalf("server session: %v", res.err)
+	}
+
+	t.Cleanup(func() {
+		res.s.Close()
+		client.Close()
+	})
+
+	return res.s, client
+}
+
+func TestSession_RequestResponse(t *testing.T) {
+	server, client := sessionPair(t, SessionOptions{})
+
+	body := bytes.Repeat([]byte("potato"), 200*1024)
+
+	go func() {
+		stream, err := client.AcceptStream()
+		if err != nil {
+			return
+		}
+		defer stream.Close()
+
+		header, _ := stream.ReadHeader()
+		data, _ := io.ReadAll(stream)
+
+		stream.WriteHeader(append([]byte("re:"), header...))
+		stream.Write(data)
+		stream.CloseWrite()
+	}()
+
+	stream, err := server.OpenStream()
+	if err != nil {
+		t.Fatalf("open stream: %v", err)
+	}
+	defer stream.Close()
+
+	stream.WriteHeader([]byte("hello"))
+
+	go func() {
+		stream.Write(body)
+		stream.CloseWrite()
+	}()
+
+	header, err := stream.ReadHeader()
+	if err != nil || string(header) != "re:hello" {
+		t.Fatalf("unexpected header %q: %v", header, err)
+	}
+
+	got, err := io.ReadAll(stream)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+
+	if !bytes.Equal(got, body) {
+		t.Fatalf("body mismatch, got %d bytes want %d", len(got), len(body))
+	}
+}
+
+func TestSession_SlowStreamDoesNotBlockOthers(t *testing.T) {
+	server, client := sessionPair(t, SessionOptions{Window: FrameDataSize * 2})
+
+	// slow stream, the reader never reads
+	slow, _ := server.OpenStream()
+	slow.WriteHeader([]byte("slow"))
+
+	slowWritten := make(chan int, 1)
+	go func() {
+		n, _ := slow.Write(make([]byte, 1024*1024))
+		slowWritten <- n
+	}()
+
+	if _, err := client.AcceptStream(); err != nil {
+		t.Fatalf("accept slow: %v", err)
+	}
+
+	// second stream should still work
+	fast, _ := server.OpenStream()
+	fast.WriteHeader([]byte("fast"))
+	fast.WriteMessage(MessageText, []byte("ping"))
+
+	fastRemote, err := client.AcceptStream()
+	if err != nil {
+		t.Fatalf("accept fast: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		kind, msg, err := fastRemote.ReadMessage()
+		if err == nil && (kind != MessageText || string(msg) != "ping") {
+			err = errors.New("unexpected message " + string(msg))
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("fast stream: %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("fast stream blocked by slow stream")
+	}
+
+	// writer of the slow stream is held by the window
+	select {
+	case n := <-slowWritten:
+		t.Fatalf("slow writer should block, wrote %d", n)
+	default:
+	}
+
+	// reset releases it
+	slow.Close()
+
+	select {
+	case <-slowWritten:
+	case <-time.After(3 * time.Second):
+		t.Fatal("slow writer not released by close")
+	}
+}
+
+func TestSession_ResetCancelsPeer(t *testing.T) {
+	server, client := sessionPair(t, SessionOptions{})
+
+	stream, _ := server.OpenStream()
+	stream.WriteHeader([]byte("req"))
+
+	remote, err := client.AcceptStream()
+	if err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+
+	stream.Close()
+
+	select {
+	case <-remote.Context().Done():
+	case <-time.After(3 * time.Second):
+		t.Fatal("remote stream not canceled")
+	}
+
+	var resetErr *ResetError
+	_, err = remote.Read(make([]byte, 10))
+	if !errors.As(err, &resetErr) || resetErr.Code != ResetCancel {
+		t.Fatalf("expected cancel reset, got %v", err)
+	}
+}
+
+func TestSession_VersionMismatch(t *testing.T) {
+	serverConn, clientConn := tcpPair(t)
+	defer clientConn.Close()
+
+	go func() {
+		hello := helloFrame(DefaultWindow)
+		hello.Data[4] = ProtocolVersion + 1
+		WriteFrame(clientConn, hello)
+		io.Copy(io.Discard, clientConn)
+	}()
+
+	_, err := NewServerSession(serverConn, SessionOptions{})
+	if !errors.Is(err, ErrProtocolVersion) {
+		t.Fatalf("expected version error, got %v", err)
+	}
+}
+
+func TestSession_KeepAliveTimeout(t *testing.T) {
+	serverConn, clientConn := tcpPair(t)
+	defer clientConn.Close()
+
+	// peer that says hello and then goes silent
+	go func() {
+		WriteFrame(clientConn, helloFrame(DefaultWindow))
+		io.Copy(io.Discard, clientConn)
+	}()
+
+	session, err := NewServerSession(serverConn, SessionOptions{
+		KeepAliveInterval: 50 * time.Millisecond,
+		KeepAliveTimeout:  200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("session: %v", err)
+	}
+
+	select {
+	case <-session.Done():
+	case <-time.After(3 * time.Second):
+		t.Fatal("session not closed after keepalive timeout")
+	}
+
+	if _, err := session.OpenStream(); !errors.Is(err, ErrSessionClosed) {
+		t.Fatalf("expected closed session, got %v", err)
+	}
+}
+
+func TestSession_OversizedFrameClosesSession(t *testing.T) {
+	serverConn, clientConn := tcpPair(t)
+	defer clientConn.Close()
+
+	go func() {
+		WriteFrame(clientConn, helloFrame(DefaultWindow))
+
+		// our writers never send data frames over FrameDataSize
+		WriteFrame(clientConn, &Frame{Type: FrameData, StreamID: 1, Data: make([]byte, FrameDataSize+1)})
+		io.Copy(io.Discard, clientConn)
+	}()
+
+	session, err := NewServerSession(serverConn, SessionOptions{})
+	if err != nil {
+		t.Fatalf("session: %v", err)
+	}
+
+	select {
+	case <-session.Done():
+	case <-time.After(3 * time.Second):
+		t.Fatal("session not closed after oversized frame")
+	}
+
+	if _, err := session.AcceptStream(); !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("expected frame too large, got %v", err)
+	}
+}
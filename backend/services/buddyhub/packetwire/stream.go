@@ -0,0 +1,454 @@
+package packetwire
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+var ErrStreamClosed = errors.New("funnel stream closed")
+
+type ResetError struct {
+	Code uint32
+}
+
+func (e *ResetError) Error() string {
+	switch e.Code {
+	case ResetCancel:
+		return "funnel stream canceled"
+	case ResetRefused:
+		return "funnel stream refused"
+	case ResetFlowControl:
+		return "funnel stream flow control violation"
+	case ResetProtocol:
+		return "funnel stream protocol error"
+	}
+	return fmt.Sprintf("funnel stream reset: %d", e.Code)
+}
+
+type chunk struct {
+	flags uint8
+	data  []byte
+}
+
+// Stream is one request (http or websocket) inside a session. Data written
+// to it is limited by the window the peer grants back as it reads, so a
+// writer blocks when the other side is slow instead of buffering forever.
+type Stream struct {
+	id   uint32
+	sess *Session
+
+	lock sync.Mutex
+
+	header     []byte
+	headerChan chan struct{}
+
+	chunks   []chunk
+	buffered int
+	// read but not granted back to the peer yet
+	consumed int
+
+	sendWindow int64
+
+	localEnd  bool
+	remoteEnd bool
+	closed    bool
+
+	readSignal  chan struct{}
+	writeSignal chan struct{}
+
+	// canceled on reset, session close or Close
+	ctx       context.Context
+	ctxCancel context.CancelCauseFunc
+}
+
+func newStream(sess *Session, id uint32) *Stream {
+	ctx, cancel := context.WithCancelCause(context.Background())
+
+	return &Stream{
+		id:          id,
+		sess:        sess,
+		headerChan:  make(chan struct{}),
+		sendWindow:  int64(sess.peerWindow),
+		readSignal:  make(chan struct{}, 1),
+		writeSignal: make(chan struct{}, 1),
+		ctx:         ctx,
+		ctxCancel:   cancel,
+	}
+}
+
+func (st *Stream) ID() uint32 {
+	return st.id
+}
+
+// Context is canceled when the stream is reset by the peer or closed
+func (st *Stream) Context() context.Context {
+	return st.ctx
+}
+
+func (st *Stream) WriteHeader(data []byte) error {
+	if err := st.writeErr(); err != nil {
+		return err
+	}
+
+	if len(data) > MaxHeaderSize {
+		return fmt.Errorf("%w: header length %d exceeds maximum %d", ErrFrameTooLarge, len(data), MaxHeaderSize)
+	}
+
+	return st.sess.sendData(&Frame{
+		Type:     FrameHeader,
+		StreamID: st.id,
+		Data:     bytes.Clone(data),
+	}, st.ctx.Done())
+}
+
+// ReadHeader waits for the header frame of the peer
+func (st *Stream) ReadHeader() ([]byte, error) {
+	select {
+	case <-st.headerChan:
+		return st.header, nil
+	case <-st.ctx.Done():
+	}
+
+	// header may have arrived with the reset
+	select {
+	case <-st.headerChan:
+		return st.header, nil
+	default:
+		return nil, context.Cause(st.ctx)
+	}
+}
+
+// Write sends body bytes, message boundaries are not kept
+func (st *Stream) Write(p []byte) (int, error) {
+	return st.writeData(messageFlags(MessageBinary), p, false)
+}
+
+// WriteMessage sends a websocket like message, ReadMessage on the other
+// side returns it whole
+func (st *Stream) WriteMessage(kind MessageKind, p []byte) error {
+	_, err := st.writeData(messageFlags(kind), p, true)
+	return err
+}
+
+func (st *Stream) writeData(flags uint8, p []byte, message bool) (int, error) {
+	written := 0
+
+	for first := true; first || written < len(p); first = false {
+		want := min(len(p)-written, FrameDataSize)
+
+		n, err := st.awaitWindow(want)
+		if err != nil {
+			return written, err
+		}
+
+		frameFlags := flags
+		if message && written+n == len(p) {
+			frameFlags |= FlagFin
+		}
+
+		err = st.sess.sendData(&Frame{
+			Type:     FrameData,
+			Flags:    frameFlags,
+			StreamID: st.id,
+			Data:     bytes.Clone(p[written : written+n]),
+		}, st.ctx.Done())
+		if err != nil {
+			return written, st.causeOr(err)
+		}
+
+		written += n
+	}
+
+	return written, nil
+}
+
+func (st *Stream) awaitWindow(want int) (int, error) {
+	for {
+		st.lock.Lock()
+		err := st.writeErrLocked()
+		if err == nil && (want == 0 || st.sendWindow > 0) {
+			n := int(min(int64(want), st.sendWindow))
+			st.sendWindow -= int64(n)
+			st.lock.Unlock()
+			return n, nil
+		}
+		st.lock.Unlock()
+
+		if err != nil {
+			return 0, err
+		}
+
+		select {
+		case <-st.writeSignal:
+		case <-st.ctx.Done():
+		}
+	}
+}
+
+// CloseWrite tells the peer nothing more will be written, reading still works
+func (st *Stream) CloseWrite() error {
+	st.lock.Lock()
+	err := st.writeErrLocked()
+	if err == nil {
+		st.localEnd = true
+	}
+	done := st.remoteEnd
+	st.lock.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	err = st.sess.sendData(&Frame{Type: FrameEnd, StreamID: st.id}, st.ctx.Done())
+	if err != nil {
+		return st.causeOr(err)
+	}
+
+	if done {
+		st.sess.removeStream(st.id)
+	}
+
+	return nil
+}
+
+// Read reads body bytes, it returns io.EOF after the peer called CloseWrite
+func (st *Stream) Read(p []byte) (int, error) {
+	for {
+		st.lock.Lock()
+
+		if len(st.chunks) > 0 {
+			n := 0
+			for len(st.chunks) > 0 && n < len(p) {
+				c := &st.chunks[0]
+				copied := copy(p[n:], c.data)
+				c.data = c.data[copied:]
+				n += copied
+				if len(c.data) == 0 {
+					st.chunks = st.chunks[1:]
+				}
+			}
+
+			grant := st.consumeLocked(n)
+			st.lock.Unlock()
+
+			st.grantWindow(grant)
+			return n, nil
+		}
+
+		err := st.readErrLocked()
+		st.lock.Unlock()
+
+		if err != nil {
+			return 0, err
+		}
+
+		select {
+		case <-st.readSignal:
+		case <-st.ctx.Done():
+		}
+	}
+}
+
+// ReadMessage reads one message written by WriteMessage
+func (st *Stream) ReadMessage() (MessageKind, []byte, error) {
+	var msg []byte
+
+	for {
+		st.lock.Lock()
+
+		grant := 0
+		for len(st.chunks) > 0 {
+			c := st.chunks[0]
+			st.chunks = st.chunks[1:]
+			grant += st.consumeLocked(len(c.data))
+			msg = append(msg, c.data...)
+
+			if c.flags&FlagFin != 0 {
+				st.lock.Unlock()
+				st.grantWindow(grant)
+				return messageKind(c.flags), msg, nil
+			}
+		}
+
+		err := st.readErrLocked()
+		st.lock.Unlock()
+
+		st.grantWindow(grant)
+
+		if err != nil {
+			if err == io.EOF && len(msg) != 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, nil, err
+		}
+
+		if len(msg) > MaxPacketDataSize {
+			st.Close()
+			return 0, nil, fmt.Errorf("message exceeds maximum %d", MaxPacketDataSize)
+		}
+
+		select {
+		case <-st.readSignal:
+		case <-st.ctx.Done():
+		}
+	}
+}
+
+// Close releases the stream, if either side has not finished the peer gets
+// a cancel reset. Data already written is delivered before the reset.
+func (st *Stream) Close() error {
+	st.lock.Lock()
+	if st.closed {
+		st.lock.Unlock()
+		return nil
+	}
+	st.closed = true
+	reset := st.ctx.Err() == nil && !(st.localEnd && st.remoteEnd)
+	st.lock.Unlock()
+
+	st.sess.removeStream(st.id)
+	st.ctxCancel(ErrStreamClosed)
+
+	if reset {
+		st.sess.sendData(uint32Frame(FrameReset, st.id, ResetCancel), nil)
+	}
+
+	return nil
+}
+
+// called from the session read loop, must not block
+
+func (st *Stream) pushHeader(data []byte) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	if st.header != nil {
+		return
+	}
+
+	st.header = data
+	close(st.headerChan)
+}
+
+func (st *Stream) pushData(flags uint8, data []byte) bool {
+	st.lock.Lock()
+
+	if st.remoteEnd {
+		st.lock.Unlock()
+		return false
+	}
+
+	if st.buffered+len(data) > int(st.sess.opts.Window) {
+		st.lock.Unlock()
+		return false
+	}
+
+	st.chunks = append(st.chunks, chunk{flags: flags, data: data})
+	st.buffered += len(data)
+	st.lock.Unlock()
+
+	notify(st.readSignal)
+	return true
+}
+
+func (st *Stream) pushEnd() {
+	st.lock.Lock()
+	st.remoteEnd = true
+	done := st.localEnd
+	st.lock.Unlock()
+
+	if done {
+		st.sess.removeStream(st.id)
+	}
+
+	notify(st.readSignal)
+}
+
+func (st *Stream) addSendWindow(n uint32) {
+	st.lock.Lock()
+	st.sendWindow += int64(n)
+	st.lock.Unlock()
+
+	notify(st.writeSignal)
+}
+
+func (st *Stream) cancel(err error) {
+	st.ctxCancel(err)
+	notify(st.readSignal)
+	notify(st.writeSignal)
+}
+
+func (st *Stream) resetWith(code uint32) {
+	st.sess.removeStream(st.id)
+	st.sess.trySendCtrl(uint32Frame(FrameReset, st.id, code))
+	st.cancel(&ResetError{Code: code})
+}
+
+// helpers
+
+func (st *Stream) consumeLocked(n int) int {
+	st.buffered -= n
+	st.consumed += n
+
+	// grant in batches, not for every small read
+	if st.consumed < int(st.sess.opts.Window)/2 {
+		return 0
+	}
+
+	grant := st.consumed
+	st.consumed = 0
+	return grant
+}
+
+func (st *Stream) grantWindow(n int) {
+	if n == 0 || st.ctx.Err() != nil {
+		return
+	}
+
+	st.sess.sendCtrl(uint32Frame(FrameWindowUpdate, st.id, uint32(n)))
+}
+
+func (st *Stream) readErrLocked() error {
+	if st.remoteEnd {
+		return io.EOF
+	}
+	if st.ctx.Err() != nil {
+		return context.Cause(st.ctx)
+	}
+	return nil
+}
+
+func (st *Stream) writeErr() error {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	return st.writeErrLocked()
+}
+
+func (st *Stream) writeErrLocked() error {
+	if st.ctx.Err() != nil {
+		return context.Cause(st.ctx)
+	}
+	if st.localEnd {
+		return ErrStreamClosed
+	}
+	return nil
+}
+
+func (st *Stream) causeOr(err error) error {
+	if cause := context.Cause(st.ctx); cause != nil {
+		return cause
+	}
+	return err
+}
+
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
@@ -1,181 +1,218 @@
 package packetwire
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"hash/crc64"
 	"io"
-
-	nanoid "github.com/jaevor/go-nanoid"
 )
 
 var crcTable = crc64.MakeTable(crc64.ISO)
 
-type PacketType = uint8
+// ProtocolVersion is exchanged in the hello frame, a peer speaking another
+// version is disconnected right after the handshake
+const ProtocolVersion = 2
+
+var helloMagic = []byte("PTFN")
+
+type FrameType = uint8
+
+const (
+	// connection level, stream id 0
+	FrameHello FrameType = iota + 1
+	FramePing
+	FramePong
+
+	// stream level
+	FrameHeader
+	FrameData
+	FrameEnd
+	FrameReset
+	FrameWindowUpdate
+)
 
+// data frame flags, a message can span many frames and its last frame has
+// FlagFin. bits 1-2 carry the message kind.
 const (
-	PTypeSendHeader        PacketType = iota
-	PtypeSendBody          PacketType = iota
-	PtypeEndBody           PacketType = iota
-	PtypeReSendBody        PacketType = iota
-	PtypeWebSocketBinData  PacketType = iota
-	PtypeWebSocketTextData PacketType = iota
-	PtypeWebSocketPing     PacketType = iota
-	PtypeWebSocketPong     PacketType = iota
-	PtypeEndSocket         PacketType = iota
+	FlagFin uint8 = 1 << 0
 )
 
+type MessageKind = uint8
 
-type Packet struct {
-	PType  PacketType
-	Offset int32 // current offset
-	Total  int32 // total body size
-	Data   []byte
-}
+const (
+	MessageBinary MessageKind = iota
+	MessageText
+	MessagePing
+	MessagePong
+)
+
+// reset codes
+const (
+	ResetCancel uint32 = iota + 1
+	ResetRefused
+	ResetFlowControl
+	ResetProtocol
+)
 
-const FragmentSize = 1024 * 512
+// FrameDataSize is the largest data a single data frame carries so one
+// stream can't hold the connection for long
+const FrameDataSize = 1024 * 32
+
+// DefaultWindow is the default per stream receive window
+const DefaultWindow = 1024 * 256
+
+// MaxHeaderSize caps header frames, same as net/http DefaultMaxHeaderBytes
+const MaxHeaderSize = 1024 * 1024
+
+// maxControlSize caps connection and stream control frames (hello, ping,
+// pong, end, reset, window update)
+const maxControlSize = 64
 
 // 16MB
 const MaxPacketDataSize = 16 * 1024 * 1024
 
-func WritePacketFull(conn io.Writer, packet *Packet, reqId string) error {
+// type(1) flags(1) stream(4) length(4) checksum(8)
+const frameHeaderSize = 18
 
-	_, err := conn.Write([]byte(reqId))
-	if err != nil {
-		return err
-	}
+var (
+	ErrProtocolVersion = errors.New("unsupported funnel protocol version")
+	ErrFrameTooLarge   = errors.New("funnel frame too large")
+)
 
-	return WritePacket(conn, packet)
+type Frame struct {
+	Type     FrameType
+	Flags    uint8
+	StreamID uint32
+	Data     []byte
 }
 
-// WritePacket writes a packet to an io.Writer
-func WritePacket(conn io.Writer, packet *Packet) error {
-	if len(packet.Data) > MaxPacketDataSize {
-		return fmt.Errorf("packet data length %d exceeds maximum %d", len(packet.Data), MaxPacketDataSize)
-	}
-	// write packet type
-	_, err := conn.Write([]byte{packet.PType})
-	if err != nil {
-		return err
-	}
-
-	// length, offset, total
-	intBytes := make([]byte, 4)
+func messageFlags(kind MessageKind) uint8 {
+	return (kind & 0x3) << 1
+}
 
-	// write length
-	binary.BigEndian.PutUint32(intBytes, uint32(len(packet.Data)))
-	_, err = conn.Write(intBytes)
-	if err != nil {
-		return err
-	}
+func messageKind(flags uint8) MessageKind {
+	return (flags >> 1) & 0x3
+}
 
-	// write offset
-	binary.BigEndian.PutUint32(intBytes, uint32(packet.Offset))
-	_, err = conn.Write(intBytes)
-	if err != nil {
-		return err
+// WriteFrame writes a frame to an io.Writer
+func WriteFrame(conn io.Writer, frame *Frame) error {
+	if len(frame.Data) > MaxPacketDataSize {
+		return fmt.Errorf("frame data length %d exceeds maximum %d", len(frame.Data), MaxPacketDataSize)
 	}
 
-	// write total
-	binary.BigEndian.PutUint32(intBytes, uint32(packet.Total))
-	_, err = conn.Write(intBytes)
-	if err != nil {
-		return err
-	}
+	header := make([]byte, frameHeaderSize)
+	header[0] = frame.Type
+	header[1] = frame.Flags
+	binary.BigEndian.PutUint32(header[2:6], frame.StreamID)
+	binary.BigEndian.PutUint32(header[6:10], uint32(len(frame.Data)))
+	binary.BigEndian.PutUint64(header[10:18], crc64.Checksum(frame.Data, crcTable))
 
-	// write checksum
-	checksumBytes := make([]byte, 8)
-	checksum := crc64.Checksum(packet.Data, crcTable)
-	binary.BigEndian.PutUint64(checksumBytes, checksum)
-	_, err = conn.Write(checksumBytes)
+	_, err := conn.Write(header)
 	if err != nil {
 		return err
 	}
 
 	// write data
 	totalWritten := 0
-	for {
-		written, err := conn.Write(packet.Data[totalWritten:])
+	for totalWritten < len(frame.Data) {
+		written, err := conn.Write(frame.Data[totalWritten:])
 		if err != nil {
 			return err
 		}
 		totalWritten += written
-		if totalWritten >= len(packet.Data) {
-			break
-		}
 	}
 
 	return nil
 }
 
-// ReadPacket reads a packet from an io.Reader
-func ReadPacket(conn io.Reader) (*Packet, error) {
-	packet := &Packet{}
-	intBytes := make([]byte, 4)
-
-	// read packet type
-	_, err := io.ReadFull(conn, intBytes[:1])
+// ReadFrame reads a frame from an io.Reader, maxLength gives the largest
+// data allowed for a frame type and longer frames are refused before their
+// data is allocated
+func ReadFrame(conn io.Reader, maxLength func(FrameType) uint32) (*Frame, error) {
+	header := make([]byte, frameHeaderSize)
+	_, err := io.ReadFull(conn, header)
 	if err != nil {
 		return nil, err
 	}
 
-	ptype := uint8(intBytes[0])
-
-	// read length
-	_, err = io.ReadFull(conn, intBytes)
-	if err != nil {
-		return nil, err
-	}
-	length := binary.BigEndian.Uint32(intBytes)
-	if length > MaxPacketDataSize {
-		return nil, fmt.Errorf("packet length %d exceeds maximum %d", length, MaxPacketDataSize)
+	length := binary.BigEndian.Uint32(header[6:10])
+	if limit := min(maxLength(header[0]), MaxPacketDataSize); length > limit {
+		return nil, fmt.Errorf("%w: type %d length %d exceeds maximum %d", ErrFrameTooLarge, header[0], length, limit)
 	}
 
-	// read offset
-	_, err = io.ReadFull(conn, intBytes)
+	data := make([]byte, length)
+	_, err = io.ReadFull(conn, data)
 	if err != nil {
 		return nil, err
 	}
-	offset := binary.BigEndian.Uint32(intBytes)
 
-	// read total
-	_, err = io.ReadFull(conn, intBytes)
-	if err != nil {
-		return nil, err
+	expectedChecksum := binary.BigEndian.Uint64(header[10:18])
+	actualChecksum := crc64.Checksum(data, crcTable)
+	if actualChecksum != expectedChecksum {
+		return nil, fmt.Errorf("data corruption detected: expected checksum %016x, got %016x", expectedChecksum, actualChecksum)
 	}
-	total := binary.BigEndian.Uint32(intBytes)
 
-	// read checksum
-	checksumBytes := make([]byte, 8)
-	_, err = io.ReadFull(conn, checksumBytes)
-	if err != nil {
-		return nil, err
-	}
-	expectedChecksum := binary.BigEndian.Uint64(checksumBytes)
+	return &Frame{
+		Type:     header[0],
+		Flags:    header[1],
+		StreamID: binary.BigEndian.Uint32(header[2:6]),
+		Data:     data,
+	}, nil
+}
 
-	// read data
-	dataBytes := make([]byte, length)
-	_, err = io.ReadFull(conn, dataBytes)
-	if err != nil {
-		return nil, err
+// sessionFrameLimit is the maxLength of established sessions, data frames
+// never carry more than FrameDataSize
+func sessionFrameLimit(ftype FrameType) uint32 {
+	switch ftype {
+	case FrameData:
+		return FrameDataSize
+	case FrameHeader:
+		return MaxHeaderSize
+	default:
+		return maxControlSize
 	}
+}
 
-	actualChecksum := crc64.Checksum(dataBytes, crcTable)
-	if actualChecksum != expectedChecksum {
-		return nil, fmt.Errorf("data corruption detected: expected checksum %016x, got %016x", expectedChecksum, actualChecksum)
+// handshakeFrameLimit only lets a hello through
+func handshakeFrameLimit(ftype FrameType) uint32 {
+	return maxControlSize
+}
+
+// hello is magic(4) version(1) window(4)
+func helloFrame(window uint32) *Frame {
+	data := make([]byte, 0, 9)
+	data = append(data, helloMagic...)
+	data = append(data, ProtocolVersion)
+	data = binary.BigEndian.AppendUint32(data, window)
+
+	return &Frame{Type: FrameHello, Data: data}
+}
+
+func parseHello(frame *Frame) (uint32, error) {
+	if frame.Type != FrameHello || len(frame.Data) < 9 || !bytes.Equal(frame.Data[:4], helloMagic) {
+		return 0, errors.New("invalid funnel hello")
 	}
 
-	packet.PType = ptype
-	packet.Offset = int32(offset)
-	packet.Total = int32(total)
-	packet.Data = dataBytes
+	if frame.Data[4] != ProtocolVersion {
+		return 0, fmt.Errorf("%w: %d", ErrProtocolVersion, frame.Data[4])
+	}
 
-	return packet, nil
+	return binary.BigEndian.Uint32(frame.Data[5:9]), nil
 }
 
-var idgen, _ = nanoid.Standard(16)
+func uint32Frame(ftype FrameType, streamId uint32, v uint32) *Frame {
+	return &Frame{
+		Type:     ftype,
+		StreamID: streamId,
+		Data:     binary.BigEndian.AppendUint32(nil, v),
+	}
+}
 
-func GetRequestId() string {
-	id := idgen()
-	return string(id)
+func frameUint32(frame *Frame) uint32 {
+	if len(frame.Data) < 4 {
+		return 0
+	}
+	return binary.BigEndian.Uint32(frame.Data)
 }
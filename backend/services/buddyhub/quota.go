@@ -0,0 +1,409 @@
+package buddyhub
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	ErrTrafficQuotaExceeded = errors.New("buddy traffic quota exceeded")
+	ErrStorageQuotaExceeded = errors.New("buddy storage quota exceeded")
+	ErrWebFunnelNotAllowed  = errors.New("web funnel not allowed for buddy")
+	ErrStorageNotAllowed    = errors.New("storage not allowed for buddy")
+)
+
+const (
+	DefaultTrafficWindow    = 30 * 24 * time.Hour
+	DefaultSoftLimitPercent = 80
+
+	// traffic window is kept as this many buckets, the oldest one drops
+	// out as the window rolls
+	trafficBuckets = 30
+
+	usageFlushInterval = time.Minute
+)
+
+type QuotaState string
+
+const (
+	QuotaOK   QuotaState = "ok"
+	QuotaSoft QuotaState = "soft"
+	QuotaHard QuotaState = "hard"
+)
+
+// BuddyLimits are the effective limits of a buddy, zero max means unlimited
+type BuddyLimits struct {
+	Static          bool  `json:"static"`
+	AllowWebFunnel  bool  `json:"allow_web_funnel"`
+	AllowStorage    bool  `json:"allow_storage"`
+	MaxStorage      int64 `json:"max_storage"`
+	MaxTrafficLimit int64 `json:"max_traffic_limit"`
+}
+
+// BuddyUsage is the usage of a buddy as shown to admins, traffic is
+// counted in the current window, in is towards the buddy and out is
+// what the buddy sent back
+type BuddyUsage struct {
+	Pubkey       string      `json:"pubkey"`
+	Name         string      `json:"name"`
+	TrafficIn    int64       `json:"traffic_in"`
+	TrafficOut   int64       `json:"traffic_out"`
+	Traffic      int64       `json:"traffic"`
+	TotalIn      int64       `json:"total_in"`
+	TotalOut     int64       `json:"total_out"`
+	StorageUsed  int64       `json:"storage_used"`
+	TrafficState QuotaState  `json:"traffic_state"`
+	StorageState QuotaState  `json:"storage_state"`
+	WindowStart  time.Time   `json:"window_start"`
+	LastSeen     time.Time   `json:"last_seen"`
+	Limits       BuddyLimits `json:"limits"`
+}
+
+type trafficBucket struct {
+	Start int64 `json:"start"`
+	In    int64 `json:"in"`
+	Out   int64 `json:"out"`
+}
+
+type buddyCounters struct {
+	Buckets     []trafficBucket `json:"buckets"`
+	TotalIn     int64           `json:"total_in"`
+	TotalOut    int64           `json:"total_out"`
+	StorageUsed int64           `json:"storage_used"`
+	LastSeen    int64           `json:"last_seen"`
+
+	// soft limit warning is logged once per crossing
+	softWarned bool
+}
+
+type quotaTracker struct {
+	counters map[string]*buddyCounters
+	mu       sync.Mutex
+	dirty    bool
+
+	// storage bytes held by writes in flight, not persisted
+	reserved map[string]int64
+
+	file       string
+	window     time.Duration
+	bucketSize time.Duration
+}
+
+func newQuotaTracker(file string, window time.Duration) *quotaTracker {
+	if window <= 0 {
+		window = DefaultTrafficWindow
+	}
+
+	bucketSize := window / trafficBuckets
+	if bucketSize < time.Minute {
+		bucketSize = time.Minute
+	}
+
+	return &quotaTracker{
+		counters:   make(map[string]*buddyCounters),
+		reserved:   make(map[string]int64),
+		file:       file,
+		window:     window,
+		bucketSize: bucketSize,
+	}
+}
+
+func (q *quotaTracker) load() error {
+	data, err := os.ReadFile(q.file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	counters := make(map[string]*buddyCounters)
+	err = json.Unmarshal(data, &counters)
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	q.counters = counters
+	q.mu.Unlock()
+
+	return nil
+}
+
+func (q *quotaTracker) save() error {
+	q.mu.Lock()
+	if !q.dirty {
+		q.mu.Unlock()
+		return nil
+	}
+
+	data, err := json.Marshal(q.counters)
+	q.dirty = false
+	q.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(path.Dir(q.file), 0755)
+	if err != nil {
+		return err
+	}
+
+	// rename so a crash never leaves a half written file
+	tmp := q.file + ".tmp"
+	err = os.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, q.file)
+}
+
+// get must be called with the lock held
+func (q *quotaTracker) get(pubkey string) *buddyCounters {
+	c, ok := q.counters[pubkey]
+	if !ok {
+		c = &buddyCounters{}
+		q.counters[pubkey] = c
+	}
+	return c
+}
+
+// prune drops buckets which rolled out of the window, lock must be held
+func (q *quotaTracker) prune(c *buddyCounters, now time.Time) {
+	cutoff := now.Add(-q.window).Unix()
+
+	idx := 0
+	for idx < len(c.Buckets) && c.Buckets[idx].Start+int64(q.bucketSize.Seconds()) <= cutoff {
+		idx++
+	}
+
+	if idx > 0 {
+		c.Buckets = append(c.Buckets[:0], c.Buckets[idx:]...)
+		q.dirty = true
+	}
+}
+
+func (q *quotaTracker) addTraffic(pubkey string, in, out int64) {
+	if in == 0 && out == 0 {
+		return
+	}
+
+	now := time.Now()
+	start := now.Truncate(q.bucketSize).Unix()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	c := q.get(pubkey)
+	q.prune(c, now)
+
+	if n := len(c.Buckets); n == 0 || c.Buckets[n-1].Start != start {
+		c.Buckets = append(c.Buckets, trafficBucket{Start: start})
+	}
+
+	last := &c.Buckets[len(c.Buckets)-1]
+	last.In += in
+	last.Out += out
+
+	c.TotalIn += in
+	c.TotalOut += out
+	c.LastSeen = now.Unix()
+	q.dirty = true
+}
+
+// traffic returns window totals and how long until the oldest bucket
+// rolls out of the window
+func (q *quotaTracker) traffic(pubkey string) (in, out int64, rollsIn time.Duration) {
+	now := time.Now()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	c, ok := q.counters[pubkey]
+	if !ok {
+		return 0, 0, 0
+	}
+
+	q.prune(c, now)
+
+	for _, b := range c.Buckets {
+		in += b.In
+		out += b.Out
+	}
+
+	if len(c.Buckets) > 0 {
+		oldestEnd := time.Unix(c.Buckets[0].Start, 0).Add(q.bucketSize).Add(q.window)
+		rollsIn = oldestEnd.Sub(now)
+	}
+
+	return in, out, rollsIn
+}
+
+func (q *quotaTracker) setStorage(pubkey string, used int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	c := q.get(pubkey)
+	if c.StorageUsed != used {
+		c.StorageUsed = used
+		q.dirty = true
+	}
+}
+
+func (q *quotaTracker) storage(pubkey string) int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	c, ok := q.counters[pubkey]
+	if !ok {
+		return 0
+	}
+	return c.StorageUsed
+}
+
+// reserve holds size bytes of storage if they fit under max together with
+// what is used and already reserved
+func (q *quotaTracker) reserve(pubkey string, size, max int64) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	used := q.reserved[pubkey]
+	if c, ok := q.counters[pubkey]; ok {
+		used += c.StorageUsed
+	}
+
+	remaining := max - used
+	if remaining <= 0 || size > remaining {
+		return false
+	}
+
+	q.reserved[pubkey] += size
+
+	return true
+}
+
+func (q *quotaTracker) unreserve(pubkey string, size int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.reserved[pubkey] -= size
+	if q.reserved[pubkey] <= 0 {
+		delete(q.reserved, pubkey)
+	}
+}
+
+// markSoft reports whether this is the first time the buddy crossed
+// the soft limit, it is reset once usage drops below it again
+func (q *quotaTracker) markSoft(pubkey string, soft bool) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	c := q.get(pubkey)
+	first := soft && !c.softWarned
+	c.softWarned = soft
+
+	return first
+}
+
+func (q *quotaTracker) pubkeys() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	keys := make([]string, 0, len(q.counters))
+	for k := range q.counters {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (q *quotaTracker) snapshot(pubkey string) *BuddyUsage {
+	in, out, _ := q.traffic(pubkey)
+	now := time.Now()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	usage := &BuddyUsage{
+		Pubkey:      pubkey,
+		TrafficIn:   in,
+		TrafficOut:  out,
+		Traffic:     in + out,
+		WindowStart: now.Add(-q.window),
+	}
+
+	if c, ok := q.counters[pubkey]; ok {
+		usage.TotalIn = c.TotalIn
+		usage.TotalOut = c.TotalOut
+		usage.StorageUsed = c.StorageUsed
+		if c.LastSeen > 0 {
+			usage.LastSeen = time.Unix(c.LastSeen, 0)
+		}
+	}
+
+	return usage
+}
+
+func (q *quotaTracker) reset(pubkey string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	c, ok := q.counters[pubkey]
+	if !ok {
+		return
+	}
+
+	c.Buckets = nil
+	c.softWarned = false
+	q.dirty = true
+}
+
+func limitState(used, max int64, softPercent int) QuotaState {
+	if max <= 0 {
+		return QuotaOK
+	}
+
+	if used >= max {
+		return QuotaHard
+	}
+
+	if used*100 >= max*int64(softPercent) {
+		return QuotaSoft
+	}
+
+	return QuotaOK
+}
+
+func dirSize(root string) (int64, error) {
+	var size int64
+
+	err := filepath.WalkDir(root, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+
+		size += info.Size()
+		return nil
+	})
+
+	return size, err
+}
@@ -0,0 +1,100 @@
+package buddyhub
+
+import (
+	"path"
+	"testing"
+	"time"
+)
+
+func TestQuotaTracker_RollingWindow(t *testing.T) {
+	q := newQuotaTracker(path.Join(t.TempDir(), "usage.json"), 30*time.Hour)
+
+	q.addTraffic("npub1buddy", 100, 400)
+
+	// a bucket which already rolled out of the window
+	q.mu.Lock()
+	c := q.get("npub1buddy")
+	old := time.Now().Add(-40 * time.Hour).Truncate(q.bucketSize).Unix()
+	c.Buckets = append([]trafficBucket{{Start: old, In: 1000, Out: 1000}}, c.Buckets...)
+	q.mu.Unlock()
+
+	in, out, rollsIn := q.traffic("npub1buddy")
+	if in != 100 || out != 400 {
+		t.Fatalf("expected 100/400 in window, got %d/%d", in, out)
+	}
+
+	if rollsIn <= 0 || rollsIn > 31*time.Hour {
+		t.Fatalf("unexpected roll over time %s", rollsIn)
+	}
+
+	usage := q.snapshot("npub1buddy")
+	if usage.TotalIn != 100 || usage.TotalOut != 400 {
+		t.Fatalf("unexpected totals %d/%d", usage.TotalIn, usage.TotalOut)
+	}
+}
+
+func TestQuotaTracker_Persist(t *testing.T) {
+	file := path.Join(t.TempDir(), "buddy", "usage.json")
+
+	q := newQuotaTracker(file, 0)
+	q.addTraffic("npub1buddy", 10, 20)
+	q.setStorage("npub1buddy", 2048)
+
+	if err := q.save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	loaded := newQuotaTracker(file, 0)
+	if err := loaded.load(); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	in, out, _ := loaded.traffic("npub1buddy")
+	if in != 10 || out != 20 {
+		t.Fatalf("expected 10/20 after load, got %d/%d", in, out)
+	}
+
+	if used := loaded.storage("npub1buddy"); used != 2048 {
+		t.Fatalf("expected 2048 storage after load, got %d", used)
+	}
+}
+
+func TestLimitState(t *testing.T) {
+	cases := []struct {
+		used, max int64
+		want      QuotaState
+	}{
+		{used: 1000, max: 0, want: QuotaOK},
+		{used: 79, max: 100, want: QuotaOK},
+		{used: 80, max: 100, want: QuotaSoft},
+		{used: 100, max: 100, want: QuotaHard},
+		{used: 150, max: 100, want: QuotaHard},
+	}
+
+	for _, tc := range cases {
+		got := limitState(tc.used, tc.max, DefaultSoftLimitPercent)
+		if got != tc.want {
+			t.Errorf("limitState(%d, %d) = %s, want %s", tc.used, tc.max, got, tc.want)
+		}
+	}
+}
+
+func TestQuotaTracker_Reserve(t *testing.T) {
+	q := newQuotaTracker(path.Join(t.TempDir(), "usage.json"), 0)
+	q.setStorage("npub1buddy", 40)
+
+	if !q.reserve("npub1buddy", 50, 100) {
+		t.Fatal("expected 50 bytes to fit")
+	}
+
+	// the first write is still in flight, its bytes count
+	if q.reserve("npub1buddy", 20, 100) {
+		t.Fatal("reservation in flight was not counted")
+	}
+
+	q.unreserve("npub1buddy", 50)
+
+	if !q.reserve("npub1buddy", 20, 100) {
+		t.Fatal("expected room after release")
+	}
+}
@@ -0,0 +1,187 @@
+package rendezvous
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/blue-monads/potatoverse/backend/utils/nostrutils"
+	"github.com/blue-monads/potatoverse/backend/utils/qq"
+	"github.com/blue-monads/potatoverse/backend/xtypes"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+const (
+	DefaultAnnounceTTL = 30 * time.Minute
+	DefaultTimeout     = 10 * time.Second
+)
+
+type NostrOptions struct {
+	Privkey string
+	Pubkey  string
+	Relays  []string
+
+	// how long an announcement stays valid, it should be re announced
+	// before that
+	TTL     time.Duration
+	Timeout time.Duration
+}
+
+// NostrProvider publishes signed node address announcements to nostr
+// relays and resolves a buddy by its latest valid announcement
+type NostrProvider struct {
+	opts NostrOptions
+}
+
+// announcement is the content of the nostr event
+type announcement struct {
+	NodeId string            `json:"node_id"`
+	URLs   []xtypes.BuddyUrl `json:"urls"`
+}
+
+func NewNostrProvider(opts NostrOptions) *NostrProvider {
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultAnnounceTTL
+	}
+
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+
+	return &NostrProvider{
+		opts: opts,
+	}
+}
+
+func (p *NostrProvider) Name() string {
+	return "nostr"
+}
+
+// Announce publishes to every relay, it is enough that one accepts it
+func (p *NostrProvider) Announce(ctx context.Context, urls []xtypes.BuddyUrl) error {
+	if len(p.opts.Relays) == 0 {
+		return errors.New("no nostr relays configured")
+	}
+
+	content, err := json.Marshal(announcement{
+		NodeId: nostrutils.PubKeyToNodeId(p.opts.Pubkey),
+		URLs:   urls,
+	})
+	if err != nil {
+		return err
+	}
+
+	event, err := nostrutils.SignNodeAnnouncement(p.opts.Privkey, string(content), time.Now().Add(p.opts.TTL))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.opts.Timeout)
+	defer cancel()
+
+	errs := make([]error, len(p.opts.Relays))
+
+	var wg sync.WaitGroup
+	for idx, url := range p.opts.Relays {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[idx] = publish(ctx, url, *event)
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("announce failed on all relays: %w", errors.Join(errs...))
+}
+
+// Resolve asks every relay and picks the newest announcement that checks
+// out, a relay handing out forged or stale events is just ignored
+func (p *NostrProvider) Resolve(ctx context.Context, pubkey string) ([]xtypes.BuddyUrl, error) {
+	filter, err := nostrutils.NodeAnnouncementFilter(pubkey)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.opts.Timeout)
+	defer cancel()
+
+	results := make([][]*nostr.Event, len(p.opts.Relays))
+
+	var wg sync.WaitGroup
+	for idx, url := range p.opts.Relays {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			events, err := query(ctx, url, filter)
+			if err != nil {
+				qq.Println("@NostrProvider/Resolve/query", url, err)
+				return
+			}
+
+			results[idx] = events
+		}()
+	}
+	wg.Wait()
+
+	now := time.Now()
+
+	var latest *nostr.Event
+	for _, events := range results {
+		for _, event := range events {
+			if nostrutils.VerifyNodeAnnouncement(event, pubkey, now) != nil {
+				continue
+			}
+
+			if latest == nil || event.CreatedAt > latest.CreatedAt {
+				latest = event
+			}
+		}
+	}
+
+	if latest == nil {
+		return nil, ErrNotFound
+	}
+
+	ann := announcement{}
+	err = json.Unmarshal([]byte(latest.Content), &ann)
+	if err != nil {
+		return nil, fmt.Errorf("invalid announcement: %w", err)
+	}
+
+	sort.SliceStable(ann.URLs, func(i, j int) bool {
+		return ann.URLs[i].Priority > ann.URLs[j].Priority
+	})
+
+	return ann.URLs, nil
+}
+
+func publish(ctx context.Context, url string, event nostr.Event) error {
+	relay, err := nostr.RelayConnect(ctx, url)
+	if err != nil {
+		return err
+	}
+	defer relay.Close()
+
+	return relay.Publish(ctx, event)
+}
+
+func query(ctx context.Context, url string, filter nostr.Filter) ([]*nostr.Event, error) {
+	relay, err := nostr.RelayConnect(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer relay.Close()
+
+	return relay.QuerySync(ctx, filter)
+}
@@ -0,0 +1,127 @@
+package rendezvous
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/blue-monads/potatoverse/backend/utils/nostrutils"
+	"github.com/blue-monads/potatoverse/backend/utils/nostrutils/testrelay"
+	"github.com/blue-monads/potatoverse/backend/xtypes"
+)
+
+func newTestProvider(t *testing.T, secret string, relays ...string) *NostrProvider {
+	pubkey, privkey, err := nostrutils.GenerateKeyPair(secret)
+	if err != nil {
+		t.Fatalf("keypair: %v", err)
+	}
+
+	return NewNostrProvider(NostrOptions{
+		Privkey: privkey,
+		Pubkey:  pubkey,
+		Relays:  relays,
+		Timeout: 3 * time.Second,
+	})
+}
+
+func TestNostrProvider_AnnounceResolve(t *testing.T) {
+	relay := testrelay.New()
+	defer relay.Close()
+
+	node := newTestProvider(t, "node-secret", relay.URL())
+	other := newTestProvider(t, "other-secret", relay.URL())
+
+	ctx := context.Background()
+
+	err := node.Announce(ctx, []xtypes.BuddyUrl{{Host: "old.example.com", Port: "80", Provider: "http"}})
+	if err != nil {
+		t.Fatalf("announce: %v", err)
+	}
+
+	// newer announcement replaces the old one
+	time.Sleep(1100 * time.Millisecond)
+
+	err = node.Announce(ctx, []xtypes.BuddyUrl{
+		{Host: "buddy-x.hq.example.com", Port: "443", Provider: "funnel", Priority: 1},
+		{Host: "node.example.com", Port: "7777", Provider: "http", Priority: 5},
+	})
+	if err != nil {
+		t.Fatalf("announce: %v", err)
+	}
+
+	urls, err := other.Resolve(ctx, node.opts.Pubkey)
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+
+	if len(urls) != 2 || urls[0].Host != "node.example.com" || urls[1].Provider != "funnel" {
+		t.Fatalf("unexpected urls %+v", urls)
+	}
+
+	_, err = node.Resolve(ctx, other.opts.Pubkey)
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestNostrProvider_IgnoresForgedAndExpired(t *testing.T) {
+	relay := testrelay.New()
+	defer relay.Close()
+
+	node := newTestProvider(t, "node-secret", relay.URL())
+	ctx := context.Background()
+
+	err := node.Announce(ctx, []xtypes.BuddyUrl{{Host: "node.example.com", Port: "80", Provider: "http"}})
+	if err != nil {
+		t.Fatalf("announce: %v", err)
+	}
+
+	// a relay handing out a newer event with a broken signature
+	forged := *relay.Events()[0]
+	forged.CreatedAt += 10
+	forged.Content = `{"urls":[{"host":"evil.example.com","port":"80","provider":"http"}]}`
+	relay.Store(&forged)
+
+	urls, err := node.Resolve(ctx, node.opts.Pubkey)
+	if err == nil {
+		t.Fatalf("forged announcement should be ignored, got %+v", urls)
+	}
+
+	// expired announcements are not used
+	expired, err := nostrutils.SignNodeAnnouncement(node.opts.Privkey, `{"urls":[]}`, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	if err := nostrutils.VerifyNodeAnnouncement(expired, node.opts.Pubkey, time.Now()); err == nil {
+		t.Fatal("expected expired announcement to fail verification")
+	}
+}
+
+func TestNostrProvider_RelayDown(t *testing.T) {
+	relay := testrelay.New()
+	defer relay.Close()
+
+	down := testrelay.New()
+	downURL := down.URL()
+	down.Close()
+
+	node := newTestProvider(t, "node-secret", downURL, relay.URL())
+	ctx := context.Background()
+
+	err := node.Announce(ctx, []xtypes.BuddyUrl{{Host: "node.example.com", Port: "80", Provider: "http"}})
+	if err != nil {
+		t.Fatalf("announce with one relay down: %v", err)
+	}
+
+	urls, err := node.Resolve(ctx, node.opts.Pubkey)
+	if err != nil || len(urls) != 1 {
+		t.Fatalf("resolve with one relay down: %+v %v", urls, err)
+	}
+
+	onlyDown := newTestProvider(t, "node-secret", downURL)
+	if err := onlyDown.Announce(ctx, nil); err == nil {
+		t.Fatal("expected announce to fail when no relay is reachable")
+	}
+}
@@ -0,0 +1,20 @@
+package rendezvous
+
+import (
+	"context"
+	"errors"
+
+	"github.com/blue-monads/potatoverse/backend/xtypes"
+)
+
+var (
+	ErrNotFound = errors.New("buddy not found on rendezvous")
+)
+
+// Provider publishes where this node can be reached and finds out where
+// other buddies are, urls are the same BuddyUrl static buddies use
+type Provider interface {
+	Name() string
+	Announce(ctx context.Context, urls []xtypes.BuddyUrl) error
+	Resolve(ctx context.Context, pubkey string) ([]xtypes.BuddyUrl, error)
+}
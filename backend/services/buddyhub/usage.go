@@ -0,0 +1,211 @@
+package buddyhub
+
+import (
+	"math"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	WebFunnelModeAll    = "all"    // any allowed buddy, default
+	WebFunnelModeStatic = "static" // only static buddies with allow_web_funnel
+	WebFunnelModeNone   = "none"
+
+	// set on funnel responses once a buddy is past its soft limit
+	QuotaHeader = "X-Buddy-Quota"
+)
+
+// GetBuddyLimits resolves limits of a buddy, static buddies use their own
+// entry and others fall back to the all_buddy_* options. allow_all_buddies
+// only opens storage to non static buddies, funnel access for them follows
+// buddy_web_funnel_mode alone as it did before quotas existed
+func (bh *BuddyHub) GetBuddyLimits(pubkey string) BuddyLimits {
+	opts := bh.options
+	if opts == nil {
+		// nothing configured, any buddy can funnel like before
+		return BuddyLimits{AllowWebFunnel: true}
+	}
+
+	funnelMode := opts.BuddyWebFunnelMode
+
+	if info, ok := bh.staticBuddies[pubkey]; ok {
+		return BuddyLimits{
+			Static:          true,
+			AllowWebFunnel:  info.AllowWebFunnel && funnelMode != WebFunnelModeNone,
+			AllowStorage:    info.AllowStorage,
+			MaxStorage:      info.MaxStorage,
+			MaxTrafficLimit: info.MaxTrafficLimit,
+		}
+	}
+
+	return BuddyLimits{
+		AllowWebFunnel:  funnelMode == "" || funnelMode == WebFunnelModeAll,
+		AllowStorage:    opts.AllowAllBuddies && opts.AllBuddyAllowStorage,
+		MaxStorage:      opts.AllBuddyMaxStorage,
+		MaxTrafficLimit: opts.AllBuddyMaxTrafficLimit,
+	}
+}
+
+// CheckTraffic returns the traffic quota state of a buddy and, when it is
+// over the hard limit, how long until enough of the window rolls over
+func (bh *BuddyHub) CheckTraffic(pubkey string) (QuotaState, time.Duration) {
+	limits := bh.GetBuddyLimits(pubkey)
+
+	in, out, rollsIn := bh.quota.traffic(pubkey)
+	state := limitState(in+out, limits.MaxTrafficLimit, bh.softPercent)
+
+	if bh.quota.markSoft(pubkey, state != QuotaOK) {
+		bh.logger.Warn("Buddy is close to its traffic limit", "pubkey", pubkey, "used", in+out, "limit", limits.MaxTrafficLimit)
+	}
+
+	if state != QuotaHard {
+		return state, 0
+	}
+
+	return state, rollsIn
+}
+
+// CheckStorage returns ErrStorageNotAllowed when the buddy has no storage
+func (bh *BuddyHub) CheckStorage(pubkey string) error {
+	if !bh.GetBuddyLimits(pubkey).AllowStorage {
+		return ErrStorageNotAllowed
+	}
+	return nil
+}
+
+// ReserveStorage holds size bytes of the storage quota of a buddy until
+// release is called, concurrent writes count each other's reservations so
+// they can not all pass the check
+func (bh *BuddyHub) ReserveStorage(pubkey string, size int64) (func(), error) {
+	limits := bh.GetBuddyLimits(pubkey)
+	if !limits.AllowStorage {
+		return nil, ErrStorageNotAllowed
+	}
+
+	if limits.MaxStorage <= 0 {
+		return func() {}, nil
+	}
+
+	if !bh.quota.reserve(pubkey, size, limits.MaxStorage) {
+		return nil, ErrStorageQuotaExceeded
+	}
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() { bh.quota.unreserve(pubkey, size) })
+	}
+
+	return release, nil
+}
+
+// StorageSize returns the size of a file or folder in the storage of a
+// buddy, name is a slash separated path inside it
+func (bh *BuddyHub) StorageSize(pubkey, name string) (int64, error) {
+	full := filepath.Join(bh.StorageDir(pubkey), filepath.FromSlash(path.Clean("/"+name)))
+	return dirSize(full)
+}
+
+func (bh *BuddyHub) StorageDir(pubkey string) string {
+	return path.Join(bh.baseBuddyDir, "storage", pubkey)
+}
+
+// PrepareStorageDir creates the storage folder of a buddy if needed
+func (bh *BuddyHub) PrepareStorageDir(pubkey string) (string, error) {
+	dir := bh.StorageDir(pubkey)
+	return dir, os.MkdirAll(dir, 0755)
+}
+
+// RefreshStorageUsage recounts the storage folder of a buddy, it is
+// called after every write so the counter follows deletes too
+func (bh *BuddyHub) RefreshStorageUsage(pubkey string) (int64, error) {
+	used, err := dirSize(bh.StorageDir(pubkey))
+	if err != nil {
+		return 0, err
+	}
+
+	bh.quota.setStorage(pubkey, used)
+
+	return used, nil
+}
+
+func (bh *BuddyHub) GetUsage(pubkey string) *BuddyUsage {
+	usage := bh.quota.snapshot(pubkey)
+	usage.Limits = bh.GetBuddyLimits(pubkey)
+	usage.TrafficState = limitState(usage.Traffic, usage.Limits.MaxTrafficLimit, bh.softPercent)
+	usage.StorageState = limitState(usage.StorageUsed, usage.Limits.MaxStorage, bh.softPercent)
+
+	if info, ok := bh.staticBuddies[pubkey]; ok {
+		usage.Name = info.Name
+	}
+
+	return usage
+}
+
+// ListUsage returns usage of static buddies and every buddy seen so far
+func (bh *BuddyHub) ListUsage() []*BuddyUsage {
+	seen := make(map[string]bool)
+	keys := make([]string, 0, len(bh.staticBuddies))
+
+	for pubkey := range bh.staticBuddies {
+		seen[pubkey] = true
+		keys = append(keys, pubkey)
+	}
+
+	for _, pubkey := range bh.quota.pubkeys() {
+		if !seen[pubkey] {
+			keys = append(keys, pubkey)
+		}
+	}
+
+	sort.Strings(keys)
+
+	result := make([]*BuddyUsage, 0, len(keys))
+	for _, pubkey := range keys {
+		result = append(result, bh.GetUsage(pubkey))
+	}
+
+	return result
+}
+
+// ResetUsage clears the traffic window of a buddy, lifetime totals and
+// storage are kept
+func (bh *BuddyHub) ResetUsage(pubkey string) {
+	bh.quota.reset(pubkey)
+}
+
+func (bh *BuddyHub) flushUsageLoop() {
+	ticker := time.NewTicker(usageFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-bh.stopChan:
+			return
+		case <-ticker.C:
+			err := bh.quota.save()
+			if err != nil {
+				bh.logger.Error("Failed to save buddy usage", "err", err)
+			}
+		}
+	}
+}
+
+// WriteQuotaExceeded answers 429, Retry-After is set when known
+func WriteQuotaExceeded(ctx *gin.Context, err error, retryAfter time.Duration) {
+	if retryAfter > 0 {
+		secs := int64(math.Ceil(retryAfter.Seconds()))
+		ctx.Header("Retry-After", strconv.FormatInt(secs, 10))
+	}
+
+	ctx.Header(QuotaHeader, string(QuotaHard))
+	ctx.String(http.StatusTooManyRequests, err.Error())
+	ctx.Abort()
+}
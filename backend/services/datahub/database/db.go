@@ -79,11 +79,11 @@ func NewDB(file string, logger *slog.Logger) (*DB, error) {
 
 func AutoMigrate(sess upperdb.Session) error {
 
+	driver := sess.Driver().(*sql.DB)
+
 	exists, _ := sess.Collection("Users").Exists()
 
 	if !exists {
-		driver := sess.Driver().(*sql.DB)
-
 		buf := bytes.Buffer{}
 
 		pschema := strings.Replace(fileops.FileSchemaSQL, "FileMeta", "PFileMeta", 1)
@@ -106,6 +106,21 @@ func AutoMigrate(sess upperdb.Session) error {
 			sess.Close()
 			return err
 		}
+
+		return nil
+	}
+
+	// older db, tables added since are created and columns altered in
+	_, err := driver.Exec(schema.Get())
+	if err != nil {
+		sess.Close()
+		return err
+	}
+
+	err = schema.MigrateColumns(driver)
+	if err != nil {
+		sess.Close()
+		return err
 	}
 
 	return nil
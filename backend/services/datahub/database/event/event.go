@@ -17,14 +17,15 @@ func NewEventOperations(db db.Session) *EventOperations {
 	}
 }
 
-func (d *EventOperations) AddEvent(installId int64, name string, payload []byte) (int64, error) {
+func (d *EventOperations) AddEvent(installId int64, name string, collapseKey string, payload []byte) (int64, error) {
 	event := &dbmodels.MQEvent{
-		InstallID: installId,
-		Name:      name,
-		Payload:   payload,
-		Status:    "new",
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		InstallID:   installId,
+		Name:        name,
+		Payload:     payload,
+		CollapseKey: collapseKey,
+		Status:      "new",
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
 	}
 
 	r, err := d.eventTable().Insert(event)
@@ -87,9 +88,23 @@ func (d *EventOperations) CreateEventTargets(eventId int64) ([]int64, error) {
 	// Create event targets for each matching subscription
 	targetIds := make([]int64, 0, len(subscriptions))
 	for _, sub := range subscriptions {
+		collapseKey := ""
+		if sub.CollapseInterval > 0 && event.CollapseKey != "" {
+			collapseKey = event.CollapseKey
+
+			collapsed, err := d.collapseIntoPending(eventId, sub.ID, collapseKey)
+			if err != nil {
+				return nil, err
+			}
+			if collapsed {
+				continue
+			}
+		}
+
 		target := &dbmodels.MQEventTarget{
 			EventID:        eventId,
 			SubscriptionID: sub.ID,
+			CollapseKey:    collapseKey,
 			Status:         "new",
 			CreatedAt:      time.Now(),
 			UpdatedAt:      time.Now(),
@@ -106,40 +121,86 @@ func (d *EventOperations) CreateEventTargets(eventId int64) ([]int64, error) {
 	return targetIds, nil
 }
 
-func (d *EventOperations) QueryNewEventTargets() ([]int64, error) {
-	targets := make([]struct {
-		ID int64 `db:"id"`
-	}, 0)
+// collapseIntoPending attaches the event to a target of the same subscription
+// and collapse key that has not started delivery yet. It is a single
+// statement so a target can not start between the check and the insert.
+// The attached target stays collapsed until its leader is done.
+func (d *EventOperations) collapseIntoPending(eventId, subscriptionId int64, collapseKey string) (bool, error) {
+	now := time.Now()
+
+	res, err := d.db.SQL().Exec(`INSERT INTO MQEventTargets (event_id, subscription_id, collapse_key, collapsed_into, status, created_at, updated_at)
+SELECT ?, subscription_id, collapse_key, id, 'collapsed', ?, ?
+FROM MQEventTargets
+WHERE subscription_id = ? AND collapse_key = ? AND collapsed_into = 0 AND status IN ('new', 'start_delayed')
+ORDER BY id LIMIT 1`, eventId, now, now, subscriptionId, collapseKey)
+	if err != nil {
+		return false, err
+	}
 
-	err := d.eventTargetTable().Find(db.Cond{"status": "new"}).Select("id").All(&targets)
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// ListCollapsedTargets lists targets delivered as part of the leader target
+func (d *EventOperations) ListCollapsedTargets(leaderId int64) ([]dbmodels.MQEventTarget, error) {
+	targets := make([]dbmodels.MQEventTarget, 0)
+	err := d.eventTargetTable().Find(db.Cond{"collapsed_into": leaderId}).OrderBy("id").All(&targets)
 	if err != nil {
 		return nil, err
 	}
+	return targets, nil
+}
 
-	ids := make([]int64, len(targets))
-	for i, t := range targets {
-		ids[i] = t.ID
+func (d *EventOperations) QueryNewEventTargets() ([]dbmodels.MQEventTargetRef, error) {
+	refs := make([]dbmodels.MQEventTargetRef, 0)
+
+	err := d.db.SQL().Select("t.id AS id", "e.install_id AS install_id").
+		From("MQEventTargets AS t").
+		Join("MQEvents AS e").On("e.id = t.event_id").
+		Where("t.status = ?", "new").
+		All(&refs)
+	if err != nil {
+		return nil, err
 	}
-	return ids, nil
+
+	return refs, nil
 }
 
-func (d *EventOperations) QueryDelayExpiredTargets() ([]int64, error) {
-	now := time.Now().Unix()
-	entityIds := make([]dbmodels.EntityId, 0)
-	err := d.eventTargetTable().Find(db.Cond{
-		"status IN":        []string{"delayed", "start_delayed"},
-		"delayed_until <=": now,
-	}).Select("id").All(&entityIds)
+func (d *EventOperations) QueryDelayExpiredTargets() ([]dbmodels.MQEventTargetRef, error) {
+	refs := make([]dbmodels.MQEventTargetRef, 0)
+
+	err := d.db.SQL().Select("t.id AS id", "e.install_id AS install_id").
+		From("MQEventTargets AS t").
+		Join("MQEvents AS e").On("e.id = t.event_id").
+		Where("t.status IN ? AND t.delayed_until <= ?", []string{"delayed", "start_delayed"}, time.Now().Unix()).
+		All(&refs)
 	if err != nil {
 		return nil, err
 	}
 
-	ids := make([]int64, len(entityIds))
-	for i, e := range entityIds {
-		ids[i] = e.Id
+	return refs, nil
+}
+
+// QueryNextDelayedAt returns the earliest delayed_until of delayed targets, 0 if none
+func (d *EventOperations) QueryNextDelayedAt() (int64, error) {
+	row, err := d.db.SQL().QueryRow(
+		"SELECT COALESCE(MIN(delayed_until), 0) FROM MQEventTargets WHERE status IN ('delayed', 'start_delayed')",
+	)
+	if err != nil {
+		return 0, err
 	}
 
-	return ids, nil
+	var next int64
+	err = row.Scan(&next)
+	if err != nil {
+		return 0, err
+	}
+
+	return next, nil
 }
 
 func (d *EventOperations) QueryEventTargetsByEventId(eventId int64) ([]int64, error) {
@@ -157,6 +218,15 @@ func (d *EventOperations) QueryEventTargetsByEventId(eventId int64) ([]int64, er
 	return ids, nil
 }
 
+func (d *EventOperations) GetEventTarget(id int64) (*dbmodels.MQEventTarget, error) {
+	target := &dbmodels.MQEventTarget{}
+	err := d.eventTargetTable().Find(db.Cond{"id": id}).One(target)
+	if err != nil {
+		return nil, err
+	}
+	return target, nil
+}
+
 func (d *EventOperations) UpdateEventTarget(id int64, data map[string]any) error {
 	data["updated_at"] = time.Now()
 	return d.eventTargetTable().Find(db.Cond{"id": id}).Update(data)
@@ -192,10 +262,196 @@ func (d *EventOperations) TransitionTargetComplete(evtId, targetId int64) error
 		return err
 	}
 
+	err = d.checkEventProcessed(evtId)
+	if err != nil {
+		return err
+	}
+
+	return d.finishCollapsed(targetId, "processed")
+}
+
+func (d *EventOperations) TransitionTargetDelay(targetId int64, eventId, delay, retryCount int64) error {
+	return d.UpdateEventTarget(targetId, map[string]any{
+		"status":        "delayed",
+		"delayed_until": delay,
+		"retry_count":   retryCount,
+	})
+}
+
+func (d *EventOperations) TransitionTargetStartDelayed(targetId int64, eventId, delay int64) error {
+	return d.UpdateEventTarget(targetId, map[string]any{
+		"status":        "start_delayed",
+		"delayed_until": delay,
+	})
+}
+
+func (d *EventOperations) TransitionTargetFail(evtId, targetId int64, errorMsg string) error {
+	return d.UpdateEventTarget(targetId, map[string]any{
+		"status": "failed",
+		"error":  errorMsg,
+	})
+}
+
+func (d *EventOperations) TransitionTargetDead(evtId, targetId int64, errorMsg string) error {
+	err := d.UpdateEventTarget(targetId, map[string]any{
+		"status": "dead",
+		"error":  errorMsg,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = d.checkEventProcessed(evtId)
+	if err != nil {
+		return err
+	}
+
+	return d.finishCollapsed(targetId, "dead")
+}
+
+// attempts
+
+func (d *EventOperations) AddTargetAttempt(attempt *dbmodels.MQEventTargetAttempt) error {
+	attempt.CreatedAt = time.Now()
+	_, err := d.eventTargetAttemptTable().Insert(attempt)
+	return err
+}
+
+func (d *EventOperations) ListTargetAttempts(targetId int64) ([]dbmodels.MQEventTargetAttempt, error) {
+	attempts := make([]dbmodels.MQEventTargetAttempt, 0)
+	err := d.eventTargetAttemptTable().Find(db.Cond{"target_id": targetId}).OrderBy("id").All(&attempts)
+	if err != nil {
+		return nil, err
+	}
+	return attempts, nil
+}
+
+// dead letter
+
+// QueryDeadTargets lists dead targets, installId and subscriptionId are
+// optional filters (0 matches all)
+func (d *EventOperations) QueryDeadTargets(installId, subscriptionId int64, offset, limit int) ([]dbmodels.MQEventTarget, error) {
+	targets := make([]dbmodels.MQEventTarget, 0)
+
+	// followers are replayed and discarded along with their leader
+	q := d.db.SQL().SelectFrom("MQEventTargets").Where("status = ? AND collapsed_into = 0", "dead")
+	if installId != 0 {
+		q = q.And("event_id IN (SELECT id FROM MQEvents WHERE install_id = ?)", installId)
+	}
+	if subscriptionId != 0 {
+		q = q.And("subscription_id = ?", subscriptionId)
+	}
+
+	if limit <= 0 {
+		limit = 100
+	}
+
+	err := q.OrderBy("id").Offset(offset).Limit(limit).All(&targets)
+	if err != nil {
+		return nil, err
+	}
+
+	return targets, nil
+}
+
+// ReplayDeadTargets moves dead targets back to new with a fresh retry budget,
+// empty targetIds replays every dead target matching the filters.
+func (d *EventOperations) ReplayDeadTargets(installId, subscriptionId int64, targetIds []int64) ([]int64, error) {
+	ids, err := d.resolveDeadTargets(installId, subscriptionId, targetIds)
+	if err != nil || len(ids) == 0 {
+		return ids, err
+	}
+
+	err = d.eventTargetTable().Find(db.Cond{"id IN": ids, "status": "dead"}).Update(map[string]any{
+		"status":        "new",
+		"retry_count":   0,
+		"delayed_until": 0,
+		"error":         "",
+		"updated_at":    time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// followers go back to waiting on their leader
+	err = d.eventTargetTable().Find(db.Cond{"collapsed_into IN": ids, "status": "dead"}).Update(map[string]any{
+		"status":     "collapsed",
+		"updated_at": time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// events of replayed targets are not done anymore
+	_, err = d.db.SQL().Update("MQEvents").Set(map[string]any{
+		"status":     "scheduled",
+		"updated_at": time.Now(),
+	}).Where("id IN (SELECT event_id FROM MQEventTargets WHERE id IN ? OR collapsed_into IN ?)", ids, ids).Exec()
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// DiscardDeadTargets marks dead targets as discarded, they are kept along
+// with their attempts for inspection but never retried.
+func (d *EventOperations) DiscardDeadTargets(installId, subscriptionId int64, targetIds []int64) ([]int64, error) {
+	ids, err := d.resolveDeadTargets(installId, subscriptionId, targetIds)
+	if err != nil || len(ids) == 0 {
+		return ids, err
+	}
+
+	err = d.eventTargetTable().Find(db.Cond{"id IN": ids, "status": "dead"}).Update(map[string]any{
+		"status":     "discarded",
+		"updated_at": time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.eventTargetTable().Find(db.Cond{"collapsed_into IN": ids, "status": "dead"}).Update(map[string]any{
+		"status":     "discarded",
+		"updated_at": time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+func (d *EventOperations) resolveDeadTargets(installId, subscriptionId int64, targetIds []int64) ([]int64, error) {
+	q := d.db.SQL().Select("id").From("MQEventTargets").Where("status = ? AND collapsed_into = 0", "dead")
+	if installId != 0 {
+		q = q.And("event_id IN (SELECT id FROM MQEvents WHERE install_id = ?)", installId)
+	}
+	if subscriptionId != 0 {
+		q = q.And("subscription_id = ?", subscriptionId)
+	}
+	if len(targetIds) != 0 {
+		q = q.And("id IN ?", targetIds)
+	}
+
+	entityIds := make([]dbmodels.EntityId, 0)
+	err := q.All(&entityIds)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, len(entityIds))
+	for i, e := range entityIds {
+		ids[i] = e.Id
+	}
+
+	return ids, nil
+}
+
+func (d *EventOperations) checkEventProcessed(evtId int64) error {
 	rows, err := d.db.SQL().Query(`	
 SELECT
   COUNT(id) AS total_target,
-  COUNT(CASE WHEN status IN ('processed', 'failed') THEN 1 END) AS is_processed
+  COUNT(CASE WHEN status IN ('processed', 'failed', 'dead', 'discarded') THEN 1 END) AS is_processed
 FROM
   MQEventTargets
 WHERE
@@ -220,26 +476,30 @@ WHERE
 	return nil
 }
 
-func (d *EventOperations) TransitionTargetDelay(targetId int64, eventId, delay, retryCount int64) error {
-	return d.UpdateEventTarget(targetId, map[string]any{
-		"status":        "delayed",
-		"delayed_until": delay,
-		"retry_count":   retryCount,
-	})
-}
+// finishCollapsed gives the targets collapsed into the leader its final
+// status and re-checks their events, replaying the leader takes them back
+func (d *EventOperations) finishCollapsed(leaderId int64, status string) error {
+	followers, err := d.ListCollapsedTargets(leaderId)
+	if err != nil || len(followers) == 0 {
+		return err
+	}
 
-func (d *EventOperations) TransitionTargetStartDelayed(targetId int64, eventId, delay int64) error {
-	return d.UpdateEventTarget(targetId, map[string]any{
-		"status":        "start_delayed",
-		"delayed_until": delay,
+	err = d.eventTargetTable().Find(db.Cond{"collapsed_into": leaderId, "status": "collapsed"}).Update(map[string]any{
+		"status":     status,
+		"updated_at": time.Now(),
 	})
-}
+	if err != nil {
+		return err
+	}
 
-func (d *EventOperations) TransitionTargetFail(evtId, targetId int64, errorMsg string) error {
-	return d.UpdateEventTarget(targetId, map[string]any{
-		"status": "failed",
-		"error":  errorMsg,
-	})
+	for _, follower := range followers {
+		err = d.checkEventProcessed(follower.EventID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // Private helper methods
@@ -252,6 +512,10 @@ func (d *EventOperations) eventTargetTable() db.Collection {
 	return d.db.Collection("MQEventTargets")
 }
 
+func (d *EventOperations) eventTargetAttemptTable() db.Collection {
+	return d.db.Collection("MQEventTargetAttempts")
+}
+
 func (d *EventOperations) subscriptionTable() db.Collection {
 	return d.db.Collection("MQSubscriptions")
 }
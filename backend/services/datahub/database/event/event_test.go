@@ -0,0 +1,170 @@
+package event
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/blue-monads/potatoverse/backend/services/datahub/database/schema"
+	"github.com/blue-monads/potatoverse/backend/services/datahub/dbmodels"
+	"github.com/upper/db/v4/adapter/sqlite"
+)
+
+func setupEventDB(t *testing.T) *EventOperations {
+	sess, err := sqlite.Open(sqlite.ConnectionURL{
+		Database: filepath.Join(t.TempDir(), "event.sqlite"),
+	})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { sess.Close() })
+
+	driver := sess.Driver().(*sql.DB)
+
+	_, err = driver.Exec(schema.Get())
+	if err != nil {
+		t.Fatalf("apply schema: %v", err)
+	}
+
+	_, err = driver.Exec(`INSERT INTO MQSubscriptions (install_id, event_key, target_type, collapse_interval) VALUES (1, 'changed', 'webhook', 60)`)
+	if err != nil {
+		t.Fatalf("add subscription: %v", err)
+	}
+
+	return NewEventOperations(sess)
+}
+
+// collapsedPair adds two events with the same collapse key, the second one
+// collapses into the target of the first
+func collapsedPair(t *testing.T, ops *EventOperations) (leader dbmodels.MQEventTarget, follower dbmodels.MQEventTarget) {
+	t.Helper()
+
+	var targets []int64
+	for range 2 {
+		eventId, err := ops.AddEvent(1, "changed", "doc-1", []byte(`{}`))
+		if err != nil {
+			t.Fatalf("add event: %v", err)
+		}
+
+		ids, err := ops.CreateEventTargets(eventId)
+		if err != nil {
+			t.Fatalf("create targets: %v", err)
+		}
+		targets = append(targets, ids...)
+	}
+
+	if len(targets) != 1 {
+		t.Fatalf("got %d targets, want 1 leader", len(targets))
+	}
+
+	followers, err := ops.ListCollapsedTargets(targets[0])
+	if err != nil || len(followers) != 1 {
+		t.Fatalf("collapsed targets = %v, %v, want 1", followers, err)
+	}
+
+	l, err := ops.GetEventTarget(targets[0])
+	if err != nil {
+		t.Fatalf("get leader: %v", err)
+	}
+
+	return *l, followers[0]
+}
+
+func assertStatus(t *testing.T, ops *EventOperations, targetId int64, want string) {
+	t.Helper()
+
+	target, err := ops.GetEventTarget(targetId)
+	if err != nil {
+		t.Fatalf("get target: %v", err)
+	}
+	if target.Status != want {
+		t.Errorf("target %d status = %q, want %q", targetId, target.Status, want)
+	}
+}
+
+func assertEventStatus(t *testing.T, ops *EventOperations, eventId int64, want string) {
+	t.Helper()
+
+	event, err := ops.GetEvent(eventId)
+	if err != nil {
+		t.Fatalf("get event: %v", err)
+	}
+	if event.Status != want {
+		t.Errorf("event %d status = %q, want %q", eventId, event.Status, want)
+	}
+}
+
+func TestCollapsedFollowsLeader(t *testing.T) {
+	ops := setupEventDB(t)
+	leader, follower := collapsedPair(t, ops)
+
+	// still waiting on the leader
+	assertStatus(t, ops, follower.ID, "collapsed")
+	assertEventStatus(t, ops, follower.EventID, "new")
+
+	err := ops.TransitionTargetComplete(leader.EventID, leader.ID)
+	if err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+
+	assertStatus(t, ops, follower.ID, "processed")
+	assertEventStatus(t, ops, leader.EventID, "processed")
+	assertEventStatus(t, ops, follower.EventID, "processed")
+}
+
+func TestCollapsedReplay(t *testing.T) {
+	ops := setupEventDB(t)
+	leader, follower := collapsedPair(t, ops)
+
+	err := ops.TransitionTargetDead(leader.EventID, leader.ID, "boom")
+	if err != nil {
+		t.Fatalf("dead: %v", err)
+	}
+
+	assertStatus(t, ops, follower.ID, "dead")
+	assertEventStatus(t, ops, follower.EventID, "processed")
+
+	// only the leader is listed, the follower goes with it
+	dead, err := ops.QueryDeadTargets(1, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("query dead: %v", err)
+	}
+	if len(dead) != 1 || dead[0].ID != leader.ID {
+		t.Fatalf("dead targets = %v, want only the leader", dead)
+	}
+
+	_, err = ops.ReplayDeadTargets(1, 0, nil)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+
+	assertStatus(t, ops, leader.ID, "new")
+	assertStatus(t, ops, follower.ID, "collapsed")
+	assertEventStatus(t, ops, follower.EventID, "scheduled")
+
+	err = ops.TransitionTargetComplete(leader.EventID, leader.ID)
+	if err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+
+	assertStatus(t, ops, follower.ID, "processed")
+	assertEventStatus(t, ops, follower.EventID, "processed")
+}
+
+func TestCollapsedDiscard(t *testing.T) {
+	ops := setupEventDB(t)
+	leader, follower := collapsedPair(t, ops)
+
+	err := ops.TransitionTargetDead(leader.EventID, leader.ID, "boom")
+	if err != nil {
+		t.Fatalf("dead: %v", err)
+	}
+
+	_, err = ops.DiscardDeadTargets(1, 0, nil)
+	if err != nil {
+		t.Fatalf("discard: %v", err)
+	}
+
+	assertStatus(t, ops, leader.ID, "discarded")
+	assertStatus(t, ops, follower.ID, "discarded")
+}
@@ -0,0 +1,299 @@
+package ppackage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blue-monads/potatoverse/backend/services/datahub/dbmodels"
+	"github.com/blue-monads/potatoverse/backend/services/datahub/enforcer"
+	"github.com/upper/db/v4"
+)
+
+/*
+
+a snapshot copies the package owned tables (zz_P__<install_id>__*) and the
+package SpaceKV rows into zs_<snapshot_id>__<table> tables in the same
+database, restoring drops the current package tables and rebuilds them from
+the saved schema. virtual tables (fts etc.) and their shadow tables are not
+copied.
+
+capability tables (zz_C__*) are left out on purpose, they hold state the
+capability keeps for itself and not package data: xCorn job schedules,
+xShell audit log, xLlm usage and xLock leases. rolling them back would
+re-fire cron jobs, lose audit entries and usage, and hand out locks that are
+still held. xLlm and xLock tables are also shared by every install
+(zz_C__xllm__*, zz_C__xlock__*) so they can not be restored per install.
+
+*/
+
+const snapshotKVTable = "SpaceKV"
+
+func (d *PackageInstallOperations) SnapshotPackageData(installId int64, versionId int64, reason string) (int64, error) {
+	driver := d.db.Driver().(*sql.DB)
+
+	tx, err := driver.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	t := time.Now()
+	result, err := tx.Exec(
+		"INSERT INTO PackageSnapshots (install_id, version_id, reason, tables, created_at) VALUES (?, ?, ?, '[]', ?)",
+		installId, versionId, reason, t,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	snapshotId, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	tables, err := packageTables(tx, installId)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, table := range tables {
+		_, err = tx.Exec(fmt.Sprintf(`CREATE TABLE %q AS SELECT * FROM %q`, snapshotTableName(snapshotId, table.Name), table.Name))
+		if err != nil {
+			return 0, fmt.Errorf("snapshot table %s: %w", table.Name, err)
+		}
+	}
+
+	_, err = tx.Exec(
+		fmt.Sprintf(`CREATE TABLE %q AS SELECT * FROM SpaceKV WHERE install_id = ?`, snapshotTableName(snapshotId, snapshotKVTable)),
+		installId,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	out, err := json.Marshal(tables)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec("UPDATE PackageSnapshots SET tables = ? WHERE id = ?", string(out), snapshotId)
+	if err != nil {
+		return 0, err
+	}
+
+	return snapshotId, tx.Commit()
+}
+
+// RestorePackageSnapshot puts package tables and kv back the way they were,
+// tables created after the snapshot are dropped
+func (d *PackageInstallOperations) RestorePackageSnapshot(id int64) error {
+	snapshot, err := d.GetPackageSnapshot(id)
+	if err != nil {
+		return err
+	}
+
+	saved := []dbmodels.PackageSnapshotTable{}
+	err = json.Unmarshal([]byte(snapshot.Tables), &saved)
+	if err != nil {
+		return err
+	}
+
+	driver := d.db.Driver().(*sql.DB)
+
+	tx, err := driver.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	current, err := packageTables(tx, snapshot.InstallId)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range current {
+		_, err = tx.Exec(fmt.Sprintf(`DROP TABLE IF EXISTS %q`, table.Name))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, table := range saved {
+		_, err = tx.Exec(table.Schema)
+		if err != nil {
+			return fmt.Errorf("recreate table %s: %w", table.Name, err)
+		}
+
+		_, err = tx.Exec(fmt.Sprintf(`INSERT INTO %q SELECT * FROM %q`, table.Name, snapshotTableName(id, table.Name)))
+		if err != nil {
+			return fmt.Errorf("restore table %s: %w", table.Name, err)
+		}
+
+		for _, index := range table.Indexes {
+			_, err = tx.Exec(index)
+			if err != nil {
+				return fmt.Errorf("restore index on %s: %w", table.Name, err)
+			}
+		}
+	}
+
+	_, err = tx.Exec("DELETE FROM SpaceKV WHERE install_id = ?", snapshot.InstallId)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(fmt.Sprintf(`INSERT INTO SpaceKV SELECT * FROM %q`, snapshotTableName(id, snapshotKVTable)))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (d *PackageInstallOperations) GetPackageSnapshot(id int64) (*dbmodels.PackageSnapshot, error) {
+	var snapshot dbmodels.PackageSnapshot
+	err := d.packageSnapshotsTable().Find(db.Cond{"id": id}).One(&snapshot)
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+func (d *PackageInstallOperations) ListPackageSnapshots(installId int64) ([]dbmodels.PackageSnapshot, error) {
+	var snapshots []dbmodels.PackageSnapshot
+	err := d.packageSnapshotsTable().Find(db.Cond{"install_id": installId}).OrderBy("-id").All(&snapshots)
+	if err != nil {
+		return nil, err
+	}
+	return snapshots, nil
+}
+
+func (d *PackageInstallOperations) DeletePackageSnapshot(id int64) error {
+	snapshot, err := d.GetPackageSnapshot(id)
+	if err != nil {
+		return err
+	}
+
+	saved := []dbmodels.PackageSnapshotTable{}
+	json.Unmarshal([]byte(snapshot.Tables), &saved)
+
+	driver := d.db.Driver().(*sql.DB)
+
+	tx, err := driver.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	saved = append(saved, dbmodels.PackageSnapshotTable{Name: snapshotKVTable})
+
+	for _, table := range saved {
+		_, err = tx.Exec(fmt.Sprintf(`DROP TABLE IF EXISTS %q`, snapshotTableName(id, table.Name)))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec("DELETE FROM PackageSnapshots WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (d *PackageInstallOperations) packageSnapshotsTable() db.Collection {
+	return d.db.Collection("PackageSnapshots")
+}
+
+func snapshotTableName(snapshotId int64, table string) string {
+	return fmt.Sprintf("zs_%d__%s", snapshotId, table)
+}
+
+// packageTables lists the regular tables a package owns with their schema
+// and indexes, the prefix is matched in go since _ is a LIKE wildcard
+func packageTables(tx *sql.Tx, installId int64) ([]dbmodels.PackageSnapshotTable, error) {
+	prefix := enforcer.TableName("P", strconv.FormatInt(installId, 10), "")
+
+	rows, err := tx.Query("SELECT name, sql FROM sqlite_master WHERE type = 'table' AND name LIKE ?", prefix+"%")
+	if err != nil {
+		return nil, err
+	}
+
+	tables := make([]dbmodels.PackageSnapshotTable, 0)
+	virtual := make([]string, 0)
+
+	for rows.Next() {
+		var name string
+		var schema sql.NullString
+		if err := rows.Scan(&name, &schema); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		if strings.Contains(strings.ToUpper(schema.String), "VIRTUAL TABLE") {
+			virtual = append(virtual, name)
+			continue
+		}
+
+		tables = append(tables, dbmodels.PackageSnapshotTable{Name: name, Schema: schema.String})
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make([]dbmodels.PackageSnapshotTable, 0, len(tables))
+
+	for _, table := range tables {
+		shadow := false
+		for _, v := range virtual {
+			if strings.HasPrefix(table.Name, v+"_") {
+				shadow = true
+				break
+			}
+		}
+		if shadow {
+			continue
+		}
+
+		indexes, err := tableIndexes(tx, table.Name)
+		if err != nil {
+			return nil, err
+		}
+		table.Indexes = indexes
+
+		result = append(result, table)
+	}
+
+	return result, nil
+}
+
+func tableIndexes(tx *sql.Tx, table string) ([]string, error) {
+	// auto indexes for unique constraints have no sql and come back with the table
+	rows, err := tx.Query("SELECT sql FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND sql IS NOT NULL", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	indexes := make([]string, 0)
+	for rows.Next() {
+		var index string
+		if err := rows.Scan(&index); err != nil {
+			return nil, err
+		}
+		indexes = append(indexes, index)
+	}
+
+	return indexes, rows.Err()
+}
@@ -0,0 +1,105 @@
+package ppackage
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/blue-monads/potatoverse/backend/services/datahub/database/schema"
+	"github.com/upper/db/v4/adapter/sqlite"
+)
+
+func setupSnapshotDB(t *testing.T) (*PackageInstallOperations, *sql.DB) {
+	sess, err := sqlite.Open(sqlite.ConnectionURL{
+		Database: filepath.Join(t.TempDir(), "snapshot.sqlite"),
+	})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { sess.Close() })
+
+	driver := sess.Driver().(*sql.DB)
+
+	_, err = driver.Exec(schema.Get())
+	if err != nil {
+		t.Fatalf("apply schema: %v", err)
+	}
+
+	return NewPackageInstallOperations(sess, nil), driver
+}
+
+func mustExec(t *testing.T, driver *sql.DB, query string, args ...any) {
+	t.Helper()
+	if _, err := driver.Exec(query, args...); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+}
+
+func countRows(t *testing.T, driver *sql.DB, query string, args ...any) int {
+	t.Helper()
+	var count int
+	if err := driver.QueryRow(query, args...).Scan(&count); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return count
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	ops, driver := setupSnapshotDB(t)
+
+	mustExec(t, driver, `CREATE TABLE zz_P__1__todos (id INTEGER PRIMARY KEY, title TEXT NOT NULL)`)
+	mustExec(t, driver, `CREATE INDEX zz_P__1__todos_title ON zz_P__1__todos (title)`)
+	mustExec(t, driver, `INSERT INTO zz_P__1__todos (title) VALUES ('a'), ('b')`)
+	// another package whose prefix matches the LIKE pattern of package 1
+	mustExec(t, driver, `CREATE TABLE zz_P__10__other (id INTEGER PRIMARY KEY)`)
+	mustExec(t, driver, `INSERT INTO SpaceKV (key, "group", value, install_id) VALUES ('m1', 'migrations', '001.sql', 1)`)
+
+	snapshotId, err := ops.SnapshotPackageData(1, 7, "upgrade")
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+
+	// what a bad upgrade could do
+	mustExec(t, driver, `ALTER TABLE zz_P__1__todos ADD COLUMN done INTEGER`)
+	mustExec(t, driver, `DELETE FROM zz_P__1__todos WHERE title = 'a'`)
+	mustExec(t, driver, `CREATE TABLE zz_P__1__tags (id INTEGER PRIMARY KEY)`)
+	mustExec(t, driver, `INSERT INTO SpaceKV (key, "group", value, install_id) VALUES ('m2', 'migrations', '002.sql', 1)`)
+
+	err = ops.RestorePackageSnapshot(snapshotId)
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+
+	if n := countRows(t, driver, `SELECT COUNT(*) FROM zz_P__1__todos`); n != 2 {
+		t.Fatalf("expected 2 todos, got %d", n)
+	}
+
+	if n := countRows(t, driver, `SELECT COUNT(*) FROM pragma_table_info('zz_P__1__todos') WHERE name = 'done'`); n != 0 {
+		t.Fatal("column added after the snapshot is still there")
+	}
+
+	if n := countRows(t, driver, `SELECT COUNT(*) FROM sqlite_master WHERE name = 'zz_P__1__tags'`); n != 0 {
+		t.Fatal("table created after the snapshot is still there")
+	}
+
+	if n := countRows(t, driver, `SELECT COUNT(*) FROM sqlite_master WHERE name = 'zz_P__1__todos_title'`); n != 1 {
+		t.Fatal("index was not restored")
+	}
+
+	if n := countRows(t, driver, `SELECT COUNT(*) FROM sqlite_master WHERE name = 'zz_P__10__other'`); n != 1 {
+		t.Fatal("restore touched another package")
+	}
+
+	if n := countRows(t, driver, `SELECT COUNT(*) FROM SpaceKV WHERE install_id = 1`); n != 1 {
+		t.Fatalf("expected 1 kv row, got %d", n)
+	}
+
+	err = ops.DeletePackageSnapshot(snapshotId)
+	if err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	if n := countRows(t, driver, `SELECT COUNT(*) FROM sqlite_master WHERE name LIKE 'zs_%'`); n != 0 {
+		t.Fatalf("expected snapshot tables to be dropped, %d left", n)
+	}
+}
@@ -0,0 +1,55 @@
+package schema
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// column is a column added to a table after it first shipped, schema.sql
+// only creates missing tables so databases made before need an ALTER
+type column struct {
+	table string
+	name  string
+	def   string
+}
+
+var addedColumns = []column{
+	{"MQSubscriptions", "collapse_mode", "TEXT NOT NULL DEFAULT 'latest'"},
+	{"MQEvents", "collapse_key", "TEXT NOT NULL DEFAULT ''"},
+	{"MQEventTargets", "collapsed_into", "INTEGER NOT NULL DEFAULT 0"},
+	{"PackageInstalls", "auto_upgrade", "BOOLEAN NOT NULL DEFAULT FALSE"},
+	{"PackageInstalls", "available_version", "TEXT NOT NULL DEFAULT ''"},
+	{"PackageInstalls", "update_checked_at", "TIMESTAMP"},
+	{"UserDevices", "prev_token_hash", "TEXT NOT NULL DEFAULT ''"},
+	{"UserDevices", "revoked_at", "TIMESTAMP NULL"},
+}
+
+// MigrateColumns adds the columns of addedColumns missing in the db
+func MigrateColumns(db *sql.DB) error {
+	for _, col := range addedColumns {
+		exists, err := hasColumn(db, col.table, col.name)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+
+		_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", col.table, col.name, col.def))
+		if err != nil {
+			return fmt.Errorf("add column %s.%s: %w", col.table, col.name, err)
+		}
+	}
+
+	return nil
+}
+
+func hasColumn(db *sql.DB, table, name string) (bool, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, name).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
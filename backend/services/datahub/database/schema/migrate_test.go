@@ -0,0 +1,61 @@
+package schema
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestMigrateColumns(t *testing.T) {
+	driver, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "migrate.sqlite"))
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { driver.Close() })
+
+	// tables as they were before the columns were added
+	_, err = driver.Exec(`
+CREATE TABLE MQSubscriptions (id INTEGER PRIMARY KEY AUTOINCREMENT, event_key TEXT NOT NULL);
+CREATE TABLE MQEvents (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL);
+CREATE TABLE MQEventTargets (id INTEGER PRIMARY KEY AUTOINCREMENT, event_id INTEGER NOT NULL, collapse_key TEXT NOT NULL DEFAULT '');
+CREATE TABLE PackageInstalls (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL DEFAULT '');
+CREATE TABLE UserDevices (id INTEGER PRIMARY KEY AUTOINCREMENT, token_hash TEXT NOT NULL DEFAULT '');
+INSERT INTO MQEvents (name) VALUES ('old');`)
+	if err != nil {
+		t.Fatalf("create old tables: %v", err)
+	}
+
+	_, err = driver.Exec(Get())
+	if err != nil {
+		t.Fatalf("apply schema: %v", err)
+	}
+
+	// twice, the second run must find every column in place
+	for range 2 {
+		err = MigrateColumns(driver)
+		if err != nil {
+			t.Fatalf("migrate: %v", err)
+		}
+	}
+
+	for _, col := range addedColumns {
+		exists, err := hasColumn(driver, col.table, col.name)
+		if err != nil {
+			t.Fatalf("check %s.%s: %v", col.table, col.name, err)
+		}
+		if !exists {
+			t.Errorf("%s.%s was not added", col.table, col.name)
+		}
+	}
+
+	var collapseKey string
+	err = driver.QueryRow(`SELECT collapse_key FROM MQEvents WHERE name = 'old'`).Scan(&collapseKey)
+	if err != nil {
+		t.Fatalf("read old row: %v", err)
+	}
+	if collapseKey != "" {
+		t.Errorf("old row collapse_key = %q, want empty", collapseKey)
+	}
+}
@@ -82,16 +82,30 @@ CREATE TABLE IF NOT EXISTS UserDevices (
   name TEXT NOT NULL DEFAULT '', 
   dtype TEXT NOT NULL DEFAULT 'sesssion', --  session token
   token_hash TEXT NOT NULL DEFAULT '', 
+  prev_token_hash TEXT NOT NULL DEFAULT '', -- refresh token before the last rotation
   user_id INTEGER NOT NULL, 
   last_ip TEXT NOT NULL DEFAULT '',
   last_login TEXT NOT NULL DEFAULT '',
   extrameta JSON NOT NULL DEFAULT '{}', 
   expires_on TIMESTAMP not null, 
+  revoked_at TIMESTAMP NULL,
   created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
   updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
   FOREIGN KEY (user_id) REFERENCES Users(id)
 );
 
+CREATE TABLE IF NOT EXISTS UserIdentities (
+  id INTEGER PRIMARY KEY AUTOINCREMENT, 
+  user_id INTEGER NOT NULL, 
+  provider TEXT NOT NULL, -- AppOptions.oidc[].name
+  subject TEXT NOT NULL, -- sub claim of the idp
+  email TEXT NOT NULL DEFAULT '',
+  last_login TIMESTAMP NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  unique(provider, subject),
+  FOREIGN KEY (user_id) REFERENCES Users(id)
+);
+
 CREATE TABLE IF NOT EXISTS UserMessages(
   id INTEGER PRIMARY KEY AUTOINCREMENT, 
   title text not null default '', 
@@ -121,7 +135,10 @@ CREATE TABLE IF NOT EXISTS PackageInstalls (
   installed_by INTEGER NOT NULL DEFAULT 0,
   installed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
   is_active BOOLEAN NOT NULL DEFAULT FALSE,
-  dev_token TEXT NOT NULL DEFAULT ''
+  dev_token TEXT NOT NULL DEFAULT '',
+  auto_upgrade BOOLEAN NOT NULL DEFAULT FALSE,
+  available_version TEXT NOT NULL DEFAULT '', -- newer repo version found by the update checker
+  update_checked_at TIMESTAMP
 );
 
 
@@ -143,6 +160,16 @@ CREATE TABLE IF NOT EXISTS PackageVersion (
   special_pages JSON NOT NULL DEFAULT '{}'
 );
 
+-- package data copied before an upgrade, tables are stored as zs_<id>__<table>
+CREATE TABLE IF NOT EXISTS PackageSnapshots (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  install_id INTEGER NOT NULL,
+  version_id INTEGER NOT NULL, -- PackageVersion active when the snapshot was taken
+  reason TEXT NOT NULL DEFAULT '', -- upgrade, rollback, manual
+  tables JSON NOT NULL DEFAULT '[]',
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
 
 
 CREATE TABLE IF NOT EXISTS Spaces (
@@ -191,6 +218,29 @@ CREATE TABLE IF NOT EXISTS SpaceUsers (
   unique(install_id, space_id, user_id)
 );
 
+CREATE TABLE IF NOT EXISTS OIDCClients (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  client_id TEXT NOT NULL,
+  secret_hash TEXT NOT NULL DEFAULT '', -- empty for public (pkce only) clients
+  name TEXT NOT NULL DEFAULT '',
+  install_id INTEGER NOT NULL,
+  space_id INTEGER NOT NULL,
+  redirect_uris JSON NOT NULL DEFAULT '[]',
+  scopes TEXT NOT NULL DEFAULT 'openid profile email',
+  owned_by INTEGER NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  unique(client_id)
+);
+
+CREATE TABLE IF NOT EXISTS OIDCConsents (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL,
+  client_id TEXT NOT NULL,
+  scopes TEXT NOT NULL DEFAULT '', -- space separated scopes the user agreed to
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  unique(user_id, client_id)
+);
+
 
 CREATE TABLE IF NOT EXISTS SpaceCapabilities (
   id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -226,6 +276,7 @@ CREATE TABLE IF NOT EXISTS MQSubscriptions (
   max_retries INTEGER NOT NULL DEFAULT 0,
   expires_on INTEGER NOT NULL DEFAULT 0, -- (created_at + expires_in > now) then status is expired
   collapse_interval INTEGER NOT NULL DEFAULT 0, -- 1 minute, 5 minute, 15 minute etc in seconds
+  collapse_mode TEXT NOT NULL DEFAULT 'latest', -- latest, list
   extrameta JSON NOT NULL DEFAULT '{}',
   created_by INTEGER NOT NULL DEFAULT 0,
   disabled BOOLEAN NOT NULL DEFAULT FALSE,
@@ -240,6 +291,7 @@ CREATE TABLE IF NOT EXISTS MQEvents (
   install_id INTEGER NOT NULL,
   name TEXT NOT NULL,
   payload BLOB NOT NULL,
+  collapse_key TEXT NOT NULL DEFAULT '',
   created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
   updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
   status TEXT NOT NULL DEFAULT 'new', -- new, scheduled, processed
@@ -251,7 +303,8 @@ CREATE TABLE IF NOT EXISTS MQEventTargets (
   collapse_key TEXT NOT NULL DEFAULT '',
   event_id INTEGER NOT NULL,
   subscription_id INTEGER NOT NULL,
-  status TEXT NOT NULL DEFAULT 'new', -- new, processing, start_delayed, delayed, processed, failed, expired
+  collapsed_into INTEGER NOT NULL DEFAULT 0, -- target delivering this one as part of a collapsed batch
+  status TEXT NOT NULL DEFAULT 'new', -- new, processing, start_delayed, delayed, processed, failed, dead, discarded, collapsed, expired
   delayed_until INTEGER NOT NULL DEFAULT 0,
   retry_count INTEGER NOT NULL DEFAULT 0,
   error TEXT NOT NULL DEFAULT '',
@@ -260,6 +313,18 @@ CREATE TABLE IF NOT EXISTS MQEventTargets (
   updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
 
+CREATE TABLE IF NOT EXISTS MQEventTargetAttempts (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  target_id INTEGER NOT NULL,
+  event_id INTEGER NOT NULL,
+  attempt INTEGER NOT NULL DEFAULT 0,
+  status TEXT NOT NULL DEFAULT '', -- success, error
+  error TEXT NOT NULL DEFAULT '',
+  response_code INTEGER NOT NULL DEFAULT 0,
+  duration_ms INTEGER NOT NULL DEFAULT 0,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
 
 CREATE TABLE IF NOT EXISTS SelfCDCMeta (
   id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -0,0 +1,99 @@
+package space
+
+import (
+	"github.com/blue-monads/potatoverse/backend/services/datahub/dbmodels"
+	"github.com/upper/db/v4"
+)
+
+func (d *SpaceOperations) ListOIDCClients(spaceId int64) ([]dbmodels.OIDCClient, error) {
+	datas := make([]dbmodels.OIDCClient, 0)
+
+	err := d.oidcClientTable().Find(db.Cond{"space_id": spaceId}).All(&datas)
+	if err != nil {
+		return nil, err
+	}
+
+	return datas, nil
+}
+
+func (d *SpaceOperations) GetOIDCClient(id int64) (*dbmodels.OIDCClient, error) {
+	data := &dbmodels.OIDCClient{}
+
+	err := d.oidcClientTable().Find(db.Cond{"id": id}).One(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (d *SpaceOperations) GetOIDCClientByClientId(clientId string) (*dbmodels.OIDCClient, error) {
+	data := &dbmodels.OIDCClient{}
+
+	err := d.oidcClientTable().Find(db.Cond{"client_id": clientId}).One(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (d *SpaceOperations) AddOIDCClient(data *dbmodels.OIDCClient) (int64, error) {
+	r, err := d.oidcClientTable().Insert(data)
+	if err != nil {
+		return 0, err
+	}
+
+	return r.ID().(int64), nil
+}
+
+func (d *SpaceOperations) UpdateOIDCClient(id int64, data map[string]any) error {
+	return d.oidcClientTable().Find(db.Cond{"id": id}).Update(data)
+}
+
+func (d *SpaceOperations) RemoveOIDCClient(id int64) error {
+	return d.oidcClientTable().Find(db.Cond{"id": id}).Delete()
+}
+
+func (d *SpaceOperations) oidcClientTable() db.Collection {
+	return d.db.Collection("OIDCClients")
+}
+
+func (d *SpaceOperations) GetOIDCConsent(userId int64, clientId string) (*dbmodels.OIDCConsent, error) {
+	data := &dbmodels.OIDCConsent{}
+
+	err := d.oidcConsentTable().Find(db.Cond{"user_id": userId, "client_id": clientId}).One(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (d *SpaceOperations) SetOIDCConsent(userId int64, clientId string, scopes string) error {
+	cond := db.Cond{"user_id": userId, "client_id": clientId}
+
+	exists, err := d.oidcConsentTable().Find(cond).Exists()
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return d.oidcConsentTable().Find(cond).Update(map[string]any{"scopes": scopes})
+	}
+
+	_, err = d.oidcConsentTable().Insert(&dbmodels.OIDCConsent{
+		UserID:   userId,
+		ClientId: clientId,
+		Scopes:   scopes,
+	})
+	return err
+}
+
+func (d *SpaceOperations) RemoveOIDCConsents(clientId string) error {
+	return d.oidcConsentTable().Find(db.Cond{"client_id": clientId}).Delete()
+}
+
+func (d *SpaceOperations) oidcConsentTable() db.Collection {
+	return d.db.Collection("OIDCConsents")
+}
@@ -0,0 +1,87 @@
+package user
+
+import (
+	"github.com/blue-monads/potatoverse/backend/services/datahub/dbmodels"
+	"github.com/upper/db/v4"
+)
+
+// user config
+
+func (d *UserOperations) GetUserConfig(userId int64, group string, key string) (string, error) {
+	data := &dbmodels.UserConfig{}
+
+	err := d.userConfigTable().Find(db.Cond{"user_id": userId, "group": group, "key": key}).One(data)
+	if err != nil {
+		return "", err
+	}
+
+	return data.Value, nil
+}
+
+func (d *UserOperations) SetUserConfig(userId int64, group string, key string, value string) error {
+	cond := db.Cond{"user_id": userId, "group": group, "key": key}
+
+	exists, err := d.userConfigTable().Find(cond).Exists()
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return d.userConfigTable().Find(cond).Update(map[string]any{"value": value})
+	}
+
+	_, err = d.userConfigTable().Insert(&dbmodels.UserConfig{
+		UserId: userId,
+		Group:  group,
+		Key:    key,
+		Value:  value,
+	})
+
+	return err
+}
+
+func (d *UserOperations) DeleteUserConfig(userId int64, group string, key string) error {
+	return d.userConfigTable().Find(db.Cond{"user_id": userId, "group": group, "key": key}).Delete()
+}
+
+// user group config
+
+func (d *UserOperations) GetUserGroupConfig(group string, key string) (string, error) {
+	data := &dbmodels.UserGroupConfig{}
+
+	err := d.userGroupConfigTable().Find(db.Cond{"group": group, "key": key}).One(data)
+	if err != nil {
+		return "", err
+	}
+
+	return data.Value, nil
+}
+
+func (d *UserOperations) SetUserGroupConfig(group string, key string, value string) error {
+	cond := db.Cond{"group": group, "key": key}
+
+	exists, err := d.userGroupConfigTable().Find(cond).Exists()
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return d.userGroupConfigTable().Find(cond).Update(map[string]any{"value": value})
+	}
+
+	_, err = d.userGroupConfigTable().Insert(&dbmodels.UserGroupConfig{
+		Group: group,
+		Key:   key,
+		Value: value,
+	})
+
+	return err
+}
+
+func (d *UserOperations) userConfigTable() db.Collection {
+	return d.db.Collection("UserConfig")
+}
+
+func (d *UserOperations) userGroupConfigTable() db.Collection {
+	return d.db.Collection("UserGroupConfig")
+}
@@ -5,11 +5,24 @@ import (
 	"github.com/upper/db/v4"
 )
 
+// ListUserDevice lists devices that are not revoked
 func (d *UserOperations) ListUserDevice(userId int64) ([]dbmodels.UserDevice, error) {
 
 	devices := make([]dbmodels.UserDevice, 0)
 
-	err := d.deviceTable().Find(db.Cond{"user_id": userId}).All(&devices)
+	err := d.deviceTable().Find(db.Cond{"user_id": userId, "revoked_at IS": nil}).All(&devices)
+	if err != nil {
+		return nil, err
+	}
+
+	return devices, nil
+}
+
+func (d *UserOperations) ListRevokedUserDevices() ([]dbmodels.UserDevice, error) {
+
+	devices := make([]dbmodels.UserDevice, 0)
+
+	err := d.deviceTable().Find(db.Cond{"revoked_at IS NOT": nil}).All(&devices)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,49 @@
+package user
+
+import (
+	"github.com/blue-monads/potatoverse/backend/services/datahub/dbmodels"
+	"github.com/upper/db/v4"
+)
+
+func (d *UserOperations) GetUserIdentity(provider string, subject string) (*dbmodels.UserIdentity, error) {
+	data := &dbmodels.UserIdentity{}
+
+	err := d.identityTable().Find(db.Cond{"provider": provider, "subject": subject}).One(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (d *UserOperations) ListUserIdentities(userId int64) ([]dbmodels.UserIdentity, error) {
+	identities := make([]dbmodels.UserIdentity, 0)
+
+	err := d.identityTable().Find(db.Cond{"user_id": userId}).All(&identities)
+	if err != nil {
+		return nil, err
+	}
+
+	return identities, nil
+}
+
+func (d *UserOperations) AddUserIdentity(data *dbmodels.UserIdentity) (int64, error) {
+	r, err := d.identityTable().Insert(data)
+	if err != nil {
+		return 0, err
+	}
+
+	return r.ID().(int64), nil
+}
+
+func (d *UserOperations) UpdateUserIdentity(id int64, data map[string]any) error {
+	return d.identityTable().Find(db.Cond{"id": id}).Update(data)
+}
+
+func (d *UserOperations) DeleteUserIdentity(userId int64, id int64) error {
+	return d.identityTable().Find(db.Cond{"id": id, "user_id": userId}).Delete()
+}
+
+func (d *UserOperations) identityTable() db.Collection {
+	return d.db.Collection("UserIdentities")
+}
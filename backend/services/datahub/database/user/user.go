@@ -52,6 +52,18 @@ func (d *UserOperations) GetUserByEmail(email string) (*dbmodels.User, error) {
 	return data, nil
 }
 
+func (d *UserOperations) GetUserByPhone(phone string) (*dbmodels.User, error) {
+
+	data := &dbmodels.User{}
+
+	err := d.userTable().Find(db.Cond{"phone": phone}).One(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
 func (d *UserOperations) GetUserByUsername(username string) (*dbmodels.User, error) {
 
 	data := &dbmodels.User{}
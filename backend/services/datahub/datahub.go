@@ -65,13 +65,27 @@ type UserOps interface {
 	GetUser(id int64) (*dbmodels.User, error)
 	GetUserByEmail(email string) (*dbmodels.User, error)
 	GetUserByUsername(username string) (*dbmodels.User, error)
+	GetUserByPhone(phone string) (*dbmodels.User, error)
 	ListUser(offset int, limit int) ([]dbmodels.User, error)
 	ListUserByCond(cond map[any]any, offset int, limit int) ([]dbmodels.User, error)
 	ListUserByOwner(owner int64) ([]dbmodels.User, error)
 	UpdateUser(id int64, data map[string]any) error
 	DeleteUser(id int64) error
 
+	GetUserConfig(userId int64, group string, key string) (string, error)
+	SetUserConfig(userId int64, group string, key string, value string) error
+	DeleteUserConfig(userId int64, group string, key string) error
+	GetUserGroupConfig(group string, key string) (string, error)
+	SetUserGroupConfig(group string, key string, value string) error
+
+	GetUserIdentity(provider string, subject string) (*dbmodels.UserIdentity, error)
+	ListUserIdentities(userId int64) ([]dbmodels.UserIdentity, error)
+	AddUserIdentity(data *dbmodels.UserIdentity) (int64, error)
+	UpdateUserIdentity(id int64, data map[string]any) error
+	DeleteUserIdentity(userId int64, id int64) error
+
 	ListUserDevice(userId int64) ([]dbmodels.UserDevice, error)
+	ListRevokedUserDevices() ([]dbmodels.UserDevice, error)
 	GetUserDevice(id int64) (*dbmodels.UserDevice, error)
 	GetUserDeviceByTokenHash(userId int64, tokenHash string) (*dbmodels.UserDevice, error)
 	AddUserDevice(data *dbmodels.UserDevice) (int64, error)
@@ -118,6 +132,12 @@ type PackageInstallOps interface {
 	GetPackageVersion(id int64) (*dbmodels.PackageVersion, error)
 	DeletePackageVersion(id int64) error
 	AddPackageVersion(installId int64, file string) (int64, error)
+
+	SnapshotPackageData(installId int64, versionId int64, reason string) (int64, error)
+	RestorePackageSnapshot(id int64) error
+	GetPackageSnapshot(id int64) (*dbmodels.PackageSnapshot, error)
+	ListPackageSnapshots(installId int64) ([]dbmodels.PackageSnapshot, error)
+	DeletePackageSnapshot(id int64) error
 }
 
 type SpaceOps interface {
@@ -159,6 +179,17 @@ type SpaceOps interface {
 	UpdateSpaceUser(installId int64, id int64, data map[string]any) error
 	RemoveSpaceUser(installId int64, id int64) error
 
+	// OIDC Clients
+	ListOIDCClients(spaceId int64) ([]dbmodels.OIDCClient, error)
+	GetOIDCClient(id int64) (*dbmodels.OIDCClient, error)
+	GetOIDCClientByClientId(clientId string) (*dbmodels.OIDCClient, error)
+	AddOIDCClient(data *dbmodels.OIDCClient) (int64, error)
+	UpdateOIDCClient(id int64, data map[string]any) error
+	RemoveOIDCClient(id int64) error
+	GetOIDCConsent(userId int64, clientId string) (*dbmodels.OIDCConsent, error)
+	SetOIDCConsent(userId int64, clientId string, scopes string) error
+	RemoveOIDCConsents(clientId string) error
+
 	// Event Subscriptions
 
 	QueryAllEventSubscriptions(includeDisabled bool) ([]dbmodels.MQSubscriptionLite, error)
@@ -299,15 +330,18 @@ type DBLowCoreOps interface {
 }
 
 type MQSynk interface {
-	AddEvent(installId int64, name string, payload []byte) (int64, error)
+	AddEvent(installId int64, name string, collapseKey string, payload []byte) (int64, error)
 	GetEvent(id int64) (*dbmodels.MQEvent, error)
 	UpdateEvent(id int64, data map[string]any) error
 
 	QueryNewEvents() ([]int64, error)
 	CreateEventTargets(eventId int64) ([]int64, error)
-	QueryNewEventTargets() ([]int64, error)
-	QueryDelayExpiredTargets() ([]int64, error)
+	QueryNewEventTargets() ([]dbmodels.MQEventTargetRef, error)
+	QueryDelayExpiredTargets() ([]dbmodels.MQEventTargetRef, error)
+	QueryNextDelayedAt() (int64, error)
 	QueryEventTargetsByEventId(eventId int64) ([]int64, error)
+	ListCollapsedTargets(leaderId int64) ([]dbmodels.MQEventTarget, error)
+	GetEventTarget(id int64) (*dbmodels.MQEventTarget, error)
 	UpdateEventTarget(id int64, data map[string]any) error
 
 	TransitionTargetStart(targetId int64) (*dbmodels.MQEventTarget, error)
@@ -315,4 +349,12 @@ type MQSynk interface {
 	TransitionTargetDelay(targetId int64, eventId, delay, retryCount int64) error
 	TransitionTargetComplete(eventId, targetId int64) error
 	TransitionTargetFail(eventId, targetId int64, error string) error
+	TransitionTargetDead(eventId, targetId int64, error string) error
+
+	AddTargetAttempt(attempt *dbmodels.MQEventTargetAttempt) error
+	ListTargetAttempts(targetId int64) ([]dbmodels.MQEventTargetAttempt, error)
+
+	QueryDeadTargets(installId, subscriptionId int64, offset, limit int) ([]dbmodels.MQEventTarget, error)
+	ReplayDeadTargets(installId, subscriptionId int64, targetIds []int64) ([]int64, error)
+	DiscardDeadTargets(installId, subscriptionId int64, targetIds []int64) ([]int64, error)
 }
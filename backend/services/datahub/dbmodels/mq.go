@@ -3,26 +3,47 @@ package dbmodels
 import "time"
 
 type MQEvent struct {
-	ID        int64     `json:"id" db:"id,omitempty"`
-	InstallID int64     `json:"install_id" db:"install_id"`
-	Name      string    `json:"name" db:"name"`
-	Payload   []byte    `json:"payload" db:"payload"`
-	Status    string    `json:"status" db:"status"`
-	CreatedAt time.Time `json:"created_at" db:"created_at,omitempty"`
-	UpdatedAt time.Time `json:"updated_at" db:"updated_at,omitempty"`
+	ID          int64     `json:"id" db:"id,omitempty"`
+	InstallID   int64     `json:"install_id" db:"install_id"`
+	Name        string    `json:"name" db:"name"`
+	Payload     []byte    `json:"payload" db:"payload"`
+	CollapseKey string    `json:"collapse_key" db:"collapse_key"`
+	Status      string    `json:"status" db:"status"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at,omitempty"`
 }
 
 type MQEventTarget struct {
 	ID             int64     `json:"id" db:"id,omitempty"`
 	EventID        int64     `json:"event_id" db:"event_id"`
 	SubscriptionID int64     `json:"subscription_id" db:"subscription_id"`
+	CollapseKey    string    `json:"collapse_key" db:"collapse_key"`
+	CollapsedInto  int64     `json:"collapsed_into" db:"collapsed_into"`
 	Status         string    `json:"status" db:"status"`
 	DelayedUntil   int64     `json:"delayed_until" db:"delayed_until"`
 	RetryCount     int64     `json:"retry_count" db:"retry_count"`
+	Error          string    `json:"error" db:"error"`
 	CreatedAt      time.Time `json:"created_at" db:"created_at,omitempty"`
 	UpdatedAt      time.Time `json:"updated_at" db:"updated_at,omitempty"`
 }
 
+type MQEventTargetRef struct {
+	ID        int64 `json:"id" db:"id"`
+	InstallID int64 `json:"install_id" db:"install_id"`
+}
+
+type MQEventTargetAttempt struct {
+	ID           int64     `json:"id" db:"id,omitempty"`
+	TargetID     int64     `json:"target_id" db:"target_id"`
+	EventID      int64     `json:"event_id" db:"event_id"`
+	Attempt      int64     `json:"attempt" db:"attempt"`
+	Status       string    `json:"status" db:"status"` // success, error
+	Error        string    `json:"error" db:"error"`
+	ResponseCode int64     `json:"response_code" db:"response_code"`
+	DurationMs   int64     `json:"duration_ms" db:"duration_ms"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at,omitempty"`
+}
+
 type MQSubscription struct {
 	ID             int64  `json:"id" db:"id,omitempty"`
 	InstallID      int64  `json:"install_id" db:"install_id"`
@@ -39,6 +60,9 @@ type MQSubscription struct {
 	MaxRetries     int64  `json:"max_retries" db:"max_retries"`
 	TargetSpaceID  int64  `json:"target_space_id" db:"target_space_id"`
 
+	CollapseInterval int64  `json:"collapse_interval" db:"collapse_interval"`
+	CollapseMode     string `json:"collapse_mode" db:"collapse_mode"` // latest, list
+
 	ExtraMeta string     `json:"extrameta" db:"extrameta,omitempty"` // JSON
 	CreatedBy int64      `json:"created_by" db:"created_by"`
 	Disabled  bool       `json:"disabled" db:"disabled"`
@@ -47,8 +71,9 @@ type MQSubscription struct {
 }
 
 type MQSubscriptionLite struct {
-	ID        int64  `json:"id" db:"id,omitempty"`
-	InstallID int64  `json:"install_id" db:"install_id"`
-	SpaceID   int64  `json:"space_id" db:"space_id"`
-	EventKey  string `json:"event_key" db:"event_key"`
+	ID               int64  `json:"id" db:"id,omitempty"`
+	InstallID        int64  `json:"install_id" db:"install_id"`
+	SpaceID          int64  `json:"space_id" db:"space_id"`
+	EventKey         string `json:"event_key" db:"event_key"`
+	CollapseInterval int64  `json:"collapse_interval" db:"collapse_interval"`
 }
@@ -3,17 +3,20 @@ package dbmodels
 import "time"
 
 type InstalledPackage struct {
-	ID              int64      `json:"id" db:"id,omitempty"`
-	Slug            string     `json:"slug" db:"slug"`
-	Name            string     `json:"name" db:"name"`
-	InstallRepo     string     `json:"install_repo" db:"install_repo"`
-	CanonicalUrl    string     `json:"canonical_url" db:"canonical_url,omitempty"`
-	StorageType     string     `json:"storage_type" db:"storage_type"`
-	ActiveInstallID int64      `json:"active_install_id" db:"active_install_id"`
-	EnvVars         string     `json:"env_vars" db:"env_vars"`
-	InstalledBy     int64      `json:"installed_by" db:"installed_by"`
-	InstalledAt     *time.Time `json:"installed_at" db:"installed_at,omitempty"`
-	DevToken        string     `json:"dev_token" db:"dev_token"`
+	ID               int64      `json:"id" db:"id,omitempty"`
+	Slug             string     `json:"slug" db:"slug"`
+	Name             string     `json:"name" db:"name"`
+	InstallRepo      string     `json:"install_repo" db:"install_repo"`
+	CanonicalUrl     string     `json:"canonical_url" db:"canonical_url,omitempty"`
+	StorageType      string     `json:"storage_type" db:"storage_type"`
+	ActiveInstallID  int64      `json:"active_install_id" db:"active_install_id"`
+	EnvVars          string     `json:"env_vars" db:"env_vars"`
+	InstalledBy      int64      `json:"installed_by" db:"installed_by"`
+	InstalledAt      *time.Time `json:"installed_at" db:"installed_at,omitempty"`
+	DevToken         string     `json:"dev_token" db:"dev_token"`
+	AutoUpgrade      bool       `json:"auto_upgrade" db:"auto_upgrade"`
+	AvailableVersion string     `json:"available_version" db:"available_version"`
+	UpdateCheckedAt  *time.Time `json:"update_checked_at" db:"update_checked_at,omitempty"`
 }
 
 type PackageVersion struct {
@@ -32,3 +35,19 @@ type PackageVersion struct {
 	Version       string `json:"version" db:"version"`
 	SpecialPages  string `json:"special_pages" db:"special_pages,omitempty"`
 }
+
+type PackageSnapshot struct {
+	ID        int64      `json:"id" db:"id,omitempty"`
+	InstallId int64      `json:"install_id" db:"install_id"`
+	VersionId int64      `json:"version_id" db:"version_id"`
+	Reason    string     `json:"reason" db:"reason"`
+	Tables    string     `json:"tables" db:"tables"`
+	CreatedAt *time.Time `json:"created_at" db:"created_at,omitempty"`
+}
+
+// PackageSnapshotTable is one package table inside PackageSnapshot.Tables
+type PackageSnapshotTable struct {
+	Name    string   `json:"name"`
+	Schema  string   `json:"schema"`
+	Indexes []string `json:"indexes,omitempty"`
+}
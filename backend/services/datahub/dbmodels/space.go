@@ -33,6 +33,31 @@ type SpaceUser struct {
 	ExtraMeta string `json:"extrameta" db:"extrameta,omitempty"`
 }
 
+// OIDCClient is an app allowed to log users in through the platform's
+// openid connect provider on behalf of a space
+type OIDCClient struct {
+	ID           int64      `json:"id" db:"id,omitempty"`
+	ClientId     string     `json:"client_id" db:"client_id"`
+	SecretHash   string     `json:"-" db:"secret_hash"`
+	Name         string     `json:"name" db:"name"`
+	InstallID    int64      `json:"install_id" db:"install_id"`
+	SpaceID      int64      `json:"space_id" db:"space_id"`
+	RedirectURIs string     `json:"redirect_uris" db:"redirect_uris"`
+	Scopes       string     `json:"scopes" db:"scopes"`
+	OwnedBy      int64      `json:"owned_by" db:"owned_by"`
+	CreatedAt    *time.Time `json:"created_at" db:"created_at,omitempty"`
+}
+
+// OIDCConsent is the scopes a user agreed to share with an OIDCClient,
+// kept apart from SpaceUsers so consenting never makes one a member
+type OIDCConsent struct {
+	ID        int64      `json:"id" db:"id,omitempty"`
+	UserID    int64      `json:"user_id" db:"user_id"`
+	ClientId  string     `json:"client_id" db:"client_id"`
+	Scopes    string     `json:"scopes" db:"scopes"`
+	CreatedAt *time.Time `json:"created_at" db:"created_at,omitempty"`
+}
+
 type SpaceTypes struct {
 	Name        string   `json:"name"`
 	Ptype       string   `json:"ptype"`
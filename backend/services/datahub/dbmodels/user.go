@@ -9,6 +9,13 @@ type UserGroup struct {
 	UpdatedAt *time.Time `json:"updated_at" db:"updated_at,omitempty"`
 }
 
+type UserGroupConfig struct {
+	ID    int64  `json:"id" db:"id,omitempty"`
+	Key   string `json:"key" db:"key"`
+	Group string `json:"group" db:"group"`
+	Value string `json:"value" db:"value"`
+}
+
 type User struct {
 	ID              int64      `json:"id" db:"id,omitempty"`
 	Name            string     `json:"name" db:"name"`
@@ -29,6 +36,14 @@ type User struct {
 	IsDeleted       bool       `json:"is_deleted" db:"is_deleted,omitempty"`
 }
 
+type UserConfig struct {
+	ID     int64  `json:"id" db:"id,omitempty"`
+	Key    string `json:"key" db:"key"`
+	Group  string `json:"group" db:"group"`
+	Value  string `json:"value" db:"value"`
+	UserId int64  `json:"user_id" db:"user_id"`
+}
+
 type UserMessage struct {
 	ID            int64      `json:"id" db:"id,omitempty"`
 	Title         string     `json:"title" db:"title"`
@@ -44,17 +59,30 @@ type UserMessage struct {
 }
 
 type UserDevice struct {
+	ID            int64      `json:"id" db:"id,omitempty"`
+	Name          string     `json:"name" db:"name"`
+	Dtype         string     `json:"dtype" db:"dtype"`
+	TokenHash     string     `json:"token_hash" db:"token_hash"`
+	PrevTokenHash string     `json:"-" db:"prev_token_hash,omitempty"`
+	UserId        int64      `json:"user_id" db:"user_id"`
+	LastIp        string     `json:"last_ip" db:"last_ip"`
+	LastLogin     string     `json:"last_login" db:"last_login"`
+	ExtraMeta     string     `json:"extrameta" db:"extrameta,omitempty"`
+	ExpiresOn     *time.Time `json:"expires_on" db:"expires_on,omitempty"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty" db:"revoked_at,omitempty"`
+	CreatedAt     *time.Time `json:"created_at" db:"created_at,omitempty"`
+	UpdatedAt     *time.Time `json:"updated_at" db:"updated_at,omitempty"`
+}
+
+// UserIdentity links a user to an external sso (oidc) account
+type UserIdentity struct {
 	ID        int64      `json:"id" db:"id,omitempty"`
-	Name      string     `json:"name" db:"name"`
-	Dtype     string     `json:"dtype" db:"dtype"`
-	TokenHash string     `json:"token_hash" db:"token_hash"`
 	UserId    int64      `json:"user_id" db:"user_id"`
-	LastIp    string     `json:"last_ip" db:"last_ip"`
-	LastLogin string     `json:"last_login" db:"last_login"`
-	ExtraMeta string     `json:"extrameta" db:"extrameta,omitempty"`
-	ExpiresOn *time.Time `json:"expires_on" db:"expires_on,omitempty"`
+	Provider  string     `json:"provider" db:"provider"`
+	Subject   string     `json:"subject" db:"subject"`
+	Email     string     `json:"email" db:"email"`
+	LastLogin *time.Time `json:"last_login" db:"last_login,omitempty"`
 	CreatedAt *time.Time `json:"created_at" db:"created_at,omitempty"`
-	UpdatedAt *time.Time `json:"updated_at" db:"updated_at,omitempty"`
 }
 
 type UserInvite struct {
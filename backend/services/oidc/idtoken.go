@@ -0,0 +1,230 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// clock skew allowed on exp and iat
+const leeway = time.Minute
+
+type Claims struct {
+	Subject           string `json:"sub"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"-"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+	Nonce             string `json:"nonce"`
+
+	// all claims of the token (and userinfo once merged), for group claims
+	Raw map[string]any `json:"-"`
+}
+
+// Strings returns a claim holding a string or a list of strings, eg. groups
+func (c *Claims) Strings(name string) []string {
+	switch v := c.Raw[name].(type) {
+	case string:
+		return []string{v}
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// Merge adds userinfo claims the id token did not carry
+func (c *Claims) Merge(userinfo map[string]any) {
+	if userinfo == nil {
+		return
+	}
+
+	// userinfo of another subject must never be mixed in
+	if sub, _ := userinfo["sub"].(string); sub != c.Subject {
+		return
+	}
+
+	for k, v := range userinfo {
+		if _, ok := c.Raw[k]; !ok {
+			c.Raw[k] = v
+		}
+	}
+	c.fill()
+}
+
+func (c *Claims) fill() {
+	c.Subject, _ = c.Raw["sub"].(string)
+	c.Email, _ = c.Raw["email"].(string)
+	c.Name, _ = c.Raw["name"].(string)
+	c.PreferredUsername, _ = c.Raw["preferred_username"].(string)
+	c.Nonce, _ = c.Raw["nonce"].(string)
+
+	// some providers send email_verified as a string
+	switch v := c.Raw["email_verified"].(type) {
+	case bool:
+		c.EmailVerified = v
+	case string:
+		c.EmailVerified = v == "true"
+	}
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// VerifyIDToken checks the id token signature against the provider jwks and
+// its issuer, audience, expiry and nonce
+func (p *Provider) VerifyIDToken(ctx context.Context, raw string, nonce string) (*Claims, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed", ErrInvalidIDToken)
+	}
+
+	header := &jwtHeader{}
+	err := decodeSegment(parts[0], header)
+	if err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrInvalidIDToken, err)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %v", ErrInvalidIDToken, err)
+	}
+
+	key, err := p.signingKey(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	err = verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), sig)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &Claims{Raw: make(map[string]any)}
+	err = decodeSegment(parts[1], &claims.Raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: payload: %v", ErrInvalidIDToken, err)
+	}
+	claims.fill()
+
+	err = p.validateClaims(claims, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (p *Provider) validateClaims(claims *Claims, nonce string) error {
+	iss, _ := claims.Raw["iss"].(string)
+	if strings.TrimSuffix(iss, "/") != p.opts.Issuer {
+		return fmt.Errorf("%w: issuer %q", ErrInvalidIDToken, iss)
+	}
+
+	if claims.Subject == "" {
+		return fmt.Errorf("%w: no subject", ErrInvalidIDToken)
+	}
+
+	audiences := claims.Strings("aud")
+	found := false
+	for _, aud := range audiences {
+		if aud == p.opts.ClientId {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("%w: audience", ErrInvalidIDToken)
+	}
+
+	if len(audiences) > 1 {
+		azp, _ := claims.Raw["azp"].(string)
+		if azp != p.opts.ClientId {
+			return fmt.Errorf("%w: authorized party", ErrInvalidIDToken)
+		}
+	}
+
+	now := time.Now()
+
+	exp, ok := claims.Raw["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(exp), 0).Add(leeway)) {
+		return fmt.Errorf("%w: expired", ErrInvalidIDToken)
+	}
+
+	if iat, ok := claims.Raw["iat"].(float64); ok && time.Unix(int64(iat), 0).After(now.Add(leeway)) {
+		return fmt.Errorf("%w: issued in the future", ErrInvalidIDToken)
+	}
+
+	if nonce != "" && claims.Nonce != nonce {
+		return fmt.Errorf("%w: nonce", ErrInvalidIDToken)
+	}
+
+	return nil
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed, sig []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "ES512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("%w: unsupported alg %q", ErrInvalidIDToken, alg)
+	}
+
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if alg[0] != 'R' {
+			break
+		}
+		if rsa.VerifyPKCS1v15(k, hash, digest, sig) != nil {
+			return fmt.Errorf("%w: bad signature", ErrInvalidIDToken)
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		if alg[0] != 'E' {
+			break
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return fmt.Errorf("%w: bad signature", ErrInvalidIDToken)
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return fmt.Errorf("%w: bad signature", ErrInvalidIDToken)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("%w: key does not match alg %q", ErrInvalidIDToken, alg)
+}
+
+func decodeSegment(seg string, out any) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
@@ -0,0 +1,129 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+)
+
+/*
+
+issuer side, used when the platform itself is the openid connect provider
+(login with potatoverse). id tokens are RS256 signed with one rsa key, its
+kid is derived from the public key so it stays stable across restarts.
+
+*/
+
+var ErrInvalidSigningKey = errors.New("invalid oidc signing key")
+
+type SigningKey struct {
+	key *rsa.PrivateKey
+	kid string
+}
+
+// JWKS is the json web key set document served at the jwks_uri
+type JWKS struct {
+	Keys []jwk `json:"keys"`
+}
+
+func NewSigningKey() (*SigningKey, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSigningKey(key)
+}
+
+// ParseSigningKey reads a key written by PEM
+func ParseSigningKey(data string) (*SigningKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, ErrInvalidSigningKey
+	}
+
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, ErrInvalidSigningKey
+	}
+
+	return newSigningKey(key)
+}
+
+func newSigningKey(key *rsa.PrivateKey) (*SigningKey, error) {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha256.Sum256(der)
+
+	return &SigningKey{
+		key: key,
+		kid: base64.RawURLEncoding.EncodeToString(h[:16]),
+	}, nil
+}
+
+func (k *SigningKey) PEM() string {
+	return string(pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(k.key),
+	}))
+}
+
+func (k *SigningKey) KeyId() string {
+	return k.kid
+}
+
+func (k *SigningKey) JWKS() *JWKS {
+	return &JWKS{
+		Keys: []jwk{{
+			Kty: "RSA",
+			Kid: k.kid,
+			Use: "sig",
+			Alg: "RS256",
+			N:   base64.RawURLEncoding.EncodeToString(k.key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.key.E)).Bytes()),
+		}},
+	}
+}
+
+// Sign returns the claims as an RS256 jwt
+func (k *SigningKey) Sign(claims map[string]any) (string, error) {
+	header, err := json.Marshal(map[string]any{"alg": "RS256", "kid": k.kid, "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	h := sha256.Sum256([]byte(signed))
+
+	sig, err := rsa.SignPKCS1v15(rand.Reader, k.key, crypto.SHA256, h[:])
+	if err != nil {
+		return "", err
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// VerifyPKCE checks a code verifier against the S256 challenge it was
+// issued for
+func VerifyPKCE(verifier, challenge string) bool {
+	if verifier == "" || challenge == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(PKCEChallenge(verifier)), []byte(challenge)) == 1
+}
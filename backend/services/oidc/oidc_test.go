@@ -0,0 +1,275 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mockIdP is a tiny openid provider issuing rs256 id tokens
+type mockIdP struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	claims map[string]any
+
+	// code -> pkce challenge it was issued for
+	codes map[string]string
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &mockIdP{t: t, key: key, codes: make(map[string]string)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                 m.server.URL,
+			"authorization_endpoint": m.server.URL + "/auth",
+			"token_endpoint":         m.server.URL + "/token",
+			"userinfo_endpoint":      m.server.URL + "/userinfo",
+			"jwks_uri":               m.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]any{{
+				"kty": "RSA",
+				"kid": "k1",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "client" || secret != "secret" {
+			http.Error(w, "bad client", http.StatusUnauthorized)
+			return
+		}
+
+		challenge, ok := m.codes[r.Form.Get("code")]
+		h := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(h[:]) != challenge {
+			http.Error(w, "bad code", http.StatusBadRequest)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "at",
+			"token_type":   "Bearer",
+			"id_token":     m.sign(m.claims),
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"sub":    m.claims["sub"],
+			"groups": []string{"staff"},
+		})
+	})
+
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+
+	return m
+}
+
+func (m *mockIdP) sign(claims map[string]any) string {
+	header, _ := json.Marshal(map[string]any{"alg": "RS256", "kid": "k1", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	h := sha256.Sum256([]byte(signed))
+
+	sig, err := rsa.SignPKCS1v15(rand.Reader, m.key, crypto.SHA256, h[:])
+	if err != nil {
+		m.t.Fatal(err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func (m *mockIdP) provider() *Provider {
+	return New(Options{
+		Issuer:       m.server.URL,
+		ClientId:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost/callback",
+		Scopes:       []string{"email", "profile"},
+	})
+}
+
+func (m *mockIdP) baseClaims(nonce string) map[string]any {
+	return map[string]any{
+		"iss":            m.server.URL,
+		"sub":            "user-1",
+		"aud":            "client",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          nonce,
+		"email":          "a@example.com",
+		"email_verified": true,
+	}
+}
+
+func TestLoginFlow(t *testing.T) {
+	idp := newMockIdP(t)
+	p := idp.provider()
+	ctx := context.Background()
+
+	verifier, _ := RandomString()
+	authURL, err := p.AuthURL(ctx, "state1", "nonce1", PKCEChallenge(verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, _ := url.Parse(authURL)
+	q := u.Query()
+	if q.Get("scope") != "openid email profile" || q.Get("code_challenge_method") != "S256" || q.Get("state") != "state1" {
+		t.Fatalf("unexpected auth url %s", authURL)
+	}
+
+	idp.codes["code1"] = q.Get("code_challenge")
+	idp.claims = idp.baseClaims("nonce1")
+
+	tokens, err := p.Exchange(ctx, "code1", verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := p.VerifyIDToken(ctx, tokens.IDToken, "nonce1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "user-1" || claims.Email != "a@example.com" || !claims.EmailVerified {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+
+	info, err := p.UserInfo(ctx, tokens.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims.Merge(info)
+	if groups := claims.Strings("groups"); len(groups) != 1 || groups[0] != "staff" {
+		t.Fatalf("unexpected groups %v", groups)
+	}
+
+	// wrong pkce verifier
+	_, err = p.Exchange(ctx, "code1", "other")
+	if !errors.Is(err, ErrTokenExchange) {
+		t.Fatalf("expected exchange error, got %v", err)
+	}
+}
+
+func TestVerifyIDTokenRejects(t *testing.T) {
+	idp := newMockIdP(t)
+	p := idp.provider()
+	ctx := context.Background()
+
+	cases := map[string]func(c map[string]any){
+		"nonce":    func(c map[string]any) { c["nonce"] = "other" },
+		"audience": func(c map[string]any) { c["aud"] = "someone-else" },
+		"issuer":   func(c map[string]any) { c["iss"] = "https://evil.example.com" },
+		"expired":  func(c map[string]any) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"azp":      func(c map[string]any) { c["aud"] = []string{"client", "other"} },
+	}
+
+	for name, mutate := range cases {
+		claims := idp.baseClaims("nonce1")
+		mutate(claims)
+
+		_, err := p.VerifyIDToken(ctx, idp.sign(claims), "nonce1")
+		if !errors.Is(err, ErrInvalidIDToken) {
+			t.Fatalf("%s: expected invalid id token, got %v", name, err)
+		}
+	}
+
+	// tampered payload
+	token := idp.sign(idp.baseClaims("nonce1"))
+	parts := strings.Split(token, ".")
+	payload, _ := json.Marshal(map[string]any{"sub": "admin"})
+	parts[1] = base64.RawURLEncoding.EncodeToString(payload)
+
+	_, err := p.VerifyIDToken(ctx, strings.Join(parts, "."), "nonce1")
+	if !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("expected bad signature, got %v", err)
+	}
+}
+
+func TestSigningKeyRoundTrip(t *testing.T) {
+	key, err := NewSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a key read back from its pem keeps its kid
+	parsed, err := ParseSigningKey(key.PEM())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.KeyId() != key.KeyId() {
+		t.Fatalf("kid changed %s != %s", parsed.KeyId(), key.KeyId())
+	}
+
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                 server.URL,
+			"authorization_endpoint": server.URL + "/authorize",
+			"token_endpoint":         server.URL + "/token",
+			"jwks_uri":               server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(parsed.JWKS())
+	})
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	p := New(Options{Issuer: server.URL, ClientId: "client"})
+
+	token, err := key.Sign(map[string]any{
+		"iss":   server.URL,
+		"sub":   "7",
+		"aud":   "client",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
+		"nonce": "nonce1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := p.VerifyIDToken(context.Background(), token, "nonce1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "7" {
+		t.Fatalf("unexpected subject %q", claims.Subject)
+	}
+
+	verifier, _ := RandomString()
+	if !VerifyPKCE(verifier, PKCEChallenge(verifier)) || VerifyPKCE("other", PKCEChallenge(verifier)) {
+		t.Fatal("pkce check mismatch")
+	}
+}
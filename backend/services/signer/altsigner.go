@@ -15,9 +15,9 @@ import (
 // donot use for anything too serious, it more as a way obfuscation
 // hope you know what you are doing
 
-func (b *Signer) deriveAltKey(salt string) []byte {
+func deriveAltKey(altKey []byte, salt string) []byte {
 	hasher := sha256.New()
-	hasher.Write([]byte(b.altKey))
+	hasher.Write(altKey)
 	hasher.Write([]byte(salt))
 	return hasher.Sum(nil)
 }
@@ -27,18 +27,29 @@ const (
 )
 
 func (b *Signer) SignAlt(salt string, data string) (string, error) {
-	return b.SignAltCore(b.deriveAltKey(salt), data)
+	return b.SignAltCore(deriveAltKey(b.keys[0].altKey, salt), data)
 }
 
+// VerifyAlt also accepts tokens of previous keys still in their grace period
 func (b *Signer) VerifyAlt(salt string, token string) (string, int64, error) {
-	return b.VerifyAltCore(b.deriveAltKey(salt), token)
+	var err error
+	for _, k := range b.liveKeys() {
+		var data string
+		var timestamp int64
+		data, timestamp, err = b.VerifyAltCore(deriveAltKey(k.altKey, salt), token)
+		if err == nil {
+			return data, timestamp, nil
+		}
+	}
+
+	return "", 0, err
 }
 
 func (b *Signer) SignAltBatch(salt string, data []string) ([]string, error) {
 
 	tokens := make([]string, len(data))
 
-	key := b.deriveAltKey(salt)
+	key := deriveAltKey(b.keys[0].altKey, salt)
 
 	for i := range data {
 		token, err := b.SignAltCore(key, data[i])
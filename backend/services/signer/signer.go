@@ -2,10 +2,14 @@ package signer
 
 import (
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
+	"sync"
+	"time"
 
 	"github.com/blue-monads/potatoverse/backend/utils/qq"
+	"github.com/eknkc/basex"
 	"github.com/hako/branca"
 	"golang.org/x/crypto/pbkdf2"
 )
@@ -21,6 +25,12 @@ const (
 	TokenTypeCapability         uint16 = 8
 	TokenTypeBuddyAuth          uint16 = 9
 	TokenTypeDevice             uint16 = 10
+	TokenTypeRefresh            uint16 = 11
+	TokenTypeLoginChallenge     uint16 = 12
+	TokenTypeOIDCState          uint16 = 13
+	TokenTypeOIDCCode           uint16 = 14
+	TokenTypeOIDCAccess         uint16 = 15
+	TokenTypeSealed             uint16 = 16
 )
 
 type DeviceClaim struct {
@@ -32,9 +42,66 @@ type DeviceClaim struct {
 type AccessClaim struct {
 	Typeid    uint16         `json:"t,omitempty"`
 	UserId    int64          `json:"u,omitempty"`
+	DeviceId  int64          `json:"d,omitempty"`
 	Extrameta map[string]any `json:"e,omitempty"`
 }
 
+// RefreshClaim is rotated on every use, only the latest one issued for a
+// device (its token_hash) is accepted
+type RefreshClaim struct {
+	Typeid   uint16 `json:"t,omitempty"`
+	UserId   int64  `json:"u,omitempty"`
+	DeviceId int64  `json:"d,omitempty"`
+}
+
+// LoginChallengeClaim is handed out after the password step when the user
+// still has to verify (or first enroll) a second factor
+type LoginChallengeClaim struct {
+	Typeid     uint16 `json:"t,omitempty"`
+	UserId     int64  `json:"u,omitempty"`
+	Purpose    string `json:"p,omitempty"` // verify, enroll
+	DeviceName string `json:"n,omitempty"`
+	OldToken   string `json:"o,omitempty"`
+}
+
+// OIDCStateClaim is kept in a cookie while the user is at the sso provider
+type OIDCStateClaim struct {
+	Typeid   uint16 `json:"t,omitempty"`
+	Provider string `json:"p,omitempty"`
+	State    string `json:"s,omitempty"`
+	Nonce    string `json:"n,omitempty"`
+	Verifier string `json:"v,omitempty"`
+	Redirect string `json:"r,omitempty"`
+}
+
+// OIDCCodeClaim is the authorization code handed to a client of the
+// openid connect provider, it is only redeemed once
+type OIDCCodeClaim struct {
+	Typeid      uint16 `json:"t,omitempty"`
+	CodeId      string `json:"i,omitempty"`
+	UserId      int64  `json:"u,omitempty"`
+	ClientId    string `json:"c,omitempty"`
+	RedirectURI string `json:"r,omitempty"`
+	Scope       string `json:"s,omitempty"`
+	Nonce       string `json:"n,omitempty"`
+	Challenge   string `json:"p,omitempty"` // pkce S256 challenge
+}
+
+// OIDCAccessClaim is the access token clients call userinfo with
+type OIDCAccessClaim struct {
+	Typeid   uint16 `json:"t,omitempty"`
+	UserId   int64  `json:"u,omitempty"`
+	ClientId string `json:"c,omitempty"`
+	Scope    string `json:"s,omitempty"`
+}
+
+// SealedClaim keeps a secret encrypted with the master secret at rest, it
+// never expires
+type SealedClaim struct {
+	Typeid uint16 `json:"t,omitempty"`
+	Data   string `json:"d,omitempty"`
+}
+
 type InviteClaim struct {
 	Typeid   uint16 `json:"t,omitempty"`
 	InviteId int64  `json:"p,omitempty"`
@@ -64,7 +131,7 @@ type SpaceFilePresignedClaim struct {
 	UserId    int64  `json:"u,omitempty"`
 	PathName  string `json:"pn,omitempty"`
 	FileName  string `json:"fn,omitempty"`
-	Expiry    int64  `json:"e,omitempty"`
+	Expiry    int64  `json:"e,omitempty"` // seconds after signing, type ttl when 0
 }
 
 type PackageDevClaim struct {
@@ -84,34 +151,158 @@ type CapabilityClaim struct {
 	ExtraMeta    map[string]any `json:"e,omitempty"`
 }
 
-// fixme => add expiry
+var (
+	ErrInvalidToken = errors.New("INVALID TOKEN")
+	ErrTokenExpired = errors.New("TOKEN EXPIRED")
+	ErrTokenRevoked = errors.New("TOKEN REVOKED")
+)
 
-var ErrInvalidToken = errors.New("INVALID TOKEN")
+// DefaultTTLs of each token type, tokens are rejected once they are older.
+// a negative ttl never expires.
+var DefaultTTLs = map[uint16]time.Duration{
+	TokenTypeAccess:             time.Hour,
+	TokenTypeRefresh:            30 * 24 * time.Hour,
+	TokenTypeDevice:             365 * 24 * time.Hour,
+	TokenTypeLoginChallenge:     5 * time.Minute,
+	TokenTypeOIDCState:          10 * time.Minute,
+	TokenTypeOIDCCode:           time.Minute,
+	TokenTypeOIDCAccess:         time.Hour,
+	TokenTypeEmailInvite:        7 * 24 * time.Hour,
+	TokenTypeSpace:              7 * 24 * time.Hour,
+	TokenTypeSpaceAdvisiery:     24 * time.Hour,
+	TokenTypeSpaceFilePresigned: time.Hour,
+	ToekenPackageDev:            90 * 24 * time.Hour,
+	TokenTypeCapability:         24 * time.Hour,
+}
 
-type Signer struct {
-	signer *branca.Branca
+// TokenTypeNames are the names token ttls are configured by
+var TokenTypeNames = map[string]uint16{
+	"access":          TokenTypeAccess,
+	"refresh":         TokenTypeRefresh,
+	"device":          TokenTypeDevice,
+	"login_challenge": TokenTypeLoginChallenge,
+	"oidc_state":      TokenTypeOIDCState,
+	"oidc_code":       TokenTypeOIDCCode,
+	"oidc_access":     TokenTypeOIDCAccess,
+	"invite":          TokenTypeEmailInvite,
+	"space":           TokenTypeSpace,
+	"space_advisiery": TokenTypeSpaceAdvisiery,
+	"presigned":       TokenTypeSpaceFilePresigned,
+	"package_dev":     ToekenPackageDev,
+	"capability":      TokenTypeCapability,
+}
+
+type PreviousKey struct {
+	Key []byte
+	// tokens signed with Key are accepted until then
+	Until time.Time
+}
+
+type Options struct {
+	// overrides DefaultTTLs per token type
+	TTLs         map[uint16]time.Duration
+	PreviousKeys []PreviousKey
+}
+
+type signingKey struct {
+	key    string
 	altKey []byte
+	until  time.Time
+}
+
+type Signer struct {
+	// current key first, then previous keys still in their grace period
+	keys []signingKey
+	ttls map[uint16]time.Duration
+
+	// devices revoked while their access tokens may still be alive
+	revokedDevices map[int64]time.Time
+	rLock          sync.RWMutex
 }
 
 func New(key []byte) *Signer {
+	return NewWithOptions(key, Options{})
+}
+
+func NewWithOptions(key []byte, opts Options) *Signer {
+	s := &Signer{
+		keys:           []signingKey{deriveKey(key, time.Time{})},
+		ttls:           make(map[uint16]time.Duration, len(DefaultTTLs)),
+		revokedDevices: make(map[int64]time.Time),
+	}
+
+	for _, pk := range opts.PreviousKeys {
+		s.keys = append(s.keys, deriveKey(pk.Key, pk.Until))
+	}
+
+	for typeid, ttl := range DefaultTTLs {
+		s.ttls[typeid] = ttl
+	}
+
+	for typeid, ttl := range opts.TTLs {
+		if ttl != 0 {
+			s.ttls[typeid] = ttl
+		}
+	}
+
+	return s
+}
+
+func deriveKey(key []byte, until time.Time) signingKey {
 	masterKey := pbkdf2.Key(key, []byte("SALTY_SALMON"), 2048, 32, sha256.New)
 	altKey := pbkdf2.Key(masterKey, []byte("UMAMI_POTATO"), 4, 32, sha256.New)
 
-	s := &Signer{
-		signer: branca.NewBranca(string(masterKey)),
+	return signingKey{
+		key:    string(masterKey),
 		altKey: altKey,
+		until:  until,
 	}
+}
 
-	return s
+// TTL is how long tokens of typeid are accepted, 0 when they never expire
+func (t *Signer) TTL(typeid uint16) time.Duration {
+	ttl := t.ttls[typeid]
+	if ttl < 0 {
+		return 0
+	}
+	return ttl
 }
 
-func (t *Signer) parse(token string, dest any) error {
-	str, err := t.signer.DecodeToString(token)
-	if err != nil {
-		return err
+// liveKeys is the current key and previous keys not past their grace period
+func (t *Signer) liveKeys() []signingKey {
+	now := time.Now()
+
+	keys := make([]signingKey, 0, len(t.keys))
+	for _, k := range t.keys {
+		if k.until.IsZero() || now.Before(k.until) {
+			keys = append(keys, k)
+		}
+	}
+
+	return keys
+}
+
+// parse decodes the token with the first live key that opens it and returns
+// the time it was signed at
+func (t *Signer) parse(token string, dest any) (time.Time, error) {
+	var err error = ErrInvalidToken
+
+	for _, k := range t.liveKeys() {
+		var str string
+		str, err = branca.NewBranca(k.key).DecodeToString(token)
+		if err != nil {
+			continue
+		}
+
+		issuedAt, err := tokenTimestamp(token)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		return issuedAt, json.Unmarshal([]byte(str), dest)
 	}
 
-	return json.Unmarshal([]byte(str), dest)
+	return time.Time{}, err
 }
 
 func (t *Signer) sign(o any) (string, error) {
@@ -120,14 +311,78 @@ func (t *Signer) sign(o any) (string, error) {
 		return "", nil
 	}
 
-	return t.signer.EncodeToString(string(out))
+	// a branca instance keeps the timestamp of its first token, so every
+	// token gets its own
+	return branca.NewBranca(t.keys[0].key).EncodeToString(string(out))
+}
+
+func (t *Signer) checkExpiry(typeid uint16, issuedAt time.Time) error {
+	ttl := t.TTL(typeid)
+	if ttl == 0 {
+		return nil
+	}
+
+	if time.Now().After(issuedAt.Add(ttl)) {
+		return ErrTokenExpired
+	}
+
+	return nil
+}
+
+const brancaBase62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+var base62, _ = basex.NewEncoding(brancaBase62)
+
+// tokenTimestamp reads the signing time from the branca header, version
+// byte then a big endian uint32 unix timestamp
+func tokenTimestamp(token string) (time.Time, error) {
+	raw, err := base62.Decode(token)
+	if err != nil || len(raw) < 5 {
+		return time.Time{}, ErrInvalidToken
+	}
+
+	return time.Unix(int64(binary.BigEndian.Uint32(raw[1:5])), 0), nil
+}
+
+// revocation
+
+// RevokeDevice rejects access tokens of deviceId signed before now, the
+// entry is dropped once those tokens would have expired anyway
+func (ts *Signer) RevokeDevice(deviceId int64, revokedAt time.Time) {
+	ts.rLock.Lock()
+	defer ts.rLock.Unlock()
+
+	ts.revokedDevices[deviceId] = revokedAt
+
+	ttl := ts.TTL(TokenTypeAccess)
+	if ttl == 0 {
+		return
+	}
+
+	for id, at := range ts.revokedDevices {
+		if time.Since(at) > ttl {
+			delete(ts.revokedDevices, id)
+		}
+	}
+}
+
+func (ts *Signer) isRevoked(deviceId int64, issuedAt time.Time) bool {
+	if deviceId == 0 {
+		return false
+	}
+
+	ts.rLock.RLock()
+	defer ts.rLock.RUnlock()
+
+	revokedAt, ok := ts.revokedDevices[deviceId]
+	return ok && !issuedAt.After(revokedAt)
 }
 
 func (ts *Signer) ParseAccess(tstr string) (*AccessClaim, error) {
 
 	claim := &AccessClaim{}
 
-	err := ts.parse(tstr, claim)
+	issuedAt, err := ts.parse(tstr, claim)
 	if err != nil {
 		return nil, err
 	}
@@ -136,6 +391,15 @@ func (ts *Signer) ParseAccess(tstr string) (*AccessClaim, error) {
 		return nil, ErrInvalidToken
 	}
 
+	err = ts.checkExpiry(TokenTypeAccess, issuedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if ts.isRevoked(claim.DeviceId, issuedAt) {
+		return nil, ErrTokenRevoked
+	}
+
 	return claim, nil
 }
 
@@ -148,7 +412,7 @@ func (ts *Signer) SignAccess(claim *AccessClaim) (string, error) {
 
 func (ts *Signer) ParseDevice(tstr string) (*DeviceClaim, error) {
 	claim := &DeviceClaim{}
-	err := ts.parse(tstr, claim)
+	issuedAt, err := ts.parse(tstr, claim)
 	if err != nil {
 		return nil, err
 	}
@@ -157,6 +421,11 @@ func (ts *Signer) ParseDevice(tstr string) (*DeviceClaim, error) {
 		return nil, ErrInvalidToken
 	}
 
+	err = ts.checkExpiry(TokenTypeDevice, issuedAt)
+	if err != nil {
+		return nil, err
+	}
+
 	return claim, nil
 }
 
@@ -165,11 +434,151 @@ func (ts *Signer) SignDevice(claim *DeviceClaim) (string, error) {
 	return ts.sign(claim)
 }
 
+func (ts *Signer) ParseRefresh(tstr string) (*RefreshClaim, error) {
+	claim := &RefreshClaim{}
+	issuedAt, err := ts.parse(tstr, claim)
+	if err != nil {
+		return nil, err
+	}
+
+	if claim.Typeid != TokenTypeRefresh {
+		return nil, ErrInvalidToken
+	}
+
+	err = ts.checkExpiry(TokenTypeRefresh, issuedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return claim, nil
+}
+
+func (ts *Signer) SignRefresh(claim *RefreshClaim) (string, error) {
+	claim.Typeid = TokenTypeRefresh
+	return ts.sign(claim)
+}
+
+func (ts *Signer) ParseLoginChallenge(tstr string) (*LoginChallengeClaim, error) {
+	claim := &LoginChallengeClaim{}
+	issuedAt, err := ts.parse(tstr, claim)
+	if err != nil {
+		return nil, err
+	}
+
+	if claim.Typeid != TokenTypeLoginChallenge {
+		return nil, ErrInvalidToken
+	}
+
+	err = ts.checkExpiry(TokenTypeLoginChallenge, issuedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return claim, nil
+}
+
+func (ts *Signer) SignLoginChallenge(claim *LoginChallengeClaim) (string, error) {
+	claim.Typeid = TokenTypeLoginChallenge
+	return ts.sign(claim)
+}
+
+func (ts *Signer) ParseOIDCState(tstr string) (*OIDCStateClaim, error) {
+	claim := &OIDCStateClaim{}
+	issuedAt, err := ts.parse(tstr, claim)
+	if err != nil {
+		return nil, err
+	}
+
+	if claim.Typeid != TokenTypeOIDCState {
+		return nil, ErrInvalidToken
+	}
+
+	err = ts.checkExpiry(TokenTypeOIDCState, issuedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return claim, nil
+}
+
+func (ts *Signer) SignOIDCState(claim *OIDCStateClaim) (string, error) {
+	claim.Typeid = TokenTypeOIDCState
+	return ts.sign(claim)
+}
+
+func (ts *Signer) ParseOIDCCode(tstr string) (*OIDCCodeClaim, error) {
+	claim := &OIDCCodeClaim{}
+	issuedAt, err := ts.parse(tstr, claim)
+	if err != nil {
+		return nil, err
+	}
+
+	if claim.Typeid != TokenTypeOIDCCode {
+		return nil, ErrInvalidToken
+	}
+
+	err = ts.checkExpiry(TokenTypeOIDCCode, issuedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return claim, nil
+}
+
+func (ts *Signer) SignOIDCCode(claim *OIDCCodeClaim) (string, error) {
+	claim.Typeid = TokenTypeOIDCCode
+	return ts.sign(claim)
+}
+
+func (ts *Signer) ParseOIDCAccess(tstr string) (*OIDCAccessClaim, error) {
+	claim := &OIDCAccessClaim{}
+	issuedAt, err := ts.parse(tstr, claim)
+	if err != nil {
+		return nil, err
+	}
+
+	if claim.Typeid != TokenTypeOIDCAccess {
+		return nil, ErrInvalidToken
+	}
+
+	err = ts.checkExpiry(TokenTypeOIDCAccess, issuedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return claim, nil
+}
+
+func (ts *Signer) SignOIDCAccess(claim *OIDCAccessClaim) (string, error) {
+	claim.Typeid = TokenTypeOIDCAccess
+	return ts.sign(claim)
+}
+
+// Seal encrypts data with the master secret
+func (ts *Signer) Seal(data string) (string, error) {
+	return ts.sign(&SealedClaim{Typeid: TokenTypeSealed, Data: data})
+}
+
+// Open decrypts data sealed by Seal
+func (ts *Signer) Open(tstr string) (string, error) {
+	claim := &SealedClaim{}
+	_, err := ts.parse(tstr, claim)
+	if err != nil {
+		return "", err
+	}
+
+	if claim.Typeid != TokenTypeSealed {
+		return "", ErrInvalidToken
+	}
+
+	return claim.Data, nil
+}
+
 func (ts *Signer) ParseInvite(tstr string) (*InviteClaim, error) {
 
 	claim := &InviteClaim{}
 
-	err := ts.parse(tstr, claim)
+	issuedAt, err := ts.parse(tstr, claim)
 	if err != nil {
 		return nil, err
 	}
@@ -178,6 +587,11 @@ func (ts *Signer) ParseInvite(tstr string) (*InviteClaim, error) {
 		return nil, ErrInvalidToken
 	}
 
+	err = ts.checkExpiry(TokenTypeEmailInvite, issuedAt)
+	if err != nil {
+		return nil, err
+	}
+
 	return claim, nil
 }
 
@@ -192,7 +606,7 @@ func (ts *Signer) ParseSpace(tstr string) (*SpaceClaim, error) {
 
 	claim := &SpaceClaim{}
 
-	err := ts.parse(tstr, claim)
+	issuedAt, err := ts.parse(tstr, claim)
 	if err != nil {
 		return nil, err
 	}
@@ -201,6 +615,11 @@ func (ts *Signer) ParseSpace(tstr string) (*SpaceClaim, error) {
 		return nil, ErrInvalidToken
 	}
 
+	err = ts.checkExpiry(TokenTypeSpace, issuedAt)
+	if err != nil {
+		return nil, err
+	}
+
 	return claim, nil
 }
 
@@ -215,7 +634,7 @@ func (ts *Signer) ParseSpaceAdvisiery(tstr string) (*SpaceAdvisieryClaim, error)
 
 	claim := &SpaceAdvisieryClaim{}
 
-	err := ts.parse(tstr, claim)
+	issuedAt, err := ts.parse(tstr, claim)
 	if err != nil {
 		return nil, err
 	}
@@ -224,6 +643,11 @@ func (ts *Signer) ParseSpaceAdvisiery(tstr string) (*SpaceAdvisieryClaim, error)
 		return nil, ErrInvalidToken
 	}
 
+	err = ts.checkExpiry(TokenTypeSpaceAdvisiery, issuedAt)
+	if err != nil {
+		return nil, err
+	}
+
 	return claim, nil
 }
 
@@ -238,7 +662,7 @@ func (ts *Signer) ParseSpaceFilePresigned(tstr string) (*SpaceFilePresignedClaim
 
 	claim := &SpaceFilePresignedClaim{}
 
-	err := ts.parse(tstr, claim)
+	issuedAt, err := ts.parse(tstr, claim)
 	if err != nil {
 		return nil, err
 	}
@@ -247,6 +671,15 @@ func (ts *Signer) ParseSpaceFilePresigned(tstr string) (*SpaceFilePresignedClaim
 		return nil, ErrInvalidToken
 	}
 
+	ttl := ts.TTL(TokenTypeSpaceFilePresigned)
+	if claim.Expiry > 0 {
+		ttl = time.Duration(claim.Expiry) * time.Second
+	}
+
+	if ttl > 0 && time.Now().After(issuedAt.Add(ttl)) {
+		return nil, ErrTokenExpired
+	}
+
 	return claim, nil
 }
 
@@ -261,7 +694,7 @@ func (ts *Signer) ParsePackageDev(tstr string) (*PackageDevClaim, error) {
 
 	claim := &PackageDevClaim{}
 
-	err := ts.parse(tstr, claim)
+	issuedAt, err := ts.parse(tstr, claim)
 	if err != nil {
 		return nil, err
 	}
@@ -270,6 +703,11 @@ func (ts *Signer) ParsePackageDev(tstr string) (*PackageDevClaim, error) {
 		return nil, ErrInvalidToken
 	}
 
+	err = ts.checkExpiry(ToekenPackageDev, issuedAt)
+	if err != nil {
+		return nil, err
+	}
+
 	return claim, nil
 }
 
@@ -284,7 +722,7 @@ func (ts *Signer) ParseCapability(tstr string) (*CapabilityClaim, error) {
 
 	claim := &CapabilityClaim{}
 
-	err := ts.parse(tstr, claim)
+	issuedAt, err := ts.parse(tstr, claim)
 	if err != nil {
 		return nil, err
 	}
@@ -294,6 +732,11 @@ func (ts *Signer) ParseCapability(tstr string) (*CapabilityClaim, error) {
 		return nil, ErrInvalidToken
 	}
 
+	err = ts.checkExpiry(TokenTypeCapability, issuedAt)
+	if err != nil {
+		return nil, err
+	}
+
 	return claim, nil
 }
 
@@ -1,7 +1,9 @@
 package signer
 
 import (
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/blue-monads/potatoverse/backend/utils/qq"
 )
@@ -26,3 +28,136 @@ func TestSigner(t *testing.T) {
 	qq.Println("timestamp: ", timestamp)
 
 }
+
+func TestTokenExpiry(t *testing.T) {
+	signer := NewWithOptions([]byte("1234567890"), Options{
+		TTLs: map[uint16]time.Duration{TokenTypeAccess: time.Nanosecond},
+	})
+
+	token, err := signer.SignAccess(&AccessClaim{UserId: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = signer.ParseAccess(token)
+	if !errors.Is(err, ErrTokenExpired) {
+		t.Fatalf("expected expired token, got %v", err)
+	}
+
+	// other types keep their default ttl
+	token, _ = signer.SignSpace(&SpaceClaim{SpaceId: 1})
+	_, err = signer.ParseSpace(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// presigned tokens carry their own expiry
+	token, _ = signer.SignSpaceFilePresigned(&SpaceFilePresignedClaim{FileName: "a.txt", Expiry: 60})
+	_, err = signer.ParseSpaceFilePresigned(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTokenIssuedAt(t *testing.T) {
+	signer := New([]byte("1234567890"))
+
+	token, _ := signer.SignAccess(&AccessClaim{UserId: 1})
+
+	issuedAt, err := tokenTimestamp(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if time.Since(issuedAt) > 2*time.Second {
+		t.Fatalf("unexpected issued at %s", issuedAt)
+	}
+}
+
+func TestRevokeDevice(t *testing.T) {
+	signer := New([]byte("1234567890"))
+
+	token, _ := signer.SignAccess(&AccessClaim{UserId: 1, DeviceId: 7})
+	other, _ := signer.SignAccess(&AccessClaim{UserId: 1, DeviceId: 8})
+
+	signer.RevokeDevice(7, time.Now())
+
+	_, err := signer.ParseAccess(token)
+	if !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("expected revoked token, got %v", err)
+	}
+
+	_, err = signer.ParseAccess(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// signed after the revocation, eg. a new login reusing the device
+	fresh := New([]byte("1234567890"))
+	fresh.RevokeDevice(7, time.Now().Add(-2*time.Second))
+
+	_, err = fresh.ParseAccess(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	old := New([]byte("old-secret"))
+
+	token, _ := old.SignAccess(&AccessClaim{UserId: 1})
+	altToken, _ := old.SignAlt("salt", "42")
+
+	rotated := NewWithOptions([]byte("new-secret"), Options{
+		PreviousKeys: []PreviousKey{{Key: []byte("old-secret"), Until: time.Now().Add(time.Hour)}},
+	})
+
+	claim, err := rotated.ParseAccess(token)
+	if err != nil || claim.UserId != 1 {
+		t.Fatalf("old token rejected during grace period: %v", err)
+	}
+
+	data, _, err := rotated.VerifyAlt("salt", altToken)
+	if err != nil || data != "42" {
+		t.Fatalf("old alt token rejected during grace period: %v", err)
+	}
+
+	expired := NewWithOptions([]byte("new-secret"), Options{
+		PreviousKeys: []PreviousKey{{Key: []byte("old-secret"), Until: time.Now().Add(-time.Hour)}},
+	})
+
+	_, err = expired.ParseAccess(token)
+	if err == nil {
+		t.Fatal("old token accepted after grace period")
+	}
+
+	// new tokens are signed with the new key only
+	token, _ = rotated.SignAccess(&AccessClaim{UserId: 2})
+	_, err = old.ParseAccess(token)
+	if err == nil {
+		t.Fatal("new token opened with the old key")
+	}
+}
+
+func TestLoginChallenge(t *testing.T) {
+	signer := New([]byte("1234567890"))
+
+	token, err := signer.SignLoginChallenge(&LoginChallengeClaim{UserId: 3, Purpose: "verify"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claim, err := signer.ParseLoginChallenge(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claim.UserId != 3 || claim.Purpose != "verify" {
+		t.Fatalf("unexpected claim %+v", claim)
+	}
+
+	// a challenge is not an access token
+	_, err = signer.ParseAccess(token)
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected invalid token, got %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package backplane
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Backplane carries room messages between sockd instances on different
+// nodes, so broadcast, pubsub and notifier fan out reaches sockets that
+// are connected to a peer. Local sockets are always served directly, a
+// backplane only ever delivers messages that came from other nodes.
+
+type Kind string
+
+const (
+	KindBroadcast Kind = "broadcast"
+	KindPublish   Kind = "publish"
+	KindUser      Kind = "user"
+	KindGroup     Kind = "group"
+	KindAll       Kind = "all"
+)
+
+var (
+	ErrClosed = errors.New("backplane closed")
+)
+
+type Message struct {
+	Origin string `json:"origin"`
+	// Epoch changes every time the origin starts, sequences start over
+	// with it
+	Epoch int64 `json:"epoch"`
+	// Seq is per origin and stream, receivers use it to drop duplicates
+	// and to deliver in order
+	Seq uint64 `json:"seq"`
+
+	Kind   Kind   `json:"kind"`
+	Room   string `json:"room,omitempty"`
+	Topic  string `json:"topic,omitempty"`
+	UserId int64  `json:"user_id,omitempty"`
+	Group  string `json:"group,omitempty"`
+
+	Payload []byte `json:"payload"`
+}
+
+// Stream is the unit messages are ordered in, one room of one kind
+func (m *Message) Stream() string {
+	switch m.Kind {
+	case KindUser:
+		return fmt.Sprintf("%s/%d", m.Kind, m.UserId)
+	case KindGroup:
+		return string(m.Kind) + "/" + m.Group
+	case KindAll:
+		return string(m.Kind)
+	}
+
+	return string(m.Kind) + "/" + m.Room
+}
+
+type Handler func(msg *Message)
+
+type Backplane interface {
+	NodeId() string
+
+	// Publish sends msg to peers, Origin and Seq are set by the backplane
+	Publish(msg *Message) error
+
+	// Subscribe sets the handler peer messages are delivered to, it is
+	// called in order per stream and never with this node's own messages
+	Subscribe(handler Handler)
+
+	Close() error
+}
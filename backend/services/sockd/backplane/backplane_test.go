@@ -0,0 +1,206 @@
+package backplane
+
+import (
+	"bytes"
+	"database/sql"
+	"io"
+	"net/http"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type collector struct {
+	msgs []*Message
+	lock sync.Mutex
+}
+
+func (c *collector) handle(msg *Message) {
+	c.lock.Lock()
+	c.msgs = append(c.msgs, msg)
+	c.lock.Unlock()
+}
+
+func (c *collector) payloads() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	out := make([]string, 0, len(c.msgs))
+	for _, msg := range c.msgs {
+		out = append(out, string(msg.Payload))
+	}
+	return out
+}
+
+func (c *collector) waitFor(t *testing.T, n int) []string {
+	t.Helper()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		if got := c.payloads(); len(got) >= n {
+			return got
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("expected %d messages, got %v", n, c.payloads())
+	return nil
+}
+
+func assertPayloads(t *testing.T, got []string, want ...string) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+}
+
+func roomMsg(seq uint64, payload string) *Message {
+	return &Message{Origin: "a", Epoch: 1, Seq: seq, Kind: KindBroadcast, Room: "r1", Payload: []byte(payload)}
+}
+
+func TestSequencer_DedupAndOrder(t *testing.T) {
+	c := &collector{}
+	s := newSequencer(time.Hour)
+	defer s.close()
+	s.setHandler(c.handle)
+
+	s.receive(roomMsg(1, "one"))
+	s.receive(roomMsg(3, "three"))
+	s.receive(roomMsg(1, "one"))
+	s.receive(roomMsg(2, "two"))
+	s.receive(roomMsg(3, "three"))
+
+	assertPayloads(t, c.payloads(), "one", "two", "three")
+
+	// a restarted origin starts a new epoch
+	restarted := roomMsg(1, "again")
+	restarted.Epoch = 2
+	s.receive(restarted)
+
+	assertPayloads(t, c.payloads(), "one", "two", "three", "again")
+}
+
+func TestSequencer_SkipsLostMessage(t *testing.T) {
+	c := &collector{}
+	s := newSequencer(100 * time.Millisecond)
+	defer s.close()
+	s.setHandler(c.handle)
+
+	s.receive(roomMsg(1, "one"))
+	s.receive(roomMsg(3, "three"))
+	s.receive(roomMsg(4, "four"))
+
+	got := c.waitFor(t, 3)
+	assertPayloads(t, got, "one", "three", "four")
+
+	// the lost one showing up late is dropped
+	s.receive(roomMsg(2, "two"))
+	time.Sleep(50 * time.Millisecond)
+	assertPayloads(t, c.payloads(), "one", "three", "four")
+}
+
+func TestLocal_Hub(t *testing.T) {
+	hub := NewHub()
+	a := hub.Join("a")
+	b := hub.Join("b")
+	defer a.Close()
+	defer b.Close()
+
+	ca, cb := &collector{}, &collector{}
+	a.Subscribe(ca.handle)
+	b.Subscribe(cb.handle)
+
+	for _, p := range []string{"1", "2", "3"} {
+		if err := a.Publish(&Message{Kind: KindPublish, Room: "r1", Topic: "t", Payload: []byte(p)}); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+	}
+
+	assertPayloads(t, cb.waitFor(t, 3), "1", "2", "3")
+
+	if len(ca.payloads()) != 0 {
+		t.Fatalf("origin should not get its own messages, got %v", ca.payloads())
+	}
+}
+
+func TestSQLite_Polling(t *testing.T) {
+	db, err := sql.Open("sqlite3", path.Join(t.TempDir(), "backplane.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+
+	a, err := NewSQLite(SQLiteOptions{NodeId: "a", DB: db, PollInterval: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("backplane a: %v", err)
+	}
+	defer a.Close()
+
+	b, err := NewSQLite(SQLiteOptions{NodeId: "b", DB: db, PollInterval: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("backplane b: %v", err)
+	}
+	defer b.Close()
+
+	ca, cb := &collector{}, &collector{}
+	a.Subscribe(ca.handle)
+	b.Subscribe(cb.handle)
+
+	a.Publish(&Message{Kind: KindUser, UserId: 7, Payload: []byte("hello")})
+	b.Publish(&Message{Kind: KindAll, Payload: []byte("all")})
+	a.Publish(&Message{Kind: KindUser, UserId: 7, Payload: []byte("again")})
+
+	assertPayloads(t, cb.waitFor(t, 2), "hello", "again")
+	assertPayloads(t, ca.waitFor(t, 1), "all")
+}
+
+// buddySender hands requests straight to the peer's Receive
+type buddySender struct {
+	from  string
+	peers map[string]*Buddy
+}
+
+func (s *buddySender) SendBuddy(pubkey string, req *http.Request) (*http.Response, error) {
+	data, _ := io.ReadAll(req.Body)
+
+	status := http.StatusOK
+	if err := s.peers[pubkey].Receive(s.from, data); err != nil {
+		status = http.StatusForbidden
+	}
+
+	return &http.Response{StatusCode: status, Body: io.NopCloser(bytes.NewReader(nil))}, nil
+}
+
+func TestBuddy_Transport(t *testing.T) {
+	peers := map[string]*Buddy{}
+
+	a := NewBuddy(BuddyOptions{NodeId: "npub-a", Peers: []string{"npub-b"}, Sender: &buddySender{from: "npub-a", peers: peers}})
+	b := NewBuddy(BuddyOptions{NodeId: "npub-b", Peers: []string{"npub-a"}, Sender: &buddySender{from: "npub-b", peers: peers}})
+	defer a.Close()
+	defer b.Close()
+
+	peers["npub-a"] = a
+	peers["npub-b"] = b
+
+	cb := &collector{}
+	b.Subscribe(cb.handle)
+
+	a.Publish(&Message{Kind: KindGroup, Group: "admin", Payload: []byte("x")})
+	a.Publish(&Message{Kind: KindGroup, Group: "admin", Payload: []byte("y")})
+
+	assertPayloads(t, cb.waitFor(t, 2), "x", "y")
+
+	if err := b.Receive("npub-stranger", []byte(`{}`)); err == nil {
+		t.Fatal("expected messages from unknown buddies to be rejected")
+	}
+}
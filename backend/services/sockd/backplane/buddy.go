@@ -0,0 +1,178 @@
+package backplane
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/blue-monads/potatoverse/backend/utils/qq"
+)
+
+const (
+	BuddyBackplanePath = "/zz/buddy/sockd/backplane"
+
+	peerQueueSize = 1024
+)
+
+// BuddySender is what buddyhub provides, requests go to the peer by its
+// pubkey over whatever transport the buddy is reachable on
+type BuddySender interface {
+	SendBuddy(buddyPubkey string, req *http.Request) (*http.Response, error)
+}
+
+type BuddyOptions struct {
+	NodeId string
+	Peers  []string
+	Sender BuddySender
+
+	// Sign adds buddy auth to outgoing requests
+	Sign func(req *http.Request) error
+}
+
+// Buddy is a backplane that pushes messages to peer buddies over http,
+// the peer hands the body to Receive
+type Buddy struct {
+	opts    BuddyOptions
+	stamper *stamper
+	seq     *sequencer
+
+	// one queue per peer keeps messages in order towards it
+	queues map[string]chan []byte
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewBuddy(opts BuddyOptions) *Buddy {
+	b := &Buddy{
+		opts:    opts,
+		stamper: newStamper(opts.NodeId),
+		seq:     newSequencer(0),
+		queues:  make(map[string]chan []byte),
+		done:    make(chan struct{}),
+	}
+
+	for _, peer := range opts.Peers {
+		if peer == opts.NodeId {
+			continue
+		}
+
+		queue := make(chan []byte, peerQueueSize)
+		b.queues[peer] = queue
+
+		go b.sendLoop(peer, queue)
+	}
+
+	return b
+}
+
+func (b *Buddy) NodeId() string {
+	return b.opts.NodeId
+}
+
+func (b *Buddy) Publish(msg *Message) error {
+	select {
+	case <-b.done:
+		return ErrClosed
+	default:
+	}
+
+	b.stamper.stamp(msg)
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	for peer, queue := range b.queues {
+		select {
+		case queue <- data:
+		default:
+			// peer is down or slow, the gap is skipped on its side
+			qq.Println("@Buddy/Publish/drop", peer)
+		}
+	}
+
+	return nil
+}
+
+func (b *Buddy) Subscribe(handler Handler) {
+	b.seq.setHandler(handler)
+}
+
+// Receive takes a message body pushed by the peer with pubkey from
+func (b *Buddy) Receive(from string, data []byte) error {
+	if _, ok := b.queues[from]; !ok {
+		return fmt.Errorf("not a backplane peer: %s", from)
+	}
+
+	msg := &Message{}
+	err := json.Unmarshal(data, msg)
+	if err != nil {
+		return err
+	}
+
+	if msg.Origin == b.opts.NodeId {
+		return nil
+	}
+
+	b.seq.receive(msg)
+
+	return nil
+}
+
+func (b *Buddy) Close() error {
+	b.closeOnce.Do(func() {
+		close(b.done)
+		b.seq.close()
+	})
+
+	return nil
+}
+
+func (b *Buddy) sendLoop(peer string, queue chan []byte) {
+	for {
+		select {
+		case <-b.done:
+			return
+		case data := <-queue:
+			err := b.send(peer, data)
+			if err != nil {
+				qq.Println("@Buddy/send", peer, err)
+			}
+		}
+	}
+}
+
+func (b *Buddy) send(peer string, data []byte) error {
+	req, err := http.NewRequest(http.MethodPost, "http://buddy"+BuddyBackplanePath, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if b.opts.Sign != nil {
+		err = b.opts.Sign(req)
+		if err != nil {
+			return err
+		}
+	}
+
+	resp, err := b.opts.Sender.SendBuddy(peer, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("peer answered %d", resp.StatusCode)
+	}
+
+	return nil
+}
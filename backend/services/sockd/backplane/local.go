@@ -0,0 +1,121 @@
+package backplane
+
+import (
+	"sync"
+)
+
+// Hub connects backplanes living in one process, the default sockd has a
+// hub of its own so publishing goes nowhere, tests and embedded setups
+// join several nodes to one hub
+type Hub struct {
+	nodes map[string]*Local
+	lock  sync.RWMutex
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		nodes: make(map[string]*Local),
+	}
+}
+
+func (h *Hub) Join(nodeId string) *Local {
+	l := &Local{
+		hub:     h,
+		stamper: newStamper(nodeId),
+		seq:     newSequencer(0),
+		inbox:   make(chan *Message, 1024),
+		done:    make(chan struct{}),
+	}
+
+	h.lock.Lock()
+	h.nodes[nodeId] = l
+	h.lock.Unlock()
+
+	go l.run()
+
+	return l
+}
+
+func (h *Hub) leave(nodeId string) {
+	h.lock.Lock()
+	delete(h.nodes, nodeId)
+	h.lock.Unlock()
+}
+
+type Local struct {
+	hub     *Hub
+	stamper *stamper
+	seq     *sequencer
+
+	inbox     chan *Message
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewLocal is an in process backplane with no peers
+func NewLocal(nodeId string) *Local {
+	return NewHub().Join(nodeId)
+}
+
+func (l *Local) NodeId() string {
+	return l.stamper.nodeId
+}
+
+func (l *Local) Publish(msg *Message) error {
+	select {
+	case <-l.done:
+		return ErrClosed
+	default:
+	}
+
+	l.stamper.stamp(msg)
+
+	l.hub.lock.RLock()
+	peers := make([]*Local, 0, len(l.hub.nodes))
+	for nodeId, peer := range l.hub.nodes {
+		if nodeId != l.NodeId() {
+			peers = append(peers, peer)
+		}
+	}
+	l.hub.lock.RUnlock()
+
+	for _, peer := range peers {
+		peer.deliver(msg)
+	}
+
+	return nil
+}
+
+func (l *Local) Subscribe(handler Handler) {
+	l.seq.setHandler(handler)
+}
+
+func (l *Local) Close() error {
+	l.closeOnce.Do(func() {
+		l.hub.leave(l.NodeId())
+		close(l.done)
+		l.seq.close()
+	})
+
+	return nil
+}
+
+func (l *Local) deliver(msg *Message) {
+	cp := *msg
+
+	select {
+	case l.inbox <- &cp:
+	case <-l.done:
+	}
+}
+
+func (l *Local) run() {
+	for {
+		select {
+		case msg := <-l.inbox:
+			l.seq.receive(msg)
+		case <-l.done:
+			return
+		}
+	}
+}
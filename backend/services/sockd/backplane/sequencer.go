@@ -0,0 +1,183 @@
+package backplane
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// a missing message is waited for this long, after that the stream
+	// moves on so one lost message does not hold the room forever
+	DefaultGapTimeout = 2 * time.Second
+
+	maxPendingPerStream = 256
+)
+
+type streamState struct {
+	next     uint64
+	pending  map[uint64]*Message
+	gapSince time.Time
+}
+
+// sequencer drops duplicates and delivers peer messages in Seq order
+// per origin and stream, shared by all backplane implementations
+type sequencer struct {
+	handler    Handler
+	streams    map[string]*streamState
+	lock       sync.Mutex
+	gapTimeout time.Duration
+
+	closeOnce sync.Once
+	stop      chan struct{}
+}
+
+func newSequencer(gapTimeout time.Duration) *sequencer {
+	if gapTimeout <= 0 {
+		gapTimeout = DefaultGapTimeout
+	}
+
+	s := &sequencer{
+		streams:    make(map[string]*streamState),
+		gapTimeout: gapTimeout,
+		stop:       make(chan struct{}),
+	}
+
+	go s.gapLoop()
+
+	return s
+}
+
+func (s *sequencer) setHandler(handler Handler) {
+	s.lock.Lock()
+	s.handler = handler
+	s.lock.Unlock()
+}
+
+func (s *sequencer) receive(msg *Message) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	key := msg.Origin + "|" + strconv.FormatInt(msg.Epoch, 10) + "|" + msg.Stream()
+
+	st, ok := s.streams[key]
+	if !ok {
+		// joined in the middle, start from whatever comes first
+		st = &streamState{
+			next:    msg.Seq,
+			pending: make(map[uint64]*Message),
+		}
+		s.streams[key] = st
+	}
+
+	if msg.Seq < st.next {
+		return
+	}
+
+	if _, dup := st.pending[msg.Seq]; dup {
+		return
+	}
+
+	st.pending[msg.Seq] = msg
+
+	if len(st.pending) > maxPendingPerStream {
+		s.skipGap(st)
+	}
+
+	s.drain(st)
+}
+
+// drain delivers everything that is in order, lock must be held
+func (s *sequencer) drain(st *streamState) {
+	for {
+		msg, ok := st.pending[st.next]
+		if !ok {
+			break
+		}
+
+		delete(st.pending, st.next)
+		st.next++
+
+		if s.handler != nil {
+			s.handler(msg)
+		}
+	}
+
+	if len(st.pending) == 0 {
+		st.gapSince = time.Time{}
+	} else if st.gapSince.IsZero() {
+		st.gapSince = time.Now()
+	}
+}
+
+// skipGap gives up on missing messages and moves to the lowest pending
+// one, lock must be held
+func (s *sequencer) skipGap(st *streamState) {
+	lowest := uint64(0)
+	for seq := range st.pending {
+		if lowest == 0 || seq < lowest {
+			lowest = seq
+		}
+	}
+
+	if lowest > st.next {
+		st.next = lowest
+	}
+}
+
+func (s *sequencer) gapLoop() {
+	ticker := time.NewTicker(s.gapTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			s.lock.Lock()
+			for _, st := range s.streams {
+				if len(st.pending) == 0 || now.Sub(st.gapSince) < s.gapTimeout {
+					continue
+				}
+
+				s.skipGap(st)
+				s.drain(st)
+			}
+			s.lock.Unlock()
+		}
+	}
+}
+
+func (s *sequencer) close() {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+	})
+}
+
+// stamper gives outgoing messages their origin, epoch and sequence
+type stamper struct {
+	nodeId string
+	epoch  int64
+	seqs   map[string]uint64
+	lock   sync.Mutex
+}
+
+func newStamper(nodeId string) *stamper {
+	return &stamper{
+		nodeId: nodeId,
+		epoch:  time.Now().UnixNano(),
+		seqs:   make(map[string]uint64),
+	}
+}
+
+func (s *stamper) stamp(msg *Message) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	stream := msg.Stream()
+	s.seqs[stream]++
+
+	msg.Origin = s.nodeId
+	msg.Epoch = s.epoch
+	msg.Seq = s.seqs[stream]
+}
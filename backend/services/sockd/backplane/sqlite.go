@@ -0,0 +1,211 @@
+package backplane
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/blue-monads/potatoverse/backend/utils/qq"
+)
+
+const (
+	DefaultPollInterval = 500 * time.Millisecond
+	DefaultRetention    = 10 * time.Minute
+
+	pollBatchSize = 500
+)
+
+const sqliteSchema = `CREATE TABLE IF NOT EXISTS SockdBackplane (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	origin TEXT NOT NULL,
+	data BLOB NOT NULL,
+	created_at INTEGER NOT NULL
+);`
+
+type SQLiteOptions struct {
+	NodeId string
+	DB     *sql.DB
+
+	PollInterval time.Duration
+	// rows older than this are deleted, a node that is down for longer
+	// misses them
+	Retention time.Duration
+}
+
+// SQLite is a backplane for nodes sharing one sqlite file, messages are
+// appended to a table and every node polls for rows it has not seen
+type SQLite struct {
+	opts    SQLiteOptions
+	stamper *stamper
+	seq     *sequencer
+
+	lastId int64
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewSQLite(opts SQLiteOptions) (*SQLite, error) {
+	if opts.DB == nil {
+		return nil, errors.New("sqlite backplane needs a database")
+	}
+
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+
+	if opts.Retention <= 0 {
+		opts.Retention = DefaultRetention
+	}
+
+	_, err := opts.DB.Exec(sqliteSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &SQLite{
+		opts:    opts,
+		stamper: newStamper(opts.NodeId),
+		seq:     newSequencer(0),
+		done:    make(chan struct{}),
+	}
+
+	// only messages published after joining are delivered
+	err = opts.DB.QueryRow("SELECT COALESCE(MAX(id), 0) FROM SockdBackplane").Scan(&s.lastId)
+	if err != nil {
+		return nil, err
+	}
+
+	go s.pollLoop()
+
+	return s, nil
+}
+
+func (s *SQLite) NodeId() string {
+	return s.opts.NodeId
+}
+
+func (s *SQLite) Publish(msg *Message) error {
+	select {
+	case <-s.done:
+		return ErrClosed
+	default:
+	}
+
+	s.stamper.stamp(msg)
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.opts.DB.Exec(
+		"INSERT INTO SockdBackplane (origin, data, created_at) VALUES (?, ?, ?)",
+		msg.Origin, data, time.Now().Unix(),
+	)
+
+	return err
+}
+
+func (s *SQLite) Subscribe(handler Handler) {
+	s.seq.setHandler(handler)
+}
+
+func (s *SQLite) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.seq.close()
+	})
+
+	return nil
+}
+
+func (s *SQLite) pollLoop() {
+	ticker := time.NewTicker(s.opts.PollInterval)
+	defer ticker.Stop()
+
+	lastPrune := time.Now()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+
+		err := s.poll()
+		if err != nil {
+			qq.Println("@SQLite/poll", err)
+		}
+
+		if time.Since(lastPrune) > s.opts.Retention/2 {
+			lastPrune = time.Now()
+
+			cutoff := time.Now().Add(-s.opts.Retention).Unix()
+			_, err := s.opts.DB.Exec("DELETE FROM SockdBackplane WHERE created_at < ?", cutoff)
+			if err != nil {
+				qq.Println("@SQLite/prune", err)
+			}
+		}
+	}
+}
+
+func (s *SQLite) poll() error {
+	for {
+		rows, err := s.opts.DB.Query(
+			"SELECT id, origin, data FROM SockdBackplane WHERE id > ? ORDER BY id LIMIT ?",
+			s.lastId, pollBatchSize,
+		)
+		if err != nil {
+			return err
+		}
+
+		messages := make([]*Message, 0)
+		count := 0
+
+		for rows.Next() {
+			var (
+				id     int64
+				origin string
+				data   []byte
+			)
+
+			err = rows.Scan(&id, &origin, &data)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+
+			count++
+			s.lastId = id
+
+			if origin == s.opts.NodeId {
+				continue
+			}
+
+			msg := &Message{}
+			err = json.Unmarshal(data, msg)
+			if err != nil {
+				continue
+			}
+
+			messages = append(messages, msg)
+		}
+
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+
+		for _, msg := range messages {
+			s.seq.receive(msg)
+		}
+
+		if count < pollBatchSize {
+			return nil
+		}
+	}
+}
@@ -4,11 +4,18 @@ import (
 	"errors"
 	"net"
 	"sync"
+
+	"github.com/blue-monads/potatoverse/backend/services/sockd/backplane"
+	"github.com/blue-monads/potatoverse/backend/services/sockd/roomlog"
+	"github.com/blue-monads/potatoverse/backend/utils/qq"
 )
 
 type BroadcastSockd struct {
 	rooms map[string]*Room
 	mu    sync.RWMutex
+
+	// peer nodes get every room message through it, nil when not clustered
+	backplane backplane.Backplane
 }
 
 func New() BroadcastSockd {
@@ -25,6 +32,8 @@ func newRoom(name string) *Room {
 		sessions:   make(map[int64]*session),
 		broadcast:  make(chan []byte, 32),
 		sLock:      sync.RWMutex{},
+		history:    roomlog.NewLog(0),
+		presence:   roomlog.NewPresence(),
 	}
 
 	// Start the Room Event Loop
@@ -46,6 +55,7 @@ func (s *BroadcastSockd) getRoom(roomName string, createIfNotExists bool) *Room
 			if sneakyRoom != nil {
 				return sneakyRoom
 			}
+			room.onMessage = s.relay
 			s.rooms[roomName] = room
 
 			go room.run()
@@ -56,12 +66,48 @@ func (s *BroadcastSockd) getRoom(roomName string, createIfNotExists bool) *Room
 }
 
 func (s *BroadcastSockd) AddConn(userId int64, conn net.Conn, connId int64, roomName string) (int64, error) {
+	return s.AddConnWithOptions(userId, conn, connId, roomName, ConnOptions{})
+}
+
+func (s *BroadcastSockd) AddConnWithOptions(userId int64, conn net.Conn, connId int64, roomName string, opts ConnOptions) (int64, error) {
 	room := s.getRoom(roomName, true)
 	if room == nil {
 		return 0, errors.New("room not found")
 	}
 
-	return room.AddConn(userId, conn, connId)
+	return room.AddConn(userId, conn, connId, opts)
+}
+
+// Resume is the reconnect handshake, the client sends the last seq it saw
+// in the room and gets everything after it before live messages
+func (s *BroadcastSockd) Resume(roomName string, connId int64, afterSeq uint64) error {
+	room := s.getRoom(roomName, false)
+	if room == nil {
+		return errors.New("room not found")
+	}
+
+	return room.Resume(connId, afterSeq)
+}
+
+// History returns the messages of a room after afterSeq, seqs are local
+// to this node so clients resume against the node they were on
+func (s *BroadcastSockd) History(roomName string, afterSeq uint64) ([]roomlog.Entry, bool) {
+	room := s.getRoom(roomName, false)
+	if room == nil {
+		return nil, afterSeq > 0
+	}
+
+	return room.History(afterSeq)
+}
+
+// Presence lists the users connected to the room on this node
+func (s *BroadcastSockd) Presence(roomName string) []int64 {
+	room := s.getRoom(roomName, false)
+	if room == nil {
+		return []int64{}
+	}
+
+	return room.Presence()
 }
 
 func (s *BroadcastSockd) RemoveConn(userId int64, connId int64, roomName string) error {
@@ -76,6 +122,16 @@ func (s *BroadcastSockd) RemoveConn(userId int64, connId int64, roomName string)
 
 func (s *BroadcastSockd) Broadcast(roomName string, message []byte) error {
 
+	s.relay(roomName, message)
+
+	return s.DeliverLocal(roomName, message)
+
+}
+
+// DeliverLocal sends to sockets on this node only, used for messages
+// coming from peers
+func (s *BroadcastSockd) DeliverLocal(roomName string, message []byte) error {
+
 	room := s.getRoom(roomName, false)
 	if room == nil {
 		return nil
@@ -84,3 +140,22 @@ func (s *BroadcastSockd) Broadcast(roomName string, message []byte) error {
 	return room.Broadcast(message)
 
 }
+
+func (s *BroadcastSockd) SetBackplane(bp backplane.Backplane) {
+	s.backplane = bp
+}
+
+func (s *BroadcastSockd) relay(roomName string, message []byte) {
+	if s.backplane == nil {
+		return
+	}
+
+	err := s.backplane.Publish(&backplane.Message{
+		Kind:    backplane.KindBroadcast,
+		Room:    roomName,
+		Payload: message,
+	})
+	if err != nil {
+		qq.Println("@BroadcastSockd/relay", roomName, err)
+	}
+}
@@ -1,11 +1,15 @@
 package broadcast
 
 import (
+	"encoding/json"
 	"errors"
 	"net"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/blue-monads/potatoverse/backend/services/sockd/roomlog"
+	"github.com/gobwas/ws/wsutil"
 )
 
 // mockConn is a mock implementation of net.Conn for testing
@@ -707,3 +711,63 @@ func TestAddConn_SameConnId_DifferentRooms(t *testing.T) {
 	}
 	room2.sLock.RUnlock()
 }
+
+func readFrame(t *testing.T, conn net.Conn) map[string]any {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+
+	msg, err := wsutil.ReadServerText(conn)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+
+	frame := map[string]any{}
+	if err := json.Unmarshal(msg, &frame); err != nil {
+		t.Fatalf("expected a frame, got %q", msg)
+	}
+
+	return frame
+}
+
+func TestResume_ReplaysMissedMessages(t *testing.T) {
+	sockd := New()
+
+	_, err := sockd.AddConn(1, newMockConn(), 100, "test-room")
+	if err != nil {
+		t.Fatalf("AddConn failed: %v", err)
+	}
+
+	sockd.Broadcast("test-room", []byte("one"))
+	sockd.Broadcast("test-room", []byte("two"))
+
+	server, client := net.Pipe()
+	defer client.Close()
+
+	connId, err := sockd.AddConnWithOptions(2, server, 200, "test-room", ConnOptions{Framed: true})
+	if err != nil {
+		t.Fatalf("AddConn failed: %v", err)
+	}
+
+	if frame := readFrame(t, client); frame["type"] != roomlog.FrameJoin {
+		t.Fatalf("expected own join, got %v", frame)
+	}
+
+	go sockd.Resume("test-room", connId, 0)
+
+	for _, want := range []string{"one", "two"} {
+		frame := readFrame(t, client)
+		if frame["type"] != roomlog.FrameMessage || frame["data"] != want {
+			t.Fatalf("expected %q, got %v", want, frame)
+		}
+	}
+
+	frame := readFrame(t, client)
+	if frame["type"] != roomlog.FrameResumed || frame["seq"] != float64(2) {
+		t.Fatalf("unexpected resumed frame %v", frame)
+	}
+
+	if users := sockd.Presence("test-room"); len(users) != 2 {
+		t.Fatalf("expected 2 users present, got %v", users)
+	}
+}
@@ -6,9 +6,21 @@ import (
 	"sync"
 	"time"
 
+	"github.com/blue-monads/potatoverse/backend/services/sockd/roomlog"
 	"github.com/blue-monads/potatoverse/backend/utils/qq"
 )
 
+var (
+	ErrConnNotFound = errors.New("connection not found")
+	ErrNotFramed    = errors.New("connection is not framed")
+)
+
+type ConnOptions struct {
+	// Framed connections get every message wrapped in a roomlog.Frame
+	// with its seq, plus join/leave events, resume needs it
+	Framed bool
+}
+
 type Room struct {
 	name string
 
@@ -18,14 +30,26 @@ type Room struct {
 	// sessions: ConnId -> Session Object
 	sessions map[int64]*session
 	sLock    sync.RWMutex
+
+	// messages sent by clients of this room are handed to it so peer
+	// nodes get them too
+	onMessage func(roomName string, message []byte)
+
+	// history of the room, hLock also orders broadcasts against resumes
+	// so a message is never replayed and sent live both
+	history *roomlog.Log
+	hLock   sync.Mutex
+
+	presence *roomlog.Presence
 }
 
-func (r *Room) AddConn(userId int64, conn net.Conn, connId int64) (int64, error) {
+func (r *Room) AddConn(userId int64, conn net.Conn, connId int64, opts ConnOptions) (int64, error) {
 	sess := &session{
 		room:   r,
 		connId: connId,
 		userId: userId,
 		conn:   conn,
+		framed: opts.Framed,
 		send:   make(chan []byte, 16),
 	}
 
@@ -41,6 +65,17 @@ func (r *Room) AddConn(userId int64, conn net.Conn, connId int64) (int64, error)
 		existingSess.teardown()
 	}
 
+	// a reconnect under the same connId is not a new member
+	if existingSess == nil || existingSess.userId != userId {
+		if existingSess != nil && r.presence.Leave(existingSess.userId) {
+			r.notify(roomlog.FrameLeave, existingSess.userId)
+		}
+
+		if r.presence.Join(userId) {
+			r.notify(roomlog.FrameJoin, userId)
+		}
+	}
+
 	return sess.connId, nil
 }
 
@@ -58,31 +93,58 @@ func (r *Room) RemoveConn(userId int64, connId int64) error {
 }
 
 func (r *Room) Broadcast(message []byte) error {
+	r.fanout(message)
+	return nil
+}
 
-	sessions := make([]*session, 0, len(r.sessions))
-
+// Resume replays to a framed connection what it missed after afterSeq,
+// it ends with a resumed frame carrying the seq to continue from
+func (r *Room) Resume(connId int64, afterSeq uint64) error {
 	r.sLock.RLock()
-	for _, sess := range r.sessions {
-		sessions = append(sessions, sess)
-	}
+	sess := r.sessions[connId]
 	r.sLock.RUnlock()
 
-	for _, sess := range sessions {
+	if sess == nil {
+		return ErrConnNotFound
+	}
 
-		tcan := time.After(time.Second * 5)
+	if !sess.framed {
+		return ErrNotFramed
+	}
 
-		select {
-		case sess.send <- message:
-			continue
-		case <-tcan:
-			qq.Println("@publish/timeout", sess.connId)
-			continue
-		}
+	r.hLock.Lock()
+	defer r.hLock.Unlock()
+
+	entries, gap := r.history.After(afterSeq)
+
+	for _, entry := range entries {
+		r.deliver(sess, (&roomlog.Frame{
+			Type: roomlog.FrameMessage,
+			Seq:  entry.Seq,
+			Data: entry.Payload,
+		}).Marshal())
 	}
 
+	r.deliver(sess, (&roomlog.Frame{
+		Type: roomlog.FrameResumed,
+		Seq:  r.history.LastSeq(),
+		Gap:  gap,
+	}).Marshal())
+
 	return nil
 }
 
+func (r *Room) History(afterSeq uint64) ([]roomlog.Entry, bool) {
+	r.hLock.Lock()
+	defer r.hLock.Unlock()
+
+	return r.history.After(afterSeq)
+}
+
+func (r *Room) Presence() []int64 {
+	return r.presence.Users()
+}
+
 // private
 
 func (r *Room) run() {
@@ -90,26 +152,10 @@ func (r *Room) run() {
 	for {
 		select {
 		case msg := <-r.broadcast:
-			copySess := make([]*session, 0, len(r.sessions))
-
-			r.sLock.RLock()
-			for _, sess := range r.sessions {
-				copySess = append(copySess, sess)
-			}
-			r.sLock.RUnlock()
-
-			for _, sess := range copySess {
-
-				tcan := time.After(time.Second * 5)
-
-				select {
-				case sess.send <- msg:
-					continue
-				case <-tcan:
-					qq.Println("@drop_message", sess.connId)
-					continue
-				}
+			r.fanout(msg)
 
+			if r.onMessage != nil {
+				r.onMessage(r.name, msg)
 			}
 
 		case connId := <-r.disconnect:
@@ -132,4 +178,76 @@ func (r *Room) cleanup(connId int64) {
 
 	sess.teardown()
 
+	if r.presence.Leave(sess.userId) {
+		r.notify(roomlog.FrameLeave, sess.userId)
+	}
+
+}
+
+// fanout records the message in history and sends it to every session
+func (r *Room) fanout(message []byte) {
+	r.hLock.Lock()
+	seq := r.history.Append(message)
+
+	r.sLock.RLock()
+	sessions := make([]*session, 0, len(r.sessions))
+	for _, sess := range r.sessions {
+		sessions = append(sessions, sess)
+	}
+	r.sLock.RUnlock()
+	r.hLock.Unlock()
+
+	var framed []byte
+
+	for _, sess := range sessions {
+		if !sess.framed {
+			r.deliver(sess, message)
+			continue
+		}
+
+		if framed == nil {
+			framed = (&roomlog.Frame{
+				Type: roomlog.FrameMessage,
+				Seq:  seq,
+				Data: message,
+			}).Marshal()
+		}
+
+		r.deliver(sess, framed)
+	}
+}
+
+// notify sends a presence event to every framed session of the room
+func (r *Room) notify(frameType string, userId int64) {
+	r.sLock.RLock()
+	sessions := make([]*session, 0, len(r.sessions))
+	for _, sess := range r.sessions {
+		if sess.framed {
+			sessions = append(sessions, sess)
+		}
+	}
+	r.sLock.RUnlock()
+
+	if len(sessions) == 0 {
+		return
+	}
+
+	frame := (&roomlog.Frame{
+		Type:   frameType,
+		UserId: userId,
+	}).Marshal()
+
+	for _, sess := range sessions {
+		r.deliver(sess, frame)
+	}
+}
+
+func (r *Room) deliver(sess *session, message []byte) {
+	tcan := time.After(time.Second * 5)
+
+	select {
+	case sess.send <- message:
+	case <-tcan:
+		qq.Println("@drop_message", sess.connId)
+	}
 }
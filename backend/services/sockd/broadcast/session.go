@@ -18,6 +18,10 @@ type session struct {
 	userId int64
 	conn   net.Conn
 
+	// framed sessions get roomlog frames with seqs and presence events
+	// instead of raw payloads
+	framed bool
+
 	send             chan []byte
 	once             sync.Once
 	closedAndCleaned bool
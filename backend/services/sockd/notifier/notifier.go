@@ -1,6 +1,7 @@
 package notifier
 
 import (
+	"encoding/json"
 	"errors"
 	"net"
 	"sync"
@@ -8,6 +9,7 @@ import (
 	"time"
 
 	"github.com/blue-monads/potatoverse/backend/services/datahub/dbmodels"
+	"github.com/blue-monads/potatoverse/backend/services/sockd/backplane"
 	"github.com/blue-monads/potatoverse/backend/utils/qq"
 )
 
@@ -19,6 +21,10 @@ type Notifier struct {
 	connIdCounter atomic.Int64
 
 	cleanConnChan chan int64
+
+	// users connected to peer nodes are reached through it, nil when
+	// not clustered
+	backplane backplane.Backplane
 }
 
 func (n *Notifier) Run() {
@@ -97,17 +103,27 @@ func (n *Notifier) RemoveUserConnection(userId int64, connId int64) error {
 }
 
 func (n *Notifier) SendUserMessage(userId int64, msg *dbmodels.UserMessage) error {
-
-	room := n.getUserRoom(userId)
-	if room == nil {
-		return nil // User has no connections
+	message, err := json.Marshal(msg)
+	if err != nil {
+		return err
 	}
 
-	return room.SendUserMessage(msg)
-
+	return n.SendUser(userId, message)
 }
 
 func (n *Notifier) SendUser(userId int64, message []byte) error {
+	n.relay(&backplane.Message{
+		Kind:    backplane.KindUser,
+		UserId:  userId,
+		Payload: message,
+	})
+
+	return n.DeliverUser(userId, message)
+}
+
+// DeliverUser sends to connections on this node only, used for messages
+// coming from peers
+func (n *Notifier) DeliverUser(userId int64, message []byte) error {
 	room := n.getUserRoom(userId)
 	if room == nil {
 		return nil // User has no connections
@@ -117,6 +133,16 @@ func (n *Notifier) SendUser(userId int64, message []byte) error {
 }
 
 func (n *Notifier) BroadcastGroup(groupName string, message []byte) error {
+	n.relay(&backplane.Message{
+		Kind:    backplane.KindGroup,
+		Group:   groupName,
+		Payload: message,
+	})
+
+	return n.DeliverGroup(groupName, message)
+}
+
+func (n *Notifier) DeliverGroup(groupName string, message []byte) error {
 
 	n.mu.RLock()
 	rooms := make([]*UserRoom, 0)
@@ -148,6 +174,15 @@ func (n *Notifier) BroadcastGroup(groupName string, message []byte) error {
 }
 
 func (n *Notifier) BroadcastAll(message []byte) error {
+	n.relay(&backplane.Message{
+		Kind:    backplane.KindAll,
+		Payload: message,
+	})
+
+	return n.DeliverAll(message)
+}
+
+func (n *Notifier) DeliverAll(message []byte) error {
 
 	n.mu.RLock()
 	rooms := make([]*UserRoom, 0, len(n.userConnections))
@@ -175,3 +210,18 @@ func (n *Notifier) BroadcastAll(message []byte) error {
 
 	return nil
 }
+
+func (n *Notifier) SetBackplane(bp backplane.Backplane) {
+	n.backplane = bp
+}
+
+func (n *Notifier) relay(msg *backplane.Message) {
+	if n.backplane == nil {
+		return
+	}
+
+	err := n.backplane.Publish(msg)
+	if err != nil {
+		qq.Println("@Notifier/relay", msg.Kind, err)
+	}
+}
@@ -4,11 +4,18 @@ import (
 	"errors"
 	"net"
 	"sync"
+
+	"github.com/blue-monads/potatoverse/backend/services/sockd/backplane"
+	"github.com/blue-monads/potatoverse/backend/services/sockd/roomlog"
+	"github.com/blue-monads/potatoverse/backend/utils/qq"
 )
 
 type PubSubSockd struct {
 	rooms map[string]*Room
 	mu    sync.RWMutex
+
+	// peer nodes get every publish through it, nil when not clustered
+	backplane backplane.Backplane
 }
 
 func New() PubSubSockd {
@@ -23,6 +30,8 @@ func newRoom(name string) *Room {
 		disconnect: make(chan int64, 32), // Buffer for burst disconnects
 		topics:     make(map[string]map[int64]bool),
 		sessions:   make(map[int64]*session),
+		history:    make(map[string]*roomlog.Log),
+		presence:   roomlog.NewPresence(),
 	}
 
 	// Start the Room Event Loop
@@ -53,12 +62,16 @@ func (s *PubSubSockd) getRoom(roomName string, createIfNotExists bool) *Room {
 }
 
 func (s *PubSubSockd) AddConn(userId int64, conn net.Conn, connId int64, roomName string) (int64, error) {
+	return s.AddConnWithOptions(userId, conn, connId, roomName, ConnOptions{})
+}
+
+func (s *PubSubSockd) AddConnWithOptions(userId int64, conn net.Conn, connId int64, roomName string, opts ConnOptions) (int64, error) {
 	room := s.getRoom(roomName, true)
 	if room == nil {
 		return 0, errors.New("room not found")
 	}
 
-	return room.AddConn(userId, conn, connId)
+	return room.AddConn(userId, conn, connId, opts)
 
 }
 
@@ -73,6 +86,25 @@ func (s *PubSubSockd) RemoveConn(userId int64, connId int64, roomName string) er
 }
 
 func (s *PubSubSockd) Publish(roomName string, topicName string, message []byte) error {
+	if s.backplane != nil {
+		err := s.backplane.Publish(&backplane.Message{
+			Kind:    backplane.KindPublish,
+			Room:    roomName,
+			Topic:   topicName,
+			Payload: message,
+		})
+		if err != nil {
+			qq.Println("@PubSubSockd/Publish/relay", roomName, err)
+		}
+	}
+
+	return s.DeliverLocal(roomName, topicName, message)
+
+}
+
+// DeliverLocal publishes to subscribers on this node only, used for
+// messages coming from peers
+func (s *PubSubSockd) DeliverLocal(roomName string, topicName string, message []byte) error {
 	room := s.getRoom(roomName, false)
 	if room == nil {
 		return nil
@@ -82,6 +114,10 @@ func (s *PubSubSockd) Publish(roomName string, topicName string, message []byte)
 
 }
 
+func (s *PubSubSockd) SetBackplane(bp backplane.Backplane) {
+	s.backplane = bp
+}
+
 func (s *PubSubSockd) AddSub(roomName string, topicName string, userId int64, connId int64, conn net.Conn) error {
 	room := s.getRoom(roomName, false)
 	if room == nil {
@@ -91,3 +127,38 @@ func (s *PubSubSockd) AddSub(roomName string, topicName string, userId int64, co
 	return room.AddSub(topicName, userId, connId)
 
 }
+
+// Resume is the reconnect handshake, the client sends the last seq it saw
+// for a topic and gets everything after it before live messages
+func (s *PubSubSockd) Resume(roomName string, topicName string, userId int64, connId int64, afterSeq uint64) error {
+	room := s.getRoom(roomName, false)
+	if room == nil {
+		return errors.New("room not found")
+	}
+
+	return room.Resume(topicName, userId, connId, afterSeq)
+
+}
+
+// History returns the messages of a topic after afterSeq, seqs are local
+// to this node so clients resume against the node they were on
+func (s *PubSubSockd) History(roomName string, topicName string, afterSeq uint64) ([]roomlog.Entry, bool) {
+	room := s.getRoom(roomName, false)
+	if room == nil {
+		return nil, afterSeq > 0
+	}
+
+	return room.History(topicName, afterSeq)
+
+}
+
+// Presence lists the users connected to the room on this node
+func (s *PubSubSockd) Presence(roomName string) []int64 {
+	room := s.getRoom(roomName, false)
+	if room == nil {
+		return []int64{}
+	}
+
+	return room.Presence()
+
+}
@@ -1,11 +1,15 @@
 package pubsub
 
 import (
+	"encoding/json"
 	"errors"
 	"net"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/blue-monads/potatoverse/backend/services/sockd/roomlog"
+	"github.com/gobwas/ws/wsutil"
 )
 
 // mockConn is a mock implementation of net.Conn for testing
@@ -1102,3 +1106,110 @@ func TestRemoveConn_BusyRoom(t *testing.T) {
 	// Wait a bit
 	time.Sleep(200 * time.Millisecond)
 }
+
+func readFrame(t *testing.T, conn net.Conn) map[string]any {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+
+	msg, err := wsutil.ReadServerText(conn)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+
+	frame := map[string]any{}
+	if err := json.Unmarshal(msg, &frame); err != nil {
+		t.Fatalf("expected a frame, got %q", msg)
+	}
+
+	return frame
+}
+
+func TestResume_ReplaysMissedMessages(t *testing.T) {
+	sockd := New()
+
+	// someone has to be in the room for it to exist
+	_, err := sockd.AddConn(1, newMockConn(), 100, "test-room")
+	if err != nil {
+		t.Fatalf("AddConn failed: %v", err)
+	}
+
+	for _, m := range []string{"one", "two", "three"} {
+		sockd.Publish("test-room", "topic1", []byte(m))
+	}
+
+	entries, gap := sockd.History("test-room", "topic1", 1)
+	if gap || len(entries) != 2 || string(entries[0].Payload) != "two" {
+		t.Fatalf("unexpected history %v gap %v", entries, gap)
+	}
+
+	server, client := net.Pipe()
+	defer client.Close()
+
+	connId, err := sockd.AddConnWithOptions(2, server, 200, "test-room", ConnOptions{Framed: true})
+	if err != nil {
+		t.Fatalf("AddConn failed: %v", err)
+	}
+
+	if frame := readFrame(t, client); frame["type"] != roomlog.FrameJoin || frame["user_id"] != float64(2) {
+		t.Fatalf("expected own join, got %v", frame)
+	}
+
+	go sockd.Resume("test-room", "topic1", 2, connId, 1)
+
+	for _, want := range []string{"two", "three"} {
+		frame := readFrame(t, client)
+		if frame["type"] != roomlog.FrameMessage || frame["data"] != want {
+			t.Fatalf("expected %q, got %v", want, frame)
+		}
+	}
+
+	frame := readFrame(t, client)
+	if frame["type"] != roomlog.FrameResumed || frame["seq"] != float64(3) || frame["gap"] != nil {
+		t.Fatalf("unexpected resumed frame %v", frame)
+	}
+
+	go sockd.Publish("test-room", "topic1", []byte(`{"live":true}`))
+
+	frame = readFrame(t, client)
+	if frame["seq"] != float64(4) || frame["topic"] != "topic1" {
+		t.Fatalf("unexpected live frame %v", frame)
+	}
+
+	if err := sockd.Resume("test-room", "topic1", 1, 100, 0); err != ErrNotFramed {
+		t.Fatalf("expected ErrNotFramed, got %v", err)
+	}
+}
+
+func TestPresence_JoinLeave(t *testing.T) {
+	sockd := New()
+
+	server, client := net.Pipe()
+	defer client.Close()
+
+	_, err := sockd.AddConnWithOptions(1, server, 100, "test-room", ConnOptions{Framed: true})
+	if err != nil {
+		t.Fatalf("AddConn failed: %v", err)
+	}
+	readFrame(t, client)
+
+	go sockd.AddConn(2, newMockConn(), 200, "test-room")
+
+	if frame := readFrame(t, client); frame["type"] != roomlog.FrameJoin || frame["user_id"] != float64(2) {
+		t.Fatalf("expected join of user 2, got %v", frame)
+	}
+
+	if users := sockd.Presence("test-room"); len(users) != 2 {
+		t.Fatalf("expected 2 users present, got %v", users)
+	}
+
+	sockd.RemoveConn(2, 200, "test-room")
+
+	if frame := readFrame(t, client); frame["type"] != roomlog.FrameLeave || frame["user_id"] != float64(2) {
+		t.Fatalf("expected leave of user 2, got %v", frame)
+	}
+
+	if users := sockd.Presence("test-room"); len(users) != 1 || users[0] != 1 {
+		t.Fatalf("expected only user 1 present, got %v", users)
+	}
+}
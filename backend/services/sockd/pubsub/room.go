@@ -6,9 +6,21 @@ import (
 	"sync"
 	"time"
 
+	"github.com/blue-monads/potatoverse/backend/services/sockd/roomlog"
 	"github.com/blue-monads/potatoverse/backend/utils/qq"
 )
 
+var (
+	ErrConnNotFound = errors.New("connection not found")
+	ErrNotFramed    = errors.New("connection is not framed")
+)
+
+type ConnOptions struct {
+	// Framed connections get every message wrapped in a roomlog.Frame
+	// with its seq, plus join/leave events, resume needs it
+	Framed bool
+}
+
 type Room struct {
 	name string
 
@@ -20,6 +32,14 @@ type Room struct {
 	// sessions: ConnId -> Session Object
 	sessions map[int64]*session
 	sLock    sync.RWMutex
+
+	// history: TopicName -> bounded log, hLock also orders publishes
+	// against resumes so a message is never replayed and sent live both
+	history     map[string]*roomlog.Log
+	historySize int
+	hLock       sync.Mutex
+
+	presence *roomlog.Presence
 }
 
 func (r *Room) run() {
@@ -28,13 +48,14 @@ func (r *Room) run() {
 	}
 }
 
-func (r *Room) AddConn(userId int64, conn net.Conn, connId int64) (int64, error) {
+func (r *Room) AddConn(userId int64, conn net.Conn, connId int64, opts ConnOptions) (int64, error) {
 
 	sess := &session{
 		room:   r, // Link back to room
 		connId: connId,
 		userId: userId,
 		conn:   conn,
+		framed: opts.Framed,
 		send:   make(chan []byte, 16),
 	}
 
@@ -49,6 +70,17 @@ func (r *Room) AddConn(userId int64, conn net.Conn, connId int64) (int64, error)
 		existingSess.teardown()
 	}
 
+	// a reconnect under the same connId is not a new member
+	if existingSess == nil || existingSess.userId != userId {
+		if existingSess != nil && r.presence.Leave(existingSess.userId) {
+			r.notify(roomlog.FrameLeave, existingSess.userId)
+		}
+
+		if r.presence.Join(userId) {
+			r.notify(roomlog.FrameJoin, userId)
+		}
+	}
+
 	return sess.connId, nil
 }
 
@@ -72,13 +104,12 @@ func (r *Room) RemoveConn(userId int64, connId int64) error {
 
 func (r *Room) Publish(topicName string, message []byte) error {
 
+	r.hLock.Lock()
+	seq := r.topicLog(topicName).Append(message)
+
 	// Get Subscribers
 	r.tLock.RLock()
-	subMap, ok := r.topics[topicName]
-	if !ok || len(subMap) == 0 {
-		r.tLock.RUnlock()
-		return nil
-	}
+	subMap := r.topics[topicName]
 
 	// Snapshot IDs
 	ids := make([]int64, 0, len(subMap))
@@ -86,11 +117,16 @@ func (r *Room) Publish(topicName string, message []byte) error {
 		ids = append(ids, id)
 	}
 	r.tLock.RUnlock()
+	r.hLock.Unlock()
+
+	if len(ids) == 0 {
+		return nil
+	}
 
 	// Send
 
 	r.sLock.RLock()
-	sessions := make([]*session, 0, len(subMap))
+	sessions := make([]*session, 0, len(ids))
 	for _, id := range ids {
 		if sess, ok := r.sessions[id]; ok {
 			sessions = append(sessions, sess)
@@ -98,22 +134,82 @@ func (r *Room) Publish(topicName string, message []byte) error {
 	}
 	r.sLock.RUnlock()
 
-	for _, sess := range sessions {
+	var framed []byte
 
-		tcan := time.After(time.Second * 5)
-
-		select {
-		case sess.send <- message:
-			continue
-		case <-tcan:
-			qq.Println("@publish/timeout", sess.connId)
+	for _, sess := range sessions {
+		if !sess.framed {
+			r.deliver(sess, message)
 			continue
 		}
+
+		if framed == nil {
+			framed = (&roomlog.Frame{
+				Type:  roomlog.FrameMessage,
+				Topic: topicName,
+				Seq:   seq,
+				Data:  message,
+			}).Marshal()
+		}
+
+		r.deliver(sess, framed)
+	}
+
+	return nil
+}
+
+// Resume subscribes a framed connection and replays what it missed after
+// afterSeq, it ends with a resumed frame carrying the seq to continue from
+func (r *Room) Resume(topicName string, userId int64, connId int64, afterSeq uint64) error {
+	r.sLock.RLock()
+	sess := r.sessions[connId]
+	r.sLock.RUnlock()
+
+	if sess == nil {
+		return ErrConnNotFound
+	}
+
+	if !sess.framed {
+		return ErrNotFramed
 	}
 
+	r.hLock.Lock()
+	defer r.hLock.Unlock()
+
+	r.AddSub(topicName, userId, connId)
+
+	log := r.topicLog(topicName)
+	entries, gap := log.After(afterSeq)
+
+	for _, entry := range entries {
+		r.deliver(sess, (&roomlog.Frame{
+			Type:  roomlog.FrameMessage,
+			Topic: topicName,
+			Seq:   entry.Seq,
+			Data:  entry.Payload,
+		}).Marshal())
+	}
+
+	r.deliver(sess, (&roomlog.Frame{
+		Type:  roomlog.FrameResumed,
+		Topic: topicName,
+		Seq:   log.LastSeq(),
+		Gap:   gap,
+	}).Marshal())
+
 	return nil
 }
 
+func (r *Room) History(topicName string, afterSeq uint64) ([]roomlog.Entry, bool) {
+	r.hLock.Lock()
+	defer r.hLock.Unlock()
+
+	return r.topicLog(topicName).After(afterSeq)
+}
+
+func (r *Room) Presence() []int64 {
+	return r.presence.Users()
+}
+
 func (r *Room) AddSub(topicName string, userId int64, connId int64) error {
 	r.tLock.Lock()
 	if r.topics[topicName] == nil {
@@ -140,6 +236,10 @@ func (r *Room) cleanup(connId int64) {
 
 	sess.teardown()
 
+	if r.presence.Leave(sess.userId) {
+		r.notify(roomlog.FrameLeave, sess.userId)
+	}
+
 	r.tLock.Lock()
 	for topicName, subscribers := range r.topics {
 		if _, ok := subscribers[connId]; ok {
@@ -152,3 +252,49 @@ func (r *Room) cleanup(connId int64) {
 	}
 	r.tLock.Unlock()
 }
+
+// topicLog returns the history of a topic, hLock must be held
+func (r *Room) topicLog(topicName string) *roomlog.Log {
+	log, ok := r.history[topicName]
+	if !ok {
+		log = roomlog.NewLog(r.historySize)
+		r.history[topicName] = log
+	}
+
+	return log
+}
+
+// notify sends a presence event to every framed session of the room
+func (r *Room) notify(frameType string, userId int64) {
+	r.sLock.RLock()
+	sessions := make([]*session, 0, len(r.sessions))
+	for _, sess := range r.sessions {
+		if sess.framed {
+			sessions = append(sessions, sess)
+		}
+	}
+	r.sLock.RUnlock()
+
+	if len(sessions) == 0 {
+		return
+	}
+
+	frame := (&roomlog.Frame{
+		Type:   frameType,
+		UserId: userId,
+	}).Marshal()
+
+	for _, sess := range sessions {
+		r.deliver(sess, frame)
+	}
+}
+
+func (r *Room) deliver(sess *session, message []byte) {
+	tcan := time.After(time.Second * 5)
+
+	select {
+	case sess.send <- message:
+	case <-tcan:
+		qq.Println("@publish/timeout", sess.connId)
+	}
+}
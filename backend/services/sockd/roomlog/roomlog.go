@@ -0,0 +1,171 @@
+package roomlog
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultHistorySize = 256
+
+	FrameMessage = "message"
+	FrameJoin    = "join"
+	FrameLeave   = "leave"
+	FrameResumed = "resumed"
+)
+
+// Frame is what framed connections get instead of the raw payload, it
+// carries the seq a reconnecting client hands back to resume from
+type Frame struct {
+	Type   string `json:"type"`
+	Topic  string `json:"topic,omitempty"`
+	Seq    uint64 `json:"seq,omitempty"`
+	UserId int64  `json:"user_id,omitempty"`
+	// Gap is set on resumed frames when history did not reach back far
+	// enough, the client has to refetch whatever it missed
+	Gap  bool   `json:"gap,omitempty"`
+	Data []byte `json:"-"`
+}
+
+func (f *Frame) Marshal() []byte {
+	type wire struct {
+		Frame
+		Data any `json:"data,omitempty"`
+	}
+
+	w := wire{Frame: *f}
+
+	if f.Data != nil {
+		if json.Valid(f.Data) {
+			w.Data = json.RawMessage(f.Data)
+		} else {
+			w.Data = string(f.Data)
+		}
+	}
+
+	out, _ := json.Marshal(w)
+	return out
+}
+
+type Entry struct {
+	Seq     uint64    `json:"seq"`
+	Payload []byte    `json:"payload"`
+	At      time.Time `json:"at"`
+}
+
+// Log is a bounded history of one stream, seqs start at 1 and keep
+// growing for the lifetime of the room
+type Log struct {
+	size    int
+	seq     uint64
+	entries []Entry
+}
+
+func NewLog(size int) *Log {
+	if size <= 0 {
+		size = DefaultHistorySize
+	}
+
+	return &Log{
+		size:    size,
+		entries: make([]Entry, 0, size),
+	}
+}
+
+func (l *Log) Append(payload []byte) uint64 {
+	l.seq++
+
+	if len(l.entries) == l.size {
+		copy(l.entries, l.entries[1:])
+		l.entries = l.entries[:l.size-1]
+	}
+
+	l.entries = append(l.entries, Entry{
+		Seq:     l.seq,
+		Payload: payload,
+		At:      time.Now(),
+	})
+
+	return l.seq
+}
+
+func (l *Log) LastSeq() uint64 {
+	return l.seq
+}
+
+// After returns entries newer than seq, gap is true when some of them
+// already fell out of the history or the room was started over since
+func (l *Log) After(seq uint64) (entries []Entry, gap bool) {
+	if seq > l.seq {
+		return nil, true
+	}
+
+	if seq == l.seq {
+		return nil, false
+	}
+
+	for i, entry := range l.entries {
+		if entry.Seq > seq {
+			gap = entry.Seq > seq+1
+			entries = make([]Entry, len(l.entries)-i)
+			copy(entries, l.entries[i:])
+			return entries, gap
+		}
+	}
+
+	return nil, true
+}
+
+// Presence counts connections per user so a user with several tabs open
+// joins once and leaves with the last one
+type Presence struct {
+	users map[int64]int
+	lock  sync.Mutex
+}
+
+func NewPresence() *Presence {
+	return &Presence{
+		users: make(map[int64]int),
+	}
+}
+
+// Join returns true when this is the first connection of the user
+func (p *Presence) Join(userId int64) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.users[userId]++
+	return p.users[userId] == 1
+}
+
+// Leave returns true when the last connection of the user is gone
+func (p *Presence) Leave(userId int64) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	count, ok := p.users[userId]
+	if !ok {
+		return false
+	}
+
+	if count <= 1 {
+		delete(p.users, userId)
+		return true
+	}
+
+	p.users[userId] = count - 1
+	return false
+}
+
+func (p *Presence) Users() []int64 {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	users := make([]int64, 0, len(p.users))
+	for userId := range p.users {
+		users = append(users, userId)
+	}
+
+	return users
+}
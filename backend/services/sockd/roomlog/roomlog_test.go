@@ -0,0 +1,77 @@
+package roomlog
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestLog_After(t *testing.T) {
+	log := NewLog(3)
+
+	for _, p := range []string{"1", "2", "3", "4", "5"} {
+		log.Append([]byte(p))
+	}
+
+	if log.LastSeq() != 5 {
+		t.Fatalf("expected last seq 5, got %d", log.LastSeq())
+	}
+
+	entries, gap := log.After(3)
+	if gap || len(entries) != 2 || entries[0].Seq != 4 || entries[1].Seq != 5 {
+		t.Fatalf("unexpected entries %v gap %v", entries, gap)
+	}
+
+	// 2 already fell out of the history
+	entries, gap = log.After(1)
+	if !gap || len(entries) != 3 || entries[0].Seq != 3 {
+		t.Fatalf("expected gap with 3 entries, got %v gap %v", entries, gap)
+	}
+
+	entries, gap = log.After(5)
+	if gap || len(entries) != 0 {
+		t.Fatalf("expected nothing new, got %v gap %v", entries, gap)
+	}
+
+	// seq from before a restart
+	_, gap = log.After(10)
+	if !gap {
+		t.Fatal("expected gap for seq ahead of the log")
+	}
+}
+
+func TestPresence(t *testing.T) {
+	p := NewPresence()
+
+	if !p.Join(1) {
+		t.Fatal("first connection should join")
+	}
+	if p.Join(1) {
+		t.Fatal("second connection should not join again")
+	}
+	if p.Leave(1) {
+		t.Fatal("user still has a connection")
+	}
+	if !p.Leave(1) {
+		t.Fatal("last connection should leave")
+	}
+	if p.Leave(1) {
+		t.Fatal("unknown user should not leave")
+	}
+	if len(p.Users()) != 0 {
+		t.Fatalf("expected no users, got %v", p.Users())
+	}
+}
+
+func TestFrame_Marshal(t *testing.T) {
+	out := map[string]any{}
+
+	json.Unmarshal((&Frame{Type: FrameMessage, Seq: 2, Data: []byte(`{"a":1}`)}).Marshal(), &out)
+	if data, ok := out["data"].(map[string]any); !ok || data["a"] != float64(1) {
+		t.Fatalf("json payload should be embedded, got %v", out)
+	}
+
+	json.Unmarshal((&Frame{Type: FrameMessage, Seq: 3, Data: []byte("plain")}).Marshal(), &out)
+	if out["data"] != "plain" || out["seq"] != float64(3) {
+		t.Fatalf("text payload should be a string, got %v", out)
+	}
+}
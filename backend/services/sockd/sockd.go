@@ -1,24 +1,41 @@
 package sockd
 
 import (
+	"github.com/blue-monads/potatoverse/backend/services/sockd/backplane"
 	"github.com/blue-monads/potatoverse/backend/services/sockd/broadcast"
 	"github.com/blue-monads/potatoverse/backend/services/sockd/notifier"
 	"github.com/blue-monads/potatoverse/backend/services/sockd/pubsub"
+	"github.com/blue-monads/potatoverse/backend/utils/qq"
 )
 
 type Sockd struct {
 	broadcast broadcast.BroadcastSockd
 	pubsub    pubsub.PubSubSockd
 	notifier  notifier.Notifier
+
+	backplane backplane.Backplane
 }
 
+// NewSockd serves sockets of this node only, its backplane has no peers
 func NewSockd() *Sockd {
+	return NewClusterSockd(backplane.NewLocal("local"))
+}
+
+// NewClusterSockd fans out to sockets on peer nodes through bp
+func NewClusterSockd(bp backplane.Backplane) *Sockd {
 	s := &Sockd{
 		broadcast: broadcast.New(),
 		pubsub:    pubsub.New(),
 		notifier:  notifier.New(),
+		backplane: bp,
 	}
 
+	s.broadcast.SetBackplane(bp)
+	s.pubsub.SetBackplane(bp)
+	s.notifier.SetBackplane(bp)
+
+	bp.Subscribe(s.handlePeerMessage)
+
 	go s.notifier.Run()
 
 	return s
@@ -35,3 +52,32 @@ func (s *Sockd) GetPubSub() *pubsub.PubSubSockd {
 func (s *Sockd) GetNotifier() *notifier.Notifier {
 	return &s.notifier
 }
+
+func (s *Sockd) GetBackplane() backplane.Backplane {
+	return s.backplane
+}
+
+func (s *Sockd) Close() error {
+	return s.backplane.Close()
+}
+
+func (s *Sockd) handlePeerMessage(msg *backplane.Message) {
+	var err error
+
+	switch msg.Kind {
+	case backplane.KindBroadcast:
+		err = s.broadcast.DeliverLocal(msg.Room, msg.Payload)
+	case backplane.KindPublish:
+		err = s.pubsub.DeliverLocal(msg.Room, msg.Topic, msg.Payload)
+	case backplane.KindUser:
+		err = s.notifier.DeliverUser(msg.UserId, msg.Payload)
+	case backplane.KindGroup:
+		err = s.notifier.DeliverGroup(msg.Group, msg.Payload)
+	case backplane.KindAll:
+		err = s.notifier.DeliverAll(msg.Payload)
+	}
+
+	if err != nil {
+		qq.Println("@Sockd/handlePeerMessage", msg.Kind, err)
+	}
+}
@@ -0,0 +1,76 @@
+package sockd
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/blue-monads/potatoverse/backend/services/sockd/backplane"
+	"github.com/gobwas/ws/wsutil"
+)
+
+func readText(t *testing.T, conn net.Conn) string {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+
+	msg, err := wsutil.ReadServerText(conn)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+
+	return string(msg)
+}
+
+func TestClusterSockd_ReachesPeerSockets(t *testing.T) {
+	hub := backplane.NewHub()
+
+	nodeA := NewClusterSockd(hub.Join("a"))
+	nodeB := NewClusterSockd(hub.Join("b"))
+	defer nodeA.Close()
+	defer nodeB.Close()
+
+	// notifier user connected to node b
+	userServer, userClient := net.Pipe()
+	defer userClient.Close()
+
+	_, err := nodeB.GetNotifier().AddUserConnection(7, "admin", userServer)
+	if err != nil {
+		t.Fatalf("add user conn: %v", err)
+	}
+
+	// pubsub subscriber connected to node b
+	subServer, subClient := net.Pipe()
+	defer subClient.Close()
+
+	pubsub := nodeB.GetPubSub()
+	connId, err := pubsub.AddConn(7, subServer, 1, "room1")
+	if err != nil {
+		t.Fatalf("add pubsub conn: %v", err)
+	}
+	pubsub.AddSub("room1", "topic1", 7, connId, subServer)
+
+	// broadcast socket connected to node b
+	bcServer, bcClient := net.Pipe()
+	defer bcClient.Close()
+
+	_, err = nodeB.GetBroadcast().AddConn(7, bcServer, 1, "room1")
+	if err != nil {
+		t.Fatalf("add broadcast conn: %v", err)
+	}
+
+	nodeA.GetNotifier().SendUser(7, []byte(`{"id":1}`))
+	if got := readText(t, userClient); got != `{"id":1}` {
+		t.Fatalf("unexpected user message %q", got)
+	}
+
+	nodeA.GetPubSub().Publish("room1", "topic1", []byte("published"))
+	if got := readText(t, subClient); got != "published" {
+		t.Fatalf("unexpected pubsub message %q", got)
+	}
+
+	nodeA.GetBroadcast().Broadcast("room1", []byte("broadcasted"))
+	if got := readText(t, bcClient); got != "broadcasted" {
+		t.Fatalf("unexpected broadcast message %q", got)
+	}
+}
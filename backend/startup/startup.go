@@ -4,6 +4,7 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/blue-monads/potatoverse/backend/app"
 	"github.com/blue-monads/potatoverse/backend/app/actions"
@@ -58,7 +59,7 @@ func BuildApp(options *xtypes.AppOptions, seedDB bool) (*app.App, error) {
 	happ := app.New(app.Option{
 		Database: db,
 		Logger:   logger,
-		Signer:   signer.New([]byte(options.MasterSecret)),
+		Signer:   signer.NewWithOptions([]byte(options.MasterSecret), signerOptions(options.Tokens, logger)),
 		AppOpts: &xtypes.AppOptions{
 			Port:         options.Port,
 			Hosts:        options.Hosts,
@@ -69,6 +70,14 @@ func BuildApp(options *xtypes.AppOptions, seedDB bool) (*app.App, error) {
 			SocketFile:   options.SocketFile,
 			Mailer:       options.Mailer,
 			Repos:        options.Repos,
+			EventHub:     options.EventHub,
+			Sockd:        options.Sockd,
+			Updates:      options.Updates,
+			Tokens:       options.Tokens,
+			OIDC:         options.OIDC,
+			OIDCProvider: options.OIDCProvider,
+
+			AllowPrivateUpstreams: options.AllowPrivateUpstreams,
 		},
 		Mailer:            m,
 		WorkingFolderBase: options.WorkingDir,
@@ -126,3 +135,38 @@ func BuildApp(options *xtypes.AppOptions, seedDB bool) (*app.App, error) {
 
 	return happ, nil
 }
+
+func signerOptions(opts *xtypes.TokenOptions, logger *slog.Logger) signer.Options {
+	sopts := signer.Options{}
+	if opts == nil {
+		return sopts
+	}
+
+	sopts.TTLs = make(map[uint16]time.Duration)
+	for name, seconds := range opts.TTLs {
+		typeid, ok := signer.TokenTypeNames[name]
+		if !ok {
+			logger.Warn("unknown token type in ttls", "name", name)
+			continue
+		}
+		sopts.TTLs[typeid] = time.Duration(seconds) * time.Second
+	}
+
+	for _, prev := range opts.PreviousSecrets {
+		until, err := time.Parse(time.RFC3339, prev.Until)
+		if err != nil {
+			until, err = time.ParseInLocation(time.DateOnly, prev.Until, time.Local)
+		}
+		if err != nil || prev.Secret == "" {
+			logger.Warn("skipping previous master secret, needs a secret and an until date", "until", prev.Until)
+			continue
+		}
+
+		sopts.PreviousKeys = append(sopts.PreviousKeys, signer.PreviousKey{
+			Key:   []byte(prev.Secret),
+			Until: until,
+		})
+	}
+
+	return sopts
+}
@@ -37,6 +37,11 @@ func GetFullUrl(domain string, path string, port int, isSecure bool) string {
 
 func BuildExecHost(currHost string, spaceId int64, hosts []string, serverKey string) string {
 
+	// tunnel hosts are not in hosts, the sub origin is derived from the node id
+	if execHost, ok := buildBuddyExecHost(currHost, spaceId); ok {
+		return execHost
+	}
+
 	bestHost := findBestHost(hosts, currHost)
 	if bestHost == "" {
 		return currHost
@@ -66,6 +71,37 @@ func findBestHost(hosts []string, currHost string) string {
 
 var spaceIdPattern = regexp.MustCompile(`zz-(\d+)-`)
 
+// tunnel subdomains, buddy-<nodeid> and zz-<space_id>-buddy-<nodeid>
+var buddySubdomainPattern = regexp.MustCompile(`^(?:zz-(\d+)-)?buddy-([a-z0-9]+)$`)
+
+// ParseBuddySubdomain returns node id and space id (0 for the plain buddy
+// host) of a tunnel subdomain
+func ParseBuddySubdomain(subdomain string) (string, int64, bool) {
+	matches := buddySubdomainPattern.FindStringSubmatch(subdomain)
+	if matches == nil {
+		return "", 0, false
+	}
+
+	spaceId := int64(0)
+	if matches[1] != "" {
+		spaceId, _ = strconv.ParseInt(matches[1], 10, 64)
+	}
+
+	return matches[2], spaceId, true
+}
+
+// buddy-abc.hq.com:8080 -> zz-12-buddy-abc.hq.com:8080
+func buildBuddyExecHost(currHost string, spaceId int64) (string, bool) {
+	label, rest, _ := strings.Cut(currHost, ".")
+
+	nodeId, _, ok := ParseBuddySubdomain(label)
+	if !ok || rest == "" {
+		return "", false
+	}
+
+	return fmt.Sprintf("zz-%d-buddy-%s.%s", spaceId, nodeId, rest), true
+}
+
 func ExtractSpaceId(domain string) int64 {
 	qq.Println("@extractDomainSpaceId/1", domain)
 
@@ -0,0 +1,29 @@
+package xutils
+
+import "testing"
+
+func TestParseBuddySubdomain(t *testing.T) {
+	tests := []struct {
+		subdomain string
+		nodeId    string
+		spaceId   int64
+		ok        bool
+	}{
+		{"buddy-abc123", "abc123", 0, true},
+		{"zz-12-buddy-abc123", "abc123", 12, true},
+		{"zz-x-buddy-abc123", "", 0, false},
+		{"buddy-", "", 0, false},
+		{"buddy-ABC", "", 0, false},
+		{"zz-12-abc123", "", 0, false},
+		{"xbuddy-abc123", "", 0, false},
+		{"buddy-abc123.hq", "", 0, false},
+	}
+
+	for _, tt := range tests {
+		nodeId, spaceId, ok := ParseBuddySubdomain(tt.subdomain)
+		if nodeId != tt.nodeId || spaceId != tt.spaceId || ok != tt.ok {
+			t.Errorf("ParseBuddySubdomain(%q) = %q, %d, %v, want %q, %d, %v",
+				tt.subdomain, nodeId, spaceId, ok, tt.nodeId, tt.spaceId, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package netguard
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"syscall"
+)
+
+/*
+
+netguard keeps outbound connections made on behalf of packages (webhooks,
+websocket relays) away from loopback, private, link local and other non
+public addresses. Control checks the resolved address of every dial, so
+redirects and dns rebinding are covered too.
+
+*/
+
+var ErrBlockedAddress = errors.New("address is not allowed")
+
+// cgnat range, not covered by netip IsPrivate
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// Control is a net.Dialer Control func refusing non public addresses
+func Control(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+
+	if !IsPublicAddr(ip) {
+		return ErrBlockedAddress
+	}
+
+	return nil
+}
+
+func IsPublicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+
+	switch {
+	case ip.IsLoopback(),
+		ip.IsPrivate(),
+		ip.IsUnspecified(),
+		ip.IsLinkLocalUnicast(),
+		ip.IsLinkLocalMulticast(),
+		ip.IsInterfaceLocalMulticast(),
+		ip.IsMulticast(),
+		sharedAddressSpace.Contains(ip):
+		return false
+	}
+
+	return true
+}
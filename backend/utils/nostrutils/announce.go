@@ -0,0 +1,106 @@
+package nostrutils
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+const (
+	// node announcements are NIP-78 app data, being addressable relays
+	// only keep the latest one of every node
+	KindNodeAnnouncement = nostr.KindApplicationSpecificData
+
+	NodeAnnouncementTag = "potatoverse/node-address"
+)
+
+// SignNodeAnnouncement signs content as the node announcement of privkey,
+// relays drop it after expiresAt (NIP-40)
+func SignNodeAnnouncement(privkey string, content string, expiresAt time.Time) (*nostr.Event, error) {
+	hexPrivkey, err := DecodeKeyToHex(privkey)
+	if err != nil {
+		return nil, err
+	}
+
+	event := &nostr.Event{
+		Kind:      KindNodeAnnouncement,
+		CreatedAt: nostr.Now(),
+		Content:   content,
+		Tags: nostr.Tags{
+			{"d", NodeAnnouncementTag},
+			{"expiration", strconv.FormatInt(expiresAt.Unix(), 10)},
+		},
+	}
+
+	err = event.Sign(hexPrivkey)
+	if err != nil {
+		return nil, err
+	}
+
+	return event, nil
+}
+
+// NodeAnnouncementFilter matches announcements of the node with the given
+// pubkey (npub or hex)
+func NodeAnnouncementFilter(pubkey string) (nostr.Filter, error) {
+	hexPubkey, err := toHexPubkey(pubkey)
+	if err != nil {
+		return nostr.Filter{}, err
+	}
+
+	return nostr.Filter{
+		Kinds:   []int{KindNodeAnnouncement},
+		Authors: []string{hexPubkey},
+		Tags:    nostr.TagMap{"d": []string{NodeAnnouncementTag}},
+		Limit:   1,
+	}, nil
+}
+
+// VerifyNodeAnnouncement checks an announcement got from a relay, relays
+// are not trusted so signature, author and expiry are checked again
+func VerifyNodeAnnouncement(event *nostr.Event, pubkey string, now time.Time) error {
+	hexPubkey, err := toHexPubkey(pubkey)
+	if err != nil {
+		return err
+	}
+
+	if event.Kind != KindNodeAnnouncement {
+		return fmt.Errorf("wrong event kind")
+	}
+
+	if event.PubKey != hexPubkey {
+		return fmt.Errorf("wrong author")
+	}
+
+	if event.Tags.FindWithValue("d", NodeAnnouncementTag) == nil {
+		return fmt.Errorf("not a node announcement")
+	}
+
+	ok, err := event.CheckSignature()
+	if !ok || err != nil {
+		return fmt.Errorf("invalid signature")
+	}
+
+	if exp := event.Tags.Find("expiration"); exp != nil {
+		ts, err := strconv.ParseInt(exp.Value(), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid expiration")
+		}
+
+		if now.Unix() >= ts {
+			return fmt.Errorf("announcement expired")
+		}
+	}
+
+	return nil
+}
+
+func toHexPubkey(pubkey string) (string, error) {
+	if nostr.IsValidPublicKey(pubkey) {
+		return pubkey, nil
+	}
+
+	return DecodeKeyToHex(pubkey)
+}
@@ -0,0 +1,211 @@
+package testrelay
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Relay is a small in memory NIP-01 relay so nostr based code can be
+// exercised offline, it keeps addressable/replaceable events the way real
+// relays do and honours NIP-40 expiration
+type Relay struct {
+	server *httptest.Server
+	parser nostr.MessageParser
+
+	events []*nostr.Event
+	lock   sync.Mutex
+}
+
+func New() *Relay {
+	r := &Relay{
+		parser: nostr.NewMessageParser(),
+	}
+
+	r.server = httptest.NewServer(http.HandlerFunc(r.handle))
+
+	return r
+}
+
+// URL is the websocket url of the relay
+func (r *Relay) URL() string {
+	return "ws" + strings.TrimPrefix(r.server.URL, "http")
+}
+
+func (r *Relay) Close() {
+	r.server.CloseClientConnections()
+	r.server.Close()
+}
+
+// Events returns a copy of the stored events
+func (r *Relay) Events() []*nostr.Event {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	events := make([]*nostr.Event, len(r.events))
+	copy(events, r.events)
+
+	return events
+}
+
+// Store puts an event directly, bypassing signature checks, tests use it
+// to plant forged events
+func (r *Relay) Store(event *nostr.Event) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.store(event)
+}
+
+func (r *Relay) handle(w http.ResponseWriter, req *http.Request) {
+	conn, _, _, err := ws.UpgradeHTTP(req, w)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	for {
+		msg, op, err := wsutil.ReadClientData(conn)
+		if err != nil {
+			return
+		}
+
+		if op != ws.OpText {
+			continue
+		}
+
+		env, err := r.parser.ParseMessage(string(msg))
+		if err != nil || env == nil {
+			continue
+		}
+
+		var replies []nostr.Envelope
+
+		switch env := env.(type) {
+		case *nostr.EventEnvelope:
+			replies = append(replies, r.publish(&env.Event))
+		case *nostr.ReqEnvelope:
+			replies = r.query(env)
+		case *nostr.CloseEnvelope:
+			closed := nostr.ClosedEnvelope{SubscriptionID: string(*env)}
+			replies = append(replies, &closed)
+		}
+
+		for _, reply := range replies {
+			out, err := reply.MarshalJSON()
+			if err != nil {
+				continue
+			}
+
+			err = wsutil.WriteServerText(conn, out)
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (r *Relay) publish(event *nostr.Event) nostr.Envelope {
+	ok, err := event.CheckSignature()
+	if !ok || err != nil {
+		return &nostr.OKEnvelope{EventID: event.ID, OK: false, Reason: "invalid: bad signature"}
+	}
+
+	if expired(event, time.Now()) {
+		return &nostr.OKEnvelope{EventID: event.ID, OK: false, Reason: "invalid: event expired"}
+	}
+
+	r.lock.Lock()
+	r.store(event)
+	r.lock.Unlock()
+
+	return &nostr.OKEnvelope{EventID: event.ID, OK: true}
+}
+
+// store must be called with the lock held
+func (r *Relay) store(event *nostr.Event) {
+	for i, existing := range r.events {
+		if !sameAddress(existing, event) {
+			continue
+		}
+
+		if existing.CreatedAt > event.CreatedAt {
+			return
+		}
+
+		r.events[i] = event
+		return
+	}
+
+	r.events = append(r.events, event)
+}
+
+func (r *Relay) query(req *nostr.ReqEnvelope) []nostr.Envelope {
+	now := time.Now()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var replies []nostr.Envelope
+
+	for _, filter := range req.Filters {
+		sent := 0
+
+		// newest first like real relays
+		for i := len(r.events) - 1; i >= 0; i-- {
+			event := r.events[i]
+			if expired(event, now) || !filter.Matches(event) {
+				continue
+			}
+
+			if filter.Limit > 0 && sent >= filter.Limit {
+				break
+			}
+
+			subId := req.SubscriptionID
+			replies = append(replies, &nostr.EventEnvelope{SubscriptionID: &subId, Event: *event})
+			sent++
+		}
+	}
+
+	eose := nostr.EOSEEnvelope(req.SubscriptionID)
+	replies = append(replies, &eose)
+
+	return replies
+}
+
+func sameAddress(a, b *nostr.Event) bool {
+	if a.PubKey != b.PubKey || a.Kind != b.Kind {
+		return false
+	}
+
+	switch {
+	case nostr.IsReplaceableKind(a.Kind):
+		return true
+	case nostr.IsAddressableKind(a.Kind):
+		return a.Tags.GetD() == b.Tags.GetD()
+	}
+
+	return a.ID == b.ID
+}
+
+func expired(event *nostr.Event, now time.Time) bool {
+	exp := event.Tags.Find("expiration")
+	if exp == nil {
+		return false
+	}
+
+	ts, err := strconv.ParseInt(exp.Value(), 10, 64)
+	if err != nil {
+		return false
+	}
+
+	return now.Unix() >= ts
+}
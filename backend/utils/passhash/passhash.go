@@ -0,0 +1,129 @@
+package passhash
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+/*
+
+passwords are stored in the phc string format
+
+	$argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+
+the algorithm and its parameters travel with the hash so they can be raised
+later, Verify reports when a stored value should be rehashed. anything that
+does not decode as such is a legacy plaintext password from before hashing,
+plaintext passwords may start with $ too.
+
+*/
+
+const (
+	prefix = "$argon2id$"
+
+	memory     = 64 * 1024
+	iterations = 3
+	threads    = 2
+	saltLen    = 16
+	keyLen     = 32
+)
+
+var ErrInvalidHash = errors.New("invalid password hash")
+
+type params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+}
+
+func Hash(password string) (string, error) {
+	salt := make([]byte, saltLen)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, iterations, memory, threads, keyLen)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		prefix,
+		argon2.Version,
+		memory, iterations, threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// IsHashed tells a hashed value from a legacy plaintext one
+func IsHashed(stored string) bool {
+	_, _, _, err := decode(stored)
+	return err == nil
+}
+
+// Verify checks password against stored, needsRehash is set when it matched
+// but stored is plaintext or uses older parameters
+func Verify(stored, password string) (ok bool, needsRehash bool) {
+	if stored == "" {
+		return false, false
+	}
+
+	if !IsHashed(stored) {
+		ok = subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+		return ok, ok
+	}
+
+	p, salt, key, err := decode(stored)
+	if err != nil {
+		return false, false
+	}
+
+	other := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return false, false
+	}
+
+	needsRehash = p.memory != memory || p.time != iterations || p.threads != threads || len(key) != keyLen
+
+	return true, needsRehash
+}
+
+func decode(stored string) (*params, []byte, []byte, error) {
+	if !strings.HasPrefix(stored, prefix) {
+		return nil, nil, nil, ErrInvalidHash
+	}
+
+	parts := strings.Split(strings.TrimPrefix(stored, prefix), "$")
+	if len(parts) != 4 {
+		return nil, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[0], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return nil, nil, nil, ErrInvalidHash
+	}
+
+	p := &params{}
+	_, err = fmt.Sscanf(parts[1], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads)
+	if err != nil || p.time == 0 || p.threads == 0 {
+		return nil, nil, nil, ErrInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, nil, nil, ErrInvalidHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(key) == 0 {
+		return nil, nil, nil, ErrInvalidHash
+	}
+
+	return p, salt, key, nil
+}
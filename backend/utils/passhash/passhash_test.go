@@ -0,0 +1,74 @@
+package passhash
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHashVerify(t *testing.T) {
+	hash, err := Hash("ilikebats_123")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(hash, "$argon2id$v=19$") {
+		t.Fatalf("unexpected hash format %s", hash)
+	}
+
+	ok, rehash := Verify(hash, "ilikebats_123")
+	if !ok || rehash {
+		t.Fatalf("expected match without rehash, got ok=%v rehash=%v", ok, rehash)
+	}
+
+	ok, _ = Verify(hash, "ilikecats_123")
+	if ok {
+		t.Fatal("wrong password matched")
+	}
+
+	other, _ := Hash("ilikebats_123")
+	if other == hash {
+		t.Fatal("hashes of the same password should differ by salt")
+	}
+}
+
+func TestVerifyLegacy(t *testing.T) {
+	ok, rehash := Verify("plain_pass", "plain_pass")
+	if !ok || !rehash {
+		t.Fatalf("expected legacy match with rehash, got ok=%v rehash=%v", ok, rehash)
+	}
+
+	ok, _ = Verify("plain_pass", "plain")
+	if ok {
+		t.Fatal("wrong legacy password matched")
+	}
+
+	ok, _ = Verify("", "")
+	if ok {
+		t.Fatal("empty password matched")
+	}
+
+	if IsHashed("$ecret1") || IsHashed("$argon2id$v=19$garbage") {
+		t.Fatal("plaintext reported as hashed")
+	}
+
+	ok, rehash = Verify("$ecret1", "$ecret1")
+	if !ok || !rehash {
+		t.Fatalf("expected legacy match for $ password, got ok=%v rehash=%v", ok, rehash)
+	}
+}
+
+func TestVerifyOldParams(t *testing.T) {
+	hash, _ := Hash("secret")
+	old := strings.Replace(hash, "t=3", "t=1", 1)
+
+	// different time cost gives a different key, so it must not match
+	ok, _ := Verify(old, "secret")
+	if ok {
+		t.Fatal("tampered params matched")
+	}
+
+	ok, _ = Verify("$argon2id$v=19$garbage", "secret")
+	if ok {
+		t.Fatal("garbage hash matched")
+	}
+}
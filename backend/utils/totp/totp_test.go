@@ -0,0 +1,79 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc 6238 appendix b, sha1 secret "12345678901234567890" with 8 digits,
+// the last 6 digits are what a 6 digit code would be
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "94287082"},
+	{1111111109, "07081804"},
+	{1111111111, "14050471"},
+	{1234567890, "89005924"},
+	{2000000000, "69279037"},
+}
+
+func TestCodeRFCVectors(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	for _, v := range rfcVectors {
+		code, err := Code(secret, Step(time.Unix(v.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if code != v.code[2:] {
+			t.Fatalf("at %d expected %s, got %s", v.unix, v.code[2:], code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	code, _ := Code(secret, Step(now))
+
+	step, ok := Validate(secret, code, now)
+	if !ok || step != Step(now) {
+		t.Fatal("current code rejected")
+	}
+
+	// still fine one step later for clock drift
+	_, ok = Validate(secret, code, now.Add(Period*time.Second))
+	if !ok {
+		t.Fatal("code rejected within skew")
+	}
+
+	_, ok = Validate(secret, code, now.Add(3*Period*time.Second))
+	if ok {
+		t.Fatal("old code accepted")
+	}
+
+	_, ok = Validate(secret, "12345", now)
+	if ok {
+		t.Fatal("short code accepted")
+	}
+}
+
+func TestURL(t *testing.T) {
+	u := URL("JBSWY3DPEHPK3PXP", "Potato Verse", "batman@example.com")
+
+	if !strings.HasPrefix(u, "otpauth://totp/Potato%20Verse:batman@example.com?") {
+		t.Fatalf("unexpected url %s", u)
+	}
+
+	if !strings.Contains(u, "secret=JBSWY3DPEHPK3PXP") || !strings.Contains(u, "issuer=Potato+Verse") {
+		t.Fatalf("missing params in %s", u)
+	}
+}
@@ -1,17 +1,99 @@
 package xtypes
 
 type AppOptions struct {
-	Name         string            `json:"name,omitempty" yaml:"name,omitempty"`
-	Port         int               `json:"port,omitempty" yaml:"port,omitempty"`
-	Hosts        []Host            `json:"hosts,omitempty" yaml:"hosts,omitempty"`
-	MasterSecret string            `json:"master_secret,omitempty" yaml:"master_secret,omitempty"`
-	Debug        bool              `json:"debug_mode,omitempty" yaml:"debug_mode,omitempty"`
-	WorkingDir   string            `json:"working_dir,omitempty" yaml:"working_dir,omitempty"`
-	SocketFile   string            `json:"socket_file,omitempty" yaml:"socket_file,omitempty"`
-	Mailer       MailerOptions     `json:"mailer" yaml:"mailer"`
-	Repos        []RepoOptions     `json:"repos" yaml:"repos"`
-	BuddyOptions *BuddyHubOptions  `json:"buddy_options,omitempty" yaml:"buddy_options,omitempty"`
-	SystemEnv    map[string]string `json:"system_env,omitempty" yaml:"system_env,omitempty"`
+	Name         string               `json:"name,omitempty" yaml:"name,omitempty"`
+	Port         int                  `json:"port,omitempty" yaml:"port,omitempty"`
+	Hosts        []Host               `json:"hosts,omitempty" yaml:"hosts,omitempty"`
+	MasterSecret string               `json:"master_secret,omitempty" yaml:"master_secret,omitempty"`
+	Debug        bool                 `json:"debug_mode,omitempty" yaml:"debug_mode,omitempty"`
+	WorkingDir   string               `json:"working_dir,omitempty" yaml:"working_dir,omitempty"`
+	SocketFile   string               `json:"socket_file,omitempty" yaml:"socket_file,omitempty"`
+	Mailer       MailerOptions        `json:"mailer" yaml:"mailer"`
+	Repos        []RepoOptions        `json:"repos" yaml:"repos"`
+	BuddyOptions *BuddyHubOptions     `json:"buddy_options,omitempty" yaml:"buddy_options,omitempty"`
+	SystemEnv    map[string]string    `json:"system_env,omitempty" yaml:"system_env,omitempty"`
+	EventHub     *EventHubOptions     `json:"event_hub,omitempty" yaml:"event_hub,omitempty"`
+	Sockd        *SockdOptions        `json:"sockd,omitempty" yaml:"sockd,omitempty"`
+	Updates      *UpdateOptions       `json:"updates,omitempty" yaml:"updates,omitempty"`
+	Tokens       *TokenOptions        `json:"tokens,omitempty" yaml:"tokens,omitempty"`
+	OIDC         []OIDCOptions        `json:"oidc,omitempty" yaml:"oidc,omitempty"`
+	OIDCProvider *OIDCProviderOptions `json:"oidc_provider,omitempty" yaml:"oidc_provider,omitempty"`
+	// let relay capabilities dial loopback and private network upstreams, for local development
+	AllowPrivateUpstreams bool `json:"allow_private_upstreams,omitempty" yaml:"allow_private_upstreams,omitempty"`
+}
+
+// OIDCProviderOptions configures the platform's own openid connect provider
+// (login with potatoverse) used by spaces and external apps
+type OIDCProviderOptions struct {
+	Disabled bool `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+	// public url of the provider, default http://<first host>/zz/oidc, set it
+	// when served behind tls
+	Issuer string `json:"issuer,omitempty" yaml:"issuer,omitempty"`
+}
+
+// OIDCOptions configures login through an external openid connect provider
+// (keycloak, dex, google etc)
+type OIDCOptions struct {
+	Name         string   `json:"name" yaml:"name"` // used in urls, eg. keycloak
+	DisplayName  string   `json:"display_name,omitempty" yaml:"display_name,omitempty"`
+	Issuer       string   `json:"issuer" yaml:"issuer"`
+	ClientId     string   `json:"client_id" yaml:"client_id"`
+	ClientSecret string   `json:"client_secret,omitempty" yaml:"client_secret,omitempty"` // $ENV_NAME reads it from env
+	Scopes       []string `json:"scopes,omitempty" yaml:"scopes,omitempty"`               // default openid, email, profile
+	// default <host>/zz/api/core/auth/oidc/<name>/callback
+	RedirectURL string `json:"redirect_url,omitempty" yaml:"redirect_url,omitempty"`
+
+	// claim holding the user's idp groups, default groups
+	GroupsClaim string `json:"groups_claim,omitempty" yaml:"groups_claim,omitempty"`
+	// first idp group the user has decides ugroup, checked on every login
+	GroupMap []OIDCGroupMap `json:"group_map,omitempty" yaml:"group_map,omitempty"`
+	// ugroup of provisioned users with no mapped group, default normal
+	DefaultGroup        string `json:"default_group,omitempty" yaml:"default_group,omitempty"`
+	DisableProvisioning bool   `json:"disable_provisioning,omitempty" yaml:"disable_provisioning,omitempty"`
+	// link to existing users by email even when the idp does not mark it verified
+	TrustUnverifiedEmail bool `json:"trust_unverified_email,omitempty" yaml:"trust_unverified_email,omitempty"`
+}
+
+type OIDCGroupMap struct {
+	Group  string `json:"group" yaml:"group"`   // idp group
+	Ugroup string `json:"ugroup" yaml:"ugroup"` // UserGroups.name
+}
+
+type TokenOptions struct {
+	// seconds per token type (access, refresh, device, login_challenge, oidc_state,
+	// oidc_code, oidc_access, invite, space, space_advisiery, presigned, package_dev,
+	// capability), -1 never expires
+	TTLs map[string]int `json:"ttls,omitempty" yaml:"ttls,omitempty"`
+	// old master secrets still accepted while rotating to a new one
+	PreviousSecrets []PreviousSecret `json:"previous_secrets,omitempty" yaml:"previous_secrets,omitempty"`
+}
+
+type PreviousSecret struct {
+	Secret string `json:"secret" yaml:"secret"`
+	Until  string `json:"until" yaml:"until"` // RFC3339 or 2006-01-02
+}
+
+type UpdateOptions struct {
+	Disabled      bool `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+	CheckInterval int  `json:"check_interval,omitempty" yaml:"check_interval,omitempty"` // minutes, default 360
+	// local time window auto upgrades run in, eg. 02:00-04:00, any time when empty
+	MaintenanceWindow string `json:"maintenance_window,omitempty" yaml:"maintenance_window,omitempty"`
+}
+
+type SockdOptions struct {
+	Backplane string `json:"backplane,omitempty" yaml:"backplane,omitempty"` // local, sqlite, buddy
+	// shared sqlite file of the sqlite backplane, main database when empty
+	SqliteFile   string   `json:"sqlite_file,omitempty" yaml:"sqlite_file,omitempty"`
+	PollInterval int      `json:"poll_interval,omitempty" yaml:"poll_interval,omitempty"` // milliseconds
+	Peers        []string `json:"peers,omitempty" yaml:"peers,omitempty"`                 // buddy pubkeys of the buddy backplane
+}
+
+type EventHubOptions struct {
+	Workers       int `json:"workers,omitempty" yaml:"workers,omitempty"`
+	MaxPerInstall int `json:"max_per_install,omitempty" yaml:"max_per_install,omitempty"`
+	PollInterval  int `json:"poll_interval,omitempty" yaml:"poll_interval,omitempty"` // seconds
+	// let webhook targets call loopback and private network addresses, for local development
+	AllowPrivateWebhooks bool `json:"allow_private_webhooks,omitempty" yaml:"allow_private_webhooks,omitempty"`
 }
 
 type Host struct {
@@ -42,6 +124,10 @@ type BuddyHubOptions struct {
 	BuddyWebFunnelMode      string          `json:"buddy_web_funnel_mode,omitempty" yaml:"buddy_web_funnel_mode,omitempty"`
 	StaticBuddies           []*BuddyInfo    `json:"static_buddies,omitempty" yaml:"static_buddies,omitempty"`
 	RendezvousUrls          []RendezvousUrl `json:"rendezvous_urls,omitempty" yaml:"rendezvous_urls,omitempty"`
+	// rolling window traffic limits are counted over, default 30 days
+	TrafficWindowHours int `json:"traffic_window_hours,omitempty" yaml:"traffic_window_hours,omitempty"`
+	// percent of a limit after which buddies get a soft limit warning, default 80
+	SoftLimitPercent int `json:"soft_limit_percent,omitempty" yaml:"soft_limit_percent,omitempty"`
 }
 
 type BuddyInfo struct {
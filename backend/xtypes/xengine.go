@@ -51,9 +51,12 @@ type Engine interface {
 
 	PublishEvent(opts *EventOptions) error
 	RefreshEventIndex()
+	WakeEventHub()
 
 	EmitHttpEvent(opts *HttpEventOptions) error
 	EmitActionEvent(opts *ActionEventOptions) error
+
+	GetSpaceWorkingFolder(spaceId int64) (string, error)
 }
 
 // Executor types
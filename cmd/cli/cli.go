@@ -15,6 +15,8 @@ type CLI struct {
 	Dev        DevCmd        `cmd:"" help:"Development utilities."`
 	Extra      ExtraCmd      `cmd:"" help:"Extra commands."`
 	Skills     SkillsCmd     `cmd:"" help:"Skills management commands."`
+	Events     EventsCmd     `cmd:"" help:"Inspect and replay event deliveries."`
+	Users      UsersCmd      `cmd:"" help:"User maintenance commands."`
 	Verbose    bool          `name:"verbose" short:"v" help:"Enable verbose output."`
 }
 
@@ -0,0 +1,157 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/alecthomas/kong"
+	"github.com/blue-monads/potatoverse/backend/services/datahub/database"
+	"github.com/blue-monads/potatoverse/backend/xtypes"
+	"gopkg.in/yaml.v3"
+)
+
+// events, works on the node database directly so it can be used when the
+// server is down, replayed targets are picked up by the server on its next poll
+
+type EventsCmd struct {
+	Dead     EventsDeadCmd     `cmd:"" help:"List dead lettered event targets."`
+	Attempts EventsAttemptsCmd `cmd:"" help:"Show delivery attempts of an event target."`
+	Replay   EventsReplayCmd   `cmd:"" help:"Replay dead lettered event targets."`
+	Discard  EventsDiscardCmd  `cmd:"" help:"Discard dead lettered event targets."`
+}
+
+type EventsDeadCmd struct {
+	Config         string `name:"config" short:"c" help:"Path to configuration file." type:"path" default:"./config.yaml"`
+	InstallId      int64  `name:"install" help:"Filter by package install id."`
+	SubscriptionId int64  `name:"subscription" help:"Filter by subscription id."`
+	Offset         int    `name:"offset" help:"Offset." default:"0"`
+	Limit          int    `name:"limit" help:"Limit." default:"100"`
+}
+
+func (c *EventsDeadCmd) Run(ctx *kong.Context) error {
+	db, err := openNodeDB(c.Config)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	targets, err := db.GetMQSynk().QueryDeadTargets(c.InstallId, c.SubscriptionId, c.Offset, c.Limit)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tEVENT\tSUBSCRIPTION\tRETRIES\tUPDATED\tERROR")
+	for _, t := range targets {
+		fmt.Fprintf(w, "%d\t%d\t%d\t%d\t%s\t%s\n", t.ID, t.EventID, t.SubscriptionID, t.RetryCount, t.UpdatedAt.Format("2006-01-02 15:04:05"), t.Error)
+	}
+
+	return w.Flush()
+}
+
+type EventsAttemptsCmd struct {
+	Config   string `name:"config" short:"c" help:"Path to configuration file." type:"path" default:"./config.yaml"`
+	TargetId int64  `arg:"" help:"Event target id."`
+}
+
+func (c *EventsAttemptsCmd) Run(ctx *kong.Context) error {
+	db, err := openNodeDB(c.Config)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	attempts, err := db.GetMQSynk().ListTargetAttempts(c.TargetId)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ATTEMPT\tSTATUS\tCODE\tDURATION\tAT\tERROR")
+	for _, a := range attempts {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%dms\t%s\t%s\n", a.Attempt, a.Status, a.ResponseCode, a.DurationMs, a.CreatedAt.Format("2006-01-02 15:04:05"), a.Error)
+	}
+
+	return w.Flush()
+}
+
+type EventsReplayCmd struct {
+	DeadTargetsSelector `embed:""`
+}
+
+func (c *EventsReplayCmd) Run(ctx *kong.Context) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+
+	db, err := openNodeDB(c.Config)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ids, err := db.GetMQSynk().ReplayDeadTargets(c.InstallId, c.SubscriptionId, c.TargetIds)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Replayed %d targets\n", len(ids))
+	return nil
+}
+
+type EventsDiscardCmd struct {
+	DeadTargetsSelector `embed:""`
+}
+
+func (c *EventsDiscardCmd) Run(ctx *kong.Context) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+
+	db, err := openNodeDB(c.Config)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ids, err := db.GetMQSynk().DiscardDeadTargets(c.InstallId, c.SubscriptionId, c.TargetIds)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Discarded %d targets\n", len(ids))
+	return nil
+}
+
+type DeadTargetsSelector struct {
+	Config         string  `name:"config" short:"c" help:"Path to configuration file." type:"path" default:"./config.yaml"`
+	InstallId      int64   `name:"install" help:"Only targets of this package install."`
+	SubscriptionId int64   `name:"subscription" help:"Only targets of this subscription."`
+	All            bool    `name:"all" help:"Select every dead target matching the filters."`
+	TargetIds      []int64 `arg:"" optional:"" help:"Event target ids."`
+}
+
+func (s *DeadTargetsSelector) validate() error {
+	if len(s.TargetIds) == 0 && !s.All {
+		return errors.New("pass target ids or --all")
+	}
+	return nil
+}
+
+func openNodeDB(configFile string) (*database.DB, error) {
+	cfgData, err := os.ReadFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	config := xtypes.AppOptions{}
+	err = yaml.Unmarshal(cfgData, &config)
+	if err != nil {
+		return nil, err
+	}
+
+	return database.NewDB(filepath.Join(config.WorkingDir, "datadb", "main.sqlite"), nil)
+}
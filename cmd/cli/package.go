@@ -1,9 +1,11 @@
 package cli
 
 type PackageCmd struct {
-	Init  PackageInitCmd  `cmd:"" help:"Initialize a new project from a template."`
-	Build PackageBuildCmd `cmd:"" help:"Build the package."`
-	Push  PackagePushCmd  `cmd:"" help:"Push the package."`
+	Init     PackageInitCmd     `cmd:"" help:"Initialize a new project from a template."`
+	Build    PackageBuildCmd    `cmd:"" help:"Build the package."`
+	Push     PackagePushCmd     `cmd:"" help:"Push the package."`
+	Sign     PackageSignCmd     `cmd:"" help:"Sign a package zip or repo index."`
+	Rollback PackageRollbackCmd `cmd:"" help:"Roll an installed package back to a kept version."`
 }
 
 type PackagePushCmd struct {
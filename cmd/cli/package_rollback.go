@@ -0,0 +1,151 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/alecthomas/kong"
+	"github.com/blue-monads/potatoverse/cmd/cli/pkgutils"
+)
+
+type PackageRollbackCmd struct {
+	PotatoYamlFile string `name:"potato-yaml-file" help:"Path to potato manifest file." type:"path" default:"./potato.yaml"`
+	VersionId      int64  `name:"version-id" help:"Package version to roll back to, lists kept versions when not set."`
+	RestoreData    bool   `name:"restore-data" help:"Restore the data snapshot taken while that version was active."`
+	DownMigrations bool   `name:"down-migrations" help:"Run the *.down.sql migrations of the current version."`
+}
+
+func (c *PackageRollbackCmd) Run(_ *kong.Context) error {
+	potatoYaml, err := pkgutils.ReadPotatoFile(c.PotatoYamlFile)
+	if err != nil {
+		return err
+	}
+
+	if potatoYaml.Developer == nil || potatoYaml.Developer.ServerUrl == "" {
+		return errors.New("server url is required")
+	}
+
+	token := potatoYaml.Developer.Token
+	if token == "" && potatoYaml.Developer.TokenEnv != "" {
+		token = os.Getenv(potatoYaml.Developer.TokenEnv)
+	}
+
+	// package dev tokens can only push, rollback goes through the core api
+	if !strings.HasPrefix(token, "pdsec_") {
+		return errors.New("rollback needs a device token (pdsec_)")
+	}
+
+	baseURL := strings.TrimSuffix(potatoYaml.Developer.ServerUrl, "/")
+	accessToken, err := exchangeDeviceTokenForAccess(baseURL, token)
+	if err != nil {
+		return err
+	}
+
+	packageId := potatoYaml.Developer.PackageId
+	if packageId == 0 {
+		packageId, err = resolvePackageIdBySlug(baseURL, accessToken, potatoYaml.Slug)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.VersionId == 0 {
+		return listPackageVersions(baseURL, accessToken, packageId)
+	}
+
+	body, _ := json.Marshal(map[string]any{
+		"version_id":      c.VersionId,
+		"restore_data":    c.RestoreData,
+		"down_migrations": c.DownMigrations,
+	})
+
+	url := fmt.Sprintf("%s%s/package/%d/rollback", baseURL, coreAPI, packageId)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "TokenV1 "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("rollback failed: %s %s", resp.Status, string(b))
+	}
+
+	var out struct {
+		Version            string   `json:"version"`
+		RestoredSnapshotId int64    `json:"restored_snapshot_id"`
+		BackupSnapshotId   int64    `json:"backup_snapshot_id"`
+		RevertedMigrations []string `json:"reverted_migrations"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return fmt.Errorf("could not decode response: %w", err)
+	}
+
+	fmt.Println("Rolled back to version", out.Version)
+	for _, migration := range out.RevertedMigrations {
+		fmt.Println("  reverted migration", migration)
+	}
+	if out.RestoredSnapshotId != 0 {
+		fmt.Println("  restored data snapshot", out.RestoredSnapshotId)
+	}
+	fmt.Println("  data before rollback saved as snapshot", out.BackupSnapshotId)
+
+	return nil
+}
+
+func listPackageVersions(baseURL, accessToken string, packageId int64) error {
+	url := fmt.Sprintf("%s%s/package/%d/info", baseURL, coreAPI, packageId)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "TokenV1 "+accessToken)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("package info failed: %s %s", resp.Status, string(b))
+	}
+
+	var out struct {
+		InstalledPackage struct {
+			ActiveInstallId int64 `json:"active_install_id"`
+		} `json:"installed_package"`
+		PackageVersions []struct {
+			Id      int64  `json:"id"`
+			Version string `json:"version"`
+		} `json:"package_versions"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return fmt.Errorf("could not decode response: %w", err)
+	}
+
+	fmt.Println("Kept versions, pass one with --version-id:")
+	for _, version := range out.PackageVersions {
+		active := ""
+		if version.Id == out.InstalledPackage.ActiveInstallId {
+			active = " (active)"
+		}
+		fmt.Printf("  %d  %s%s\n", version.Id, version.Version, active)
+	}
+
+	return nil
+}
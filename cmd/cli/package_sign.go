@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/alecthomas/kong"
+	"github.com/blue-monads/potatoverse/backend/engine/hubs/repohub/reposign"
+)
+
+type PackageSignCmd struct {
+	File string `arg:"" help:"Package zip or harvest-index.json to sign." type:"existingfile"`
+	// a 32 byte hex ed25519 seed or a hex/nsec nostr key
+	KeyFile string `name:"key-file" help:"File holding the private key." type:"existingfile" required:""`
+	Alg     string `name:"alg" help:"Key type, ed25519 or nostr." enum:"ed25519,nostr" default:"ed25519"`
+}
+
+func (c *PackageSignCmd) Run(_ *kong.Context) error {
+	rawKey, err := os.ReadFile(c.KeyFile)
+	if err != nil {
+		return err
+	}
+
+	key := strings.TrimSpace(string(rawKey))
+
+	digest, err := reposign.DigestFile(c.File)
+	if err != nil {
+		return err
+	}
+
+	var sig *reposign.Signature
+
+	switch c.Alg {
+	case reposign.AlgEd25519:
+		seed, err := hex.DecodeString(key)
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return errors.New("ed25519 key must be a 32 byte hex seed")
+		}
+		sig, err = reposign.SignEd25519(ed25519.NewKeyFromSeed(seed), digest)
+		if err != nil {
+			return err
+		}
+	case reposign.AlgNostr:
+		sig, err = reposign.SignNostr(key, digest)
+		if err != nil {
+			return err
+		}
+	}
+
+	out, err := json.MarshalIndent(sig, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	sigFile := c.File + reposign.SignatureSuffix
+
+	err = os.WriteFile(sigFile, out, 0644)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("sha256: %s\n", digest)
+	fmt.Printf("key:    %s\n", sig.KeyId())
+	fmt.Printf("wrote:  %s\n", sigFile)
+
+	return nil
+}
@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
 
 	"github.com/alecthomas/kong"
 	"github.com/blue-monads/potatoverse/backend/engine/hubs/repohub"
@@ -175,6 +177,20 @@ func (c *ServerActualStartCmd) Run(ctx *kong.Context) error {
 		config.MasterSecret = os.Getenv(after)
 	}
 
+	if config.Tokens != nil {
+		for i, prev := range config.Tokens.PreviousSecrets {
+			if after, ok := strings.CutPrefix(prev.Secret, "$"); ok {
+				config.Tokens.PreviousSecrets[i].Secret = os.Getenv(after)
+			}
+		}
+	}
+
+	for i, provider := range config.OIDC {
+		if after, ok := strings.CutPrefix(provider.ClientSecret, "$"); ok {
+			config.OIDC[i].ClientSecret = os.Getenv(after)
+		}
+	}
+
 	app, err := startup.NewProdApp(&config, c.AutoSeed)
 	if err != nil {
 		return err
@@ -185,8 +201,11 @@ func (c *ServerActualStartCmd) Run(ctx *kong.Context) error {
 		return err
 	}
 
-	ch := make(chan struct{})
-	<-ch // block forever
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	<-sigs
+
+	app.Stop()
 
 	return nil
 }
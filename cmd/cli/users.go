@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/alecthomas/kong"
+	"github.com/blue-monads/potatoverse/backend/utils/passhash"
+)
+
+// users, works on the node database directly like events
+
+type UsersCmd struct {
+	HashPasswords UsersHashPasswordsCmd `cmd:"" help:"Hash passwords still stored in plaintext."`
+}
+
+type UsersHashPasswordsCmd struct {
+	Config string `name:"config" short:"c" help:"Path to configuration file." type:"path" default:"./config.yaml"`
+	DryRun bool   `name:"dry-run" help:"Only count the plaintext passwords."`
+}
+
+func (c *UsersHashPasswordsCmd) Run(ctx *kong.Context) error {
+	db, err := openNodeDB(c.Config)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	userOps := db.GetUserOps()
+
+	hashed := 0
+	var lastId int64
+
+	for {
+		users, err := userOps.ListUser(int(lastId), 100)
+		if err != nil {
+			return err
+		}
+
+		if len(users) == 0 {
+			break
+		}
+
+		for _, user := range users {
+			lastId = max(lastId, user.ID)
+
+			if user.Password == "" || passhash.IsHashed(user.Password) {
+				continue
+			}
+
+			hashed++
+			if c.DryRun {
+				continue
+			}
+
+			hash, err := passhash.Hash(user.Password)
+			if err != nil {
+				return err
+			}
+
+			err = userOps.UpdateUser(user.ID, map[string]any{
+				"password": hash,
+			})
+			if err != nil {
+				return fmt.Errorf("user %d: %w", user.ID, err)
+			}
+		}
+	}
+
+	if c.DryRun {
+		fmt.Printf("%d plaintext passwords found\n", hashed)
+		return nil
+	}
+
+	fmt.Printf("Hashed %d passwords\n", hashed)
+	return nil
+}
@@ -1,8 +1,8 @@
 "use client"
 import Image from "next/image";
 import WithLoginLayout from "./WithLoginLayout";
-import { useState } from "react";
-import { initHttpClient, login } from "@/lib/api";
+import { useEffect, useState } from "react";
+import { confirmTwoFactorChallenge, enrollTwoFactorChallenge, exchangeSSOChallenge, initHttpClient, listSSOProviders, login, LoginResponse, SSOProvider, ssoStartUrl, TwoFactorSetup, verifyTwoFactor } from "@/lib/api";
 import { useRouter, useSearchParams } from "next/navigation";
 import { useGApp } from "@/hooks";
 
@@ -17,12 +17,89 @@ export default function Page() {
     const [loading, setLoading] = useState<boolean>(false);
     const [error, setError] = useState<string>("");
 
+    // second factor step
+    const [challengeToken, setChallengeToken] = useState<string>("");
+    const [step, setStep] = useState<"password" | "verify" | "enroll" | "recovery_codes">("password");
+    const [code, setCode] = useState<string>("");
+    const [useRecovery, setUseRecovery] = useState<boolean>(false);
+    const [setup, setSetup] = useState<TwoFactorSetup | null>(null);
+    const [recoveryCodes, setRecoveryCodes] = useState<string[]>([]);
+    const [pendingLogin, setPendingLogin] = useState<LoginResponse | null>(null);
+
+    // sso
+    const [ssoProviders, setSSOProviders] = useState<SSOProvider[]>([]);
+    const [ssoRedirect, setSSORedirect] = useState<string>("");
+
 
     const router = useRouter();
 
+    useEffect(() => {
+        listSSOProviders()
+            .then((res) => setSSOProviders(Array.isArray(res.data) ? res.data : []))
+            .catch(() => setSSOProviders([]));
+
+        // the sso callback sends the challenge back in the fragment
+        const frag = new URLSearchParams(window.location.hash.slice(1));
+        const ssoError = frag.get("sso_error");
+        const ssoChallenge = frag.get("sso");
+        if (!ssoError && !ssoChallenge) return;
+
+        window.history.replaceState(null, "", window.location.pathname + window.location.search);
+
+        if (ssoError) {
+            setError(ssoError);
+            return;
+        }
+
+        const redirect = frag.get("redirect") || "";
+        setSSORedirect(redirect);
+        setLoading(true);
+        exchangeSSOChallenge(ssoChallenge!)
+            .then((res) => handleLoginResponse(res.data, redirect))
+            .catch((err) => setError(errorMessage(err)))
+            .finally(() => setLoading(false));
+    }, []);
+
+    const finishLogin = (data: LoginResponse, redirect?: string) => {
+        gapp.logIn(data.access_token, data.user_info, data.refresh_token);
+        initHttpClient();
+
+        const after_login_redirect_back_url = redirect || ssoRedirect || params.get('after_login_redirect_back_url');
+        if (after_login_redirect_back_url) {
+            router.push(after_login_redirect_back_url);
+        } else {
+            router.push("/portal/admin");
+        }
+    }
+
+    const errorMessage = (err: any) => {
+        return err?.response?.data?.message || (err instanceof Error ? err.message : "An unknown error occurred");
+    }
+
+    // password and sso logins may both need a second factor first
+    const handleLoginResponse = async (data: LoginResponse, redirect?: string) => {
+        if (data.two_factor_required) {
+            setChallengeToken(data.challenge_token || "");
+            setStep("verify");
+            return;
+        }
+
+        if (data.two_factor_setup_required) {
+            const token = data.challenge_token || "";
+            setChallengeToken(token);
+            const setupRes = await enrollTwoFactorChallenge(token);
+            setSetup(setupRes.data);
+            setStep("enroll");
+            return;
+        }
+
+        finishLogin(data, redirect);
+    }
+
     const handleSubmit = async (e: React.MouseEvent<HTMLButtonElement>) => {
         e.preventDefault();
         setLoading(true);
+        setError("");
         try {
             const res = await login(username, password);
             if (res.status !== 200) {
@@ -30,26 +107,49 @@ export default function Page() {
                 return;
             }
 
-            const token = res.data.access_token;
-            gapp.logIn(token, res.data.user_info);
-            console.log("@saveLoginData", res.data.user_info);            
-            initHttpClient();
-
-            const after_login_redirect_back_url = params.get('after_login_redirect_back_url');
-            if (after_login_redirect_back_url) {
-                router.push(after_login_redirect_back_url);
-            } else {
-                router.push("/portal/admin");
-            }
+            await handleLoginResponse(res.data);
+        } catch (err) {
+            setError(errorMessage(err));
+        } finally {
+            setLoading(false);
+        }
+    }
 
+    const handleVerify = async (e: React.MouseEvent<HTMLButtonElement>) => {
+        e.preventDefault();
+        setLoading(true);
+        setError("");
+        try {
+            const res = useRecovery
+                ? await verifyTwoFactor(challengeToken, "", code)
+                : await verifyTwoFactor(challengeToken, code);
+            finishLogin(res.data);
+        } catch (err) {
+            setError(errorMessage(err));
+        } finally {
+            setLoading(false);
+        }
+    }
 
+    const handleEnrollConfirm = async (e: React.MouseEvent<HTMLButtonElement>) => {
+        e.preventDefault();
+        setLoading(true);
+        setError("");
+        try {
+            const res = await confirmTwoFactorChallenge(challengeToken, code);
+            setPendingLogin(res.data);
+            setRecoveryCodes(res.data.recovery_codes || []);
+            setStep("recovery_codes");
         } catch (err) {
-            setError(err instanceof Error ? err.message : "An unknown error occurred"   );
+            setError(errorMessage(err));
         } finally {
             setLoading(false);
         }
     }
 
+    const inputClass = "w-full mt-2 px-3 py-2 text-gray-500 bg-transparent outline-none border focus:border-primary-100 shadow-sm rounded-lg";
+    const buttonClass = "w-full px-4 py-2 text-white font-medium bg-primary-700-300  rounded-lg duration-150 hover:opacity-80";
+
 
     return (<>
         <WithLoginLayout    >
@@ -67,48 +167,140 @@ export default function Page() {
                     </div>
                 </div>
 
-                <form
-                    onSubmit={(e) => e.preventDefault()}
-                    className="space-y-5"
-                >
+                {step === "password" && (
+                    <form
+                        onSubmit={(e) => e.preventDefault()}
+                        className="space-y-5"
+                    >
 
-                    <div>
-                        <label className="font-medium">
-                            Username
-                        </label>
-                        <input
-                            type="text"
-                            required
-                            className="w-full mt-2 px-3 py-2 text-gray-500 bg-transparent outline-none border focus:border-primary-100 shadow-sm rounded-lg"
-                            value={username}
-                            onChange={(e) => setUsername(e.target.value)}
-                        />
-                    </div>
-                    <div>
-                        <label className="font-medium">
-                            Password
-                        </label>
-                        <input
-                            type="password"
-                            required
-                            className="w-full mt-2 px-3 py-2 text-gray-500 bg-transparent outline-none border focus:border-primary-100 shadow-sm rounded-lg"
-                            value={password}
-                            onChange={(e) => setPassword(e.target.value)}
-                        />
+                        <div>
+                            <label className="font-medium">
+                                Username
+                            </label>
+                            <input
+                                type="text"
+                                required
+                                className="w-full mt-2 px-3 py-2 text-gray-500 bg-transparent outline-none border focus:border-primary-100 shadow-sm rounded-lg"
+                                value={username}
+                                onChange={(e) => setUsername(e.target.value)}
+                            />
+                        </div>
+                        <div>
+                            <label className="font-medium">
+                                Password
+                            </label>
+                            <input
+                                type="password"
+                                required
+                                className="w-full mt-2 px-3 py-2 text-gray-500 bg-transparent outline-none border focus:border-primary-100 shadow-sm rounded-lg"
+                                value={password}
+                                onChange={(e) => setPassword(e.target.value)}
+                            />
+                        </div>
+
+                        {error && <p className="text-red-500">{error}</p>}
+
+
+
+                        <button
+                            onClick={handleSubmit}
+                            disabled={loading}
+                            className="w-full px-4 py-2 text-white font-medium bg-primary-700-300  rounded-lg duration-150 hover:opacity-80"
+                        >
+                            {loading ? "Loading..." : "Login"}
+                        </button>
+
+                        {ssoProviders.length > 0 && (
+                            <div className="space-y-2">
+                                <p className="text-center text-sm text-gray-400">or</p>
+                                {ssoProviders.map((p) => (
+                                    <a
+                                        key={p.name}
+                                        href={ssoStartUrl(p.name, params.get('after_login_redirect_back_url') || undefined)}
+                                        className="block w-full px-4 py-2 text-center font-medium border rounded-lg duration-150 hover:bg-gray-50"
+                                    >
+                                        Continue with {p.display_name}
+                                    </a>
+                                ))}
+                            </div>
+                        )}
+                    </form>
+                )}
+
+                {step === "verify" && (
+                    <form onSubmit={(e) => e.preventDefault()} className="space-y-5">
+                        <div>
+                            <label className="font-medium">
+                                {useRecovery ? "Recovery code" : "Authentication code"}
+                            </label>
+                            <input
+                                type="text"
+                                required
+                                autoFocus
+                                autoComplete="one-time-code"
+                                className={inputClass}
+                                value={code}
+                                onChange={(e) => setCode(e.target.value)}
+                            />
+                        </div>
+
+                        {error && <p className="text-red-500">{error}</p>}
+
+                        <button onClick={handleVerify} disabled={loading} className={buttonClass}>
+                            {loading ? "Loading..." : "Verify"}
+                        </button>
+
+                        <button
+                            type="button"
+                            className="text-sm text-primary-contrast-200-800"
+                            onClick={() => { setUseRecovery(!useRecovery); setCode(""); }}
+                        >
+                            {useRecovery ? "Use authenticator code" : "Use a recovery code"}
+                        </button>
+                    </form>
+                )}
+
+                {step === "enroll" && setup && (
+                    <form onSubmit={(e) => e.preventDefault()} className="space-y-5">
+                        <p>Your group requires two factor authentication. Add this secret to your authenticator app, then enter the code it shows.</p>
+                        <div className="p-3 rounded-lg bg-gray-100 font-mono break-all text-sm">{setup.secret}</div>
+                        <a href={setup.otpauth_url} className="text-sm text-primary-contrast-200-800 break-all">{setup.otpauth_url}</a>
+                        <div>
+                            <label className="font-medium">
+                                Authentication code
+                            </label>
+                            <input
+                                type="text"
+                                required
+                                autoComplete="one-time-code"
+                                className={inputClass}
+                                value={code}
+                                onChange={(e) => setCode(e.target.value)}
+                            />
+                        </div>
+
+                        {error && <p className="text-red-500">{error}</p>}
+
+                        <button onClick={handleEnrollConfirm} disabled={loading} className={buttonClass}>
+                            {loading ? "Loading..." : "Enable and login"}
+                        </button>
+                    </form>
+                )}
+
+                {step === "recovery_codes" && (
+                    <div className="space-y-5">
+                        <p>Save these recovery codes somewhere safe, each can be used once if you lose your authenticator.</p>
+                        <div className="grid grid-cols-2 gap-2 p-3 rounded-lg bg-gray-100 font-mono text-sm">
+                            {recoveryCodes.map((rc) => <span key={rc}>{rc}</span>)}
+                        </div>
+                        <button
+                            onClick={() => pendingLogin && finishLogin(pendingLogin)}
+                            className={buttonClass}
+                        >
+                            Continue
+                        </button>
                     </div>
-
-                    {error && <p className="text-red-500">{error}</p>}
-
-
-
-                    <button
-                        onClick={handleSubmit}
-                        disabled={loading}
-                        className="w-full px-4 py-2 text-white font-medium bg-primary-700-300  rounded-lg duration-150 hover:opacity-80"
-                    >
-                        {loading ? "Loading..." : "Login"}
-                    </button>
-                </form>
+                )}
 
                 <div className="flex flex-col items-center gap-2">
                     <p className="">Need account ? <a href="/zz/pages/auth/signup/open" className="font-medium text-primary-contrast-200-800">Sign up</a></p>
@@ -0,0 +1,146 @@
+"use client";
+import { useGApp } from "@/hooks";
+import { decideOIDCAuthorize, getOIDCAuthorizeInfo, OIDCAuthorizeInfo, OIDCAuthorizeParams } from "@/lib";
+import { useSearchParams } from "next/navigation";
+import { useEffect, useMemo, useState } from "react";
+
+const scopeLabels: Record<string, string> = {
+    openid: "Know who you are",
+    profile: "See your name and username",
+    email: "See your email address",
+};
+
+export default function OIDCAuthorizePage() {
+    return (
+        <div className="flex flex-col items-center justify-center h-screen">
+            <OIDCConsent />
+        </div>
+    );
+}
+
+const OIDCConsent = () => {
+    const gapp = useGApp();
+    const params = useSearchParams();
+    const [info, setInfo] = useState<OIDCAuthorizeInfo | null>(null);
+    const [error, setError] = useState<string | null>(null);
+    const [submitting, setSubmitting] = useState(false);
+
+    const request = useMemo<OIDCAuthorizeParams>(() => ({
+        client_id: params.get("client_id") || "",
+        redirect_uri: params.get("redirect_uri") || "",
+        response_type: params.get("response_type") || "",
+        scope: params.get("scope") || "",
+        state: params.get("state") || undefined,
+        nonce: params.get("nonce") || undefined,
+        code_challenge: params.get("code_challenge") || undefined,
+        code_challenge_method: params.get("code_challenge_method") || undefined,
+    }), [params]);
+
+    const errorMessage = (err: any) => {
+        return err?.response?.data?.message || (err instanceof Error ? err.message : "An unknown error occurred");
+    }
+
+    const decide = async (approve: boolean) => {
+        try {
+            setSubmitting(true);
+            const res = await decideOIDCAuthorize(request, approve);
+            // never navigate to javascript: and other non http urls
+            const target = new URL(res.data.redirect_url);
+            if (target.protocol !== "https:" && target.protocol !== "http:") {
+                throw new Error("Invalid redirect url");
+            }
+            window.location.href = target.toString();
+        } catch (err) {
+            setError(errorMessage(err));
+            setSubmitting(false);
+        }
+    }
+
+    useEffect(() => {
+        if (!gapp.isInitialized) return;
+
+        getOIDCAuthorizeInfo(request)
+            .then((res) => {
+                // nothing new to agree to, go straight back to the app
+                if (res.data.consented) {
+                    decide(true);
+                    return;
+                }
+                setInfo(res.data);
+            })
+            .catch((err) => setError(errorMessage(err)));
+    }, [gapp.isInitialized, request]);
+
+    const toLogin = () => {
+        const loginPageUrl = new URL("/zz/pages/auth/login", window.location.origin);
+        loginPageUrl.searchParams.set("after_login_redirect_back_url", window.location.href);
+        window.location.href = loginPageUrl.toString();
+    }
+
+    const changeAccount = () => {
+        gapp.logOut();
+        toLogin();
+    }
+
+    return (
+        <div className="flex items-center justify-center min-h-[500px] bg-gray-100 p-4">
+            <div className="bg-white rounded-lg shadow-xl p-8 w-full max-w-md flex flex-col gap-4">
+                <div className="flex mb-6 space-x-4 items-center justify-center">
+                    <img src="/zz/pages/logo.png" alt="Potatoverse Logo" className="w-10 h-10" />
+                </div>
+
+                {error && <p className="text-red-600 text-sm">{error}</p>}
+
+                {gapp.loaded && !gapp.isAuthenticated && (<>
+                    <h6 className="h4 text-base">
+                        You are not logged in, Please login first to continue to the app.
+                    </h6>
+                    <button
+                        onClick={toLogin}
+                        className="w-full bg-blue-600 text-white py-2 px-4 rounded-md hover:bg-blue-700 focus:outline-none focus:ring-2 focus:ring-blue-500 focus:ring-offset-2 transition duration-150 ease-in-out"
+                    >
+                        Login
+                    </button>
+                </>)}
+
+                {gapp.isAuthenticated && !info && !error && <div>Loading...</div>}
+
+                {info && (<>
+                    <h6 className="h4 text-base">
+                        <span className="font-medium">{info.client_name}</span> wants to use your account to
+                    </h6>
+
+                    <ul className="list-disc pl-6 text-sm text-gray-700">
+                        {info.scopes.map((scope) => (
+                            <li key={scope}>{scopeLabels[scope] || scope}</li>
+                        ))}
+                    </ul>
+
+                    <div className="space-y-3 mb-6">
+                        <button
+                            onClick={() => decide(true)}
+                            disabled={submitting}
+                            className="w-full bg-blue-600 text-white py-2 px-4 rounded-md hover:bg-blue-700 focus:outline-none focus:ring-2 focus:ring-blue-500 focus:ring-offset-2 transition duration-150 ease-in-out"
+                        >
+                            Allow
+                        </button>
+                        <button
+                            onClick={() => decide(false)}
+                            disabled={submitting}
+                            className="w-full bg-gray-200 text-gray-800 py-2 px-4 rounded-md hover:bg-gray-300 focus:outline-none focus:ring-2 focus:ring-gray-400 focus:ring-offset-2 transition duration-150 ease-in-out"
+                        >
+                            Deny
+                        </button>
+                    </div>
+
+                    <p className="text-center text-sm text-gray-500">
+                        Logged in as <span className="font-medium">{gapp.userInfo?.name}</span>.{" "}
+                        <button onClick={changeAccount} className="text-blue-600 hover:underline">
+                            Change account
+                        </button>
+                    </p>
+                </>)}
+            </div>
+        </div>
+    );
+}
@@ -2,8 +2,8 @@
 
 import React, { useState, useEffect } from "react";
 import Link from "next/link";
-import { Smartphone, ArrowLeft, Monitor, Plus, X, Copy, Check } from "lucide-react";
-import { getSelfDevices, createSelfDevice, UserDevice, CreateDeviceResponse } from "@/lib/api";
+import { Smartphone, ArrowLeft, Monitor, Plus, X, Copy, Check, LogOut } from "lucide-react";
+import { getSelfDevices, createSelfDevice, revokeSelfDevice, logoutAll, UserDevice, CreateDeviceResponse } from "@/lib/api";
 import { useGApp } from "@/hooks";
 
 function formatDate(iso: string) {
@@ -21,7 +21,7 @@ export default function Page() {
 }
 
 function DevicesPage() {
-    const { loaded, isInitialized, isAuthenticated } = useGApp();
+    const { loaded, isInitialized, isAuthenticated, logOut } = useGApp();
     const [devices, setDevices] = useState<UserDevice[]>([]);
     const [loading, setLoading] = useState(true);
     const [error, setError] = useState<string | null>(null);
@@ -86,6 +86,29 @@ function DevicesPage() {
         }
     };
 
+    const revokeDevice = async (device: UserDevice) => {
+        if (!confirm(`Revoke "${device.name || device.dtype}"? It will be signed out right away.`)) return;
+        try {
+            await revokeSelfDevice(device.id);
+            loadDevices();
+        } catch (e) {
+            console.error("Failed to revoke device:", e);
+            setError("Failed to revoke device.");
+        }
+    };
+
+    const signOutEverywhere = async () => {
+        if (!confirm("Sign out of every session and device, including this one?")) return;
+        try {
+            await logoutAll();
+        } catch (e) {
+            console.error("Failed to sign out everywhere:", e);
+            setError("Failed to sign out everywhere.");
+            return;
+        }
+        logOut();
+    };
+
     const copyToken = async () => {
         if (!created?.token) return;
         try {
@@ -133,6 +156,14 @@ function DevicesPage() {
                         </div>
 
                         <div className="flex items-center gap-2">
+                            <button
+                                type="button"
+                                onClick={signOutEverywhere}
+                                className="btn btn-base preset-tonal"
+                            >
+                                <LogOut className="w-4 h-4" />
+                                Sign out everywhere
+                            </button>
                             <button
                                 type="button"
                                 onClick={openAdd}
@@ -181,6 +212,7 @@ function DevicesPage() {
                                         <th className="text-left py-3 px-4 text-sm font-semibold text-gray-700">Last IP</th>
                                         <th className="text-left py-3 px-4 text-sm font-semibold text-gray-700">Last login</th>
                                         <th className="text-left py-3 px-4 text-sm font-semibold text-gray-700">Created</th>
+                                        <th className="py-3 px-4" />
                                     </tr>
                                 </thead>
                                 <tbody className="divide-y divide-gray-100">
@@ -191,6 +223,15 @@ function DevicesPage() {
                                             <td className="py-3 px-4 text-gray-600 text-sm font-mono">{d.last_ip || "—"}</td>
                                             <td className="py-3 px-4 text-gray-600 text-sm">{formatDate(d.last_login)}</td>
                                             <td className="py-3 px-4 text-gray-600 text-sm">{formatDate(d.created_at)}</td>
+                                            <td className="py-3 px-4 text-right">
+                                                <button
+                                                    type="button"
+                                                    onClick={() => revokeDevice(d)}
+                                                    className="text-sm text-red-600 hover:underline"
+                                                >
+                                                    Revoke
+                                                </button>
+                                            </td>
                                         </tr>
                                     ))}
                                 </tbody>
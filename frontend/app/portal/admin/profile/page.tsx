@@ -1,6 +1,6 @@
 "use client";
 import React, { useState, useEffect } from 'react';
-import { User, Mail, Edit, Save, X, Smartphone } from 'lucide-react';
+import { User, Mail, Edit, Save, X, Smartphone, ShieldCheck } from 'lucide-react';
 import { getSelfInfo, updateSelfBio, User as UserType } from '../../../../lib/api';
 import { useGApp } from '../../../../hooks/contexts/GAppStateContext';
 import { useRouter } from 'next/navigation';
@@ -149,6 +149,14 @@ const UserProfile = () => {
                                 Devices
                             </button>
 
+                            <button
+                                onClick={() => router.push('/portal/admin/profile/security')}
+                                className="btn btn-base preset-filled bg-secondary-600 text-white"
+                            >
+                                <ShieldCheck className="w-4 h-4" />
+                                Security
+                            </button>
+
 
                             </>
                             
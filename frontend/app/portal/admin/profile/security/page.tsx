@@ -0,0 +1,296 @@
+"use client";
+
+import React, { useState, useEffect } from "react";
+import { ShieldCheck, KeyRound } from "lucide-react";
+import {
+    getSelfTwoFactor,
+    beginSelfTwoFactorEnroll,
+    confirmSelfTwoFactorEnroll,
+    disableSelfTwoFactor,
+    regenerateRecoveryCodes,
+    getSelfIdentities,
+    unlinkSelfIdentity,
+    TwoFactorSetup,
+    TwoFactorStatus,
+    UserIdentity,
+} from "@/lib/api";
+import { useGApp } from "@/hooks";
+
+function errorMessage(e: unknown, fallback: string) {
+    return e && typeof e === "object" && "response" in e && e.response && typeof (e.response as { data?: { message?: string } }).data?.message === "string"
+        ? (e.response as { data: { message: string } }).data.message
+        : fallback;
+}
+
+export default function Page() {
+    return <SecurityPage />;
+}
+
+function SecurityPage() {
+    const { loaded, isInitialized, isAuthenticated } = useGApp();
+    const [status, setStatus] = useState<TwoFactorStatus | null>(null);
+    const [loading, setLoading] = useState(true);
+    const [error, setError] = useState<string | null>(null);
+    const [setup, setSetup] = useState<TwoFactorSetup | null>(null);
+    const [code, setCode] = useState("");
+    const [password, setPassword] = useState("");
+    const [recoveryCodes, setRecoveryCodes] = useState<string[]>([]);
+    const [submitting, setSubmitting] = useState(false);
+    const [identities, setIdentities] = useState<UserIdentity[]>([]);
+
+    useEffect(() => {
+        if (loaded && isInitialized && isAuthenticated) {
+            loadStatus();
+            loadIdentities();
+        }
+    }, [loaded, isInitialized, isAuthenticated]);
+
+    const loadIdentities = async () => {
+        try {
+            const res = await getSelfIdentities();
+            setIdentities(Array.isArray(res.data) ? res.data : []);
+        } catch (e) {
+            console.error("Failed to load linked accounts:", e);
+        }
+    };
+
+    const unlink = (identity: UserIdentity) => {
+        if (!confirm(`Unlink your ${identity.provider} account${identity.email ? ` (${identity.email})` : ""}?`)) return;
+        run(async () => {
+            await unlinkSelfIdentity(identity.id);
+            loadIdentities();
+        }, "Failed to unlink account.");
+    };
+
+    const loadStatus = async () => {
+        try {
+            setLoading(true);
+            setError(null);
+            const res = await getSelfTwoFactor();
+            setStatus(res.data);
+        } catch (e) {
+            console.error("Failed to load two factor status:", e);
+            setError("Failed to load two factor status.");
+        } finally {
+            setLoading(false);
+        }
+    };
+
+    const run = async (fn: () => Promise<void>, fallback: string) => {
+        try {
+            setSubmitting(true);
+            setError(null);
+            await fn();
+        } catch (e) {
+            console.error(fallback, e);
+            setError(errorMessage(e, fallback));
+        } finally {
+            setSubmitting(false);
+        }
+    };
+
+    const startEnroll = () => run(async () => {
+        const res = await beginSelfTwoFactorEnroll();
+        setSetup(res.data);
+        setCode("");
+        setRecoveryCodes([]);
+    }, "Failed to start two factor setup.");
+
+    const confirmEnroll = () => run(async () => {
+        const res = await confirmSelfTwoFactorEnroll(code.trim());
+        setRecoveryCodes(res.data.recovery_codes || []);
+        setSetup(null);
+        setCode("");
+        loadStatus();
+    }, "Failed to enable two factor authentication.");
+
+    const disable = () => run(async () => {
+        await disableSelfTwoFactor(password, code.trim());
+        setPassword("");
+        setCode("");
+        setRecoveryCodes([]);
+        loadStatus();
+    }, "Failed to disable two factor authentication.");
+
+    const newRecoveryCodes = () => run(async () => {
+        const res = await regenerateRecoveryCodes(code.trim());
+        setRecoveryCodes(res.data.recovery_codes || []);
+        setCode("");
+        loadStatus();
+    }, "Failed to generate recovery codes.");
+
+    if (!loaded || !isInitialized) {
+        return (
+            <div className="min-h-screen bg-gray-50 flex items-center justify-center">
+                <div className="text-center">
+                    <div className="animate-spin rounded-full h-12 w-12 border-b-2 border-blue-600 mx-auto mb-4" />
+                    <p className="text-gray-600">Initializing...</p>
+                </div>
+            </div>
+        );
+    }
+
+    if (!isAuthenticated) {
+        return (
+            <div className="min-h-screen bg-gray-50 flex items-center justify-center">
+                <div className="text-center">
+                    <p className="text-gray-600">Please log in to manage security settings.</p>
+                </div>
+            </div>
+        );
+    }
+
+    const inputClass = "w-full px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500 focus:border-blue-500";
+
+    return (
+        <div className="min-h-screen bg-gray-50">
+            <header className="bg-white border-b border-gray-200 px-6 py-4">
+                <div className="max-w-4xl mx-auto flex items-center gap-2">
+                    <ShieldCheck className="w-6 h-6 text-blue-600" />
+                    <div>
+                        <h1 className="text-xl font-bold">Security</h1>
+                        <p className="text-sm text-gray-600">Two factor authentication and linked accounts</p>
+                    </div>
+                </div>
+            </header>
+
+            <div className="max-w-4xl mx-auto px-6 py-8 space-y-6">
+                {loading ? (
+                    <div className="bg-white rounded-xl border border-gray-200 p-12 text-center">
+                        <div className="animate-spin rounded-full h-10 w-10 border-b-2 border-blue-600 mx-auto mb-4" />
+                        <p className="text-gray-600">Loading...</p>
+                    </div>
+                ) : status && (
+                    <div className="bg-white rounded-xl border border-gray-200 p-6 space-y-4">
+                        <div className="flex items-center justify-between">
+                            <div>
+                                <p className="font-medium text-gray-900">
+                                    Two factor authentication is {status.enabled ? "on" : "off"}
+                                </p>
+                                {status.required && (
+                                    <p className="text-sm text-gray-600">Your group requires two factor authentication.</p>
+                                )}
+                                {status.enabled && (
+                                    <p className="text-sm text-gray-600">{status.recovery_codes_left} recovery codes left</p>
+                                )}
+                            </div>
+                            {!status.enabled && !setup && (
+                                <button
+                                    type="button"
+                                    onClick={startEnroll}
+                                    disabled={submitting}
+                                    className="btn btn-base preset-filled bg-primary-600 text-white"
+                                >
+                                    <KeyRound className="w-4 h-4" />
+                                    Set up
+                                </button>
+                            )}
+                        </div>
+
+                        {error && <p className="text-red-600 text-sm">{error}</p>}
+
+                        {setup && (
+                            <div className="space-y-3">
+                                <p className="text-sm text-gray-600">Add this secret to your authenticator app, then enter the code it shows.</p>
+                                <div className="p-3 rounded-lg bg-gray-100 font-mono break-all text-sm">{setup.secret}</div>
+                                <a href={setup.otpauth_url} className="text-sm text-blue-600 break-all">{setup.otpauth_url}</a>
+                                <input
+                                    type="text"
+                                    placeholder="Authentication code"
+                                    autoComplete="one-time-code"
+                                    className={inputClass}
+                                    value={code}
+                                    onChange={(e) => setCode(e.target.value)}
+                                />
+                                <button
+                                    type="button"
+                                    onClick={confirmEnroll}
+                                    disabled={submitting || !code.trim()}
+                                    className="btn btn-base preset-filled bg-primary-600 text-white"
+                                >
+                                    Enable
+                                </button>
+                            </div>
+                        )}
+
+                        {status.enabled && (
+                            <div className="space-y-3">
+                                <input
+                                    type="text"
+                                    placeholder="Authentication code"
+                                    autoComplete="one-time-code"
+                                    className={inputClass}
+                                    value={code}
+                                    onChange={(e) => setCode(e.target.value)}
+                                />
+                                <div className="flex items-center gap-2">
+                                    <button
+                                        type="button"
+                                        onClick={newRecoveryCodes}
+                                        disabled={submitting || !code.trim()}
+                                        className="btn btn-base preset-tonal"
+                                    >
+                                        New recovery codes
+                                    </button>
+                                </div>
+
+                                {!status.required && (
+                                    <div className="flex items-center gap-2">
+                                        <input
+                                            type="password"
+                                            placeholder="Password"
+                                            className={inputClass}
+                                            value={password}
+                                            onChange={(e) => setPassword(e.target.value)}
+                                        />
+                                        <button
+                                            type="button"
+                                            onClick={disable}
+                                            disabled={submitting || !code.trim() || !password}
+                                            className="btn btn-base preset-filled bg-red-600 text-white"
+                                        >
+                                            Disable
+                                        </button>
+                                    </div>
+                                )}
+                            </div>
+                        )}
+
+                        {recoveryCodes.length > 0 && (
+                            <div className="space-y-2">
+                                <p className="text-sm text-gray-600">Save these recovery codes somewhere safe, each can be used once. They will not be shown again.</p>
+                                <div className="grid grid-cols-2 gap-2 p-3 rounded-lg bg-gray-100 font-mono text-sm">
+                                    {recoveryCodes.map((rc) => <span key={rc}>{rc}</span>)}
+                                </div>
+                            </div>
+                        )}
+                    </div>
+                )}
+
+                {identities.length > 0 && (
+                    <div className="bg-white rounded-xl border border-gray-200 p-6 space-y-4">
+                        <p className="font-medium text-gray-900">Linked accounts</p>
+                        <ul className="divide-y divide-gray-200">
+                            {identities.map((identity) => (
+                                <li key={identity.id} className="py-3 flex items-center justify-between">
+                                    <div>
+                                        <p className="text-gray-900">{identity.provider}</p>
+                                        <p className="text-sm text-gray-600">{identity.email || identity.subject}</p>
+                                    </div>
+                                    <button
+                                        type="button"
+                                        onClick={() => unlink(identity)}
+                                        disabled={submitting}
+                                        className="btn btn-base preset-tonal"
+                                    >
+                                        Unlink
+                                    </button>
+                                </li>
+                            ))}
+                        </ul>
+                    </div>
+                )}
+            </div>
+        </div>
+    );
+}
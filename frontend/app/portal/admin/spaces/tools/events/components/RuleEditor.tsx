@@ -26,6 +26,19 @@ const operators = [
     { value: 'not_contains', label: 'Not Contains' },
     { value: 'before', label: 'Before' },
     { value: 'after', label: 'After' },
+    { value: 'within_last', label: 'Within Last (1h, 7d)' },
+    { value: 'not_within_last', label: 'Not Within Last' },
+    { value: 'within_next', label: 'Within Next' },
+    { value: 'matches', label: 'Matches Regex' },
+    { value: 'not_matches', label: 'Not Matches Regex' },
+    { value: 'in', label: 'In (a,b,c)' },
+    { value: 'not_in', label: 'Not In' },
+    { value: 'contains_any', label: 'Contains Any' },
+    { value: 'contains_all', label: 'Contains All' },
+    { value: 'between', label: 'Between (min,max)' },
+    { value: 'not_between', label: 'Not Between' },
+    { value: 'exists', label: 'Exists' },
+    { value: 'not_exists', label: 'Not Exists' },
     { value: 'group', label: 'Logical Group' }, // Special operator for logical groups
 ];
 
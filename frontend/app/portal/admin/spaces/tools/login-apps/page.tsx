@@ -0,0 +1,237 @@
+"use client";
+import React, { useEffect, useState } from 'react';
+import { LogIn, Trash2, RefreshCw, Copy } from 'lucide-react';
+import { useSearchParams } from 'next/navigation';
+import WithAdminBodyLayout from '@/contain/Layouts/WithAdminBodyLayout';
+import { useGApp } from '@/hooks';
+import {
+    getInstalledPackageInfo,
+    InstalledPackageInfo,
+    listOIDCClients,
+    createOIDCClient,
+    deleteOIDCClient,
+    rotateOIDCClientSecret,
+    OIDCClient,
+} from '@/lib';
+import useSimpleDataLoader from '@/hooks/useSimpleDataLoader';
+
+export default function Page() {
+    const searchParams = useSearchParams();
+    const installId = searchParams.get('install_id');
+    const spaceId = searchParams.get('space_id');
+
+    if (!installId) {
+        return <div>Install ID not provided</div>;
+    }
+
+    return <LoginAppsPage
+        installId={parseInt(installId)}
+        spaceId={spaceId ? parseInt(spaceId) : undefined}
+    />;
+}
+
+const errorMessage = (err: any) => {
+    return err?.response?.data?.message || (err instanceof Error ? err.message : "An unknown error occurred");
+}
+
+const LoginAppsPage = ({ installId, spaceId }: { installId: number; spaceId?: number }) => {
+    const gapp = useGApp();
+    const [selectedSpace, setSelectedSpace] = useState<number | undefined>(spaceId);
+    const [name, setName] = useState('');
+    const [redirectURIs, setRedirectURIs] = useState('');
+    const [isPublic, setIsPublic] = useState(false);
+    const [secret, setSecret] = useState<{ clientId: string; secret: string } | null>(null);
+    const [error, setError] = useState<string | null>(null);
+    const [submitting, setSubmitting] = useState(false);
+
+    const pkgLoader = useSimpleDataLoader<InstalledPackageInfo>({
+        loader: () => getInstalledPackageInfo(installId),
+        ready: gapp.isInitialized,
+    });
+
+    const spaces = pkgLoader.data?.spaces || [];
+
+    useEffect(() => {
+        if (selectedSpace === undefined && spaces.length > 0) {
+            setSelectedSpace(spaces[0].id);
+        }
+    }, [spaces, selectedSpace]);
+
+    const loader = useSimpleDataLoader<OIDCClient[]>({
+        loader: () => listOIDCClients(selectedSpace!),
+        ready: gapp.isInitialized && selectedSpace !== undefined,
+        dependencies: [selectedSpace],
+    });
+
+    // the configured issuer can differ from this origin (tls proxies)
+    const [issuer, setIssuer] = useState('/zz/oidc');
+    useEffect(() => {
+        fetch('/zz/oidc/.well-known/openid-configuration')
+            .then((res) => res.json())
+            .then((data) => data.issuer && setIssuer(data.issuer))
+            .catch(() => { });
+    }, []);
+
+    const run = async (fn: () => Promise<void>) => {
+        try {
+            setSubmitting(true);
+            setError(null);
+            await fn();
+        } catch (err) {
+            setError(errorMessage(err));
+        } finally {
+            setSubmitting(false);
+        }
+    }
+
+    const handleCreate = () => run(async () => {
+        const res = await createOIDCClient({
+            space_id: selectedSpace!,
+            name: name.trim(),
+            redirect_uris: redirectURIs.split('\n').map((u) => u.trim()).filter(Boolean),
+            public: isPublic,
+        });
+        if (res.data.client_secret) {
+            setSecret({ clientId: res.data.client_id, secret: res.data.client_secret });
+        }
+        setName('');
+        setRedirectURIs('');
+        setIsPublic(false);
+        loader.reload();
+    });
+
+    const handleDelete = (client: OIDCClient) => {
+        if (!confirm(`Delete ${client.name}? Apps using it can no longer log users in.`)) return;
+        run(async () => {
+            await deleteOIDCClient(client.id);
+            loader.reload();
+        });
+    }
+
+    const handleRotate = (client: OIDCClient) => {
+        if (!confirm(`Replace the secret of ${client.name}? The current one stops working right away.`)) return;
+        run(async () => {
+            const res = await rotateOIDCClientSecret(client.id);
+            setSecret({ clientId: client.client_id, secret: res.data.client_secret || '' });
+            loader.reload();
+        });
+    }
+
+    const inputClass = "w-full px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500 focus:border-blue-500";
+
+    return (
+        <WithAdminBodyLayout
+            Icon={LogIn}
+            name="Login Apps"
+            description="Apps that log users in with this space through Login with PotatoVerse (OpenID Connect)"
+            variant="none"
+        >
+            <div className="max-w-4xl w-full mx-auto px-6 py-6 space-y-6">
+                <div className="bg-white rounded-xl border border-gray-200 p-4 text-sm text-gray-600 space-y-1">
+                    <p>Issuer <span className="font-mono">{issuer}</span></p>
+                    <p>Discovery <span className="font-mono">{issuer}/.well-known/openid-configuration</span></p>
+                </div>
+
+                {spaces.length > 1 && (
+                    <select
+                        className={inputClass}
+                        value={selectedSpace}
+                        onChange={(e) => setSelectedSpace(parseInt(e.target.value))}
+                    >
+                        {spaces.map((space) => (
+                            <option key={space.id} value={space.id}>{space.namespace_key}</option>
+                        ))}
+                    </select>
+                )}
+
+                {(error || loader.error) && <p className="text-red-600 text-sm">{error || loader.error}</p>}
+
+                {secret && (
+                    <div className="bg-yellow-50 rounded-xl border border-yellow-200 p-4 space-y-2">
+                        <p className="text-sm text-gray-700">Copy the secret of <span className="font-mono">{secret.clientId}</span> now, it will not be shown again.</p>
+                        <div className="flex items-center gap-2">
+                            <span className="flex-1 p-2 rounded-lg bg-white font-mono text-sm break-all">{secret.secret}</span>
+                            <button
+                                type="button"
+                                onClick={() => navigator.clipboard.writeText(secret.secret)}
+                                className="btn btn-sm preset-tonal"
+                            >
+                                <Copy className="w-4 h-4" />
+                            </button>
+                        </div>
+                    </div>
+                )}
+
+                <div className="bg-white rounded-xl border border-gray-200 p-6 space-y-3">
+                    <p className="font-medium text-gray-900">Register an app</p>
+                    <input
+                        type="text"
+                        placeholder="Name shown on the consent screen"
+                        className={inputClass}
+                        value={name}
+                        onChange={(e) => setName(e.target.value)}
+                    />
+                    <textarea
+                        placeholder="Redirect URIs, one per line"
+                        className={inputClass}
+                        rows={3}
+                        value={redirectURIs}
+                        onChange={(e) => setRedirectURIs(e.target.value)}
+                    />
+                    <label className="flex items-center gap-2 text-sm text-gray-700">
+                        <input type="checkbox" checked={isPublic} onChange={(e) => setIsPublic(e.target.checked)} />
+                        Public app (browser or mobile, no secret, must use PKCE)
+                    </label>
+                    <button
+                        type="button"
+                        onClick={handleCreate}
+                        disabled={submitting || selectedSpace === undefined || !redirectURIs.trim()}
+                        className="btn btn-base preset-filled bg-primary-600 text-white"
+                    >
+                        Register
+                    </button>
+                </div>
+
+                <div className="bg-white rounded-xl border border-gray-200 p-6">
+                    {loader.loading ? (
+                        <p className="text-gray-600">Loading...</p>
+                    ) : (loader.data || []).length === 0 ? (
+                        <p className="text-gray-600">No apps registered for this space.</p>
+                    ) : (
+                        <ul className="divide-y divide-gray-200">
+                            {(loader.data || []).map((client) => (
+                                <li key={client.id} className="py-3 flex items-center justify-between gap-4">
+                                    <div className="min-w-0">
+                                        <p className="text-gray-900">{client.name}</p>
+                                        <p className="text-sm text-gray-600 font-mono break-all">{client.client_id}</p>
+                                        <p className="text-xs text-gray-500 break-all">{JSON.parse(client.redirect_uris || '[]').join(', ')}</p>
+                                    </div>
+                                    <div className="flex items-center gap-2">
+                                        <button
+                                            type="button"
+                                            onClick={() => handleRotate(client)}
+                                            disabled={submitting}
+                                            className="btn btn-sm preset-tonal"
+                                            title="New secret"
+                                        >
+                                            <RefreshCw className="w-4 h-4" />
+                                        </button>
+                                        <button
+                                            type="button"
+                                            onClick={() => handleDelete(client)}
+                                            disabled={submitting}
+                                            className="btn btn-sm preset-tonal text-red-600"
+                                            title="Delete"
+                                        >
+                                            <Trash2 className="w-4 h-4" />
+                                        </button>
+                                    </div>
+                                </li>
+                            ))}
+                        </ul>
+                    )}
+                </div>
+            </div>
+        </WithAdminBodyLayout>
+    );
+}
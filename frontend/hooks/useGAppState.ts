@@ -1,4 +1,4 @@
-import { getLoginData, initHttpClient, removeLoginData, saveLoginData } from "@/lib";
+import { getLoginData, initHttpClient, logout, removeLoginData, saveLoginData } from "@/lib";
 import { useEffect, useState } from "react";
 import { useGModal, ModalHandle } from "./modal/useGModal";
 
@@ -41,13 +41,15 @@ export const useGAppState = () => {
     }, [loaded, isAuthenticated]);
 
     const logOut = () => {
+        // revoke the session server side, the local data goes either way
+        logout().catch(() => { });
         removeLoginData();
         setUserInfo(null);
         setIsAuthenticated(false);
     }
 
-    const logIn = (token: string, userInfo: UserInfo) => {
-        saveLoginData(token, userInfo);
+    const logIn = (token: string, userInfo: UserInfo, refreshToken?: string) => {
+        saveLoginData(token, userInfo, refreshToken);
         checkToken();
     }
 
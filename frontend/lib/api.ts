@@ -1,5 +1,5 @@
 import axios, { AxiosInstance } from "axios";
-import { getLoginData } from "./utils";
+import { getLoginData, saveLoginData } from "./utils";
 import { staticGradients } from "@/app/utils";
 
 
@@ -28,17 +28,159 @@ export const initHttpClient = () => {
         headers,
     });
 
+    // access tokens are short lived, on 401 trade the refresh token for a
+    // new pair once and retry
+    iaxios.interceptors.response.use(undefined, async (error) => {
+        const config = error.config;
+        if (error.response?.status !== 401 || !config || config._retried || config.url?.startsWith("/core/auth/")) {
+            return Promise.reject(error);
+        }
+        config._retried = true;
+
+        if (!refreshing) {
+            refreshing = refreshAccessToken().finally(() => {
+                refreshing = null;
+            });
+        }
+
+        const token = await refreshing;
+        if (!token) {
+            return Promise.reject(error);
+        }
+
+        iaxios.defaults.headers["Authorization"] = `TokenV1 ${token}`;
+        config.headers["Authorization"] = `TokenV1 ${token}`;
+        return iaxios(config);
+    });
+
+}
+
+let refreshing: Promise<string | null> | null = null;
+
+const refreshAccessToken = async (): Promise<string | null> => {
+    const data = getLoginData();
+    if (!data?.refreshToken) return null;
+
+    try {
+        const res = await axios.post<LoginResponse>("/zz/api/core/auth/refresh", { refresh_token: data.refreshToken });
+        saveLoginData(res.data.access_token, data.userInfo, res.data.refresh_token);
+        return res.data.access_token;
+    } catch {
+        // another tab may have rotated it first
+        const latest = getLoginData();
+        if (latest?.refreshToken && latest.refreshToken !== data.refreshToken) {
+            return latest.accessToken;
+        }
+        return null;
+    }
+}
 
+export interface LoginResponse {
+    access_token: string;
+    refresh_token?: string;
+    expires_in?: number;
+    user_info: User;
+    challenge_token?: string;
+    two_factor_required?: boolean;
+    two_factor_setup_required?: boolean;
+    recovery_codes?: string[];
+}
+
+export interface TwoFactorSetup {
+    secret: string;
+    otpauth_url: string;
+}
+
+export interface TwoFactorStatus {
+    enabled: boolean;
+    required: boolean;
+    recovery_codes_left: number;
 }
 
 
 export const login = async (username: string, password: string) => {
-    return iaxios.post<{ access_token: string, user_info: User }>("/core/auth/login", {
+    return iaxios.post<LoginResponse>("/core/auth/login", {
         username,
         password,
     });
 }
 
+export const verifyTwoFactor = async (challengeToken: string, code: string, recoveryCode?: string) => {
+    return iaxios.post<LoginResponse>("/core/auth/2fa/verify", {
+        challenge_token: challengeToken,
+        code,
+        recovery_code: recoveryCode,
+    });
+}
+
+export const enrollTwoFactorChallenge = async (challengeToken: string) => {
+    return iaxios.post<TwoFactorSetup>("/core/auth/2fa/enroll", { challenge_token: challengeToken });
+}
+
+export const confirmTwoFactorChallenge = async (challengeToken: string, code: string) => {
+    return iaxios.post<LoginResponse>("/core/auth/2fa/enroll/confirm", {
+        challenge_token: challengeToken,
+        code,
+    });
+}
+
+export interface SSOProvider {
+    name: string;
+    display_name: string;
+}
+
+export const listSSOProviders = async () => {
+    return iaxios.get<SSOProvider[]>("/core/auth/oidc/providers");
+}
+
+export const exchangeSSOChallenge = async (challengeToken: string) => {
+    return iaxios.post<LoginResponse>("/core/auth/oidc/exchange", { challenge_token: challengeToken });
+}
+
+/** Browser url that starts an sso login, the server redirects to the provider. */
+export const ssoStartUrl = (provider: string, redirect?: string) => {
+    const q = redirect ? `?redirect=${encodeURIComponent(redirect)}` : "";
+    return `/zz/api/core/auth/oidc/${encodeURIComponent(provider)}/start${q}`;
+}
+
+export interface UserIdentity {
+    id: number;
+    user_id: number;
+    provider: string;
+    subject: string;
+    email: string;
+    last_login?: string;
+    created_at?: string;
+}
+
+export const getSelfIdentities = async () => {
+    return iaxios.get<UserIdentity[]>("/core/self/identities");
+}
+
+export const unlinkSelfIdentity = async (id: number) => {
+    return iaxios.delete(`/core/self/identities/${id}`);
+}
+
+export const logout = async () => {
+    return iaxios.post("/core/auth/logout");
+}
+
+export const logoutAll = async () => {
+    return iaxios.post("/core/self/logout-all");
+}
+
+export const revokeUserSessions = async (userId: number) => {
+    return iaxios.post(`/core/user/${userId}/logout-all`);
+}
+
+export const resetUserTwoFactor = async (userId: number) => {
+    return iaxios.post(`/core/user/${userId}/2fa/reset`);
+}
+
+export const setUserGroupRequire2FA = async (name: string, required: boolean) => {
+    return iaxios.put(`/core/user/groups/${name}/require-2fa`, { required });
+}
+
 export interface User {
     id: number;
     name: string;
@@ -223,9 +365,33 @@ export const createSelfDevice = async (name: string) => {
     return iaxios.post<CreateDeviceResponse>("/core/self/devices", { name });
 }
 
+export const revokeSelfDevice = async (id: number) => {
+    return iaxios.delete(`/core/self/devices/${id}`);
+}
+
+export const getSelfTwoFactor = async () => {
+    return iaxios.get<TwoFactorStatus>("/core/self/2fa");
+}
+
+export const beginSelfTwoFactorEnroll = async () => {
+    return iaxios.post<TwoFactorSetup>("/core/self/2fa/enroll");
+}
+
+export const confirmSelfTwoFactorEnroll = async (code: string) => {
+    return iaxios.post<{ recovery_codes: string[] }>("/core/self/2fa/confirm", { code });
+}
+
+export const disableSelfTwoFactor = async (password: string, code: string) => {
+    return iaxios.post("/core/self/2fa/disable", { password, code });
+}
+
+export const regenerateRecoveryCodes = async (code: string) => {
+    return iaxios.post<{ recovery_codes: string[] }>("/core/self/2fa/recovery-codes", { code });
+}
+
 /** Exchange a device token for an access token (for API/CLI). */
 export const loginWithDeviceToken = async (deviceToken: string) => {
-    return iaxios.post<{ access_token: string; user_info: User }>("/core/auth/device-token", { device_token: deviceToken });
+    return iaxios.post<LoginResponse>("/core/auth/device-token", { device_token: deviceToken });
 }
 
 export interface InstallPackageResult {
@@ -244,23 +410,29 @@ export interface UpgradePackageResult {
 }
 
 
-export const installPackage = async (url: string) => {
-    return iaxios.post<InstallPackageResult>(`/core/package/install`, { url });
+/** allowUnsigned lets an admin install packages that fail signature verification. */
+export const installPackage = async (url: string, allowUnsigned?: boolean) => {
+    return iaxios.post<InstallPackageResult>(`/core/package/install`, { url, allow_unsigned: allowUnsigned });
 }
 
-export const installPackageZip = async (zip: ArrayBuffer) => {
+/** signature is the content of the zip's detached .sig file. */
+export const installPackageZip = async (zip: ArrayBuffer, signature?: string, allowUnsigned?: boolean) => {
     return iaxios.post<InstallPackageResult>(`/core/package/install/zip`, zip, {
         headers: {
             "Content-Type": "application/zip",
+            ...(signature ? { "X-Package-Signature": btoa(signature) } : {}),
         },
+        params: allowUnsigned ? { allow_unsigned: "true" } : undefined,
     });
 }
 
-export const upgradePackageZipDirectly = async (packageId: number, zip: ArrayBuffer) => {
+export const upgradePackageZipDirectly = async (packageId: number, zip: ArrayBuffer, signature?: string, allowUnsigned?: boolean) => {
     return iaxios.post<UpgradePackageResult>(`/core/package/${packageId}/upgrade/zip`, zip, {
         headers: {
             "Content-Type": "application/zip",
+            ...(signature ? { "X-Package-Signature": btoa(signature) } : {}),
         },
+        params: allowUnsigned ? { allow_unsigned: "true" } : undefined,
     });
 }
 
@@ -279,6 +451,7 @@ export interface UpgradePackageFromRepoRequest {
     repo_slug: string;
     name: string;
     version: string;
+    allow_unsigned?: boolean;
 }
 
 /** Upgrade package to a specific version from repo. Returns UpgradePackageResult (update_page when set shows Configure). */
@@ -286,13 +459,94 @@ export const upgradePackageFromRepo = async (packageId: number, req: UpgradePack
     return iaxios.post<UpgradePackageResult>(`/core/package/${packageId}/upgrade/repo`, req);
 }
 
-export const installPackageEmbed = async (name: string, repoSlug?: string) => {
+export interface RollbackPackageRequest {
+    version_id: number;
+    /** put back the data snapshot taken while version_id was active */
+    restore_data?: boolean;
+    /** run xMigrator *.down.sql files of the current version */
+    down_migrations?: boolean;
+}
+
+export interface RollbackPackageResult {
+    package_version_id: number;
+    version: string;
+    restored_snapshot_id?: number;
+    backup_snapshot_id: number;
+    reverted_migrations?: string[];
+}
+
+export const rollbackPackage = async (packageId: number, req: RollbackPackageRequest) => {
+    return iaxios.post<RollbackPackageResult>(`/core/package/${packageId}/rollback`, req);
+}
+
+/** Package data copied before an upgrade or rollback. */
+export interface PackageSnapshot {
+    id: number;
+    install_id: number;
+    version_id: number;
+    reason: string;
+    tables: string;
+    created_at: string;
+}
+
+export const listPackageSnapshots = async (packageId: number) => {
+    return iaxios.get<PackageSnapshot[]>(`/core/package/${packageId}/snapshots`);
+}
+
+/** Newer repo version found by the background update checker. */
+export interface PackageUpdate {
+    package_id: number;
+    name: string;
+    slug: string;
+    repo_slug: string;
+    current_version: string;
+    latest_version: string;
+    auto_upgrade: boolean;
+}
+
+export const listPackageUpdates = async () => {
+    return iaxios.get<PackageUpdate[]>(`/core/package/updates`);
+}
+
+/** Runs an update check now, does not auto upgrade. */
+export const checkPackageUpdates = async () => {
+    return iaxios.post<PackageUpdate[]>(`/core/package/updates/check`);
+}
+
+export const setPackageAutoUpgrade = async (packageId: number, enabled: boolean) => {
+    return iaxios.put<void>(`/core/package/${packageId}/auto-upgrade`, { enabled });
+}
+
+export const installPackageEmbed = async (name: string, repoSlug?: string, allowUnsigned?: boolean) => {
     return iaxios.post<InstallPackageResult>(`/core/package/install/repo`, {
         name,
-        repo_slug: repoSlug
+        repo_slug: repoSlug,
+        allow_unsigned: allowUnsigned,
     });
 }
 
+/** Publisher key trusted for package signatures, key_id is alg:hex-pubkey. */
+export interface TrustedKey {
+    id: number;
+    key_id: string;
+    name: string;
+    added_by: number;
+    added_at: string;
+}
+
+export const listTrustedKeys = async () => {
+    return iaxios.get<TrustedKey[]>(`/core/repo/trust`);
+}
+
+/** key accepts ed25519:<hex>, nostr:<hex> or an npub. */
+export const addTrustedKey = async (key: string, name: string) => {
+    return iaxios.post<TrustedKey>(`/core/repo/trust`, { key, name });
+}
+
+export const removeTrustedKey = async (id: number) => {
+    return iaxios.delete<void>(`/core/repo/trust/${id}`);
+}
+
 export const deletePackage = async (id: number) => {
     return iaxios.delete<void>(`/core/package/${id}`);
 }
@@ -379,6 +633,9 @@ export interface InstalledPackageInfo {
         name: string;
         install_repo: string;
         update_url: string;
+        auto_upgrade: boolean;
+        available_version: string;
+        update_checked_at?: string;
         storage_type: string;
         active_install_id: number;
         installed_by: number;
@@ -497,6 +754,66 @@ export const authorizeSpace = async (space_key: string, space_id: number) => {
     return iaxios.post<{ token: string }>(`/core/space/authorize/${space_key}`, { space_id });
 }
 
+// OIDC provider API (login with potatoverse)
+export interface OIDCAuthorizeParams {
+    client_id: string;
+    redirect_uri: string;
+    response_type: string;
+    scope: string;
+    state?: string;
+    nonce?: string;
+    code_challenge?: string;
+    code_challenge_method?: string;
+}
+
+export interface OIDCAuthorizeInfo {
+    client_name: string;
+    space_id: number;
+    scopes: string[];
+    consented: boolean;
+}
+
+export const getOIDCAuthorizeInfo = async (params: OIDCAuthorizeParams) => {
+    return iaxios.get<OIDCAuthorizeInfo>("/core/oidc/authorize", { params });
+}
+
+export const decideOIDCAuthorize = async (params: OIDCAuthorizeParams, approve: boolean) => {
+    return iaxios.post<{ redirect_url: string }>("/core/oidc/authorize", { ...params, approve });
+}
+
+export interface OIDCClient {
+    id: number;
+    client_id: string;
+    name: string;
+    install_id: number;
+    space_id: number;
+    redirect_uris: string; // json array
+    scopes: string;
+    owned_by: number;
+    created_at?: string;
+    client_secret?: string; // only right after create or rotate
+}
+
+export const listOIDCClients = async (spaceId: number) => {
+    return iaxios.get<OIDCClient[]>("/core/oidc/clients", { params: { space_id: spaceId } });
+}
+
+export const createOIDCClient = async (data: { space_id: number; name: string; redirect_uris: string[]; scopes?: string[]; public?: boolean }) => {
+    return iaxios.post<OIDCClient>("/core/oidc/clients", data);
+}
+
+export const updateOIDCClient = async (id: number, data: { name?: string; redirect_uris?: string[] }) => {
+    return iaxios.put<OIDCClient>(`/core/oidc/clients/${id}`, data);
+}
+
+export const deleteOIDCClient = async (id: number) => {
+    return iaxios.delete(`/core/oidc/clients/${id}`);
+}
+
+export const rotateOIDCClientSecret = async (id: number) => {
+    return iaxios.post<OIDCClient>(`/core/oidc/clients/${id}/rotate-secret`);
+}
+
 // Package Files API
 export interface PackageFile {
     id: number;
@@ -3,8 +3,8 @@
 const KEY = "_potato_login_info_";
 
 
-export const saveLoginData = (accessToken: string, userInfo: any) => {
-     localStorage.setItem(KEY, JSON.stringify({ accessToken, userInfo }));
+export const saveLoginData = (accessToken: string, userInfo: any, refreshToken?: string) => {
+     localStorage.setItem(KEY, JSON.stringify({ accessToken, refreshToken, userInfo }));
 }
 
 export const getLoginData = () => {